@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	apiKeyKind = "APIKey"
+	// APIKeyPrefix starts all API keys, to tell them apart from user tokens in Authorization headers.
+	APIKeyPrefix = "dipkey-"
+	// APIKeyUserIdPrefix starts the user IDs of requests authorized by API keys, which never collide with OAuth user IDs.
+	APIKeyUserIdPrefix = "api-key:"
+	// How long keys must be, prefix included, to be hard to guess.
+	minAPIKeyLength = len(APIKeyPrefix) + 32
+	// How many keys can be configured at once, to stay within the entities of a single datastore put.
+	maxConfiguredAPIKeys = 500
+	// Used for keys configured without RequestsPerMinute.
+	defaultAPIKeyRequestsPerMinute = 60
+	apiKeyRateLimitWindow          = time.Minute
+)
+
+var (
+	apiKeyRoutes = map[string]bool{}
+)
+
+// AllowAPIKeyRoutes lets requests authorized by API keys use the named routes. Requests with API keys to all other routes get 403.
+// Must be called when setting up the router.
+func AllowAPIKeyRoutes(routes ...string) {
+	for _, route := range routes {
+		apiKeyRoutes[route] = true
+	}
+}
+
+// APIKey authorizes read only access to public lists, for dashboards without users.
+type APIKey struct {
+	Name string
+	// Key is only provided when configuring the key. Only its hash is stored.
+	Key               string `datastore:"-" json:",omitempty"`
+	RequestsPerMinute int
+	CreatedAt         time.Time
+}
+
+type APIKeys []APIKey
+
+func (a *APIKey) Validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("Name can't be empty")
+	}
+	if !strings.HasPrefix(a.Key, APIKeyPrefix) || len(a.Key) < minAPIKeyLength {
+		return fmt.Errorf("%q: Key must start with %q and be at least %d characters long", a.Name, APIKeyPrefix, minAPIKeyLength)
+	}
+	if a.RequestsPerMinute < 0 {
+		return fmt.Errorf("%q: RequestsPerMinute can't be negative", a.Name)
+	}
+	return nil
+}
+
+// ValidateAPIKeys validates each key, and makes sure no two keys have the same name or key.
+func ValidateAPIKeys(keys APIKeys) error {
+	if len(keys) > maxConfiguredAPIKeys {
+		return fmt.Errorf("can configure at most %d keys at once", maxConfiguredAPIKeys)
+	}
+	names := map[string]bool{}
+	hashes := map[string]bool{}
+	for i := range keys {
+		if err := keys[i].Validate(); err != nil {
+			return err
+		}
+		if names[keys[i].Name] || hashes[hashAPIKey(keys[i].Key)] {
+			return fmt.Errorf("%q: more than one key with the same name or key", keys[i].Name)
+		}
+		names[keys[i].Name] = true
+		hashes[hashAPIKey(keys[i].Key)] = true
+	}
+	return nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func APIKeyID(ctx context.Context, hash string) *datastore.Key {
+	return datastore.NewKey(ctx, apiKeyKind, hash, 0, nil)
+}
+
+// SetAPIKeys creates or replaces the keys. Like presets, keys can be changed after they are first configured, so only
+// superusers may configure them.
+func SetAPIKeys(ctx context.Context, keys APIKeys) error {
+	ids := make([]*datastore.Key, len(keys))
+	for i := range keys {
+		ids[i] = APIKeyID(ctx, hashAPIKey(keys[i].Key))
+		keys[i].CreatedAt = time.Now()
+	}
+	_, err := datastore.PutMulti(ctx, ids, keys)
+	return err
+}
+
+// APIKeysChange describes what storing the keys would do, for configuration dry runs.
+func APIKeysChange(ctx context.Context, keys APIKeys) (string, error) {
+	created, replaced := 0, 0
+	for i := range keys {
+		if err := datastore.Get(ctx, APIKeyID(ctx, hashAPIKey(keys[i].Key)), &APIKey{}); err == nil {
+			replaced++
+		} else if err == datastore.ErrNoSuchEntity {
+			created++
+		} else {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("would create %d and replace %d keys", created, replaced), nil
+}
+
+// apiKeyRateLimitExceeded counts a request with the key in the current window, and returns how many seconds to wait if
+// the key has made too many requests. The counters live in memcache, so if memcache is unavailable requests are let through.
+func apiKeyRateLimitExceeded(ctx context.Context, hash string, limit int) (int, bool) {
+	now := time.Now()
+	windowStart := now.Truncate(apiKeyRateLimitWindow)
+	key := fmt.Sprintf("apiKeyRateLimit/%s/%d", hash, windowStart.Unix())
+
+	// Add the counter with an expiry first, since Increment creates counters that never expire.
+	if err := memcache.Add(ctx, &memcache.Item{
+		Key:        key,
+		Value:      []byte("0"),
+		Expiration: apiKeyRateLimitWindow * 2,
+	}); err != nil && err != memcache.ErrNotStored {
+		log.Warningf(ctx, "Unable to add API key rate limit counter %q: %v; letting the request through", key, err)
+		return 0, false
+	}
+	count, err := memcache.Increment(ctx, key, 1, 0)
+	if err != nil {
+		log.Warningf(ctx, "Unable to increment API key rate limit counter %q: %v; letting the request through", key, err)
+		return 0, false
+	}
+	if count <= uint64(limit) {
+		return 0, false
+	}
+	retryAfter := windowStart.Add(apiKeyRateLimitWindow).Sub(now)
+	return int((retryAfter + time.Second - 1) / time.Second), true
+}
+
+// authorizeAPIKey makes sure the key exists, is allowed to use the route of the request, and isn't rate limited, and
+// lets the request continue as a user without any games or stats.
+func authorizeAPIKey(ctx context.Context, w ResponseWriter, r Request, key string) error {
+	hash := hashAPIKey(key)
+	apiKey := &APIKey{}
+	if err := datastore.Get(ctx, APIKeyID(ctx, hash), apiKey); err == datastore.ErrNoSuchEntity {
+		return HTTPErr{"unknown API key", http.StatusUnauthorized}
+	} else if err != nil {
+		return err
+	}
+
+	route := mux.CurrentRoute(r.Req())
+	if route == nil || !apiKeyRoutes[route.GetName()] {
+		return HTTPErr{"API keys can only list public data", http.StatusForbidden}
+	}
+
+	limit := apiKey.RequestsPerMinute
+	if limit == 0 {
+		limit = defaultAPIKeyRequestsPerMinute
+	}
+	if seconds, exceeded := apiKeyRateLimitExceeded(ctx, hash, limit); exceeded {
+		w.Header().Set("Retry-After", fmt.Sprint(seconds))
+		return HTTPErr{fmt.Sprintf("rate limited, at most %d requests per minute are allowed", limit), http.StatusTooManyRequests}
+	}
+
+	log.Infof(ctx, "Request by API key %q", apiKey.Name)
+
+	r.Values()["user"] = &User{
+		Id:   APIKeyUserIdPrefix + apiKey.Name,
+		Name: apiKey.Name,
+	}
+	return nil
+}
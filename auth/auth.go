@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -41,6 +42,8 @@ const (
 	ApproveRedirectRoute  = "ApproveRedirect"
 	ListRedirectURLsRoute = "ListRedirectURLs"
 	ReplaceFCMRoute       = "ReplaceFCM"
+	AddFCMTokenRoute      = "AddFCMToken"
+	RemoveFCMTokenRoute   = "RemoveFCMToken"
 	TestUpdateUserRoute   = "TestUpdateUser"
 )
 
@@ -131,6 +134,42 @@ func GetUnsubscribeURL(ctx context.Context, r *mux.Router, host string, userId s
 	return unsubscribeURL, nil
 }
 
+var (
+	unsubscribeAddressPattern = "unsubscribe+%s@diplicity-engine.appspotmail.com"
+	unsubscribeAddressReg     = regexp.MustCompile("^unsubscribe\\+([^@]+)@diplicity-engine.appspotmail.com$")
+)
+
+// GetUnsubscribeAddress returns an address that unsubscribes the user from
+// diplicity mail when mailed, for the mailto part of List-Unsubscribe headers.
+func GetUnsubscribeAddress(ctx context.Context, userId string) (string, error) {
+	unsubToken, err := EncodeString(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(unsubscribeAddressPattern, unsubToken), nil
+}
+
+// UnsubscribeAddressToken returns the unsubscribe token of an address created
+// by GetUnsubscribeAddress, or "" if the address isn't an unsubscribe address.
+func UnsubscribeAddressToken(address string) string {
+	match := unsubscribeAddressReg.FindStringSubmatch(strings.ToLower(address))
+	if len(match) == 0 {
+		return ""
+	}
+	// The token is case sensitive, so cut it out of the original address.
+	return address[len("unsubscribe+") : len("unsubscribe+")+len(match[1])]
+}
+
+// UnsubscribeWithToken disables mail for the user the token was created for.
+func UnsubscribeWithToken(ctx context.Context, unsubToken string) error {
+	userId, err := DecodeString(ctx, unsubToken)
+	if err != nil {
+		return err
+	}
+	_, _, err = disableMail(ctx, userId)
+	return err
+}
+
 type RedirectURLs []RedirectURL
 
 func (u RedirectURLs) Item(r Request, userId string) *Item {
@@ -272,18 +311,17 @@ func getSuperusersKey(ctx context.Context) *datastore.Key {
 	return datastore.NewKey(ctx, superusersKind, prodKey, 0, nil)
 }
 
+// SetSuperusers must be called inside a transaction.
 func SetSuperusers(ctx context.Context, superusers *Superusers) error {
 	log.Infof(ctx, "Setting superusers to %+v", superusers)
-	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
-		currentSuperusers := &Superusers{}
-		if err := datastore.Get(ctx, getSuperusersKey(ctx), currentSuperusers); err == nil {
-			return HTTPErr{"Superusers already configured", http.StatusBadRequest}
-		}
-		if _, err := datastore.Put(ctx, getSuperusersKey(ctx), superusers); err != nil {
-			return err
-		}
-		return nil
-	}, &datastore.TransactionOptions{XG: false})
+	currentSuperusers := &Superusers{}
+	if err := datastore.Get(ctx, getSuperusersKey(ctx), currentSuperusers); err == nil {
+		return HTTPErr{"Superusers already configured", http.StatusBadRequest}
+	}
+	if _, err := datastore.Put(ctx, getSuperusersKey(ctx), superusers); err != nil {
+		return err
+	}
+	return nil
 }
 
 func GetSuperusers(ctx context.Context) (*Superusers, error) {
@@ -357,24 +395,30 @@ type OAuth struct {
 	Secret   string
 }
 
+func (o *OAuth) Validate() error {
+	if o.ClientID == "" || o.Secret == "" {
+		return fmt.Errorf("missing ClientID or Secret")
+	}
+	return nil
+}
+
 func getOAuthKey(ctx context.Context) *datastore.Key {
 	return datastore.NewKey(ctx, oAuthKind, prodKey, 0, nil)
 }
 
+// SetOAuth must be called inside a transaction.
 func SetOAuth(ctx context.Context, oAuth *OAuth) error {
-	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
-		currentOAuth := &OAuth{}
-		if err := datastore.Get(ctx, getOAuthKey(ctx), currentOAuth); err == nil {
-			return HTTPErr{"OAuth already configured", http.StatusBadRequest}
-		}
-		if _, err := datastore.Put(ctx, getOAuthKey(ctx), oAuth); err != nil {
-			return err
-		}
-		return nil
-	}, &datastore.TransactionOptions{XG: false})
+	currentOAuth := &OAuth{}
+	if err := datastore.Get(ctx, getOAuthKey(ctx), currentOAuth); err == nil {
+		return HTTPErr{"OAuth already configured", http.StatusBadRequest}
+	}
+	if _, err := datastore.Put(ctx, getOAuthKey(ctx), oAuth); err != nil {
+		return err
+	}
+	return nil
 }
 
-func getOAuth(ctx context.Context) (*OAuth, error) {
+func GetOAuth(ctx context.Context) (*OAuth, error) {
 	prodOAuthLock.RLock()
 	if prodOAuth != nil {
 		defer prodOAuthLock.RUnlock()
@@ -399,7 +443,7 @@ func getOAuth2Config(ctx context.Context, r *http.Request) (*oauth2.Config, erro
 	redirectURL.Host = r.Host
 	redirectURL.Scheme = DefaultScheme
 
-	oauth, err := getOAuth(ctx)
+	oauth, err := GetOAuth(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -484,6 +528,9 @@ func DecodeString(ctx context.Context, s string) (string, error) {
 }
 
 func DecodeBytes(ctx context.Context, b []byte) ([]byte, error) {
+	if len(b) < 24 {
+		return nil, HTTPErr{"badly encrypted token", http.StatusUnauthorized}
+	}
 	var nonceAry [24]byte
 	copy(nonceAry[:], b)
 	nacl, err := getNaCl(ctx)
@@ -802,7 +849,14 @@ func tokenFilter(w ResponseWriter, r Request) (bool, error) {
 		}
 	}
 
-	if token != "" {
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		if queryToken {
+			return false, HTTPErr{"API keys must be sent in the Authorization header", http.StatusBadRequest}
+		}
+		if err := authorizeAPIKey(ctx, w, r, token); err != nil {
+			return false, err
+		}
+	} else if token != "" {
 		plain, err := DecodeString(ctx, token)
 		if err != nil {
 			return false, err
@@ -934,19 +988,9 @@ func renderMessage(w http.ResponseWriter, title, msg string) error {
 	})
 }
 
-func unsubscribe(w ResponseWriter, r Request) error {
-	ctx := appengine.NewContext(r.Req())
-
-	decodedUserId, err := DecodeString(ctx, r.Req().URL.Query().Get("t"))
-	if err != nil {
-		return err
-	}
-
-	if decodedUserId != r.Vars()["user_id"] {
-		return HTTPErr{"can only unsubscribe yourself", http.StatusForbidden}
-	}
-
-	userID := UserID(ctx, r.Vars()["user_id"])
+// disableMail turns off mail for the user. It does nothing if mail is already turned off.
+func disableMail(ctx context.Context, userId string) (*User, *UserConfig, error) {
+	userID := UserID(ctx, userId)
 
 	userConfigID := UserConfigID(ctx, userID)
 
@@ -963,9 +1007,33 @@ func unsubscribe(w ResponseWriter, r Request) error {
 		_, err := datastore.Put(ctx, userConfigID, userConfig)
 		return err
 	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return nil, nil, err
+	}
+	return user, userConfig, nil
+}
+
+func unsubscribe(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	decodedUserId, err := DecodeString(ctx, r.Req().URL.Query().Get("t"))
+	if err != nil {
 		return err
 	}
 
+	if decodedUserId != r.Vars()["user_id"] {
+		return HTTPErr{"can only unsubscribe yourself", http.StatusForbidden}
+	}
+
+	user, userConfig, err := disableMail(ctx, decodedUserId)
+	if err != nil {
+		return err
+	}
+
+	// One-click unsubscriptions (RFC 8058) are POSTed by mail clients that don't care about the response.
+	if r.Req().Method == "POST" {
+		return nil
+	}
+
 	if redirTemplate := userConfig.MailConfig.UnsubscribeConfig.RedirectTemplate; redirTemplate != "" {
 		redirURL, err := raymond.Render(redirTemplate, map[string]interface{}{
 			"user":       user,
@@ -1094,8 +1162,10 @@ func SetupRouter(r *mux.Router) {
 	// Don't use `Handle` here, because we don't want CORS support for this particular route.
 	router.Path("/Auth/OAuth2Callback").Methods("GET").Name(OAuth2CallbackRoute).HandlerFunc(handleOAuth2Callback)
 	Handle(router, "/Auth/ApproveRedirect", []string{"POST"}, ApproveRedirectRoute, handleApproveRedirect)
-	Handle(router, "/User/{user_id}/Unsubscribe", []string{"GET"}, UnsubscribeRoute, unsubscribe)
+	Handle(router, "/User/{user_id}/Unsubscribe", []string{"GET", "POST"}, UnsubscribeRoute, unsubscribe)
 	Handle(router, "/User/{user_id}/FCMToken/{replace_token}/Replace", []string{"PUT"}, ReplaceFCMRoute, replaceFCM)
+	Handle(router, "/User/{user_id}/FCMToken", []string{"POST"}, AddFCMTokenRoute, addFCMToken)
+	Handle(router, "/User/{user_id}/FCMToken/{token_value}", []string{"DELETE"}, RemoveFCMTokenRoute, removeFCMToken)
 	AddFilter(decorateAPILevel)
 	AddFilter(tokenFilter)
 	AddFilter(logHeaders)
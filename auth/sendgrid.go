@@ -3,6 +3,8 @@ package auth
 import (
 	"fmt"
 	"net/http"
+	netMail "net/mail"
+	"strings"
 	"sync"
 
 	"github.com/sendgrid/rest"
@@ -23,28 +25,55 @@ var (
 )
 
 const (
-	sendGridKind = "SendGrid"
+	sendGridKind       = "SendGrid"
+	defaultFromAddress = "noreply@oort.se"
+	defaultFromName    = "Diplicity"
 )
 
 type SendGrid struct {
-	APIKey string
+	APIKey      string
+	FromName    string
+	FromAddress string
+}
+
+func (s *SendGrid) Validate() error {
+	if s.APIKey == "" {
+		return fmt.Errorf("missing APIKey")
+	}
+	if s.FromAddress != "" {
+		if _, err := netMail.ParseAddress(s.FromAddress); err != nil {
+			return fmt.Errorf("invalid FromAddress %q: %v", s.FromAddress, err)
+		}
+	}
+	return nil
+}
+
+// From returns the sender identity of outgoing mail, with defaults for deployments configured without one.
+func (s *SendGrid) From() (name string, address string) {
+	name, address = s.FromName, s.FromAddress
+	if name == "" {
+		name = defaultFromName
+	}
+	if address == "" {
+		address = defaultFromAddress
+	}
+	return name, address
 }
 
 func getSendGridKey(ctx context.Context) *datastore.Key {
 	return datastore.NewKey(ctx, sendGridKind, prodKey, 0, nil)
 }
 
+// SetSendGrid must be called inside a transaction.
 func SetSendGrid(ctx context.Context, sendGrid *SendGrid) error {
-	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
-		currentSendGrid := &SendGrid{}
-		if err := datastore.Get(ctx, getSendGridKey(ctx), currentSendGrid); err == nil {
-			return HTTPErr{"SendGrid already configured", http.StatusBadRequest}
-		}
-		if _, err := datastore.Put(ctx, getSendGridKey(ctx), sendGrid); err != nil {
-			return err
-		}
-		return nil
-	}, &datastore.TransactionOptions{XG: false})
+	currentSendGrid := &SendGrid{}
+	if err := datastore.Get(ctx, getSendGridKey(ctx), currentSendGrid); err == nil {
+		return HTTPErr{"SendGrid already configured", http.StatusBadRequest}
+	}
+	if _, err := datastore.Put(ctx, getSendGridKey(ctx), sendGrid); err != nil {
+		return err
+	}
+	return nil
 }
 
 func GetSendGrid(ctx context.Context) (*SendGrid, error) {
@@ -65,16 +94,17 @@ func GetSendGrid(ctx context.Context) (*SendGrid, error) {
 }
 
 type EMail struct {
-	FromAddr       string
-	FromName       string
-	ToAddr         string
-	ToName         string
-	Subject        string
-	TextBody       string
-	HTMLBody       string
-	UnsubscribeURL string
-	MessageID      string
-	Reference      string
+	FromAddr           string
+	FromName           string
+	ToAddr             string
+	ToName             string
+	Subject            string
+	TextBody           string
+	HTMLBody           string
+	UnsubscribeURL     string
+	UnsubscribeAddress string
+	MessageID          string
+	Reference          string
 }
 
 func (e *EMail) Send(ctx context.Context) error {
@@ -84,8 +114,10 @@ func (e *EMail) Send(ctx context.Context) error {
 	return e.SendWithoutUnsubscribeHeader(ctx)
 }
 
+// SendWithoutUnsubscribeHeader sends the mail. Mails without FromAddr are sent
+// from the sender identity of the SendGrid configuration.
 func (e *EMail) SendWithoutUnsubscribeHeader(ctx context.Context) error {
-	if e.FromAddr == "" || e.ToAddr == "" || e.Subject == "" || (e.TextBody == "" && e.HTMLBody == "") {
+	if e.ToAddr == "" || e.Subject == "" || (e.TextBody == "" && e.HTMLBody == "") {
 		return fmt.Errorf("invalid EMail %+v", e)
 	}
 
@@ -94,6 +126,10 @@ func (e *EMail) SendWithoutUnsubscribeHeader(ctx context.Context) error {
 		return err
 	}
 
+	if e.FromAddr == "" {
+		e.FromName, e.FromAddr = sendGridConf.From()
+	}
+
 	msg := mail.NewV3Mail()
 	if e.TextBody != "" {
 		msg.AddContent(mail.NewContent(
@@ -112,8 +148,16 @@ func (e *EMail) SendWithoutUnsubscribeHeader(ctx context.Context) error {
 	p.AddTos(mail.NewEmail(e.ToName, e.ToAddr))
 	msg.AddPersonalizations(p)
 	msg.SetFrom(mail.NewEmail(e.FromName, e.FromAddr))
+	unsubscribeTargets := []string{}
+	if e.UnsubscribeAddress != "" {
+		unsubscribeTargets = append(unsubscribeTargets, fmt.Sprintf("<mailto:%s>", e.UnsubscribeAddress))
+	}
 	if e.UnsubscribeURL != "" {
-		msg.SetHeader("List-Unsubscribe", fmt.Sprintf("<%s>", e.UnsubscribeURL))
+		unsubscribeTargets = append(unsubscribeTargets, fmt.Sprintf("<%s>", e.UnsubscribeURL))
+		msg.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	if len(unsubscribeTargets) > 0 {
+		msg.SetHeader("List-Unsubscribe", strings.Join(unsubscribeTargets, ", "))
 	}
 	idGen := func(s string) string {
 		return fmt.Sprintf("<%s@diplicity-engine.appspot.com>", s)
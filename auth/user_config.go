@@ -1,7 +1,14 @@
 package auth
 
 import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/aymerick/raymond"
 	"github.com/zond/go-fcm"
@@ -17,6 +24,17 @@ const (
 	userConfigKind = "UserConfig"
 )
 
+type Notification string
+
+const (
+	NotificationPhaseStarted     Notification = "PhaseStarted"
+	NotificationPhaseResolved    Notification = "PhaseResolved"
+	NotificationNewMessage       Notification = "NewMessage"
+	NotificationGameFinished     Notification = "GameFinished"
+	NotificationDeadlineReminder Notification = "DeadlineReminder"
+	NotificationKicked           Notification = "Kicked"
+)
+
 func init() {
 	raymond.RegisterHelper("encodeKey", func(key datastore.Key) string {
 		return key.Encode()
@@ -133,6 +151,73 @@ type FCMToken struct {
 	ReplaceToken  string                `methods:"PUT"`
 }
 
+type WebPushSubscription struct {
+	Endpoint string `methods:"PUT" datastore:",noindex"`
+	P256dh   string `methods:"PUT" datastore:",noindex"`
+	Auth     string `methods:"PUT" datastore:",noindex"`
+	Disabled bool   `methods:"PUT"`
+	Note     string `methods:"PUT" datastore:",noindex"`
+}
+
+// Validate makes sure the keys are usable, and that the endpoint is an https URL on a public host so that the
+// server can't be made to push to itself or its network.
+func (w *WebPushSubscription) Validate() error {
+	p256dh, err := decodeWebPushKey(w.P256dh)
+	if err != nil {
+		return fmt.Errorf("unparseable P256dh: %v", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return fmt.Errorf("invalid P256dh: %v", err)
+	}
+	if auth, err := decodeWebPushKey(w.Auth); err != nil {
+		return fmt.Errorf("unparseable Auth: %v", err)
+	} else if len(auth) == 0 {
+		return fmt.Errorf("Auth can't be empty")
+	}
+	endpoint, err := url.Parse(w.Endpoint)
+	if err != nil {
+		return fmt.Errorf("unparseable Endpoint: %v", err)
+	}
+	if endpoint.Scheme != "https" {
+		return fmt.Errorf("Endpoint %q must use https", w.Endpoint)
+	}
+	if endpoint.User != nil {
+		return fmt.Errorf("Endpoint %q can't contain credentials", w.Endpoint)
+	}
+	if !isPublicHost(endpoint.Hostname()) {
+		return fmt.Errorf("Endpoint %q must be on a public host", w.Endpoint)
+	}
+	return nil
+}
+
+// decodeWebPushKey decodes keys the way browsers and webpush-go encode them, URL safe or not, padded or not.
+func decodeWebPushKey(key string) ([]byte, error) {
+	key = strings.TrimRight(key, "=")
+	if b, err := base64.RawStdEncoding.DecodeString(key); err == nil {
+		return b, nil
+	}
+	return base64.RawURLEncoding.DecodeString(key)
+}
+
+func isPublicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+	}
+	if !strings.Contains(host, ".") {
+		return false
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal"} {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
 type UnsubscribeConfig struct {
 	RedirectTemplate string `methods:"PUT"`
 	HTMLTemplate     string `methods:"PUT"`
@@ -172,12 +257,59 @@ func (m *MailConfig) Validate() error {
 	return nil
 }
 
+// NotificationPreferences mute kinds of notifications. They are mute flags
+// rather than enabled flags so that configs saved before they existed keep
+// getting everything.
+type NotificationPreferences struct {
+	MutePhaseStarted      bool `methods:"PUT"`
+	MutePhaseResolved     bool `methods:"PUT"`
+	MuteNewMessage        bool `methods:"PUT"`
+	MuteGameFinished      bool `methods:"PUT"`
+	MuteDeadlineReminders bool `methods:"PUT"`
+}
+
+// Mutes returns whether the notification is muted. Notifications without a
+// preference are never muted.
+func (n *NotificationPreferences) Mutes(notification Notification) bool {
+	switch notification {
+	case NotificationPhaseStarted:
+		return n.MutePhaseStarted
+	case NotificationPhaseResolved:
+		return n.MutePhaseResolved
+	case NotificationNewMessage:
+		return n.MuteNewMessage
+	case NotificationGameFinished:
+		return n.MuteGameFinished
+	case NotificationDeadlineReminder:
+		return n.MuteDeadlineReminders
+	}
+	return false
+}
+
 type UserConfig struct {
 	UserId                           string
-	FCMTokens                        []FCMToken `methods:"PUT"`
-	MailConfig                       MailConfig `methods:"PUT"`
-	Colors                           []string   `methods:"PUT"`
-	PhaseDeadlineWarningMinutesAhead int        `methods:"PUT"`
+	FCMTokens                        []FCMToken              `methods:"PUT"`
+	WebPushSubscriptions             []WebPushSubscription   `methods:"PUT"`
+	MailConfig                       MailConfig              `methods:"PUT"`
+	NotificationPreferences          NotificationPreferences `methods:"PUT"`
+	Colors                           []string                `methods:"PUT"`
+	PhaseDeadlineWarningMinutesAhead int                     `methods:"PUT"`
+	MutedUsers                       []string                `methods:"PUT"`
+}
+
+// WantsMail returns whether the user wants to be mailed about the notification.
+// All mail notifications must check this before sending.
+func (u *UserConfig) WantsMail(notification Notification) bool {
+	return u.MailConfig.Enabled && !u.NotificationPreferences.Mutes(notification)
+}
+
+func (u *UserConfig) HasMutedUser(userId string) bool {
+	for _, mut := range u.MutedUsers {
+		if mut == userId {
+			return true
+		}
+	}
+	return false
 }
 
 func (u *UserConfig) Load(props []datastore.Property) error {
@@ -225,10 +357,23 @@ func (u *UserConfig) Item(r Request) *Item {
 				"Two template fields, one for phase and one for message notifications.",
 				"Each token also has a `ReplaceToken` defined by the client. Defining a `ReplaceToken` other than the empty string allows the client to replace the `Value` in the token without requiring a regular authentication token.",
 			},
+			[]string{
+				"Adding and removing FCM tokens",
+				"To register a device without rewriting the whole configuration, `POST` an FCM token JSON body to `/User/{user_id}/FCMToken`. If a token with the same `Value` already exists it will be updated instead of duplicated.",
+				"To unregister a device, `DELETE` `/User/{user_id}/FCMToken/{token_value}`. Removing a token that doesn't exist succeeds without doing anything.",
+				"Tokens that FCM reports as unregistered are removed automatically.",
+			},
 			[]string{
 				"ReplaceToken",
 				"To use the `ReplaceToken` to replace the `Value` of your FCM token, `PUT` a JSON body containing `{ 'Value': 'new token value' }` to `/User/{user_id}/FCMToken/{replace_token}/Replace`.",
 			},
+			[]string{
+				"Web push subscriptions",
+				"Users without any enabled FCM tokens get notifications through their web push subscriptions instead.",
+				"Each subscription has the `Endpoint`, `P256dh` and `Auth` values of the `PushSubscription` created in the browser, using the VAPID public key of the server as application server key.",
+				"The payload is the JSON of the notification, with the same title, body, tag and click action fields as the FCM notification.",
+				"Like FCM tokens, subscriptions get disabled with a note when the push service reports them gone.",
+			},
 			[]string{
 				"FCM templates",
 				"The FCM templates define the title, body and click action of the FCM notifications sent out.",
@@ -242,6 +387,10 @@ func (u *UserConfig) Item(r Request) *Item {
 				"New message FCM notifications",
 				"FCM notifications for new messages will have the payload `{ DiplicityJSON: DATA }` where DATA is `{ message: [message JSON], type: 'message' }` compressed with libz.",
 			},
+			[]string{
+				"Deadline reminder FCM notifications",
+				"FCM notifications reminding about phases resolving soon without orders will have the payload `{ DiplicityJSON: DATA }` where DATA is `{ gameID: [game ID], phaseOrdinal: [phase ordinal], deadlineAt: [deadline], remainingSeconds: [seconds until the deadline], type: 'deadlineReminder' }` compressed with libz. They use the data and notification settings of the phase template.",
+			},
 			[]string{
 				"Email config",
 				"A user has an email config, defining if and how this user should receive email about new phases and messages.",
@@ -251,6 +400,16 @@ func (u *UserConfig) Item(r Request) *Item {
 				"Two template fields, one for phase and one for message notifications.",
 				"All templates will be parsed by the same parser as the FCM templates.",
 			},
+			[]string{
+				"Notification preferences",
+				"The notification preferences mute kinds of email notifications: the first phase of a game starting, later phases resolving, new messages, games finishing, and reminders about phases resolving soon without orders.",
+				"All notifications are sent unless muted, as long as email is enabled in the email config.",
+			},
+			[]string{
+				"Muted users",
+				"Adding a user ID to the 'MutedUsers' list hides all press from that user, and skips notifications about it, in all games.",
+				"This works together with the muting in the game state of each game.",
+			},
 		})
 }
 
@@ -300,9 +459,103 @@ func updateUserConfig(w ResponseWriter, r Request) (*UserConfig, error) {
 		return nil, err
 	}
 
+	for _, subscription := range config.WebPushSubscriptions {
+		if err := subscription.Validate(); err != nil {
+			return nil, HTTPErr{err.Error(), http.StatusBadRequest}
+		}
+	}
+
 	if _, err := datastore.Put(ctx, config.ID(ctx), config); err != nil {
 		return nil, err
 	}
 
 	return config, nil
 }
+
+// mutateUserConfig runs mutator on the config of the user in the `user_id` route variable, and stores the result.
+// Users can only mutate their own configs.
+func mutateUserConfig(r Request, mutator func(*UserConfig) error) (*UserConfig, error) {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*User)
+	if !ok {
+		return nil, HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	if r.Vars()["user_id"] != user.Id {
+		return nil, HTTPErr{"can only change your own user config", http.StatusForbidden}
+	}
+
+	var config *UserConfig
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		config = &UserConfig{}
+		if err := datastore.Get(ctx, UserConfigID(ctx, user.ID(ctx)), config); err == datastore.ErrNoSuchEntity {
+			config.UserId = user.Id
+		} else if err != nil {
+			return err
+		}
+		if err := mutator(config); err != nil {
+			return err
+		}
+		_, err := datastore.Put(ctx, config.ID(ctx), config)
+		return err
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func addFCMToken(w ResponseWriter, r Request) error {
+	token := &FCMToken{}
+	if err := json.NewDecoder(r.Req().Body).Decode(token); err != nil {
+		return HTTPErr{fmt.Sprintf("unparseable FCM token: %v", err), http.StatusBadRequest}
+	}
+	if token.Value == "" {
+		return HTTPErr{"FCM tokens must have values", http.StatusBadRequest}
+	}
+	if err := token.MessageConfig.Validate(); err != nil {
+		return HTTPErr{err.Error(), http.StatusBadRequest}
+	}
+	if err := token.PhaseConfig.Validate(); err != nil {
+		return HTTPErr{err.Error(), http.StatusBadRequest}
+	}
+
+	config, err := mutateUserConfig(r, func(config *UserConfig) error {
+		for i := range config.FCMTokens {
+			if config.FCMTokens[i].Value == token.Value {
+				config.FCMTokens[i] = *token
+				return nil
+			}
+		}
+		config.FCMTokens = append(config.FCMTokens, *token)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.SetContent(config.Item(r))
+	return nil
+}
+
+func removeFCMToken(w ResponseWriter, r Request) error {
+	value := r.Vars()["token_value"]
+
+	config, err := mutateUserConfig(r, func(config *UserConfig) error {
+		newTokens := []FCMToken{}
+		for _, token := range config.FCMTokens {
+			if token.Value != value {
+				newTokens = append(newTokens, token)
+			}
+		}
+		config.FCMTokens = newTokens
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.SetContent(config.Item(r))
+	return nil
+}
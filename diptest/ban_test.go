@@ -90,6 +90,16 @@ func TestBans(t *testing.T) {
 		Follow("bans", "Links").Success().
 		AssertLen(0, "Properties")
 
+	env3.GetRoute(game.ListBansRoute).RouteParams("user_id", env1.GetUID()).Status(403)
+	env3.GetRoute(game.ListBansRoute).RouteParams("user_id", env2.GetUID()).Status(403)
+
+	env1.GetRoute(game.ListBansRoute).RouteParams("user_id", env1.GetUID()).
+		QueryParams(url.Values{"limit": []string{"1"}}).Success().
+		AssertLen(1, "Properties").
+		Find("next", []string{"Links"}, []string{"Rel"}).
+		FollowLink().Success().
+		AssertLen(0, "Properties")
+
 	env2.GetRoute(game.IndexRoute).Success().
 		Follow("bans", "Links").Success().
 		Follow("create", "Links").Body(map[string]interface{}{
@@ -258,3 +268,64 @@ func testBanEfficacy(t *testing.T) {
 	unbanView.AssertNil("Properties", "ActiveBans")
 	unbanView.Find("join", []string{"Links"}, []string{"Rel"})
 }
+
+func TestLiftBan(t *testing.T) {
+	env1 := NewEnv().SetUID(String("fake"))
+	env2 := NewEnv().SetUID(String("fake"))
+
+	env1.GetRoute(game.IndexRoute).Success().
+		Follow("bans", "Links").Success().
+		Follow("create", "Links").Body(map[string]interface{}{
+		"UserIds": []string{env1.GetUID(), env2.GetUID()},
+	}).Success()
+
+	gameDesc := String("game")
+	env1.GetRoute(game.IndexRoute).Success().
+		Follow("create-game", "Links").
+		Body(map[string]interface{}{
+			"Variant":            "Classical",
+			"Desc":               gameDesc,
+			"NoMerge":            true,
+			"PhaseLengthMinutes": time.Duration(60),
+		}).Success()
+
+	env2.GetRoute(game.IndexRoute).Success().
+		Follow("open-games", "Links").Success().
+		AssertNotFind(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+
+	t.Run("OneSidedLiftKeepsBan", func(t *testing.T) {
+		env1.GetRoute(game.IndexRoute).Success().
+			Follow("bans", "Links").Success().
+			Find("lift", []string{"Properties"}, []string{"Links"}, []string{"Rel"}).
+			FollowLink().Success().
+			AssertEq([]interface{}{env1.GetUID()}, "Properties", "LiftIds")
+
+		env1.GetRoute(game.IndexRoute).Success().
+			Follow("bans", "Links").Success().
+			AssertLen(1, "Properties").
+			AssertNotFind("lift", []string{"Properties"}, []string{"Links"}, []string{"Rel"})
+
+		env2.GetRoute(game.IndexRoute).Success().
+			Follow("open-games", "Links").Success().
+			AssertNotFind(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+	})
+
+	t.Run("TwoSidedLiftRemovesBan", func(t *testing.T) {
+		env2.GetRoute(game.IndexRoute).Success().
+			Follow("bans", "Links").Success().
+			Find("lift", []string{"Properties"}, []string{"Links"}, []string{"Rel"}).
+			FollowLink().Success()
+
+		env1.GetRoute(game.IndexRoute).Success().
+			Follow("bans", "Links").Success().
+			AssertLen(0, "Properties")
+
+		env2.GetRoute(game.IndexRoute).Success().
+			Follow("bans", "Links").Success().
+			AssertLen(0, "Properties")
+
+		env2.GetRoute(game.IndexRoute).Success().
+			Follow("open-games", "Links").Success().
+			Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+	})
+}
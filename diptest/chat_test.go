@@ -2,6 +2,7 @@ package diptest
 
 import (
 	"math"
+	"net/url"
 	"sort"
 	"strings"
 	"testing"
@@ -84,17 +85,101 @@ func testChat(t *testing.T) {
 			Find(chanName, []string{"Properties"}, []string{"Name"}).
 			Follow("messages", "Links").Success().
 			AssertNotFind(msg1, []string{"Properties"}, []string{"Properties", "Body"})
+		startedGameEnvs[1].PutRoute(game.UpdateSeenMarkerRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			Body(map[string]interface{}{
+				"At": "2000-01-01T00:00:00Z",
+			}).Success()
+		startedGames[1].Follow("channels", "Links").Success().
+			Find(chanName, []string{"Properties"}, []string{"Name"}).
+			AssertEq(0.0, "Properties", "UnreadCount")
 		startedGames[1].Follow("game-states", "Links").Success().
 			Find(startedGameNats[1], []string{"Properties"}, []string{"Properties", "Nation"}).
 			Follow("update", "Links").Body(map[string]interface{}{
 			"Muted": []string{},
 		}).Success()
+		startedGames[1].Follow("channels", "Links").Success().
+			Find(chanName, []string{"Properties"}, []string{"Name"}).
+			AssertEq(1.0, "Properties", "UnreadCount")
 		startedGames[1].Follow("channels", "Links").Success().
 			Find(chanName, []string{"Properties"}, []string{"Name"}).
 			Follow("messages", "Links").Success().
 			Find(msg1, []string{"Properties"}, []string{"Properties", "Body"})
 	})
 
+	t.Run("TestMessagePagination", func(t *testing.T) {
+		firstPage := startedGameEnvs[0].GetRoute(game.ListMessagesRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			QueryParams(url.Values{"limit": []string{"1"}}).Success().
+			AssertLen(1, "Properties").
+			AssertRel("next", "Links")
+		firstPage.Follow("next", "Links").Success().
+			AssertNotFind(firstPage.GetValue("Properties", "0", "Properties", "Body"), []string{"Properties"}, []string{"Properties", "Body"})
+		startedGameEnvs[0].GetRoute(game.ListMessagesRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).Success().
+			AssertNotRel("next", "Links")
+	})
+
+	t.Run("TestMessageSearch", func(t *testing.T) {
+		startedGameEnvs[0].GetRoute(game.SearchMessagesRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			QueryParams(url.Values{"q": []string{strings.ToUpper(msg1)}}).Success().
+			Find(msg1, []string{"Properties"}, []string{"Properties", "Body"})
+		words := strings.Split(msg1, "-")
+		for i, j := 0, len(words)-1; i < j; i, j = i+1, j-1 {
+			words[i], words[j] = words[j], words[i]
+		}
+		startedGameEnvs[0].GetRoute(game.SearchMessagesRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			QueryParams(url.Values{"q": []string{strings.Join(words, " ")}}).Success().
+			Find(msg1, []string{"Properties"}, []string{"Properties", "Body"})
+		startedGameEnvs[0].GetRoute(game.SearchMessagesRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			QueryParams(url.Values{"q": []string{String("not-in-any-message")}}).Success().
+			AssertLen(0, "Properties")
+		startedGameEnvs[2].GetRoute(game.SearchMessagesRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			QueryParams(url.Values{"q": []string{msg1}}).Status(403)
+	})
+
+	t.Run("TestSeenMarker", func(t *testing.T) {
+		startedGameEnvs[0].PutRoute(game.UpdateSeenMarkerRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			Body(map[string]interface{}{
+				"At": "2000-01-01T00:00:00Z",
+			}).Success()
+		nMessages := startedGames[0].Follow("channels", "Links").Success().
+			Find(chanName, []string{"Properties"}, []string{"Name"}).
+			GetValue("Properties", "NMessages")
+		startedGames[0].Follow("channels", "Links").Success().
+			Find(chanName, []string{"Properties"}, []string{"Name"}).
+			AssertEq(nMessages, "Properties", "UnreadCount")
+		startedGameEnvs[0].PutRoute(game.UpdateSeenMarkerRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			Body(map[string]interface{}{}).Success()
+		startedGames[0].Follow("channels", "Links").Success().
+			Find(chanName, []string{"Properties"}, []string{"Name"}).
+			AssertEq(0.0, "Properties", "UnreadCount")
+		startedGameEnvs[2].PutRoute(game.UpdateSeenMarkerRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			Body(map[string]interface{}{}).Status(403)
+	})
+
+	t.Run("TestAttachmentUploadOnlyForChannelMembers", func(t *testing.T) {
+		startedGameEnvs[2].PostRoute(game.CreateAttachmentUploadRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			Body(map[string]interface{}{
+				"ContentType": "image/png",
+				"Size":        1024,
+			}).Status(403)
+		NewEnv().SetUID(String("fake")).PostRoute(game.CreateAttachmentUploadRoute).
+			RouteParams("game_id", startedGameID, "channel_members", chanName).
+			Body(map[string]interface{}{
+				"ContentType": "image/png",
+				"Size":        1024,
+			}).Status(403)
+	})
+
 	t.Run("TestNonMemberSeeingPublicChannelMessages", func(t *testing.T) {
 		outsiderGame := NewEnv().SetUID(String("fake")).GetRoute(game.IndexRoute).Success().
 			Follow("started-games", "Links").Success().
@@ -203,6 +288,48 @@ func testChat(t *testing.T) {
 				AssertEq(0.0, "Properties", "NMessagesSince", "NMessages")
 		}
 	})
+
+	t.Run("TestMessageEditing", func(t *testing.T) {
+		bdy := String("body")
+		sent := startedGames[0].Follow("channels", "Links").Success().
+			Follow("message", "Links").Body(map[string]interface{}{
+			"Body":           String("typo"),
+			"ChannelMembers": members,
+		}).Success().
+			AssertEq(false, "Properties", "Edited")
+		startedGameEnvs[1].PutURL("http://localhost:8080/Game/" + startedGameID + "/Channel/" + chanName + "/Messages/" + sent.GetValue("Properties", "ID").(string)).
+			Body(map[string]interface{}{
+				"Body": bdy,
+			}).Status(403)
+		sent.Follow("update", "Links").Body(map[string]interface{}{
+			"Body": bdy,
+		}).Success().
+			AssertEq(bdy, "Properties", "Body").
+			AssertEq(true, "Properties", "Edited")
+		startedGames[1].Follow("channels", "Links").Success().
+			Find(chanName, []string{"Properties"}, []string{"Name"}).
+			Follow("messages", "Links").Success().
+			Find(bdy, []string{"Properties"}, []string{"Properties", "Body"}).
+			AssertEq(true, "Properties", "Edited").
+			AssertNotRel("update", "Links")
+	})
+
+	t.Run("TestMessageReactions", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			startedGames[1].Follow("channels", "Links").Success().
+				Find(chanName, []string{"Properties"}, []string{"Name"}).
+				Follow("messages", "Links").Success().
+				Find(msg1, []string{"Properties"}, []string{"Properties", "Body"}).
+				Follow("react", "Links").Body(map[string]interface{}{
+				"Emoji": "👍",
+			}).Success()
+		}
+		startedGames[0].Follow("channels", "Links").Success().
+			Find(chanName, []string{"Properties"}, []string{"Name"}).
+			Follow("messages", "Links").Success().
+			Find(msg1, []string{"Properties"}, []string{"Properties", "Body"}).
+			AssertEq(1.0, "Properties", "Reactions", "👍")
+	})
 }
 
 func TestDisabledChats(t *testing.T) {
@@ -236,6 +363,63 @@ func TestDisabledChats(t *testing.T) {
 			"ChannelMembers": classical.Nations,
 		}).Success()
 	})
+	t.Run("PressDisabled", func(t *testing.T) {
+		withStartedGameOpts(func(opts map[string]interface{}) {
+			opts["DisablePress"] = true
+		}, func() {
+			verifyNotAnonymous()
+			startedGames[1].AssertNotRel("channels", "Links")
+			startedGameEnvs[1].GetRoute(game.ListChannelsRoute).RouteParams("game_id", startedGameID).Status(403)
+			startedGameEnvs[1].GetRoute("Message.Create").RouteParams("game_id", startedGameID).Body(map[string]interface{}{
+				"Body":           String("body"),
+				"ChannelMembers": classical.Nations,
+			}).Status(403)
+			publicChannel := make([]string, len(classical.Nations))
+			for i := range classical.Nations {
+				publicChannel[i] = string(classical.Nations[i])
+			}
+			sort.Strings(publicChannel)
+			startedGameEnvs[1].GetRoute(game.ListMessagesRoute).RouteParams("game_id", startedGameID, "channel_members", strings.Join(publicChannel, ",")).Status(403)
+			for _, game := range startedGames {
+				game.Follow("phases", "Links").Success().
+					Find("Movement", []string{"Properties"}, []string{"Properties", "Type"}).
+					Follow("phase-states", "Links").Success().
+					Find(false, []string{"Properties"}, []string{"Properties", "ReadyToResolve"}).
+					Follow("update", "Links").Body(map[string]interface{}{
+					"ReadyToResolve": true,
+					"WantsDIAS":      true,
+				}).Success()
+			}
+		})
+		WaitForEmptyQueue("game-asyncResolvePhase")
+		startedGameEnvs[1].GetRoute(game.ListChannelsRoute).RouteParams("game_id", startedGameID).Success().
+			Follow("message", "Links").Body(map[string]interface{}{
+			"Body":           String("body"),
+			"ChannelMembers": classical.Nations,
+		}).Success()
+	})
+	t.Run("BroadcastOnly", func(t *testing.T) {
+		withStartedGameOpts(func(opts map[string]interface{}) {
+			opts["BroadcastOnly"] = true
+		}, func() {
+			for _, members := range []sort.StringSlice{
+				{startedGameNats[0], startedGameNats[1]},
+				{startedGameNats[0], startedGameNats[1], startedGameNats[2]},
+			} {
+				sort.Sort(members)
+				startedGames[1].Follow("channels", "Links").Success().
+					Follow("message", "Links").Body(map[string]interface{}{
+					"Body":           String("body"),
+					"ChannelMembers": members,
+				}).Status(400)
+			}
+			startedGames[1].Follow("channels", "Links").Success().
+				Follow("message", "Links").Body(map[string]interface{}{
+				"Body":           String("body"),
+				"ChannelMembers": classical.Nations,
+			}).Success()
+		})
+	})
 	t.Run("ConferenceChat", func(t *testing.T) {
 		t.Run("Enabled", func(t *testing.T) {
 			withStartedGame(func() {
@@ -379,7 +563,60 @@ func TestNonMemberSeeingAllMessagesInFinishedGames(t *testing.T) {
 				GetValue("Properties", "TrueSkill", "Rating").(float64); math.Round(foundRating) != wantedRating {
 				t.Errorf("Got rating %v for %v, wanted %v", foundRating, startedGameNats[idx], wantedRating)
 			}
+			if history := env.GetRoute("UserStats.Load").RouteParams("user_id", env.GetUID()).Success().
+				GetValue("Properties", "ReliabilityHistory").([]interface{}); len(history) == 0 || len(history) > 20 {
+				t.Errorf("Got %v reliability samples for %v, wanted 1-20", len(history), startedGameNats[idx])
+			}
 		}
 
 	})
 }
+
+func TestSpectatorDelay(t *testing.T) {
+	withStartedGameOpts(func(m map[string]interface{}) {
+		m["AllowSpectators"] = true
+		m["SpectatorDelayMinutes"] = 30
+	}, func() {
+		spectator := NewEnv().SetUID(String("fake"))
+		spectator.PostRoute(game.SpectateGameRoute).RouteParams("game_id", startedGameID).Success().
+			AssertRel("stop-spectating", "Links")
+
+		msg := String("message")
+		startedGames[0].Follow("channels", "Links").Success().
+			Follow("message", "Links").Body(map[string]interface{}{
+			"Body":           msg,
+			"ChannelMembers": classical.Nations,
+		}).Success()
+
+		sortedNations := make([]string, len(startedGameNats))
+		copy(sortedNations, startedGameNats)
+		sort.Sort(sort.StringSlice(sortedNations))
+		chanName := strings.Join(sortedNations, ",")
+
+		startedGameEnvs[1].GetRoute(game.ListMessagesRoute).RouteParams("game_id", startedGameID, "channel_members", chanName).Success().
+			Find(msg, []string{"Properties"}, []string{"Properties", "Body"})
+		spectator.GetRoute(game.ListMessagesRoute).RouteParams("game_id", startedGameID, "channel_members", chanName).Success().
+			AssertNotFind(msg, []string{"Properties"}, []string{"Properties", "Body"})
+		spectator.GetRoute(game.ListChannelsRoute).RouteParams("game_id", startedGameID).Success().
+			AssertNotFind(msg, []string{"Properties"}, []string{"Properties", "LatestMessage", "Body"})
+		startedGameEnvs[1].GetRoute(game.SearchMessagesRoute).RouteParams("game_id", startedGameID, "channel_members", chanName).
+			QueryParams(url.Values{"q": []string{msg}}).Success().
+			Find(msg, []string{"Properties"}, []string{"Properties", "Body"})
+		spectator.GetRoute(game.SearchMessagesRoute).RouteParams("game_id", startedGameID, "channel_members", chanName).
+			QueryParams(url.Values{"q": []string{msg}}).Success().
+			AssertNotFind(msg, []string{"Properties"}, []string{"Properties", "Body"})
+		spectator.GetRoute(game.ListPhasesRoute).RouteParams("game_id", startedGameID).Success().
+			AssertLen(0, "Properties")
+		startedGameEnvs[1].GetRoute(game.ListPhasesRoute).RouteParams("game_id", startedGameID).Success().
+			AssertLen(1, "Properties")
+
+		for _, env := range []*Env{spectator, NewEnv().SetUID(String("fake"))} {
+			env.GetRoute(game.ListMessagesRoute).RouteParams("game_id", startedGameID, "channel_members", chanName).Success().
+				AssertNotFind(msg, []string{"Properties"}, []string{"Properties", "Body"})
+			env.GetRoute("Phase.Load").RouteParams("game_id", startedGameID, "phase_ordinal", "1").Status(404)
+			env.GetRoute(game.RenderPhaseMapRoute).RouteParams("game_id", startedGameID, "phase_ordinal", "1").Status(404)
+			env.GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+				AssertNil("Properties", "NewestPhaseMeta")
+		}
+	})
+}
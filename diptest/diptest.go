@@ -20,6 +20,7 @@ import (
 	"github.com/jmoiron/jsonq"
 	"github.com/kr/pretty"
 	"github.com/zond/diplicity/auth"
+	"github.com/zond/diplicity/game"
 	"github.com/zond/diplicity/routes"
 	"google.golang.org/appengine/v2/aetest"
 )
@@ -124,6 +125,11 @@ type Transport interface {
 	Execute(req *http.Request) (status int, header http.Header, body io.Reader, err error)
 }
 
+const (
+	// superuserUID is the user NewSuperuserEnv configures as the superuser.
+	superuserUID = "diptest-superuser"
+)
+
 var (
 	counter   uint64
 	startTime = time.Now().UnixNano()
@@ -168,8 +174,23 @@ func NewEnv() *Env {
 }
 
 type Env struct {
-	uid   string
-	email string
+	uid    string
+	email  string
+	bearer string
+}
+
+// NewSuperuserEnv returns an env for superuserUID, first configuring it as the superuser if no superusers are configured.
+func NewSuperuserEnv() *Env {
+	superusers := map[string]interface{}{
+		"Superusers": map[string]interface{}{
+			"UserIds": superuserUID,
+		},
+	}
+	if NewEnv().PostRoute(game.ConfigureRoute).QueryParams(url.Values{"dryRun": []string{"true"}}).Body(superusers).Success().
+		GetValue("Properties", "Superusers") == "would be configured" {
+		NewEnv().PostRoute(game.ConfigureRoute).Body(superusers).Success()
+	}
+	return NewEnv().SetUID(superuserUID)
 }
 
 func (e *Env) GetUID() string {
@@ -181,6 +202,12 @@ func (e *Env) SetEmail(m string) *Env {
 	return e
 }
 
+// SetBearer makes the requests of the env send token in the Authorization header.
+func (e *Env) SetBearer(token string) *Env {
+	e.bearer = token
+	return e
+}
+
 func (e *Env) SetUID(uid string) *Env {
 	e.uid = uid
 	return e
@@ -527,6 +554,9 @@ func (r *Req) do() *Result {
 		panic(fmt.Errorf("creating GET %q: %v", r.url, err))
 	}
 	req.Header.Set("Accept", "application/json; charset=utf-8")
+	if r.env.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+r.env.bearer)
+	}
 	if r.body != nil {
 		req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	}
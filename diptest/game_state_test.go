@@ -1,6 +1,10 @@
 package diptest
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/zond/diplicity/game"
+)
 
 func testGameState(t *testing.T) {
 	g0 := startedGames[0]
@@ -39,5 +43,171 @@ func testGameState(t *testing.T) {
 	g1.Follow("game-states", "Links").Success().AssertLen(7, "Properties").
 		Find(nat1, []string{"Properties"}, []string{"Properties", "Nation"}).
 		AssertNil("Properties", "Muted")
+	startedGameEnvs[0].
+		PutRoute("GameState.Update").
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"Muted":      []string{nat1},
+			"MutedUsers": []string{"not-a-member"},
+		}).Status(400)
+
+	startedGameEnvs[0].
+		PutRoute("GameState.Update").
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"Muted":      []string{nat1},
+			"MutedUsers": []string{startedGameEnvs[1].GetUID()},
+		}).Success()
+
+	startedGameEnvs[0].
+		GetRoute("GameState.Load").
+		RouteParams("game_id", startedGameID, "nation", nat0).Success().
+		AssertEq([]interface{}{nat1}, "Properties", "Muted").
+		AssertEq([]interface{}{startedGameEnvs[1].GetUID()}, "Properties", "MutedUsers")
+
+	for _, prefs := range [][]string{
+		{"blapp"},
+		{nat0, nat0},
+	} {
+		startedGameEnvs[0].
+			PutRoute("GameState.Update").
+			RouteParams("game_id", startedGameID, "nation", nat0).
+			Body(map[string]interface{}{
+				"Muted":             []string{nat1},
+				"NationPreferences": prefs,
+			}).Status(400)
+	}
+
+	startedGameEnvs[0].
+		PutRoute("GameState.Update").
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"Muted":             []string{nat1},
+			"NationPreferences": []string{nat1, nat0},
+		}).Success()
+
+	startedGameEnvs[0].
+		GetRoute("GameState.Load").
+		RouteParams("game_id", startedGameID, "nation", nat0).Success().
+		AssertEq([]interface{}{nat1}, "Properties", "Muted").
+		AssertEq([]interface{}{nat1, nat0}, "Properties", "NationPreferences")
+
+	startedGameEnvs[0].
+		PostRoute(game.UnmuteAllGameStateRoute).
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{}).Success().
+		AssertNil("Properties", "Muted").
+		AssertNil("Properties", "MutedUsers").
+		AssertEq([]interface{}{nat1, nat0}, "Properties", "NationPreferences").
+		AssertRel("update", "Links")
+
+	startedGameEnvs[0].
+		PutRoute("GameState.Update").
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"Muted": []string{nat1},
+		}).Success()
+
+	startedGameEnvs[0].
+		PutRoute(game.UpdateNotificationSettingsRoute).
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"MutePress":        true,
+			"MutePhaseChanges": true,
+		}).Success()
+
+	startedGameEnvs[0].
+		GetRoute("GameState.Load").
+		RouteParams("game_id", startedGameID, "nation", nat0).Success().
+		AssertEq([]interface{}{nat1}, "Properties", "Muted").
+		AssertEq(true, "Properties", "NotificationSettings", "MutePress").
+		AssertEq(true, "Properties", "NotificationSettings", "MutePhaseChanges").
+		AssertEq(false, "Properties", "NotificationSettings", "MuteDeadlineReminders")
+
+	g1.Follow("game-states", "Links").Success().
+		Find(nat0, []string{"Properties"}, []string{"Properties", "Nation"}).
+		AssertEq([]interface{}{nat1}, "Properties", "Muted").
+		AssertEq(false, "Properties", "NotificationSettings", "MutePress")
+
+	startedGameEnvs[0].
+		PutRoute(game.UpdateNotificationSettingsRoute).
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"MutePress":        false,
+			"MutePhaseChanges": false,
+		}).Success().
+		AssertEq([]interface{}{nat1}, "Properties", "Muted")
+
+	startedGameEnvs[0].
+		PutRoute(game.UpdateNotificationSettingsRoute).
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"MutePress": true,
+		}).Success()
+
+	startedGameEnvs[0].
+		PutRoute("GameState.Update").
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"Muted": []string{nat1},
+		}).Success().
+		AssertEq([]interface{}{nat1}, "Properties", "Muted").
+		AssertEq(false, "Properties", "NotificationSettings", "MutePress")
+
+	nat2 := startedGameNats[2]
+
+	startedGameEnvs[0].
+		PostRoute(game.MuteGameStateRoute).
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{}).Status(400)
+
+	for i := 0; i < 2; i++ {
+		startedGameEnvs[0].
+			PostRoute(game.MuteGameStateRoute).
+			RouteParams("game_id", startedGameID, "nation", nat0).
+			Body(map[string]interface{}{
+				"Nation": nat2,
+			}).Success().
+			AssertEq([]interface{}{nat1, nat2}, "Properties", "Muted").
+			AssertRel("update", "Links")
+	}
+
+	for i := 0; i < 2; i++ {
+		startedGameEnvs[0].
+			PostRoute(game.UnmuteGameStateRoute).
+			RouteParams("game_id", startedGameID, "nation", nat0).
+			Body(map[string]interface{}{
+				"Nation": nat2,
+			}).Success().
+			AssertEq([]interface{}{nat1}, "Properties", "Muted")
+	}
+
+	startedGameEnvs[1].
+		PostRoute(game.MuteGameStateRoute).
+		RouteParams("game_id", startedGameID, "nation", nat0).
+		Body(map[string]interface{}{
+			"Nation": nat2,
+		}).Status(404)
+
+	startedGameEnvs[0].
+		GetRoute(game.MuteAuditRoute).
+		RouteParams("game_id", startedGameID).Status(403)
 
+	startedGameEnvs[0].
+		GetRoute(game.ExportGameRoute).
+		RouteParams("game_id", startedGameID).Success().
+		AssertEq(startedGameDesc, "Desc").
+		Find(1, []string{"Phases"}, []string{"Phase", "PhaseOrdinal"})
+
+	NewEnv().SetUID(String("fake")).
+		GetRoute(game.ExportGameRoute).
+		RouteParams("game_id", startedGameID).Status(403)
+
+	startedGameEnvs[0].
+		GetRoute(game.ExportTranscriptRoute).
+		RouteParams("game_id", startedGameID).Status(403)
+
+	startedGameEnvs[0].
+		DeleteRoute("Member.Delete").
+		RouteParams("game_id", startedGameID, "user_id", startedGameEnvs[0].GetUID()).Status(412)
 }
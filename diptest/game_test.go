@@ -532,12 +532,41 @@ func randBool() *string {
 	return nil
 }
 
+func randSort() *string {
+	if rand.Int() > 0 {
+		rval := "asc"
+		if rand.Int() > 0 {
+			rval = "desc"
+		}
+		return &rval
+	}
+	return nil
+}
+
+func randResultType() *string {
+	if rand.Intn(2) == 0 {
+		rval := []string{"solo", "draw", "concession"}[rand.Intn(3)]
+		return &rval
+	}
+	return nil
+}
+
+func randDirection() *string {
+	if rand.Intn(2) == 0 {
+		rval := "backward"
+		return &rval
+	}
+	return nil
+}
+
 // Not really a test, but it forces the dev_appserver to create (or validate, if run with --require_indexes)
 // indices for a lot of combinations of filters and lists.
 func TestIndexCreation(t *testing.T) {
 	routes := []string{
 		game.ListMyStagingGamesRoute,
 		game.ListMyStartedGamesRoute,
+		game.ListMyActiveGamesRoute,
+		game.ListMyNeedsOrdersGamesRoute,
 		game.ListMyFinishedGamesRoute,
 		game.ListOpenGamesRoute,
 		game.ListStartedGamesRoute,
@@ -560,6 +589,9 @@ func TestIndexCreation(t *testing.T) {
 		"conference-chat-disabled": randBool,
 		"group-chat-disabled":      randBool,
 		"private-chat-disabled":    randBool,
+		"sort":                     randSort,
+		"direction":                randDirection,
+		"result":                   randResultType,
 	}
 	for i := 0; i < 100; i++ {
 		for _, route := range routes {
@@ -743,6 +775,26 @@ func testGameListFilters(t *testing.T, private bool) {
 				"0:59",
 				false,
 			},
+			{
+				"minPhaseLength",
+				"60",
+				true,
+			},
+			{
+				"minPhaseLength",
+				"61",
+				false,
+			},
+			{
+				"maxPhaseLength",
+				"60",
+				true,
+			},
+			{
+				"maxPhaseLength",
+				"59",
+				false,
+			},
 			{
 				"nation-allocation",
 				"1",
@@ -753,6 +805,11 @@ func testGameListFilters(t *testing.T, private bool) {
 				"true",
 				false,
 			},
+			{
+				"result",
+				"solo",
+				false,
+			},
 			{
 				"variant",
 				"Classical",
@@ -863,6 +920,58 @@ func testGameListFilters(t *testing.T, private bool) {
 				res.AssertNotFind(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
 			}
 		}
+
+		env2.GetRoute(game.ListOpenGamesRoute).QueryParams(url.Values{
+			"variant": []string{"blapp", "Classical"},
+		}).Success().
+			Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+		env2.GetRoute(game.ListOpenGamesRoute).QueryParams(url.Values{
+			"variant": []string{"blapp", "blepp"},
+		}).Success().
+			AssertNotFind(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+		env2.GetRoute(game.ListOpenGamesRoute).QueryParams(url.Values{
+			"variant": []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"},
+		}).Status(http.StatusBadRequest)
+		env2.GetRoute(game.ListOpenGamesRoute).QueryParams(url.Values{
+			"result": []string{"blapp"},
+		}).Status(http.StatusBadRequest)
+		env2.GetRoute(game.ListOpenGamesRoute).QueryParams(url.Values{
+			"min-member-rating": []string{"blapp"},
+		}).Status(http.StatusBadRequest)
+		env2.GetRoute(game.ListOpenGamesRoute).QueryParams(url.Values{
+			"minPhaseLength": []string{"blapp"},
+		}).Status(http.StatusBadRequest)
+
+		env2.GetRoute(game.SearchGamesRoute).QueryParams(url.Values{
+			"q": []string{strings.ToUpper(gameDesc)},
+		}).Success().
+			Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+		env2.GetRoute(game.SearchGamesRoute).QueryParams(url.Values{
+			"q": []string{gameDesc + " blapp"},
+		}).Success().
+			AssertNotFind(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+		env2.GetRoute(game.SearchGamesRoute).QueryParams(url.Values{
+			"q": []string{" ,. "},
+		}).Success().
+			AssertLen(0, "Properties")
+		env2.GetRoute(game.SearchGamesRoute).QueryParams(url.Values{
+			"q":     []string{gameDesc},
+			"count": []string{"true"},
+		}).Success().
+			AssertEq(1.0, "TotalCount")
+		env2.GetRoute(game.SearchGamesRoute).QueryParams(url.Values{
+			"q":         []string{gameDesc},
+			"withCount": []string{"true"},
+		}).Success().
+			AssertEq(1.0, "TotalCount")
+		env2.GetRoute(game.SearchGamesRoute).QueryParams(url.Values{
+			"q":     []string{gameDesc},
+			"limit": []string{"1"},
+		}).Success().
+			AssertLen(1, "Properties").
+			AssertBoolEq(false, "HasMore").
+			AssertEq(1.0, "Limit").
+			AssertNotRel("next", "Links")
 	}
 
 	env2.GetURL(gameURL.String()).Success().Follow("join", "Links").Body(map[string]string{}).Success()
@@ -941,10 +1050,71 @@ func TestConcede(t *testing.T) {
 			Find(startedGameNats[1], []string{"Properties", "SoloWinnerMember"}).
 			Find(startedGameEnvs[1].uid, []string{"Properties", "SoloWinnerUser"})
 
+		startedGameEnvs[0].GetRoute(game.ListFinishedGamesRoute).QueryParams(url.Values{
+			"result": []string{"concession"},
+		}).Success().
+			Find(startedGameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+			AssertEq("concession", "Properties", "ResultType")
+		startedGameEnvs[0].GetRoute(game.ListFinishedGamesRoute).QueryParams(url.Values{
+			"result":  []string{"solo"},
+			"variant": []string{"Cold War"},
+		}).Success().
+			AssertNotFind(startedGameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+
+		startedGameEnvs[0].GetRoute(game.IndexRoute).Success().
+			Follow("finished-games", "Links").Success().
+			Find(startedGameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+			Follow("export", "Links").Success().
+			AssertEq(startedGameDesc, "Desc").
+			Find(startedGameNats[1], []string{"Members"}, []string{"Nation"}).
+			Find(startedGameEnvs[1].uid, []string{"UserId"})
+
+		exported := startedGameEnvs[0].GetRoute(game.ExportGameRoute).
+			RouteParams("game_id", startedGameID).Success()
+		exported.Find(3, []string{"Phases"}, []string{"Phase", "PhaseOrdinal"}).
+			Find(startedGameNats[0], []string{"PhaseStates"}, []string{"Nation"})
+
+		startedGameEnvs[0].PostRoute(game.ImportGameRoute).Body(map[string]interface{}{
+			"Variant": "Not a variant",
+			"Phases":  exported.GetValue("Phases"),
+		}).Status(400)
+		replayID := startedGameEnvs[0].PostRoute(game.ImportGameRoute).Body(exported.Body).Success().
+			AssertEq(true, "Properties", "Replay").
+			AssertEq(startedGameDesc, "Properties", "Desc").
+			GetValue("Properties", "ID").(string)
+		startedGameEnvs[0].GetRoute("Game.Load").RouteParams("id", replayID).Success().
+			Follow("phases", "Links").Success().
+			Find(3, []string{"Properties"}, []string{"Properties", "PhaseOrdinal"})
+		startedGameEnvs[0].GetRoute(game.IndexRoute).Success().
+			Follow("finished-games", "Links").Success().
+			AssertNotFind(replayID, []string{"Properties"}, []string{"Properties", "ID"})
 	})
 }
 
 func TestAnonymousGames(t *testing.T) {
+	t.Run("MutedUsers", func(t *testing.T) {
+		withStartedGameOpts(func(opts map[string]interface{}) {
+			opts["Anonymous"] = true
+		}, func() {
+			startedGameEnvs[0].
+				PutRoute("GameState.Update").
+				RouteParams("game_id", startedGameID, "nation", startedGameNats[0]).
+				Body(map[string]interface{}{
+					"MutedUsers": []string{startedGameEnvs[1].GetUID()},
+				}).Success()
+			startedGameEnvs[0].
+				GetRoute("GameState.Load").
+				RouteParams("game_id", startedGameID, "nation", startedGameNats[0]).Success().
+				AssertEq([]interface{}{startedGameEnvs[1].GetUID()}, "Properties", "MutedUsers")
+			startedGameEnvs[1].
+				GetRoute("GameState.Load").
+				RouteParams("game_id", startedGameID, "nation", startedGameNats[0]).Success().
+				AssertNil("Properties", "MutedUsers")
+			startedGames[1].Follow("game-states", "Links").Success().
+				Find(startedGameNats[0], []string{"Properties"}, []string{"Properties", "Nation"}).
+				AssertNil("Properties", "MutedUsers")
+		})
+	})
 	t.Run("PrivateGames", func(t *testing.T) {
 		t.Run("NotGunboat", func(t *testing.T) {
 			t.Run("Anonymous", func(t *testing.T) {
@@ -987,7 +1157,7 @@ func TestAnonymousGames(t *testing.T) {
 				withStartedGameOpts(func(opts map[string]interface{}) {
 					opts["Private"] = false
 					opts["Anonymous"] = true
-				}, verifyNotAnonymous)
+				}, verifyAnonymous)
 			})
 			t.Run("NotAnonymous", func(t *testing.T) {
 				withStartedGameOpts(func(opts map[string]interface{}) {
@@ -1469,3 +1639,158 @@ func TestMustering(t *testing.T) {
 		}).Success()
 	})
 }
+
+func TestDevForceMuster(t *testing.T) {
+	gameDesc := String("test-game")
+	env1 := NewEnv().SetUID(String("uid"))
+	gameID := env1.GetRoute(game.IndexRoute).Success().
+		Follow("create-game", "Links").Body(map[string]interface{}{
+		"Variant":            "France vs Austria",
+		"NoMerge":            true,
+		"Desc":               gameDesc,
+		"Private":            false,
+		"PhaseLengthMinutes": 60,
+	}).Success().GetValue("Properties", "ID").(string)
+
+	env1.GetRoute(game.DevForceMusterRoute).RouteParams("game_id", gameID).Status(412)
+
+	env2 := NewEnv().SetUID(String("uid"))
+	env2.GetRoute("Game.Load").RouteParams("id", gameID).Success().
+		Follow("join", "Links").Body(map[string]interface{}{}).Success()
+
+	g := env1.GetRoute(game.DevForceMusterRoute).RouteParams("game_id", gameID).Success().
+		AssertEq(true, "Properties", "Started").
+		AssertEq(true, "Properties", "Mustered").
+		AssertLen(1, "Properties", "NewestPhaseMeta")
+
+	members := g.GetValue("Properties", "Members").([]interface{})
+	nations := map[string]bool{}
+	for _, member := range members {
+		nation := member.(map[string]interface{})["Nation"].(string)
+		if nation == "" || nations[nation] {
+			t.Errorf("Got nation %q in %+v, wanted unique nations", nation, members)
+		}
+		nations[nation] = true
+	}
+	if len(nations) != len(variants.Variants["France vs Austria"].Nations) {
+		t.Errorf("Got nations %+v, wanted one per nation of the variant", nations)
+	}
+
+	WaitForEmptyQueue("game-asyncStartGame")
+
+	env1.GetRoute("Game.Load").RouteParams("id", gameID).Success().
+		AssertEq(true, "Properties", "Mustered").
+		Follow("phases", "Links").Success().
+		Find(godip.Movement, []string{"Properties"}, []string{"Properties", "Type"})
+}
+
+func TestDrawVote(t *testing.T) {
+	NewEnv().SetUID(String("fake")).GetRoute(game.IndexRoute).Success().
+		Follow("create-game", "Links").Body(map[string]interface{}{
+		"Variant":            "Classical",
+		"NoMerge":            true,
+		"Desc":               String("test-game"),
+		"PhaseLengthMinutes": 60,
+		"DrawRule":           "Plurality",
+	}).Status(http.StatusBadRequest)
+
+	withStartedGameOpts(func(m map[string]interface{}) {
+		m["DrawRule"] = game.DrawRuleMajority
+	}, func() {
+		startedGameEnvs[0].PostRoute(game.DrawVoteRoute).RouteParams("game_id", startedGameID).Success().
+			AssertRel("withdraw-draw-vote", "Links").
+			AssertLen(1, "Properties", "DrawVotes")
+		startedGameEnvs[0].DeleteRoute(game.WithdrawDrawVoteRoute).RouteParams("game_id", startedGameID).Success().
+			AssertRel("draw-vote", "Links")
+		startedGameEnvs[0].DeleteRoute(game.WithdrawDrawVoteRoute).RouteParams("game_id", startedGameID).Status(http.StatusNotFound)
+		NewEnv().SetUID(String("fake")).PostRoute(game.DrawVoteRoute).RouteParams("game_id", startedGameID).Status(http.StatusNotFound)
+
+		majority := len(startedGameNats)/2 + 1
+		for i := 0; i < majority; i++ {
+			startedGameEnvs[i].PostRoute(game.DrawVoteRoute).RouteParams("game_id", startedGameID).Success()
+		}
+
+		startedGameEnvs[0].GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+			AssertEq(true, "Properties", "Finished").
+			AssertEq(game.GameResultTypeDraw, "Properties", "ResultType")
+		startedGameEnvs[0].GetRoute("GameResult.Load").RouteParams("game_id", startedGameID).Success().
+			AssertLen(majority, "Properties", "DIASMembers").
+			Find(startedGameNats[0], []string{"Properties", "DIASMembers"}, []string{})
+	})
+}
+
+func TestConcessionVote(t *testing.T) {
+	withStartedGame(func() {
+		winner := -1
+		for i, nat := range startedGameNats {
+			if nat == "Russia" {
+				winner = i
+			}
+		}
+		loser := (winner + 1) % len(startedGameNats)
+
+		startedGameEnvs[loser].PostRoute(game.ConcessionVoteRoute).RouteParams("game_id", startedGameID).Body(map[string]interface{}{
+			"Winner": startedGameNats[(winner+2)%len(startedGameNats)],
+		}).Status(http.StatusBadRequest)
+		startedGameEnvs[loser].PostRoute(game.ConcessionVoteRoute).RouteParams("game_id", startedGameID).Body(map[string]interface{}{
+			"Winner": startedGameNats[loser],
+		}).Status(http.StatusBadRequest)
+		startedGameEnvs[loser].DeleteRoute(game.WithdrawConcessionVoteRoute).RouteParams("game_id", startedGameID).Status(http.StatusNotFound)
+
+		for i := range startedGameEnvs {
+			if i == winner {
+				continue
+			}
+			startedGameEnvs[i].PostRoute(game.ConcessionVoteRoute).RouteParams("game_id", startedGameID).Body(map[string]interface{}{
+				"Winner": "Russia",
+			}).Success()
+		}
+
+		startedGameEnvs[winner].GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+			AssertEq(true, "Properties", "Finished").
+			AssertEq(game.GameResultTypeConcession, "Properties", "ResultType")
+		startedGameEnvs[winner].GetRoute("GameResult.Load").RouteParams("game_id", startedGameID).Success().
+			AssertEq("Russia", "Properties", "SoloWinnerMember").
+			AssertEq(startedGameEnvs[winner].GetUID(), "Properties", "SoloWinnerUser")
+	})
+}
+
+func TestPhaseWebhook(t *testing.T) {
+	creator := NewEnv().SetUID(String("fake"))
+	gameID := creator.GetRoute(game.IndexRoute).Success().
+		Follow("create-game", "Links").Body(map[string]interface{}{
+		"Variant":            "Classical",
+		"NoMerge":            true,
+		"Desc":               String("test-game"),
+		"PhaseLengthMinutes": 60,
+	}).Success().
+		AssertRel("update-phase-webhook", "Links").
+		GetValue("Properties", "ID").(string)
+
+	creator.GetRoute(game.PhaseWebhookRoute).RouteParams("game_id", gameID).Status(http.StatusNotFound)
+	creator.PutRoute(game.UpdatePhaseWebhookRoute).RouteParams("game_id", gameID).Body(map[string]interface{}{
+		"URL": "not a url",
+	}).Status(http.StatusBadRequest)
+	NewEnv().SetUID(String("fake")).PutRoute(game.UpdatePhaseWebhookRoute).RouteParams("game_id", gameID).Body(map[string]interface{}{
+		"URL": "https://example.com/hook",
+	}).Status(http.StatusForbidden)
+
+	secret := creator.PutRoute(game.UpdatePhaseWebhookRoute).RouteParams("game_id", gameID).Body(map[string]interface{}{
+		"URL": "https://example.com/hook",
+	}).Success().
+		AssertEq("https://example.com/hook", "Properties", "URL").
+		GetValue("Properties", "Secret").(string)
+	if secret == "" {
+		t.Errorf("Got no secret, wanted one")
+	}
+	creator.PutRoute(game.UpdatePhaseWebhookRoute).RouteParams("game_id", gameID).Body(map[string]interface{}{
+		"URL": "https://example.com/other-hook",
+	}).Success().
+		AssertEq(secret, "Properties", "Secret")
+	creator.GetRoute(game.PhaseWebhookRoute).RouteParams("game_id", gameID).Success().
+		AssertEq("https://example.com/other-hook", "Properties", "URL")
+	NewEnv().SetUID(String("fake")).GetRoute(game.PhaseWebhookRoute).RouteParams("game_id", gameID).Status(http.StatusForbidden)
+
+	creator.DeleteRoute(game.DeletePhaseWebhookRoute).RouteParams("game_id", gameID).Success()
+	creator.GetRoute(game.PhaseWebhookRoute).RouteParams("game_id", gameID).Status(http.StatusNotFound)
+}
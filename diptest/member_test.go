@@ -72,6 +72,16 @@ func TestJoinLeaveGame(t *testing.T) {
 			Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
 			Follow("leave", "Links").Success()
 
+		env2.GetRoute(game.ListMyStagingGamesRoute).Success().
+			Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+			AssertEq(1.0, "Properties", "NMembers").
+			AssertLen(1, "Properties", "Members")
+
+		env1.GetRoute(game.IndexRoute).Success().
+			Follow("open-games", "Links").Success().
+			Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+			AssertRel("join", "Links")
+
 		env2.GetRoute(game.ListMyStagingGamesRoute).Success().
 			Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
 			Follow("leave", "Links").Success()
@@ -83,3 +93,43 @@ func TestJoinLeaveGame(t *testing.T) {
 			AssertNotFind(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
 	})
 }
+
+func TestKickMember(t *testing.T) {
+	gameDesc := String("test-game")
+
+	env1 := NewEnv().SetUID(String("fake"))
+	env2 := NewEnv().SetUID(String("fake"))
+
+	gameID := env1.GetRoute(game.IndexRoute).Success().
+		Follow("create-game", "Links").
+		Body(map[string]interface{}{
+			"Variant":            "Classical",
+			"Desc":               gameDesc,
+			"PhaseLengthMinutes": time.Duration(60),
+			"NoMerge":            true,
+		}).Success().
+		GetValue("Properties", "ID").(string)
+
+	env2.GetRoute(game.IndexRoute).Success().
+		Follow("open-games", "Links").Success().
+		Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+		Follow("join", "Links").Body(map[string]interface{}{}).Success()
+
+	env2.PostRoute(game.KickMemberRoute).
+		RouteParams("game_id", gameID, "user_id", env1.GetUID()).
+		Body(map[string]interface{}{}).Status(403)
+
+	env1.GetRoute(game.ListMyStagingGamesRoute).Success().
+		Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+		AssertNotRel("kick-"+env1.GetUID(), "Links").
+		Follow("kick-"+env2.GetUID(), "Links").Body(map[string]interface{}{}).Success()
+
+	WaitForEmptyQueue("game-sendKickNotification")
+
+	env2.GetRoute(game.ListMyStagingGamesRoute).Success().
+		AssertNotFind(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"})
+
+	env1.GetRoute(game.ListMyStagingGamesRoute).Success().
+		Find(gameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+		AssertEq(1.0, "Properties", "NMembers")
+}
@@ -1,6 +1,9 @@
 package diptest
 
 import (
+	"fmt"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/zond/diplicity/game"
@@ -64,6 +67,22 @@ func testOrders(t *testing.T) {
 
 		otherPlayerPhase.Follow("orders", "Links").Success().
 			AssertEmpty("Properties")
+
+		otherPlayerPhase.Follow("phase-states", "Links").Success().
+			Find(nation, []string{"Properties"}, []string{"Properties", "Nation"}).
+			AssertBoolEq(true, "Properties", "HasOrders")
+	})
+
+	t.Run("TestOptionsDiff", func(t *testing.T) {
+		ordinal := fmt.Sprint(phase.GetValue("Properties", "PhaseOrdinal"))
+		startedGameEnvs[0].GetRoute(game.GetOptionsDiffRoute).
+			RouteParams("game_id", startedGameID, "phase_ordinal", ordinal).
+			QueryParams(url.Values{"from": []string{ordinal}}).Success().
+			AssertEmpty("Properties", "Provinces")
+
+		NewEnv().SetUID(String("fake")).GetRoute(game.GetOptionsDiffRoute).
+			RouteParams("game_id", startedGameID, "phase_ordinal", ordinal).
+			QueryParams(url.Values{"from": []string{ordinal}}).Status(404)
 	})
 
 	t.Run("TestDeleteOrder", func(t *testing.T) {
@@ -81,7 +100,140 @@ func testOrders(t *testing.T) {
 			"Parts": badParts,
 		}).Failure()
 
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": []string{okParts[0], "Convoy", okParts[0], okParts[0]},
+		}).Status(400)
+
+		phase.Follow("orders", "Links").Success().
+			AssertEmpty("Properties")
+	})
+
+	t.Run("TestDislodgedConditions", func(t *testing.T) {
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": okParts,
+			"Conditions": []map[string]interface{}{
+				{"If": []string{okParts[0], game.ConditionDislodged}, "Then": []string{okParts[0], "Hold"}},
+			},
+		}).Status(400)
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": okParts,
+			"Conditions": []map[string]interface{}{
+				{"If": []string{badParts[0], game.ConditionDislodged}, "Then": []string{okParts[0], "Disband"}},
+			},
+		}).Status(400)
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": okParts,
+			"Conditions": []map[string]interface{}{
+				{"If": []string{okParts[0], game.ConditionDislodged}, "Then": []string{okParts[0], "Disband"}},
+			},
+		}).Success()
+
+		phase.Follow("orders", "Links").Success().
+			Find(nation, []string{"Properties"}, []string{"Properties", "Nation"}).
+			AssertLen(1, "Properties", "Conditions").
+			Follow("delete", "Links").Success()
+
+		phase.Follow("orders", "Links").Success().
+			AssertEmpty("Properties")
+	})
+
+	t.Run("TestReplaceOrders", func(t *testing.T) {
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": okParts,
+		}).Success()
+
+		phase.Follow("replace-orders", "Links").Body(map[string]interface{}{
+			"Orders": []map[string]interface{}{
+				{"Parts": okParts},
+				{"Parts": badParts},
+			},
+		}).Status(400)
+
+		phase.Follow("orders", "Links").Success().
+			AssertLen(1, "Properties")
+
+		phase.Follow("replace-orders", "Links").Body(map[string]interface{}{
+			"Orders": []map[string]interface{}{},
+		}).Success().
+			AssertEmpty("Properties")
+
 		phase.Follow("orders", "Links").Success().
 			AssertEmpty("Properties")
+
+		phase.Follow("replace-orders", "Links").Body(map[string]interface{}{
+			"Orders": []map[string]interface{}{
+				{"Parts": okParts},
+			},
+		}).Success().
+			AssertLen(1, "Properties")
+
+		phase.Follow("orders", "Links").Success().
+			AssertLen(1, "Properties").
+			Find(nation, []string{"Properties"}, []string{"Properties", "Nation"}).
+			Follow("delete", "Links").Success()
+
+		phase.Follow("orders", "Links").Success().
+			AssertEmpty("Properties")
+	})
+
+	t.Run("TestValidateOrders", func(t *testing.T) {
+		phase.Follow("validate-orders", "Links").Body(map[string]interface{}{
+			"Orders": []map[string]interface{}{
+				{"Parts": okParts},
+				{"Parts": badParts},
+			},
+		}).Success().
+			AssertBoolEq(true, "Properties", "Orders", "0", "Valid").
+			AssertBoolEq(false, "Properties", "Orders", "1", "Valid")
+
+		phase.Follow("orders", "Links").Success().
+			AssertEmpty("Properties")
+	})
+
+	t.Run("TestOrderConditions", func(t *testing.T) {
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": okParts,
+			"Conditions": []map[string]interface{}{
+				{"If": []string{okParts[0], "Hold"}, "Then": okParts},
+			},
+		}).Status(400)
+
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": okParts,
+			"Conditions": []map[string]interface{}{
+				{"If": []string{badParts[0], "Hold"}, "Then": okParts},
+			},
+		}).Success()
+
+		phase.Follow("orders", "Links").Success().
+			Find(nation, []string{"Properties"}, []string{"Properties", "Nation"}).
+			AssertLen(1, "Properties", "Conditions").
+			Follow("delete", "Links").Success()
+
+		phase.Follow("orders", "Links").Success().
+			AssertEmpty("Properties")
+	})
+
+	t.Run("TestOrderRevisions", func(t *testing.T) {
+		before := len(phase.Follow("order-revisions", "Links").Success().GetValue("Properties").([]interface{}))
+
+		phase.Follow("create-order", "Links").Body(map[string]interface{}{
+			"Parts": okParts,
+		}).Success()
+		phase.Follow("replace-orders", "Links").Body(map[string]interface{}{
+			"Orders": []map[string]interface{}{},
+		}).Success()
+
+		revisions := phase.Follow("order-revisions", "Links").Success().
+			AssertLen(before+2, "Properties").
+			AssertEq(strings.Join(okParts, " "), "Properties", fmt.Sprint(before), "Properties", "Orders", "0").
+			AssertEmpty("Properties", fmt.Sprint(before+1), "Properties", "Orders")
+		if first, second := revisions.GetValue("Properties", fmt.Sprint(before), "Properties", "Revision"), revisions.GetValue("Properties", fmt.Sprint(before+1), "Properties", "Revision"); first == second {
+			t.Errorf("Got revision %v twice, wanted distinct revisions", first)
+		}
+
+		startedGameEnvs[1].GetRoute(game.ListOrderRevisionsRoute).
+			RouteParams("game_id", startedGameID, "phase_ordinal", fmt.Sprint(phase.GetValue("Properties", "PhaseOrdinal"))).
+			QueryParams(url.Values{"nation": []string{nation}}).Status(403)
 	})
 }
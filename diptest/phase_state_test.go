@@ -1,6 +1,11 @@
 package diptest
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zond/diplicity/game"
+)
 
 func testPhaseState(t *testing.T) {
 	phases := make([]*Result, len(startedGameEnvs))
@@ -36,4 +41,74 @@ func testPhaseState(t *testing.T) {
 		AssertBoolEq(false, "Properties", "ReadyToResolve").
 		AssertBoolEq(false, "Properties", "WantsDIAS")
 
+	otherPhaseState := phases[1].Follow("phase-states", "Links").Success().
+		Find(startedGameNats[0], []string{"Properties"}, []string{"Properties", "Nation"}).
+		AssertBoolEq(true, "Properties", "ReadyToResolve").
+		AssertBoolEq(false, "Properties", "WantsDIAS")
+	otherPhaseState.AssertNotRel("update", "Links")
+
+	NewEnv().SetUID(String("fake")).GetRoute(game.ListPhaseStatesRoute).
+		RouteParams("game_id", startedGameID, "phase_ordinal", fmt.Sprint(phases[0].GetValue("Properties", "PhaseOrdinal"))).Success().
+		AssertLen(0, "Properties").
+		AssertEq(1.0, "ReadyToResolveCount").
+		AssertEq(float64(len(startedGameNats)), "NationCount")
+
+	t.Run("TestAllPhaseStates", func(t *testing.T) {
+		allPhaseStates := startedGames[1].Follow("all-phase-states", "Links").Success().
+			AssertLen(len(startedGameNats), "Properties")
+		allPhaseStates.Find(startedGameNats[0], []string{"Properties"}, []string{"Properties", "Nation"}).
+			AssertBoolEq(true, "Properties", "ReadyToResolve").
+			AssertBoolEq(false, "Properties", "WantsDIAS")
+		allPhaseStates.AssertNotRel("next", "Links")
+
+		NewEnv().SetUID(String("fake")).GetRoute(game.ListAllPhaseStatesRoute).
+			RouteParams("game_id", startedGameID).Success().
+			AssertLen(0, "Properties")
+	})
+
+	t.Run("TestPauseVote", func(t *testing.T) {
+		startedGameEnvs[0].GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+			AssertNotRel("resume", "Links").
+			Follow("pause", "Links").Success().
+			AssertBoolEq(false, "Properties", "Paused").
+			AssertLen(1, "Properties", "PauseVotes")
+
+		startedGameEnvs[0].PostRoute(game.ResumeGameRoute).RouteParams("game_id", startedGameID).Status(412)
+
+		NewEnv().SetUID(String("fake")).PostRoute(game.PauseGameRoute).RouteParams("game_id", startedGameID).Status(403)
+	})
+
+	t.Run("TestResignLink", func(t *testing.T) {
+		startedGameEnvs[0].GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+			AssertRel("resign", "Links")
+
+		NewEnv().SetUID(String("fake")).PostRoute(game.ResignGameRoute).RouteParams("game_id", startedGameID).Status(404)
+	})
+
+	t.Run("TestFeedbackInUnfinishedGame", func(t *testing.T) {
+		startedGameEnvs[0].GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+			AssertNotRel("feedback", "Links")
+
+		startedGameEnvs[0].PostRoute("Feedback.Create").RouteParams("game_id", startedGameID).Body(map[string]interface{}{
+			"RateeId":  startedGameEnvs[1].GetUID(),
+			"Reliable": true,
+		}).Status(412)
+	})
+
+	t.Run("TestUserGames", func(t *testing.T) {
+		startedGameEnvs[0].GetRoute(game.ListUserGamesRoute).RouteParams("user_id", startedGameEnvs[0].GetUID()).Success().
+			Find(startedGameDesc, []string{"Properties"}, []string{"Properties", "Desc"}).
+			AssertEq(game.OutcomePlaying, "Properties", "UserHistory", "Outcome").
+			AssertEq(string(startedGameNats[0]), "Properties", "UserHistory", "Nation")
+
+		startedGameEnvs[1].GetRoute(game.ListUserGamesRoute).RouteParams("user_id", startedGameEnvs[0].GetUID()).Success()
+	})
+
+	t.Run("TestSpectateWithoutAllowSpectators", func(t *testing.T) {
+		env := NewEnv().SetUID(String("fake"))
+		env.GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+			AssertNotRel("spectate", "Links")
+		env.PostRoute(game.SpectateGameRoute).RouteParams("game_id", startedGameID).Status(412)
+		env.DeleteRoute(game.StopSpectatingGameRoute).RouteParams("game_id", startedGameID).Status(404)
+	})
 }
@@ -1646,3 +1646,31 @@ func TestEliminatedNMRPlayer(t *testing.T) {
 		})
 	})
 }
+
+func TestDryRun(t *testing.T) {
+	withStartedGame(func() {
+		russia := startedGameEnvs[startedGameIdxByNat["Russia"]]
+		russiaPhase := russia.GetRoute("Game.Load").RouteParams("id", startedGameID).Success().
+			Follow("phases", "Links").Success().
+			Find("Movement", []string{"Properties"}, []string{"Properties", "Type"})
+		dryRun := russiaPhase.Follow("dry-run", "Links").Body(map[string]interface{}{
+			"Orders": []map[string]interface{}{
+				{"Parts": []string{"war", "Move", "gal"}},
+			},
+		}).Success()
+		dryRun.Find("war", []string{"Properties", "Resolutions"}, []string{"Province"}).
+			AssertEq("OK", "Resolution")
+		dryRun.Find("gal", []string{"Properties", "Phase", "Units"}, []string{"Province"}).
+			AssertEq("Russia", "Unit", "Nation")
+		russiaPhase.Follow("corroborate", "Links").Success().
+			AssertNotFind("Russia", []string{"Properties", "Orders"}, []string{"Nation"})
+		russiaPhase.Follow("dry-run", "Links").Body(map[string]interface{}{
+			"Orders": []map[string]interface{}{
+				{"Parts": []string{"lon", "Move", "nth"}},
+			},
+		}).Status(403)
+		NewEnv().SetUID(String("fake")).PostRoute(game.DryRunPhaseRoute).
+			RouteParams("game_id", startedGameID, "phase_ordinal", fmt.Sprint(russiaPhase.GetValue("Properties", "PhaseOrdinal"))).
+			Body(map[string]interface{}{}).Status(404)
+	})
+}
@@ -1,8 +1,10 @@
 package diptest
 
 import (
+	"net/url"
 	"testing"
 
+	"github.com/zond/diplicity/auth"
 	"github.com/zond/diplicity/game"
 )
 
@@ -14,7 +16,10 @@ var loggedInRels = []string{
 	"started-games",
 	"finished-games",
 	"open-games",
+	"replaceable-games",
+	"hate",
 	"create-game",
+	"calendar-token",
 }
 
 var loggedOutRels = []string{
@@ -24,6 +29,7 @@ var loggedOutRels = []string{
 var bothRels = []string{
 	"self",
 	"variants",
+	"finished-games-atom",
 }
 
 func TestRootNotLoggedIn(t *testing.T) {
@@ -58,3 +64,227 @@ func TestRootLoggedIn(t *testing.T) {
 		r.AssertRel(rel, "Links")
 	}
 }
+
+func TestCalendarToken(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	otherEnv := NewEnv().SetUID(String("fake"))
+	calendarToken := func(env *Env) string {
+		calendarURL := env.GetRoute(game.IndexRoute).Success().
+			Follow("calendar-token", "Links").Success().
+			Find("calendar", []string{"Links"}, []string{"Rel"}).GetValue("URL").(string)
+		tokenURL, err := url.Parse(calendarURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenURL.Query().Get("t")
+	}
+	calendar := func(token string) *Req {
+		return NewEnv().GetRoute(game.CalendarRoute).RouteParams("user_id", env.GetUID()).
+			QueryParams(url.Values{"t": []string{token}})
+	}
+
+	token := calendarToken(env)
+	if again := calendarToken(env); again != token {
+		t.Errorf("Got calendar token %q, wanted the same token %q as before", again, token)
+	}
+	calendar(calendarToken(otherEnv)).Status(403)
+	calendar("not-a-token").Status(403)
+
+	env.GetRoute(game.IndexRoute).Success().
+		Follow("calendar-token", "Links").Success().
+		Follow("rotate", "Links").Success()
+	calendar(token).Status(403)
+	if rotated := calendarToken(env); rotated == token {
+		t.Errorf("Got the same calendar token %q after rotating it", rotated)
+	}
+
+	otherEnv.GetRoute(game.GetCalendarTokenRoute).RouteParams("user_id", env.GetUID()).Status(403)
+}
+
+func TestConfigureInvalidSendGridFromAddress(t *testing.T) {
+	NewEnv().PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"SendGrid": map[string]interface{}{
+			"APIKey":      "fake-key",
+			"FromName":    "Diplicity",
+			"FromAddress": "not an address",
+		},
+	}).Status(400)
+}
+
+func TestConfigureInvalidWebPushKeys(t *testing.T) {
+	NewEnv().PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"WebPush": map[string]interface{}{
+			"PublicKey":  "not a key",
+			"PrivateKey": "not a key",
+			"Subject":    "mailto:admin@example.com",
+		},
+	}).Status(400)
+}
+
+func TestConfigureCORS(t *testing.T) {
+	cors := map[string]interface{}{
+		"CORS": map[string]interface{}{
+			"AllowedOrigins": []string{"https://diplicity.com"},
+		},
+	}
+	NewEnv().PostRoute(game.ConfigureRoute).Body(cors).Status(401)
+	NewEnv().SetUID(String("fake")).PostRoute(game.ConfigureRoute).Body(cors).Status(403)
+	// Only dry runs, since configuring CORS would restrict the other tests.
+	dryRun := url.Values{"dryRun": []string{"true"}}
+	NewSuperuserEnv().PostRoute(game.ConfigureRoute).QueryParams(dryRun).Body(cors).Success().
+		AssertEq("would be configured", "Properties", "CORS")
+}
+
+// The configuration tests only use the Superusers section, which NewSuperuserEnv makes sure is configured,
+// and the GamePresets section, which can be replaced, so that they don't configure anything for the other tests.
+func TestConfigureIsAtomic(t *testing.T) {
+	presetName := String("preset")
+	superuser := NewSuperuserEnv()
+	superuser.PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"GamePresets": []map[string]interface{}{
+			{
+				"Name":               presetName,
+				"Variant":            "Classical",
+				"PhaseLengthMinutes": 60,
+			},
+		},
+		"Superusers": map[string]interface{}{
+			"UserIds": superuser.GetUID(),
+		},
+	}).Status(400)
+	// The presets are stored before the superusers, so they would be found if the failing request stored them.
+	superuser.GetRoute(game.ListGamePresetsRoute).Success().
+		AssertNotFind(presetName, []string{"Properties"}, []string{"Name"})
+}
+
+func TestConfigureDryRun(t *testing.T) {
+	dryRun := url.Values{"dryRun": []string{"true"}}
+	superuser := NewSuperuserEnv()
+	superuser.PostRoute(game.ConfigureRoute).QueryParams(dryRun).Body(map[string]interface{}{
+		"GamePresets": []map[string]interface{}{
+			{
+				"Name":               String("preset"),
+				"Variant":            "not a variant",
+				"PhaseLengthMinutes": 60,
+			},
+		},
+	}).Status(400)
+	presets := []map[string]interface{}{
+		{
+			"Name":               String("preset"),
+			"Variant":            "Classical",
+			"PhaseLengthMinutes": 60,
+		},
+	}
+	for i := 0; i < 2; i++ {
+		superuser.PostRoute(game.ConfigureRoute).QueryParams(dryRun).Body(map[string]interface{}{
+			"GamePresets": presets,
+			"Superusers": map[string]interface{}{
+				"UserIds": superuser.GetUID(),
+			},
+		}).Success().
+			AssertEq("would create 1 and replace 0 presets", "Properties", "GamePresets").
+			AssertEq("already configured, would fail", "Properties", "Superusers")
+	}
+}
+
+func TestGamePresets(t *testing.T) {
+	presetName := String("preset")
+	NewEnv().PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"GamePresets": []map[string]interface{}{},
+	}).Status(401)
+	NewEnv().SetUID(String("fake")).PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"GamePresets": []map[string]interface{}{},
+	}).Status(403)
+	superuser := NewSuperuserEnv()
+	superuser.PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"GamePresets": []map[string]interface{}{
+			{
+				"Name":               presetName,
+				"Variant":            "not a variant",
+				"PhaseLengthMinutes": 60,
+			},
+		},
+	}).Status(400)
+	superuser.PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"GamePresets": []map[string]interface{}{
+			{
+				"Name":               presetName,
+				"Variant":            "Classical",
+				"PhaseLengthMinutes": 60,
+				"NationAllocation":   7,
+			},
+		},
+	}).Status(400)
+	superuser.PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"GamePresets": []map[string]interface{}{
+			{
+				"Name":                  presetName,
+				"Variant":               "Classical",
+				"PhaseLengthMinutes":    15,
+				"DisableConferenceChat": true,
+				"DisableGroupChat":      true,
+				"DisablePrivateChat":    true,
+			},
+		},
+	}).Success()
+
+	env := NewEnv().SetUID(String("fake"))
+	env.GetRoute(game.ListGamePresetsRoute).Success().
+		Find(presetName, []string{"Properties"}, []string{"Name"})
+
+	gameDesc := String("test-game")
+	env.PostRoute("Game.Create").QueryParams(url.Values{"preset": []string{presetName}}).Body(map[string]interface{}{
+		"Desc":               gameDesc,
+		"NoMerge":            true,
+		"PhaseLengthMinutes": 30,
+	}).Success().
+		AssertEq("Classical", "Properties", "Variant").
+		AssertEq(30.0, "Properties", "PhaseLengthMinutes").
+		AssertEq(true, "Properties", "DisablePrivateChat")
+	env.PostRoute("Game.Create").QueryParams(url.Values{"preset": []string{String("missing")}}).Body(map[string]interface{}{
+		"Desc": gameDesc,
+	}).Status(404)
+}
+
+func TestSendAnnouncement(t *testing.T) {
+	NewEnv().PostRoute(game.SendAnnouncementRoute).Body(map[string]interface{}{}).Status(401)
+	NewEnv().SetUID(String("fake")).PostRoute(game.SendAnnouncementRoute).Body(map[string]interface{}{}).Status(400)
+}
+
+func TestAPIKeys(t *testing.T) {
+	key := auth.APIKeyPrefix + String("0123456789abcdef0123456789abcdef")
+	NewEnv().SetUID(String("fake")).PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"APIKeys": []map[string]interface{}{
+			{
+				"Name": String("api-key"),
+				"Key":  key,
+			},
+		},
+	}).Status(403)
+	superuser := NewSuperuserEnv()
+	superuser.PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"APIKeys": []map[string]interface{}{
+			{
+				"Name": String("api-key"),
+				"Key":  String("too-short"),
+			},
+		},
+	}).Status(400)
+	superuser.PostRoute(game.ConfigureRoute).Body(map[string]interface{}{
+		"APIKeys": []map[string]interface{}{
+			{
+				"Name": String("api-key"),
+				"Key":  key,
+			},
+		},
+	}).Success()
+
+	env := NewEnv().SetBearer(key)
+	env.GetRoute(game.ListOpenGamesRoute).Success()
+	env.GetRoute(game.ListTopRatedPlayersRoute).Success()
+	env.GetRoute(game.ListMyStartedGamesRoute).Status(403)
+
+	NewEnv().SetBearer(auth.APIKeyPrefix + String("0123456789abcdef0123456789abcdef")).
+		GetRoute(game.ListOpenGamesRoute).Status(401)
+}
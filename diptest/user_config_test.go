@@ -78,3 +78,69 @@ func TestUserConfig(t *testing.T) {
 		AssertEq(tokens, "Properties", "FCMTokens")
 
 }
+
+func TestNotificationPreferences(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	env.GetRoute(game.IndexRoute).Success().
+		Follow("user-config", "Links").Success().
+		AssertEq(false, "Properties", "NotificationPreferences", "MutePhaseStarted").
+		AssertEq(false, "Properties", "NotificationPreferences", "MuteNewMessage")
+
+	preferences := map[string]interface{}{
+		"MutePhaseStarted":      false,
+		"MutePhaseResolved":     true,
+		"MuteNewMessage":        true,
+		"MuteGameFinished":      false,
+		"MuteDeadlineReminders": true,
+	}
+	env.GetRoute(game.IndexRoute).Success().
+		Follow("user-config", "Links").Success().
+		Follow("update", "Links").Body(map[string]interface{}{
+		"NotificationPreferences": preferences,
+	}).Success().AssertEq(preferences, "Properties", "NotificationPreferences")
+	env.GetRoute(game.IndexRoute).Success().
+		Follow("user-config", "Links").Success().
+		AssertEq(preferences, "Properties", "NotificationPreferences")
+}
+
+func TestAddAndRemoveFCMTokens(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	phone := String("phone-token")
+	tablet := String("tablet-token")
+
+	env.PostRoute(auth.AddFCMTokenRoute).RouteParams("user_id", env.GetUID()).Body(map[string]interface{}{
+		"Value": phone,
+		"App":   "phone",
+	}).Success().
+		AssertLen(1, "Properties", "FCMTokens")
+	env.PostRoute(auth.AddFCMTokenRoute).RouteParams("user_id", env.GetUID()).Body(map[string]interface{}{
+		"Value": tablet,
+		"App":   "tablet",
+	}).Success().
+		AssertLen(2, "Properties", "FCMTokens")
+	env.PostRoute(auth.AddFCMTokenRoute).RouteParams("user_id", env.GetUID()).Body(map[string]interface{}{
+		"Value": phone,
+		"App":   "new-phone",
+	}).Success().
+		AssertLen(2, "Properties", "FCMTokens").
+		AssertEq("new-phone", "Properties", "FCMTokens", "0", "App")
+	env.PostRoute(auth.AddFCMTokenRoute).RouteParams("user_id", env.GetUID()).Body(map[string]interface{}{
+		"App": "empty",
+	}).Status(400)
+
+	env2 := NewEnv().SetUID(String("fake"))
+	env2.PostRoute(auth.AddFCMTokenRoute).RouteParams("user_id", env.GetUID()).Body(map[string]interface{}{
+		"Value": String("intruder-token"),
+	}).Status(403)
+	env2.DeleteRoute(auth.RemoveFCMTokenRoute).RouteParams("user_id", env.GetUID(), "token_value", phone).Status(403)
+
+	env.DeleteRoute(auth.RemoveFCMTokenRoute).RouteParams("user_id", env.GetUID(), "token_value", phone).Success().
+		AssertLen(1, "Properties", "FCMTokens").
+		AssertEq(tablet, "Properties", "FCMTokens", "0", "Value")
+	env.DeleteRoute(auth.RemoveFCMTokenRoute).RouteParams("user_id", env.GetUID(), "token_value", phone).Success().
+		AssertLen(1, "Properties", "FCMTokens")
+	env.GetRoute(game.IndexRoute).Success().
+		Follow("user-config", "Links").Success().
+		AssertLen(1, "Properties", "FCMTokens").
+		AssertEq(tablet, "Properties", "FCMTokens", "0", "Value")
+}
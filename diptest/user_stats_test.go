@@ -1,6 +1,7 @@
 package diptest
 
 import (
+	"net/url"
 	"testing"
 
 	"github.com/zond/diplicity/game"
@@ -12,5 +13,80 @@ func TestUserStatsLists(t *testing.T) {
 	env.GetRoute(game.ListTopReliablePlayersRoute).Success()
 	env.GetRoute(game.ListTopHatedPlayersRoute).Success()
 	env.GetRoute(game.ListTopHaterPlayersRoute).Success()
+	env.GetRoute(game.ListTopNetHatedPlayersRoute).Success()
 	env.GetRoute(game.ListTopQuickPlayersRoute).Success()
 }
+
+func TestUserRank(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	for _, stat := range []string{"rating", "reliability", "hated", "hater", "net-hate", "quickness"} {
+		env.GetRoute(game.GetUserRankRoute).RouteParams("user_id", env.GetUID(), "stat", stat).Success().
+			AssertEq(stat, "Properties", "Stat")
+	}
+	env.GetRoute(game.GetUserRankRoute).RouteParams("user_id", env.GetUID(), "stat", "blapp").Failure()
+
+	// Like the top quick players list, quickness ranks only count players with response samples.
+	quicknessTotal := env.GetRoute(game.GetUserRankRoute).RouteParams("user_id", env.GetUID(), "stat", "quickness").Success().
+		GetValue("Properties", "Total").(float64)
+	ratingTotal := env.GetRoute(game.GetUserRankRoute).RouteParams("user_id", env.GetUID(), "stat", "rating").Success().
+		GetValue("Properties", "Total").(float64)
+	if quicknessTotal > ratingTotal {
+		t.Errorf("Got quickness total %v, wanted at most the rating total %v", quicknessTotal, ratingTotal)
+	}
+}
+
+func TestEmptyReliabilityHistory(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	env.GetRoute("UserStats.Load").RouteParams("user_id", env.GetUID()).Success().
+		AssertLen(0, "Properties", "ReliabilityHistory")
+}
+
+func TestUserStatsBackwardPaging(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	firstPage := env.GetRoute(game.ListTopReliablePlayersRoute).
+		QueryParams(url.Values{"limit": []string{"1"}}).Success().
+		AssertLen(1, "Properties").
+		AssertBoolEq(true, "HasMore").
+		AssertEq(1.0, "Limit").
+		AssertNotRel("prev", "Links")
+	secondPage := firstPage.Follow("next", "Links").Success().
+		AssertRel("prev", "Links")
+	secondPage.Follow("prev", "Links").Success().
+		AssertLen(1, "Properties").
+		AssertEq(firstPage.GetValue("Properties", "0", "Properties", "UserId"), "Properties", "0", "Properties", "UserId")
+
+	env.GetRoute(game.SearchGamesRoute).
+		QueryParams(url.Values{"q": []string{"blapp"}, "direction": []string{"backward"}}).Status(400)
+}
+
+func TestEmptyRatingHistory(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	env.GetRoute("UserStats.Load").RouteParams("user_id", env.GetUID()).Success().
+		Follow("rating-history", "Links").Success().
+		AssertEmpty("Properties")
+}
+
+func TestEmptyQuickness(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	env.GetRoute("UserStats.Load").RouteParams("user_id", env.GetUID()).Success().
+		Follow("quickness", "Links").Success().
+		AssertEq(0.0, "Properties", "SampleCount").
+		AssertEmpty("Properties", "PhaseTypes")
+}
+
+func TestHeadToHeadWithoutSharedGames(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	env.GetRoute(game.GetHeadToHeadRoute).RouteParams("user_id", env.GetUID(), "other_user_id", String("fake")).Success().
+		AssertEq(0.0, "Properties", "SharedGames").
+		AssertEq(0.0, "Properties", "Ahead").
+		AssertEq(0.0, "Properties", "Behind")
+}
+
+func TestHate(t *testing.T) {
+	env := NewEnv().SetUID(String("fake"))
+	env.GetRoute(game.IndexRoute).Success().
+		Follow("hate", "Links").Success().
+		AssertEmpty("Properties", "HatedBy").
+		AssertEmpty("Properties", "Hates")
+	env.GetRoute(game.GetHateRoute).RouteParams("user_id", String("fake")).Status(403)
+}
@@ -0,0 +1,297 @@
+package game
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	attachmentConfKind = "AttachmentConf"
+	storageHost        = "storage.googleapis.com"
+	// How long signed upload and download URLs are valid.
+	attachmentURLTTL = time.Hour
+	// Attachments larger than this are rejected, both when requesting upload URLs and by Cloud Storage when uploading.
+	maxAttachmentSize = 5 * 1024 * 1024
+)
+
+var (
+	prodAttachmentConf = &confCache{}
+
+	allowedAttachmentContentTypes = map[string]bool{
+		"image/png":  true,
+		"image/jpeg": true,
+		"image/gif":  true,
+		"image/webp": true,
+	}
+)
+
+// AttachmentConf defines where message attachments are stored.
+// The service account of the app must be able to sign blobs and to read and create objects in the bucket.
+type AttachmentConf struct {
+	Bucket string
+}
+
+func (a *AttachmentConf) Validate() error {
+	if a.Bucket == "" {
+		return fmt.Errorf("Bucket must be set")
+	}
+	return nil
+}
+
+func getAttachmentConfKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, attachmentConfKind, prodKey, 0, nil)
+}
+
+// SetAttachment creates or replaces the Attachment configuration. Must be called inside a transaction.
+func SetAttachment(ctx context.Context, attachmentConf *AttachmentConf) error {
+	if _, err := datastore.Put(ctx, getAttachmentConfKey(ctx), attachmentConf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getAttachmentConf(ctx context.Context) (*AttachmentConf, error) {
+	conf, err := prodAttachmentConf.get(ctx, getAttachmentConfKey(ctx), &AttachmentConf{})
+	if err != nil {
+		return nil, err
+	}
+	return conf.(*AttachmentConf), nil
+}
+
+type Attachment struct {
+	ObjectName  string `methods:"POST"`
+	ContentType string `methods:"POST"`
+	Size        int64  `methods:"POST"`
+	// URL is a signed download URL, only populated for channel members.
+	URL string `datastore:"-"`
+}
+
+// AttachmentUpload is what a client needs to upload an attachment to Cloud Storage.
+// The upload must be a PUT to UploadURL with exactly the given Headers.
+type AttachmentUpload struct {
+	ObjectName  string
+	ContentType string
+	Size        int64
+	UploadURL   string
+	Headers     map[string]string
+}
+
+func (a *AttachmentUpload) Item(r Request) *Item {
+	return NewItem(a).SetName("attachment-upload").SetDesc([][]string{
+		[]string{
+			"Uploading",
+			fmt.Sprintf("PUT the attachment to the UploadURL within %v, with the Headers. The URL only accepts the declared content type and at most the declared size.", attachmentURLTTL),
+		},
+		[]string{
+			"Attaching",
+			"Add the ObjectName, ContentType and Size to the Attachments of a message created in the same channel.",
+		},
+	})
+}
+
+// attachmentPrefix returns the prefix of all attachment objects of the channel.
+func attachmentPrefix(gameID *datastore.Key, channelMembers Nations) string {
+	sortedMembers := append(Nations{}, channelMembers...)
+	sort.Sort(sortedMembers)
+	return fmt.Sprintf("attachments/%s/%s/", gameID.Encode(), sortedMembers.String())
+}
+
+func validateAttachmentType(contentType string, size int64) error {
+	if !allowedAttachmentContentTypes[contentType] {
+		return HTTPErr{fmt.Sprintf("content type %q not allowed, only images are", contentType), http.StatusBadRequest}
+	}
+	if size < 1 || size > maxAttachmentSize {
+		return HTTPErr{fmt.Sprintf("size must be between 1 and %d bytes", maxAttachmentSize), http.StatusBadRequest}
+	}
+	return nil
+}
+
+// validateAttachments makes sure the attachments of the message are allowed, and were uploaded to the channel of the message.
+func validateAttachments(message *Message) error {
+	prefix := attachmentPrefix(message.GameID, message.ChannelMembers)
+	for _, attachment := range message.Attachments {
+		if !strings.HasPrefix(attachment.ObjectName, prefix) || strings.Contains(attachment.ObjectName[len(prefix):], "/") {
+			return HTTPErr{fmt.Sprintf("attachment %q doesn't belong to this channel", attachment.ObjectName), http.StatusBadRequest}
+		}
+		if err := validateAttachmentType(attachment.ContentType, attachment.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storageEscape percent encodes s according to RFC 3986, leaving slashes unless escapeSlash.
+func storageEscape(s string, escapeSlash bool) string {
+	buf := &strings.Builder{}
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '.' || b == '_' || b == '~' || (b == '/' && !escapeSlash) {
+			buf.WriteByte(b)
+		} else {
+			fmt.Fprintf(buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+// storageSignedURL returns a Cloud Storage V4 signed URL for the object, signed by serviceAccount using sign.
+// headers, apart from host, must be sent with the request when using the URL.
+func storageSignedURL(serviceAccount string, sign func([]byte) ([]byte, error), method, bucket, objectName string, headers map[string]string, now time.Time, ttl time.Duration) (string, error) {
+	now = now.UTC()
+	datetime := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/auto/storage/goog4_request", now.Format("20060102"))
+
+	canonicalHeaders := map[string]string{"host": storageHost}
+	for name, value := range headers {
+		canonicalHeaders[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+	headerNames := make([]string, 0, len(canonicalHeaders))
+	for name := range canonicalHeaders {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	signedHeaders := strings.Join(headerNames, ";")
+
+	query := map[string]string{
+		"X-Goog-Algorithm":     "GOOG4-RSA-SHA256",
+		"X-Goog-Credential":    serviceAccount + "/" + scope,
+		"X-Goog-Date":          datetime,
+		"X-Goog-Expires":       fmt.Sprint(int(ttl / time.Second)),
+		"X-Goog-SignedHeaders": signedHeaders,
+	}
+	queryNames := make([]string, 0, len(query))
+	for name := range query {
+		queryNames = append(queryNames, name)
+	}
+	sort.Strings(queryNames)
+	queryParts := make([]string, len(queryNames))
+	for i, name := range queryNames {
+		queryParts[i] = storageEscape(name, true) + "=" + storageEscape(query[name], true)
+	}
+	canonicalQuery := strings.Join(queryParts, "&")
+
+	path := "/" + bucket + "/" + storageEscape(objectName, false)
+	canonicalRequest := &strings.Builder{}
+	fmt.Fprintf(canonicalRequest, "%s\n%s\n%s\n", method, path, canonicalQuery)
+	for _, name := range headerNames {
+		fmt.Fprintf(canonicalRequest, "%s:%s\n", name, canonicalHeaders[name])
+	}
+	fmt.Fprintf(canonicalRequest, "\n%s\nUNSIGNED-PAYLOAD", signedHeaders)
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest.String()))
+	stringToSign := fmt.Sprintf("GOOG4-RSA-SHA256\n%s\n%s\n%s", datetime, scope, hex.EncodeToString(requestHash[:]))
+	signature, err := sign([]byte(stringToSign))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("https://%s%s?%s&X-Goog-Signature=%s", storageHost, path, canonicalQuery, hex.EncodeToString(signature)), nil
+}
+
+func appengineStorageSignedURL(ctx context.Context, method, bucket, objectName string, headers map[string]string) (string, error) {
+	serviceAccount, err := appengine.ServiceAccount(ctx)
+	if err != nil {
+		return "", err
+	}
+	return storageSignedURL(serviceAccount, func(b []byte) ([]byte, error) {
+		_, signature, err := appengine.SignBytes(ctx, b)
+		return signature, err
+	}, method, bucket, objectName, headers, time.Now(), attachmentURLTTL)
+}
+
+// signAttachmentURLs populates the download URLs of the attachments of the messages.
+func signAttachmentURLs(ctx context.Context, messages Messages) error {
+	var conf *AttachmentConf
+	for msgIdx := range messages {
+		for attIdx := range messages[msgIdx].Attachments {
+			if conf == nil {
+				var err error
+				if conf, err = getAttachmentConf(ctx); err != nil {
+					return err
+				}
+			}
+			attachment := &messages[msgIdx].Attachments[attIdx]
+			downloadURL, err := appengineStorageSignedURL(ctx, "GET", conf.Bucket, attachment.ObjectName, nil)
+			if err != nil {
+				return err
+			}
+			attachment.URL = downloadURL
+		}
+	}
+	return nil
+}
+
+/*
+ * createAttachmentUpload returns a signed URL that a channel member can upload one image attachment to.
+ */
+func createAttachmentUpload(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	channelMembers := Nations{}
+	channelMembers.FromString(r.Vars()["channel_members"])
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return err
+	}
+	game.ID = gameID
+
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if !isMember || !game.Started || !game.Mustered || !channelMembers.Includes(member.Nation) {
+		return HTTPErr{"can only upload attachments to member channels", http.StatusForbidden}
+	}
+
+	upload := &AttachmentUpload{}
+	if err := json.NewDecoder(r.Req().Body).Decode(upload); err != nil {
+		return HTTPErr{fmt.Sprintf("unable to parse upload: %v", err), http.StatusBadRequest}
+	}
+	if err := validateAttachmentType(upload.ContentType, upload.Size); err != nil {
+		return err
+	}
+
+	conf, err := getAttachmentConf(ctx)
+	if err == datastore.ErrNoSuchEntity {
+		return HTTPErr{"attachments not configured", http.StatusPreconditionFailed}
+	} else if err != nil {
+		return err
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	upload.ObjectName = attachmentPrefix(gameID, channelMembers) + hex.EncodeToString(random)
+	upload.Headers = map[string]string{
+		"Content-Type":                upload.ContentType,
+		"X-Goog-Content-Length-Range": fmt.Sprintf("0,%d", upload.Size),
+	}
+	if upload.UploadURL, err = appengineStorageSignedURL(ctx, "PUT", conf.Bucket, upload.ObjectName, upload.Headers); err != nil {
+		return err
+	}
+
+	w.SetContent(upload.Item(r))
+	return nil
+}
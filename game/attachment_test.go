@@ -0,0 +1,82 @@
+package game
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStorageEscape(t *testing.T) {
+	for _, tc := range []struct {
+		s           string
+		escapeSlash bool
+		want        string
+	}{
+		{"attachments/a b/Austria,France", false, "attachments/a%20b/Austria%2CFrance"},
+		{"user@example.com/20200101/auto", true, "user%40example.com%2F20200101%2Fauto"},
+		{"A-z_0.9~", true, "A-z_0.9~"},
+	} {
+		if got := storageEscape(tc.s, tc.escapeSlash); got != tc.want {
+			t.Errorf("Got %q for %q, wanted %q", got, tc.s, tc.want)
+		}
+	}
+}
+
+func TestStorageSignedURL(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var signed []byte
+	signedURL, err := storageSignedURL("app@example.com", func(b []byte) ([]byte, error) {
+		signed = b
+		return []byte{0xab, 0xcd}, nil
+	}, "PUT", "bucket", "attachments/game/Austria,France/obj", map[string]string{
+		"Content-Type": "image/png",
+	}, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCanonicalRequest := strings.Join([]string{
+		"PUT",
+		"/bucket/attachments/game/Austria%2CFrance/obj",
+		"X-Goog-Algorithm=GOOG4-RSA-SHA256&X-Goog-Credential=app%40example.com%2F20200102%2Fauto%2Fstorage%2Fgoog4_request&X-Goog-Date=20200102T030405Z&X-Goog-Expires=3600&X-Goog-SignedHeaders=content-type%3Bhost",
+		"content-type:image/png",
+		"host:storage.googleapis.com",
+		"",
+		"content-type;host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(wantCanonicalRequest))
+	wantSigned := "GOOG4-RSA-SHA256\n20200102T030405Z\n20200102/auto/storage/goog4_request\n" + hex.EncodeToString(hash[:])
+	if string(signed) != wantSigned {
+		t.Errorf("Got string to sign %q, wanted %q", signed, wantSigned)
+	}
+
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Host != storageHost || parsed.EscapedPath() != "/bucket/attachments/game/Austria%2CFrance/obj" {
+		t.Errorf("Got %q, wanted a URL to the object", signedURL)
+	}
+	if sig := parsed.Query().Get("X-Goog-Signature"); sig != "abcd" {
+		t.Errorf("Got signature %q, wanted the hex encoded signature", sig)
+	}
+}
+
+func TestValidateAttachmentType(t *testing.T) {
+	if err := validateAttachmentType("image/png", 1024); err != nil {
+		t.Errorf("Got %v for a small png, wanted no error", err)
+	}
+	if err := validateAttachmentType("application/pdf", 1024); err == nil {
+		t.Errorf("Got no error for a pdf, wanted one")
+	}
+	if err := validateAttachmentType("image/png", maxAttachmentSize+1); err == nil {
+		t.Errorf("Got no error for a too large png, wanted one")
+	}
+	if err := validateAttachmentType("image/png", 0); err == nil {
+		t.Errorf("Got no error for an empty png, wanted one")
+	}
+}
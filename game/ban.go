@@ -3,8 +3,11 @@ package game
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zond/diplicity/auth"
 	"golang.org/x/net/context"
@@ -16,6 +19,8 @@ import (
 
 const (
 	banKind = "Ban"
+	// How many games can be given as the reason for a ban by each owner.
+	maxBanGameIDs = 8
 )
 
 var BanResource *Resource
@@ -39,7 +44,49 @@ func init() {
 
 type Bans []Ban
 
-func (b Bans) Item(r Request, userId string) *Item {
+// isSuperuser returns whether the user with userId is a superuser. There are no superusers until they are configured.
+func isSuperuser(ctx context.Context, userId string) (bool, error) {
+	superusers, err := auth.GetSuperusers(ctx)
+	if err == datastore.ErrNoSuchEntity {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return superusers.Includes(userId), nil
+}
+
+// requireSelfOrSuperuser returns a 403 with msg unless user is the user with userId or a superuser.
+func requireSelfOrSuperuser(ctx context.Context, user *auth.User, userId string, msg string) error {
+	if userId == user.Id {
+		return nil
+	}
+	superuser, err := isSuperuser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if !superuser {
+		return HTTPErr{msg, http.StatusForbidden}
+	}
+	return nil
+}
+
+// requireSuperuser returns a 401 unless the request is authenticated, and a 403 with msg unless the user is a superuser.
+func requireSuperuser(ctx context.Context, r Request, msg string) error {
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+	superuser, err := isSuperuser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if !superuser {
+		return HTTPErr{msg, http.StatusForbidden}
+	}
+	return nil
+}
+
+func (b Bans) Item(r Request, userId string, cursor string, limit int) *Item {
 	banItems := make(List, len(b))
 	for i := range b {
 		banItems[i] = b[i].Item(r)
@@ -48,12 +95,40 @@ func (b Bans) Item(r Request, userId string) *Item {
 		Rel:         "self",
 		Route:       ListBansRoute,
 		RouteParams: []string{"user_id", userId},
-	})).AddLink(r.NewLink(BanResource.Link("create", Create, []string{"user_id", userId}))).SetDesc([][]string{
+	})).SetDesc([][]string{
 		[]string{
 			"Bans",
 			"Bans prevent players from seeing or joining each others games. If you never want to risk playing with a given user again, create a ban with both your IDs.",
+			fmt.Sprintf("To remember why, add the IDs of up to %d games you played with the user as 'GameIDs' when creating the ban.", maxBanGameIDs),
+		},
+		[]string{
+			"Lifting bans",
+			"If both users of a ban want to play together again, they can both use the 'lift' link of the ban. When both have done so, the ban is removed.",
+		},
+		[]string{
+			"Cursor and limit",
+			fmt.Sprintf("The list contains at most %d bans.", maxLimit),
+			"If there are more bans, a 'next' link will be available with a 'cursor' query parameter.",
+			fmt.Sprintf("To list fewer than %d bans, add an explicit 'limit' query parameter.", maxLimit),
 		},
 	})
+	if user, ok := r.Values()["user"].(*auth.User); ok && user.Id == userId {
+		bansItem.AddLink(r.NewLink(BanResource.Link("create", Create, []string{"user_id", userId})))
+	}
+	if cursor != "" {
+		next := url.Values{}
+		for k, v := range r.Req().URL.Query() {
+			next[k] = v
+		}
+		next.Set("cursor", cursor)
+		next.Set("limit", fmt.Sprint(limit))
+		bansItem.AddLink(r.NewLink(Link{
+			Rel:         "next",
+			Route:       ListBansRoute,
+			RouteParams: []string{"user_id", userId},
+			QueryParams: next,
+		}))
+	}
 	return bansItem
 }
 
@@ -61,6 +136,11 @@ type Ban struct {
 	UserIds  []string `methods:"POST"`
 	OwnerIds []string
 	Users    []auth.User
+	// GameIDs are the games the owners shared with the banned user, given as reasons for the ban.
+	GameIDs   []*datastore.Key `methods:"POST"`
+	CreatedAt time.Time
+	// LiftIds are the users willing to lift the ban. When both users are, the ban is removed.
+	LiftIds []string
 }
 
 func (b *Ban) OwnedBy(uid string) bool {
@@ -72,21 +152,40 @@ func (b *Ban) OwnedBy(uid string) bool {
 	return false
 }
 
+func (b *Ban) WillingToLift(uid string) bool {
+	for _, liftId := range b.LiftIds {
+		if liftId == uid {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *Ban) Item(r Request) *Item {
 	user := r.Values()["user"].(*auth.User)
 
 	banItem := NewItem(b)
-	if b.OwnedBy(user.Id) {
-		bannedId := ""
-		for _, userId := range b.UserIds {
-			if userId != user.Id {
-				bannedId = userId
-				break
-			}
+	isUser := false
+	bannedId := ""
+	for _, userId := range b.UserIds {
+		if userId == user.Id {
+			isUser = true
+		} else {
+			bannedId = userId
 		}
+	}
+	if b.OwnedBy(user.Id) {
 		banItem.AddLink(r.NewLink(BanResource.Link("unsign", Delete, []string{"user_id", user.Id, "banned_id", bannedId})))
 		banItem.AddLink(r.NewLink(BanResource.Link("self", Load, []string{"user_id", user.Id, "banned_id", bannedId})))
 	}
+	if isUser && !b.WillingToLift(user.Id) {
+		banItem.AddLink(r.NewLink(Link{
+			Rel:         "lift",
+			Method:      "POST",
+			Route:       LiftBanRoute,
+			RouteParams: []string{"user_id", user.Id, "banned_id", bannedId},
+		}))
+	}
 	return banItem
 }
 
@@ -188,7 +287,11 @@ func deleteBan(w ResponseWriter, r Request) (*Ban, error) {
 	return ban, nil
 }
 
-func listBans(w ResponseWriter, r Request) error {
+/*
+ * liftBan marks the requesting user as willing to lift a ban they are part of,
+ * and removes the ban if the other user is willing as well.
+ */
+func liftBan(w ResponseWriter, r Request) error {
 	ctx := appengine.NewContext(r.Req())
 
 	user, ok := r.Values()["user"].(*auth.User)
@@ -197,17 +300,121 @@ func listBans(w ResponseWriter, r Request) error {
 	}
 
 	if r.Vars()["user_id"] != user.Id {
-		return HTTPErr{"can only list bans containing you", http.StatusForbidden}
+		return HTTPErr{"can only lift bans containing you", http.StatusForbidden}
 	}
 
-	bans := Bans{}
+	banID, err := BanID(ctx, []string{user.Id, r.Vars()["banned_id"]})
+	if err != nil {
+		return err
+	}
+
+	ban := &Ban{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		*ban = Ban{}
+		if err := datastore.Get(ctx, banID, ban); err != nil {
+			return err
+		}
+
+		if !ban.WillingToLift(user.Id) {
+			ban.LiftIds = append(ban.LiftIds, user.Id)
+		}
+
+		for _, userId := range ban.UserIds {
+			if !ban.WillingToLift(userId) {
+				return ban.Save(ctx)
+			}
+		}
 
-	if _, err := datastore.NewQuery(banKind).Filter("UserIds=", user.Id).GetAll(ctx, &bans); err != nil {
+		if err := UpdateUserStatsASAP(ctx, ban.UserIds); err != nil {
+			return err
+		}
+		return datastore.Delete(ctx, banID)
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
 		return err
 	}
 
-	w.SetContent(bans.Item(r, user.Id))
+	w.SetContent(ban.Item(r))
+	return nil
+}
 
+func listBans(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	userId := r.Vars()["user_id"]
+	if err := requireSelfOrSuperuser(ctx, user, userId, "can only list bans containing you"); err != nil {
+		return err
+	}
+
+	limit, err := strconv.ParseInt(r.Req().URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit > maxLimit || limit < 1 {
+		limit = maxLimit
+	}
+
+	q := datastore.NewQuery(banKind).Filter("UserIds=", userId)
+	if cursorParam := r.Req().URL.Query().Get("cursor"); cursorParam != "" {
+		decoded, err := datastore.DecodeCursor(cursorParam)
+		if err != nil {
+			return err
+		}
+		q = q.Start(decoded)
+	}
+
+	bans := Bans{}
+	nextCursor := ""
+	iter := q.Run(ctx)
+	for len(bans) < int(limit) {
+		ban := Ban{}
+		if _, err := iter.Next(&ban); err == datastore.Done {
+			break
+		} else if err != nil {
+			return err
+		}
+		bans = append(bans, ban)
+	}
+	if len(bans) == int(limit) {
+		cursor, err := iter.Cursor()
+		if err != nil {
+			return err
+		}
+		nextCursor = cursor.String()
+	}
+
+	w.SetContent(bans.Item(r, userId, nextCursor, int(limit)))
+
+	return nil
+}
+
+// validateBanGameIDs makes sure all games contain both banned users.
+func validateBanGameIDs(ctx context.Context, gameIDs []*datastore.Key, userIds []string) error {
+	if len(gameIDs) > maxBanGameIDs {
+		return HTTPErr{fmt.Sprintf("can only give %d games as reasons for a ban", maxBanGameIDs), http.StatusBadRequest}
+	}
+	if len(gameIDs) == 0 {
+		return nil
+	}
+	games := make(Games, len(gameIDs))
+	if err := datastore.GetMulti(ctx, gameIDs, games); err != nil {
+		if merr, ok := err.(appengine.MultiError); ok {
+			for _, err := range merr {
+				if err == datastore.ErrNoSuchEntity {
+					return HTTPErr{"can only give existing games as reasons for a ban", http.StatusBadRequest}
+				}
+			}
+		}
+		return err
+	}
+	for i := range games {
+		for _, userId := range userIds {
+			if _, isMember := games[i].GetMemberByUserId(userId); !isMember {
+				return HTTPErr{fmt.Sprintf("%v is not a member of %v", userId, gameIDs[i].Encode()), http.StatusBadRequest}
+			}
+		}
+	}
 	return nil
 }
 
@@ -237,6 +444,11 @@ func createBan(w ResponseWriter, r Request) (*Ban, error) {
 		return nil, HTTPErr{"can only create bans containing yourself", http.StatusBadRequest}
 	}
 	userIds := ban.UserIds
+	gameIDs := ban.GameIDs
+
+	if err := validateBanGameIDs(ctx, gameIDs, userIds); err != nil {
+		return nil, err
+	}
 
 	banID, err := ban.ID(ctx)
 	if err != nil {
@@ -244,13 +456,28 @@ func createBan(w ResponseWriter, r Request) (*Ban, error) {
 	}
 
 	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		*ban = Ban{}
 		if err := datastore.Get(ctx, banID, ban); err == datastore.ErrNoSuchEntity {
 			ban.UserIds = userIds
 			ban.OwnerIds = []string{user.Id}
+			ban.CreatedAt = time.Now()
 		} else if err != nil {
 			return err
 		}
 
+		for _, gameID := range gameIDs {
+			found := false
+			for _, existingID := range ban.GameIDs {
+				if existingID.Equal(gameID) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ban.GameIDs = append(ban.GameIDs, gameID)
+			}
+		}
+
 		wasOwner := false
 		for _, ownerId := range ban.OwnerIds {
 			if ownerId == user.Id {
@@ -262,6 +489,15 @@ func createBan(w ResponseWriter, r Request) (*Ban, error) {
 			ban.OwnerIds = append(ban.OwnerIds, user.Id)
 		}
 
+		// Signing a ban again means no longer being willing to lift it.
+		newLiftIds := []string{}
+		for _, liftId := range ban.LiftIds {
+			if liftId != user.Id {
+				newLiftIds = append(newLiftIds, liftId)
+			}
+		}
+		ban.LiftIds = newLiftIds
+
 		if len(ban.OwnerIds) < 1 || len(ban.OwnerIds) > 2 {
 			return fmt.Errorf("bans must have 1 or 2 owner ids")
 		}
@@ -0,0 +1,272 @@
+package game
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	calendarTokenKind  = "CalendarToken"
+	calendarTokenBytes = 32
+	icalDateFormat     = "20060102T150405Z"
+	// RFC 5545 lines should be at most 75 octets long, excluding the line break.
+	icalMaxLineLength = 75
+)
+
+// CalendarToken is the secret authenticating the deadline calendar feed of a user.
+// It's separate from other tokens of the user so that it can be rotated if it leaks.
+type CalendarToken struct {
+	UserId    string
+	Token     string `datastore:",noindex"`
+	CreatedAt time.Time
+}
+
+func (c *CalendarToken) Item(r Request) *Item {
+	return NewItem(c).SetName("calendar-token").SetDesc([][]string{
+		[]string{
+			"Calendar token",
+			"The `calendar` link is an iCalendar feed of the upcoming phase deadlines in your started games, authenticated by the token.",
+			"POST to the `rotate` link to replace the token, and stop the old feed URL from working.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       GetCalendarTokenRoute,
+		RouteParams: []string{"user_id", c.UserId},
+	})).AddLink(r.NewLink(Link{
+		Rel:         "rotate",
+		Route:       RotateCalendarTokenRoute,
+		RouteParams: []string{"user_id", c.UserId},
+		Method:      "POST",
+	})).AddLink(r.NewLink(Link{
+		Rel:         "calendar",
+		Route:       CalendarRoute,
+		RouteParams: []string{"user_id", c.UserId},
+		QueryParams: url.Values{
+			"t": []string{c.Token},
+		},
+	}))
+}
+
+func CalendarTokenID(ctx context.Context, userId string) *datastore.Key {
+	return datastore.NewKey(ctx, calendarTokenKind, "token", 0, auth.UserID(ctx, userId))
+}
+
+func newCalendarToken(userId string) (*CalendarToken, error) {
+	token := make([]byte, calendarTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	return &CalendarToken{
+		UserId:    userId,
+		Token:     base64.RawURLEncoding.EncodeToString(token),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// getCalendarToken returns the calendar token of the user, creating it if the user has none.
+func getCalendarToken(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	if r.Vars()["user_id"] != user.Id {
+		return HTTPErr{"can only see your own calendar token", http.StatusForbidden}
+	}
+
+	calendarToken := &CalendarToken{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := datastore.Get(ctx, CalendarTokenID(ctx, user.Id), calendarToken); err == nil {
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		newToken, err := newCalendarToken(user.Id)
+		if err != nil {
+			return err
+		}
+		calendarToken = newToken
+		_, err = datastore.Put(ctx, CalendarTokenID(ctx, user.Id), calendarToken)
+		return err
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return err
+	}
+
+	w.SetContent(calendarToken.Item(r))
+	return nil
+}
+
+// rotateCalendarToken replaces the calendar token of the user, invalidating the old one.
+func rotateCalendarToken(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	if r.Vars()["user_id"] != user.Id {
+		return HTTPErr{"can only rotate your own calendar token", http.StatusForbidden}
+	}
+
+	calendarToken, err := newCalendarToken(user.Id)
+	if err != nil {
+		return err
+	}
+	if _, err := datastore.Put(ctx, CalendarTokenID(ctx, user.Id), calendarToken); err != nil {
+		return err
+	}
+
+	w.SetContent(calendarToken.Item(r))
+	return nil
+}
+
+type calendarEvent struct {
+	uid         string
+	at          time.Time
+	summary     string
+	description string
+	link        string
+}
+
+// icalText escapes s to be used as an RFC 5545 TEXT value.
+func icalText(s string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+	).Replace(s)
+}
+
+// icalLine folds the content line to lines of at most icalMaxLineLength octets, without splitting UTF-8 sequences.
+func icalLine(buf *bytes.Buffer, line string) {
+	lineLength := 0
+	for _, r := range line {
+		runeLength := len(string(r))
+		if lineLength+runeLength > icalMaxLineLength {
+			buf.WriteString("\r\n ")
+			// The leading space counts towards the length of the continuation line.
+			lineLength = 1
+		}
+		buf.WriteRune(r)
+		lineLength += runeLength
+	}
+	buf.WriteString("\r\n")
+}
+
+func renderCalendar(now time.Time, events []calendarEvent) string {
+	buf := &bytes.Buffer{}
+	icalLine(buf, "BEGIN:VCALENDAR")
+	icalLine(buf, "VERSION:2.0")
+	icalLine(buf, "PRODID:-//Diplicity//Phase deadlines//EN")
+	icalLine(buf, "CALSCALE:GREGORIAN")
+	icalLine(buf, "METHOD:PUBLISH")
+	icalLine(buf, "X-WR-CALNAME:Diplicity deadlines")
+	for _, event := range events {
+		icalLine(buf, "BEGIN:VEVENT")
+		icalLine(buf, "UID:"+event.uid)
+		icalLine(buf, "DTSTAMP:"+now.UTC().Format(icalDateFormat))
+		icalLine(buf, "DTSTART:"+event.at.UTC().Format(icalDateFormat))
+		icalLine(buf, "DTEND:"+event.at.UTC().Format(icalDateFormat))
+		icalLine(buf, "SUMMARY:"+icalText(event.summary))
+		icalLine(buf, "DESCRIPTION:"+icalText(event.description))
+		if event.link != "" {
+			icalLine(buf, "URL:"+event.link)
+		}
+		icalLine(buf, "END:VEVENT")
+	}
+	icalLine(buf, "END:VCALENDAR")
+	return buf.String()
+}
+
+/*
+ * handleCalendar returns an iCalendar document with one event per upcoming deadline
+ * of the unresolved phases in the started games the user is a member of.
+ */
+func handleCalendar(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	userId := r.Vars()["user_id"]
+
+	calendarToken := &CalendarToken{}
+	if err := datastore.Get(ctx, CalendarTokenID(ctx, userId), calendarToken); err == datastore.ErrNoSuchEntity {
+		return HTTPErr{"invalid calendar token", http.StatusForbidden}
+	} else if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(calendarToken.Token), []byte(r.Req().URL.Query().Get("t"))) != 1 {
+		return HTTPErr{"invalid calendar token", http.StatusForbidden}
+	}
+
+	games := Games{}
+	gameIDs, err := datastore.NewQuery(gameKind).
+		Filter("Members.User.Id=", userId).
+		Filter("Started=", true).
+		Filter("Finished=", false).
+		Limit(maxLimit).
+		GetAll(ctx, &games)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	events := []calendarEvent{}
+	for idx, gameID := range gameIDs {
+		game := &games[idx]
+		game.ID = gameID
+		if len(game.NewestPhaseMeta) == 0 {
+			continue
+		}
+		phase := game.NewestPhaseMeta[0]
+		if phase.Resolved || phase.DeadlineAt.IsZero() || phase.DeadlineAt.Before(now) {
+			continue
+		}
+		member, isMember := game.GetMemberByUserId(userId)
+		if !isMember {
+			continue
+		}
+		phaseURL, err := makeURL(RenderPhaseMapRoute, r.Req().Host, "game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phase.PhaseOrdinal))
+		if err != nil {
+			return err
+		}
+		events = append(events, calendarEvent{
+			uid: fmt.Sprintf("%s-%d@%s", gameID.Encode(), phase.PhaseOrdinal, r.Req().Host),
+			at:  phase.DeadlineAt,
+			summary: fmt.Sprintf(
+				"%s (%s): %s %d, %s deadline",
+				game.DescFor(member.Nation),
+				game.Variant,
+				phase.Season,
+				phase.Year,
+				phase.Type,
+			),
+			description: fmt.Sprintf("%s %d, %s in %s resolves, playing %s.", phase.Season, phase.Year, phase.Type, game.DescFor(member.Nation), member.Nation),
+			link:        phaseURL.String(),
+		})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=900") // 15 minutes, only in the cache of the user since the feed is personal.
+	w.Write([]byte(renderCalendar(now, events)))
+	return nil
+}
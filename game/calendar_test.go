@@ -0,0 +1,38 @@
+package game
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderCalendar(t *testing.T) {
+	at := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	calendar := renderCalendar(at, []calendarEvent{
+		{
+			uid:         "game-1@example.com",
+			at:          at.Add(time.Hour),
+			summary:     "Game, with; special\\chars (Classical): Spring 1901, Movement deadline",
+			description: strings.Repeat("å", 100),
+			link:        "https://example.com/Game/game/Phase/1/Map",
+		},
+	})
+	if !strings.HasPrefix(calendar, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(calendar, "END:VCALENDAR\r\n") {
+		t.Errorf("Got %q, wanted a VCALENDAR", calendar)
+	}
+	unfolded := strings.Replace(calendar, "\r\n ", "", -1)
+	for _, wanted := range []string{
+		"DTSTART:20200304T060607Z\r\n",
+		`SUMMARY:Game\, with\; special\\chars (Classical): Spring 1901\, Movement deadline` + "\r\n",
+		"DESCRIPTION:" + strings.Repeat("å", 100) + "\r\n",
+	} {
+		if !strings.Contains(unfolded, wanted) {
+			t.Errorf("Got %q, wanted it to contain %q", unfolded, wanted)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(calendar, "\r\n"), "\r\n") {
+		if len(line) > icalMaxLineLength {
+			t.Errorf("Got line %q of %v octets, wanted at most %v", line, len(line), icalMaxLineLength)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/mail"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -62,12 +63,15 @@ func init() {
 
 	MessageResource = &Resource{
 		Create:     createMessage,
+		Update:     updateMessage,
 		CreatePath: "/Game/{game_id}/Messages",
+		FullPath:   "/Game/{game_id}/Channel/{channel_members}/Messages/{message_id}",
 		Listers: []Lister{
 			{
-				Path:    "/Game/{game_id}/Channel/{channel_members}/Messages",
-				Route:   ListMessagesRoute,
-				Handler: listMessages,
+				Path:        "/Game/{game_id}/Channel/{channel_members}/Messages",
+				Route:       ListMessagesRoute,
+				Handler:     etagCached(listMessages),
+				QueryParams: []string{"since", "wait", "limit", "cursor"},
 			},
 		},
 	}
@@ -115,6 +119,24 @@ type msgNotificationContext struct {
 	mapURL       *url.URL
 }
 
+func (m *msgNotificationContext) notificationPayload(host string) *fcm.NotificationPayload {
+	notificationBody := m.message.Body
+	if runes := []rune(notificationBody); len(runes) > 512 {
+		notificationBody = string(runes[:512]) + "..."
+	}
+	return &fcm.NotificationPayload{
+		Title: fmt.Sprintf(
+			"%s: %s => %s",
+			m.game.DescFor(m.member.Nation),
+			m.game.AbbrNat(m.message.Sender),
+			m.game.AbbrNats(m.message.ChannelMembers).String(),
+		),
+		Body:        notificationBody,
+		Tag:         "diplicity-engine-new-message",
+		ClickAction: fmt.Sprintf("%s://%s/Game/%s/Channel/%s/Messages", DefaultScheme, host, m.game.ID.Encode(), m.message.ChannelMembers.String()),
+	}
+}
+
 func getMsgNotificationContext(ctx context.Context, host string, gameID *datastore.Key, channelMembers Nations, messageID *datastore.Key, userId string) (*msgNotificationContext, error) {
 	res := &msgNotificationContext{}
 
@@ -164,6 +186,23 @@ func getMsgNotificationContext(ctx context.Context, host string, gameID *datasto
 		return nil, noConfigError
 	}
 
+	if sender, found := res.game.GetMemberByNation(res.message.Sender); found && res.userConfig.HasMutedUser(sender.User.Id) {
+		log.Infof(ctx, "%q has muted %q in all games", userId, sender.User.Id)
+		return nil, mutedSenderError
+	}
+
+	if res.message.Sender != DiplicitySender {
+		gameState, err := loadMemberGameState(ctx, gameID, res.member.Nation)
+		if err != nil {
+			log.Errorf(ctx, "Unable to load game state of %q in %v: %v; hope datastore gets fixed", userId, gameID, err)
+			return nil, err
+		}
+		if gameState.NotificationSettings.MutePress {
+			log.Infof(ctx, "%q has muted press notifications for %v", userId, gameID)
+			return nil, mutedNotifError
+		}
+	}
+
 	phaseOrdinal := 1
 	if len(res.game.NewestPhaseMeta) > 0 {
 		phaseOrdinal = int(res.game.NewestPhaseMeta[0].PhaseOrdinal)
@@ -193,8 +232,6 @@ func getMsgNotificationContext(ctx context.Context, host string, gameID *datasto
 
 func sendEmailError(ctx context.Context, to string, errorMessage string) error {
 	return (&auth.EMail{
-		FromAddr: noreplyFromAddr,
-		FromName: noreplyFromName,
 		ToAddr:   to,
 		TextBody: fmt.Sprintf("Your recent mail to diplicity was not successfully parsed.\n\nAn error message follows.\n\n%v", errorMessage),
 		Subject:  "Unsuccessfully parsed",
@@ -208,13 +245,19 @@ func sendMsgNotificationsToMail(ctx context.Context, host string, gameID *datast
 	if err == noConfigError {
 		log.Infof(ctx, "%q has no configuration, will skip sending notification", userId)
 		return nil
+	} else if err == mutedSenderError {
+		log.Infof(ctx, "%q has muted the sender, will skip sending notification", userId)
+		return nil
+	} else if err == mutedNotifError {
+		log.Infof(ctx, "%q has muted press notifications for %v, will skip sending notification", userId, gameID)
+		return nil
 	} else if err != nil {
 		log.Errorf(ctx, "Unable to get msg notification context: %v; fix getMsgNotificationContext or hope datastore gets fixed", err)
 		return err
 	}
 
-	if !msgContext.userConfig.MailConfig.Enabled {
-		log.Infof(ctx, "%q hasn't enabled mail notifications for mail, will skip sending notification", userId)
+	if !msgContext.userConfig.WantsMail(auth.NotificationNewMessage) {
+		log.Infof(ctx, "%q doesn't want mail notifications for messages, will skip sending notification", userId)
 		return nil
 	}
 
@@ -236,6 +279,11 @@ func sendMsgNotificationsToMail(ctx context.Context, host string, gameID *datast
 	)
 	msg.UnsubscribeURL = unsubscribeURL.String()
 
+	if msg.UnsubscribeAddress, err = auth.GetUnsubscribeAddress(ctx, userId); err != nil {
+		log.Errorf(ctx, "Unable to create unsubscribe address for %q: %v; fix auth.GetUnsubscribeAddress", userId, err)
+		return err
+	}
+
 	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
 		mailId := &MailIdentifier{Nation: msgContext.member.Nation, ChannelID: msgContext.channelID}
 		mailIdID, err := mailId.ID(ctx)
@@ -307,6 +355,12 @@ func sendMsgNotificationsToFCM(ctx context.Context, host string, gameID *datasto
 	if err == noConfigError {
 		log.Infof(ctx, "%q has no configuration, will skip sending notification", userId)
 		return nil
+	} else if err == mutedSenderError {
+		log.Infof(ctx, "%q has muted the sender, will skip sending notification", userId)
+		return nil
+	} else if err == mutedNotifError {
+		log.Infof(ctx, "%q has muted press notifications for %v, will skip sending notification", userId, gameID)
+		return nil
 	} else if err != nil {
 		log.Errorf(ctx, "Unable to get msg notification context: %v; fix getMsgNotificationContext or hope datastore gets fixed", err)
 		return err
@@ -318,9 +372,9 @@ func sendMsgNotificationsToFCM(ctx context.Context, host string, gameID *datasto
 		return err
 	}
 
-	if len(msgContext.userConfig.FCMTokens) == 0 {
-		log.Infof(ctx, "%q hasn't registered any FCM tokens, will skip sending notifiations", userId)
-		return nil
+	if !hasEnabledFCMTokens(msgContext.userConfig) {
+		log.Infof(ctx, "%q hasn't registered any enabled FCM tokens, will fall back to web push", userId)
+		return sendWebPushFallback(ctx, userId, msgContext.userConfig, msgContext.notificationPayload(host))
 	}
 
 	for _, fcmToken := range msgContext.userConfig.FCMTokens {
@@ -332,21 +386,7 @@ func sendMsgNotificationsToFCM(ctx context.Context, host string, gameID *datasto
 		}
 		log.Infof(ctx, "Found an FCM token to send to: %v", PP(fcmToken))
 		finishedTokens[fcmToken.Value] = struct{}{}
-		notificationBody := msgContext.message.Body
-		if runes := []rune(notificationBody); len(runes) > 512 {
-			notificationBody = string(runes[:512]) + "..."
-		}
-		notificationPayload := &fcm.NotificationPayload{
-			Title: fmt.Sprintf(
-				"%s: %s => %s",
-				msgContext.game.DescFor(msgContext.member.Nation),
-				msgContext.game.AbbrNat(msgContext.message.Sender),
-				msgContext.game.AbbrNats(msgContext.message.ChannelMembers).String(),
-			),
-			Body:        notificationBody,
-			Tag:         "diplicity-engine-new-message",
-			ClickAction: fmt.Sprintf("%s://%s/Game/%s/Channel/%s/Messages", DefaultScheme, host, gameID.Encode(), channelMembers.String()),
-		}
+		notificationPayload := msgContext.notificationPayload(host)
 
 		fcmToken.MessageConfig.Customize(ctx, notificationPayload, msgContext.mailData)
 		if fcmToken.MessageConfig.DontSendData {
@@ -415,7 +455,12 @@ func sendMsgNotificationsToUsers(ctx context.Context, host string, gameID *datas
 				log.Errorf(ctx, "Unable to load channels for %v in %v: %v; hope datastore gets fixed", member.Nation, gameID, err)
 				return err
 			}
-			if err := countUnreadMessages(ctx, channels, member.Nation); err != nil {
+			mutedNats, err := loadMutedNations(ctx, game, uids[0])
+			if err != nil {
+				log.Errorf(ctx, "Unable to load muted nations for %v in %v: %v; hope datastore gets fixed", member.Nation, gameID, err)
+				return err
+			}
+			if err := countUnreadMessages(ctx, channels, member.Nation, mutedNats); err != nil {
 				log.Errorf(ctx, "Unable to count unread messages for %v in %v: %v; hope datastore gets fixed", member.Nation, gameID, err)
 				return err
 			}
@@ -514,6 +559,13 @@ func (c Channels) Item(r Request, gameID *datastore.Key, createMessageLink bool)
 		[]string{
 			"Counters",
 			"Channels tell you how many messages they have, and how many new since you last loaded messages from them.",
+			"For members of the channel, 'UnreadCount' is the number of messages newer than their seen marker for the channel.",
+			"The seen marker moves forward when messages are loaded, and can be set explicitly by PUTting `{ 'At': [RFC3339 time] }` to `/Game/{game_id}/Channel/{channel_members}/SeenMarker`. Leaving out 'At' marks all messages in the channel as seen.",
+		},
+		[]string{
+			"Channel members",
+			"The `{channel_members}` of channel paths are the nations of the channel, sorted and separated by commas. Until the game finishes, only members of the channel can list its messages, except for the channel of all nations which everyone can list.",
+			"New messages must go to channels including the sender. Games with 'BroadcastOnly' only accept messages to the channel of all nations, and games with 'DisablePress' reject all messages, channel listings and message listings with 403 until they finish.",
 		},
 	}).AddLink(r.NewLink(Link{
 		Rel:         "self",
@@ -554,13 +606,26 @@ type Channel struct {
 	NMessages      int
 	LatestMessage  Message
 	NMessagesSince NMessagesSince `datastore:"-"`
+	UnreadCount    int            `datastore:"-"`
 }
 
 type SeenMarker struct {
 	GameID  *datastore.Key
 	Members Nations
 	Owner   godip.Nation
-	At      time.Time `methods:"POST"`
+	At      time.Time `methods:"POST,PUT"`
+}
+
+func (s *SeenMarker) Item(r Request) *Item {
+	return NewItem(s).SetName("seen-marker").AddLink(r.NewLink(Link{
+		Rel:         "messages",
+		Route:       ListMessagesRoute,
+		RouteParams: []string{"game_id", s.GameID.Encode(), "channel_members", s.Members.String()},
+	})).AddLink(r.NewLink(Link{
+		Rel:         "channels",
+		Route:       ListChannelsRoute,
+		RouteParams: []string{"game_id", s.GameID.Encode()},
+	}))
 }
 
 func SeenMarkerID(ctx context.Context, channelID *datastore.Key, owner godip.Nation) (*datastore.Key, error) {
@@ -604,13 +669,34 @@ func (c *Channel) ID(ctx context.Context) (*datastore.Key, error) {
 	return ChannelID(ctx, c.GameID, c.Members)
 }
 
-func (c *Channel) CountSince(ctx context.Context, since time.Time) error {
+func (c *Channel) hasMutedMember(mutedNats map[godip.Nation]struct{}) bool {
+	for _, member := range c.Members {
+		if _, isMuted := mutedNats[member]; isMuted {
+			return true
+		}
+	}
+	return false
+}
+
+// CountSince counts the messages created after since, except those sent by muted nations.
+func (c *Channel) CountSince(ctx context.Context, since time.Time, mutedNats map[godip.Nation]struct{}) error {
 	channelID, err := ChannelID(ctx, c.GameID, c.Members)
 	if err != nil {
 		return err
 	}
-	count, err := datastore.NewQuery(messageKind).Ancestor(channelID).Filter("CreatedAt>", since).Count(ctx)
-	if err != nil {
+	query := datastore.NewQuery(messageKind).Ancestor(channelID).Filter("CreatedAt>", since)
+	count := 0
+	if c.hasMutedMember(mutedNats) {
+		messages := Messages{}
+		if _, err := query.GetAll(ctx, &messages); err != nil {
+			return err
+		}
+		for _, message := range messages {
+			if _, isMuted := mutedNats[message.Sender]; !isMuted {
+				count++
+			}
+		}
+	} else if count, err = query.Count(ctx); err != nil {
 		return err
 	}
 	c.NMessagesSince.Since = since
@@ -620,7 +706,7 @@ func (c *Channel) CountSince(ctx context.Context, since time.Time) error {
 
 type Messages []Message
 
-func (m Messages) Item(r Request, gameID *datastore.Key, channelMembers Nations, isMember bool) *Item {
+func (m Messages) Item(r Request, route string, gameID *datastore.Key, channelMembers Nations, isMember bool, cursor string, limit int) *Item {
 	messageItems := make(List, len(m))
 	for i := range m {
 		messageItems[i] = m[i].Item(r)
@@ -630,13 +716,63 @@ func (m Messages) Item(r Request, gameID *datastore.Key, channelMembers Nations,
 			"Limiting messages",
 			"Messages normally contain all messages for the chosen channel, but if you provide a `since` query parameter they will only contain new messages since that time.",
 		},
+		[]string{
+			"Cursor and limit",
+			"The list contains all messages, the most recent first.",
+			fmt.Sprintf("To page through the messages, add a 'limit' query parameter of at most %d.", maxLimit),
+			"If there are older messages, a 'next' link will be available with a 'cursor' query parameter.",
+			"Use the 'next' link to page backward in time through the history of the channel.",
+			"Messages from muted members are removed after the page is loaded, so a page can contain fewer messages than the limit.",
+		},
+		[]string{
+			"Searching messages",
+			"To find messages containing some words, ignoring case and punctuation, add `/Search?q=words` to the path of the message list.",
+			fmt.Sprintf("Only messages containing all of the first %d words match.", maxSearchTokens),
+			fmt.Sprintf("Search results are paged with 'cursor' and 'limit' like the message list, but contain at most %d messages even without a 'limit'.", maxLimit),
+		},
+		[]string{
+			"Editing messages",
+			fmt.Sprintf("The sender of a message can change its body within %v of sending it, using the 'update' link of the message.", messageEditWindow),
+			"Edited messages have 'Edited' set to true, and 'EditedAt' set to the time of the latest edit.",
+		},
+		[]string{
+			"Reactions",
+			"Channel members can react to a message with a short emoji using the 'react' link of the message.",
+			"Reacting twice with the same emoji has no further effect.",
+			"The 'Reactions' field of each message contains the number of reactions per emoji, not counting reactions from muted members.",
+		},
+		[]string{
+			"Attachments",
+			"Channel members can attach images to messages, by first uploading them using the 'attachment-upload' link, and then adding them to the 'Attachments' of the new message.",
+			fmt.Sprintf("Channel members get signed download URLs for the attachments, valid for %v.", attachmentURLTTL),
+		},
 	}).AddLink(r.NewLink(Link{
 		Rel:         "self",
 		Route:       ListMessagesRoute,
 		RouteParams: []string{"game_id", gameID.Encode(), "channel_members", channelMembers.String()},
 	}))
+	if cursor != "" {
+		next := url.Values{}
+		for k, v := range r.Req().URL.Query() {
+			next[k] = v
+		}
+		next.Set("cursor", cursor)
+		next.Set("limit", fmt.Sprint(limit))
+		messagesItem.AddLink(r.NewLink(Link{
+			Rel:         "next",
+			Route:       route,
+			RouteParams: []string{"game_id", gameID.Encode(), "channel_members", channelMembers.String()},
+			QueryParams: next,
+		}))
+	}
 	if isMember {
 		messagesItem.AddLink(r.NewLink(MessageFlagResource.Link("flag-messages", Create, []string{"game_id", gameID.Encode(), "channel_members", channelMembers.String()})))
+		messagesItem.AddLink(r.NewLink(Link{
+			Rel:         "attachment-upload",
+			Method:      "POST",
+			Route:       CreateAttachmentUploadRoute,
+			RouteParams: []string{"game_id", gameID.Encode(), "channel_members", channelMembers.String()},
+		}))
 	}
 	return messagesItem
 }
@@ -646,9 +782,28 @@ type Message struct {
 	GameID         *datastore.Key
 	ChannelMembers Nations `methods:"POST"`
 	Sender         godip.Nation
-	Body           string `methods:"POST" datastore:",noindex"`
+	Body           string `methods:"POST,PUT" datastore:",noindex"`
 	CreatedAt      time.Time
-	Age            time.Duration `datastore:"-" ticker:"true"`
+	Edited         bool
+	EditedAt       time.Time
+	BodyTokens     []string       `json:"-"`
+	Attachments    []Attachment   `methods:"POST"`
+	Reacted        bool           `json:"-"` // Whether anyone reacted to the message, since only those need their reactions counted.
+	Reactions      map[string]int `datastore:"-"`
+	Age            time.Duration  `datastore:"-" ticker:"true"`
+}
+
+func (m *Message) Save() ([]datastore.Property, error) {
+	m.BodyTokens = searchTokens(m.Body)
+	return datastore.SaveStruct(m)
+}
+
+func (m *Message) Load(props []datastore.Property) error {
+	err := datastore.LoadStruct(m, props)
+	if _, is := err.(*datastore.ErrFieldMismatch); is {
+		err = nil
+	}
+	return err
 }
 
 func (m *Message) NotifyRecipients(ctx context.Context, host string, game *Game) error {
@@ -666,11 +821,16 @@ func (m *Message) NotifyRecipients(ctx context.Context, host string, game *Game)
 	states := make(GameStates, len(stateIDs))
 	err := datastore.GetMulti(ctx, stateIDs, states)
 
+	senderId := ""
+	if sender, found := game.GetMemberByNation(m.Sender); found {
+		senderId = sender.User.Id
+	}
+
 	// Populate a list of nations that haven't muted the sender (and aren't the sender).
 	unmutedMembers := []godip.Nation{}
 	if err == nil {
 		for _, state := range states {
-			if state.Nation != m.Sender && !state.HasMuted(m.Sender) {
+			if state.Nation != m.Sender && !state.HasMuted(m.Sender) && !state.HasMutedUser(senderId) {
 				unmutedMembers = append(unmutedMembers, state.Nation)
 			}
 		}
@@ -678,7 +838,7 @@ func (m *Message) NotifyRecipients(ctx context.Context, host string, game *Game)
 		if merr, ok := err.(appengine.MultiError); ok {
 			for index, serr := range merr {
 				if serr == nil {
-					if m.ChannelMembers[index] != m.Sender && !states[index].HasMuted(m.Sender) {
+					if m.ChannelMembers[index] != m.Sender && !states[index].HasMuted(m.Sender) && !states[index].HasMutedUser(senderId) {
 						unmutedMembers = append(unmutedMembers, states[index].Nation)
 					}
 				} else if serr != datastore.ErrNoSuchEntity {
@@ -696,7 +856,7 @@ func (m *Message) NotifyRecipients(ctx context.Context, host string, game *Game)
 	memberIds := []string{}
 	for _, nat := range unmutedMembers {
 		for _, member := range game.Members {
-			if member.Nation == nat && member.User.Id != "" {
+			if member.Nation == nat && !member.Vacant() {
 				memberIds = append(memberIds, member.User.Id)
 				break
 			}
@@ -729,7 +889,18 @@ func (m *Message) NotifyRecipients(ctx context.Context, host string, game *Game)
 }
 
 func (m *Message) Item(r Request) *Item {
-	return NewItem(m).SetName(string(m.Sender))
+	messageItem := NewItem(m).SetName(string(m.Sender))
+	memberNation, found := r.Values()[memberNationFlag].(godip.Nation)
+	if !found || m.ID == nil {
+		return messageItem
+	}
+	if memberNation == m.Sender && time.Now().Sub(m.CreatedAt) < messageEditWindow {
+		messageItem.AddLink(r.NewLink(MessageResource.Link("update", Update, []string{"game_id", m.GameID.Encode(), "channel_members", m.ChannelMembers.String(), "message_id", m.ID.Encode()})))
+	}
+	if m.ChannelMembers.Includes(memberNation) {
+		messageItem.AddLink(r.NewLink(MessageReactionResource.Link("react", Create, []string{"game_id", m.GameID.Encode(), "channel_members", m.ChannelMembers.String(), "message_id", m.ID.Encode()})))
+	}
+	return messageItem
 }
 
 func createMessageHelper(ctx context.Context, host string, message *Message) error {
@@ -762,6 +933,8 @@ func createMessageHelper(ctx context.Context, host string, message *Message) err
 		game.ID = message.GameID
 		channel.NMessages += 1
 		channel.LatestMessage = *message
+		// Only the messages themselves need to be searchable, and a retried transaction has already tokenized the message.
+		channel.LatestMessage.BodyTokens = nil
 		toSave := []interface{}{channel, message}
 		saveKeys := []*datastore.Key{channelID, datastore.NewIncompleteKey(ctx, messageKind, channelID)}
 		if !channelExisted {
@@ -824,13 +997,115 @@ func createMessage(w ResponseWriter, r Request) (*Message, error) {
 		return nil, err
 	}
 
+	if err := validateAttachments(message); err != nil {
+		return nil, err
+	}
+
+	if err := checkMessageRateLimit(ctx, w, gameID, message.ChannelMembers, member.Nation); err != nil {
+		return nil, err
+	}
+
 	if err := createMessageHelper(ctx, r.Req().Host, message); err != nil {
 		return nil, err
 	}
 
+	r.Values()[memberNationFlag] = member.Nation
+
+	return message, nil
+}
+
+func updateMessage(w ResponseWriter, r Request) (*Message, error) {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return nil, HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return nil, err
+	}
+
+	channelMembers := Nations{}
+	channelMembers.FromString(r.Vars()["channel_members"])
+
+	channelID, err := ChannelID(ctx, gameID, channelMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := datastore.DecodeKey(r.Vars()["message_id"])
+	if err != nil {
+		return nil, err
+	}
+	if messageID.Kind() != messageKind || !channelID.Equal(messageID.Parent()) {
+		return nil, HTTPErr{"message not found in channel", http.StatusNotFound}
+	}
+
+	bodyBytes, err := ioutil.ReadAll(r.Req().Body)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &Message{}
+	var member *Member
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		game := &Game{}
+		channel := &Channel{}
+		if err := datastore.GetMulti(ctx, []*datastore.Key{gameID, channelID, messageID}, []interface{}{game, channel, message}); err != nil {
+			return err
+		}
+		game.ID = gameID
+		message.ID = messageID
+
+		var isMember bool
+		member, isMember = game.GetMemberByUserId(user.Id)
+		if !isMember {
+			return HTTPErr{"can only update messages in member games", http.StatusNotFound}
+		}
+		if message.Sender != member.Nation {
+			return HTTPErr{"can only update your own messages", http.StatusForbidden}
+		}
+		if time.Now().Sub(message.CreatedAt) >= messageEditWindow {
+			return HTTPErr{fmt.Sprintf("can only update messages within %v of sending them", messageEditWindow), http.StatusForbidden}
+		}
+
+		if err := CopyBytes(message, r, bodyBytes, "PUT"); err != nil {
+			return err
+		}
+		if strings.TrimSpace(message.Body) == "" {
+			return HTTPErr{"can not create empty messages", http.StatusBadRequest}
+		}
+		message.Edited = true
+		message.EditedAt = time.Now()
+
+		toSave := []interface{}{message}
+		saveKeys := []*datastore.Key{messageID}
+		if channel.LatestMessage.Sender == message.Sender && channel.LatestMessage.CreatedAt.Equal(message.CreatedAt) {
+			channel.LatestMessage = *message
+			// Only the messages themselves need to be searchable.
+			channel.LatestMessage.BodyTokens = nil
+			toSave = append(toSave, channel)
+			saveKeys = append(saveKeys, channelID)
+		}
+		_, err := datastore.PutMulti(ctx, saveKeys, toSave)
+		return err
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return nil, err
+	}
+
+	r.Values()[memberNationFlag] = member.Nation
+	message.Age = time.Now().Sub(message.CreatedAt)
+
 	return message, nil
 }
 
+// pressDisabled returns whether members can't send or read messages in the game.
+func (g *Game) pressDisabled() bool {
+	return !g.Finished && g.DisablePress
+}
+
 func validateMessage(ctx context.Context, message *Message) error {
 	if strings.TrimSpace(message.Body) == "" {
 		return HTTPErr{"can not create empty messages", http.StatusBadRequest}
@@ -850,7 +1125,13 @@ func validateMessage(ctx context.Context, message *Message) error {
 	if !game.Mustered {
 		return HTTPErr{"game is mustering", http.StatusBadRequest}
 	}
+	if game.pressDisabled() {
+		return HTTPErr{"press disabled", http.StatusForbidden}
+	}
 	if !game.Finished {
+		if game.BroadcastOnly && !isPublic(game.Variant, message.ChannelMembers) {
+			return HTTPErr{"only messages to all nations allowed", http.StatusBadRequest}
+		}
 		if game.DisablePrivateChat && len(message.ChannelMembers) == 2 {
 			return HTTPErr{"private chat disabled", http.StatusBadRequest}
 		}
@@ -926,6 +1207,23 @@ func listMessages(w ResponseWriter, r Request) error {
 
 	wait := r.Req().URL.Query().Get("wait") == "true"
 
+	// Without a limit all messages are returned, like before paging was supported.
+	limit := int64(0)
+	if limitParam := r.Req().URL.Query().Get("limit"); limitParam != "" {
+		if limit, err = strconv.ParseInt(limitParam, 10, 64); err != nil || limit > maxLimit || limit < 1 {
+			limit = maxLimit
+		}
+	}
+
+	var startCursor *datastore.Cursor
+	if cursorParam := r.Req().URL.Query().Get("cursor"); cursorParam != "" {
+		decoded, err := datastore.DecodeCursor(cursorParam)
+		if err != nil {
+			return err
+		}
+		startCursor = &decoded
+	}
+
 	game := &Game{}
 	err = datastore.Get(ctx, gameID, game)
 	if err != nil {
@@ -934,26 +1232,24 @@ func listMessages(w ResponseWriter, r Request) error {
 	game.ID = gameID
 
 	var nation godip.Nation
-	mutedNats := map[godip.Nation]struct{}{}
 	if member, found := game.GetMemberByUserId(user.Id); game.Started && game.Mustered && found {
 		nation = member.Nation
-		gameStateID, err := GameStateID(ctx, gameID, nation)
-		if err != nil {
-			return err
-		}
-		gameState := &GameState{}
-		if err = datastore.Get(ctx, gameStateID, gameState); err == nil {
-			for _, nat := range gameState.Muted {
-				mutedNats[nat] = struct{}{}
-			}
-		} else if err != datastore.ErrNoSuchEntity {
-			return err
-		}
+		r.Values()[memberNationFlag] = nation
+	}
+
+	mutedNats, err := loadMutedNations(ctx, game, user.Id)
+	if err != nil {
+		return err
 	}
 
 	if !game.Finished && !channelMembers.Includes(nation) && !isPublic(game.Variant, channelMembers) {
 		return HTTPErr{"can only list member channels", http.StatusForbidden}
 	}
+	if game.pressDisabled() {
+		return HTTPErr{"press disabled", http.StatusForbidden}
+	}
+
+	cutoff, delayed := game.nonMemberCutoff(user.Id, time.Now())
 
 	channelID, err := ChannelID(ctx, gameID, channelMembers)
 	if err != nil {
@@ -962,19 +1258,45 @@ func listMessages(w ResponseWriter, r Request) error {
 
 	var seenMarker *SeenMarker
 	messages := Messages{}
+	nextCursor := ""
 	for {
 		if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
 			q := datastore.NewQuery(messageKind).Ancestor(channelID)
 			if since != nil {
 				q = q.Filter("CreatedAt>", *since)
 			}
-			messageIDs, err := q.Order("-CreatedAt").GetAll(ctx, &messages)
-			if err != nil {
-				return err
+			q = q.Order("-CreatedAt")
+			if startCursor != nil {
+				q = q.Start(*startCursor)
+			}
+			messages = Messages{}
+			nextCursor = ""
+			iter := q.Run(ctx)
+			for limit == 0 || len(messages) < int(limit) {
+				message := Message{}
+				messageID, err := iter.Next(&message)
+				if err == datastore.Done {
+					break
+				} else if err != nil {
+					return err
+				}
+				if delayed && message.CreatedAt.After(cutoff) {
+					continue
+				}
+				// Muted messages are skipped here, so that they don't count towards the limit.
+				if _, isMuted := mutedNats[message.Sender]; isMuted {
+					continue
+				}
+				message.ID = messageID
+				message.Age = time.Now().Sub(message.CreatedAt)
+				messages = append(messages, message)
 			}
-			for i := range messages {
-				messages[i].ID = messageIDs[i]
-				messages[i].Age = time.Now().Sub(messages[i].CreatedAt)
+			if limit > 0 && len(messages) == int(limit) {
+				cursor, err := iter.Cursor()
+				if err != nil {
+					return err
+				}
+				nextCursor = cursor.String()
 			}
 			if game.Started && game.Mustered && nation != "" {
 				seenMarkerID, err := SeenMarkerID(ctx, channelID, nation)
@@ -1048,7 +1370,7 @@ func listMessages(w ResponseWriter, r Request) error {
 				}
 			}
 
-			if err := countUnreadMessages(ctx, filteredChannels, nation); err != nil {
+			if err := countUnreadMessages(ctx, filteredChannels, nation, mutedNats); err != nil {
 				return err
 			}
 
@@ -1072,14 +1394,139 @@ func listMessages(w ResponseWriter, r Request) error {
 		}
 	}
 
-	filteredMessages := make(Messages, 0, len(messages))
-	for _, msg := range messages {
-		if _, isMuted := mutedNats[msg.Sender]; !isMuted {
-			filteredMessages = append(filteredMessages, msg)
+	if err := countReactions(ctx, messages, mutedNats); err != nil {
+		return err
+	}
+
+	if channelMembers.Includes(nation) {
+		if err := signAttachmentURLs(ctx, messages); err != nil {
+			return err
 		}
 	}
 
-	w.SetContent(filteredMessages.Item(r, gameID, channelMembers, isMember))
+	w.SetContent(messages.Item(r, ListMessagesRoute, gameID, channelMembers, isMember, nextCursor, int(limit)))
+	return nil
+}
+
+/*
+ * searchMessages returns the messages in a channel with bodies containing all words of the q query parameter, ignoring case,
+ * using the BodyTokens of the messages.
+ */
+func searchMessages(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	channelMembers := Nations{}
+	channelMembers.FromString(r.Vars()["channel_members"])
+
+	tokens := searchTokens(r.Req().URL.Query().Get("q"))
+	if len(tokens) == 0 {
+		return HTTPErr{"must provide a q query parameter", http.StatusBadRequest}
+	}
+	if len(tokens) > maxSearchTokens {
+		tokens = tokens[:maxSearchTokens]
+	}
+
+	limit, err := strconv.ParseInt(r.Req().URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit > maxLimit || limit < 1 {
+		limit = maxLimit
+	}
+
+	var startCursor *datastore.Cursor
+	if cursorParam := r.Req().URL.Query().Get("cursor"); cursorParam != "" {
+		decoded, err := datastore.DecodeCursor(cursorParam)
+		if err != nil {
+			return err
+		}
+		startCursor = &decoded
+	}
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return err
+	}
+	game.ID = gameID
+
+	var nation godip.Nation
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if game.Started && game.Mustered && isMember {
+		nation = member.Nation
+		r.Values()[memberNationFlag] = nation
+	}
+
+	if !game.Finished && !channelMembers.Includes(nation) && !isPublic(game.Variant, channelMembers) {
+		return HTTPErr{"can only search member channels", http.StatusForbidden}
+	}
+	if game.pressDisabled() {
+		return HTTPErr{"press disabled", http.StatusForbidden}
+	}
+
+	mutedNats, err := loadMutedNations(ctx, game, user.Id)
+	if err != nil {
+		return err
+	}
+
+	cutoff, delayed := game.nonMemberCutoff(user.Id, time.Now())
+
+	channelID, err := ChannelID(ctx, gameID, channelMembers)
+	if err != nil {
+		return err
+	}
+
+	q := datastore.NewQuery(messageKind).Ancestor(channelID)
+	for _, token := range tokens {
+		q = q.Filter("BodyTokens=", token)
+	}
+	q = q.Order("-CreatedAt")
+	if startCursor != nil {
+		q = q.Start(*startCursor)
+	}
+
+	messages := Messages{}
+	nextCursor := ""
+	found := 0
+	iter := q.Run(ctx)
+	for found < int(limit) {
+		message := Message{}
+		messageID, err := iter.Next(&message)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return err
+		}
+		found++
+		if delayed && message.CreatedAt.After(cutoff) {
+			continue
+		}
+		if _, isMuted := mutedNats[message.Sender]; isMuted {
+			continue
+		}
+		message.ID = messageID
+		message.Age = time.Now().Sub(message.CreatedAt)
+		messages = append(messages, message)
+	}
+	if found == int(limit) {
+		cursor, err := iter.Cursor()
+		if err != nil {
+			return err
+		}
+		nextCursor = cursor.String()
+	}
+
+	if err := countReactions(ctx, messages, mutedNats); err != nil {
+		return err
+	}
+
+	w.SetContent(messages.Item(r, SearchMessagesRoute, gameID, channelMembers, isMember && nation != "", nextCursor, int(limit)))
 	return nil
 }
 
@@ -1112,7 +1559,8 @@ func loadChannels(ctx context.Context, game *Game, viewer godip.Nation) (Channel
 	return channels, nil
 }
 
-func countUnreadMessages(ctx context.Context, unfilteredChannels Channels, viewer godip.Nation) error {
+// countUnreadMessages counts the messages the viewer hasn't seen in each of their channels, ignoring messages from muted nations.
+func countUnreadMessages(ctx context.Context, unfilteredChannels Channels, viewer godip.Nation, mutedNats map[godip.Nation]struct{}) error {
 	seenMarkerIDs := []*datastore.Key{}
 	seenMarkers := []SeenMarker{}
 	channels := []*Channel{}
@@ -1153,11 +1601,11 @@ func countUnreadMessages(ctx context.Context, unfilteredChannels Channels, viewe
 	results := make(chan error)
 	for i := range channels {
 		go func(c *Channel, since time.Time) {
-			if since.IsZero() {
+			if since.IsZero() && !c.hasMutedMember(mutedNats) {
 				c.NMessagesSince.NMessages = c.NMessages
 				results <- nil
 			} else {
-				results <- c.CountSince(ctx, since)
+				results <- c.CountSince(ctx, since, mutedNats)
 			}
 		}(channels[i], seenMarkerTimes[i])
 	}
@@ -1170,6 +1618,104 @@ func countUnreadMessages(ctx context.Context, unfilteredChannels Channels, viewe
 	if len(merr) > 0 {
 		return merr
 	}
+	for _, c := range channels {
+		c.UnreadCount = c.NMessagesSince.NMessages
+	}
+	return nil
+}
+
+/*
+ * updateSeenMarker lets a member explicitly set how far they have read in a channel,
+ * and updates the unread message count of the member to match.
+ */
+func updateSeenMarker(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	channelMembers := Nations{}
+	channelMembers.FromString(r.Vars()["channel_members"])
+	sort.Sort(channelMembers)
+
+	seenMarker := &SeenMarker{}
+	if err := Copy(seenMarker, r, "PUT"); err != nil {
+		return err
+	}
+	if seenMarker.At.IsZero() {
+		seenMarker.At = time.Now()
+	}
+
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		game := &Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+		game.ID = gameID
+
+		member, isMember := game.GetMemberByUserId(user.Id)
+		if !isMember || !game.Started || !game.Mustered {
+			return HTTPErr{"can only update seen markers of mustered member games", http.StatusForbidden}
+		}
+		if !channelMembers.Includes(member.Nation) {
+			return HTTPErr{"can only update seen markers of member channels", http.StatusForbidden}
+		}
+
+		seenMarker.GameID = gameID
+		seenMarker.Owner = member.Nation
+		seenMarker.Members = channelMembers
+		seenMarkerID, err := seenMarker.ID(ctx)
+		if err != nil {
+			return err
+		}
+
+		channels, err := loadChannels(ctx, game, member.Nation)
+		if err != nil {
+			return err
+		}
+		mutedNats, err := loadMutedNations(ctx, game, user.Id)
+		if err != nil {
+			return err
+		}
+		otherChannels := Channels{}
+		unread := 0
+		for _, channel := range channels {
+			if channel.Members.String() == channelMembers.String() {
+				if err := channel.CountSince(ctx, seenMarker.At, mutedNats); err != nil {
+					return err
+				}
+				unread += channel.NMessagesSince.NMessages
+			} else {
+				otherChannels = append(otherChannels, channel)
+			}
+		}
+
+		if err := countUnreadMessages(ctx, otherChannels, member.Nation, mutedNats); err != nil {
+			return err
+		}
+		for _, channel := range otherChannels {
+			unread += channel.NMessagesSince.NMessages
+		}
+
+		member.UnreadMessages = unread
+		if err := game.DBSave(ctx); err != nil {
+			return err
+		}
+
+		_, err = datastore.Put(ctx, seenMarkerID, seenMarker)
+		return err
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
+		return err
+	}
+
+	w.SetContent(seenMarker.Item(r))
 	return nil
 }
 
@@ -1193,6 +1739,11 @@ func listChannels(w ResponseWriter, r Request) error {
 	}
 	game.ID = gameID
 
+	// Games without press only have the messages of the server, and show them when they finish.
+	if game.pressDisabled() {
+		return HTTPErr{"press disabled", http.StatusForbidden}
+	}
+
 	var nation godip.Nation
 
 	member, isMember := game.GetMemberByUserId(user.Id)
@@ -1205,11 +1756,28 @@ func listChannels(w ResponseWriter, r Request) error {
 		return err
 	}
 
+	mutedNats, err := loadMutedNations(ctx, game, user.Id)
+	if err != nil {
+		return err
+	}
+	if cutoff, delayed := game.nonMemberCutoff(user.Id, time.Now()); delayed {
+		for i := range channels {
+			if err := channels[i].delayTo(ctx, cutoff); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range channels {
+		if _, isMuted := mutedNats[channels[i].LatestMessage.Sender]; isMuted {
+			channels[i].LatestMessage = Message{}
+		}
+	}
+
 	if game.Started && game.Mustered && isMember {
-		if err := countUnreadMessages(ctx, channels, nation); err != nil {
+		if err := countUnreadMessages(ctx, channels, nation, mutedNats); err != nil {
 			return err
 		}
-	} else {
+	} else if isMember {
 		for i := range channels {
 			channels[i].NMessagesSince.NMessages = channels[i].NMessages
 		}
@@ -1223,6 +1791,38 @@ func listChannels(w ResponseWriter, r Request) error {
 	return nil
 }
 
+type pressReply struct {
+	fromAddress string
+	token       string
+	body        string
+}
+
+// parsePressReply finds the sender address, the reply token in the recipient
+// address, and the reply text without quoted text of an incoming email.
+func parsePressReply(enmsg *enmime.Envelope) (*pressReply, error) {
+	fromAddress, err := mail.ParseAddress(enmsg.GetHeader("From"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse From address %q: %v", enmsg.GetHeader("From"), err)
+	}
+
+	toAddresses, err := mail.ParseAddressList(enmsg.GetHeader("To"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse To address %q: %v", enmsg.GetHeader("To"), err)
+	}
+
+	for _, toAddress := range toAddresses {
+		if match := fromAddressReg.FindStringSubmatch(toAddress.Address); len(match) > 0 {
+			return &pressReply{
+				fromAddress: strings.ToLower(fromAddress.Address),
+				token:       match[1],
+				body:        mailstrip.Parse(enmsg.Text).String(),
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no recipient address in %q matches %v", enmsg.GetHeader("To"), fromAddressReg)
+}
+
 func receiveMail(w ResponseWriter, r Request) error {
 	ctx := appengine.NewContext(r.Req())
 
@@ -1249,15 +1849,6 @@ func receiveMail(w ResponseWriter, r Request) error {
 
 	from := enmsg.GetHeader("From")
 
-	toAddressString := enmsg.GetHeader("To")
-
-	toAddress, err := mail.ParseAddress(toAddressString)
-	if err != nil {
-		e := fmt.Sprintf("Unable to parse To address %q: %v", toAddressString, err)
-		log.Errorf(ctx, e)
-		return sendEmailError(ctx, from, e)
-	}
-
 	forumMail, err := GetForumMail(ctx)
 	if err != nil {
 		e := fmt.Sprintf("Unable to load root forum email: %v", err)
@@ -1281,24 +1872,37 @@ func receiveMail(w ResponseWriter, r Request) error {
 		}
 	}
 
-	match := fromAddressReg.FindStringSubmatch(toAddress.Address)
-	if len(match) == 0 {
-		e := fmt.Sprintf("Recipient address of %v doesn't match %v.", toAddress, fromAddressReg)
+	if toAddresses, err := mail.ParseAddressList(enmsg.GetHeader("To")); err == nil {
+		for _, toAddress := range toAddresses {
+			if unsubToken := auth.UnsubscribeAddressToken(toAddress.Address); unsubToken != "" {
+				if err := auth.UnsubscribeWithToken(ctx, unsubToken); err != nil {
+					e := fmt.Sprintf("Unable to unsubscribe using %q: %v", toAddress.Address, err)
+					log.Errorf(ctx, e)
+					return sendEmailError(ctx, from, e)
+				}
+				log.Infof(ctx, "Unsubscribed using %q.", toAddress.Address)
+				return nil
+			}
+		}
+	}
+
+	reply, err := parsePressReply(enmsg)
+	if err != nil {
+		e := fmt.Sprintf("Unable to parse reply: %v", err)
 		log.Errorf(ctx, e)
 		return sendEmailError(ctx, from, e)
 	}
 
-	fromToken := match[1]
-	plainToken, err := auth.DecodeString(ctx, fromToken)
+	plainToken, err := auth.DecodeString(ctx, reply.token)
 	if err != nil {
-		e := fmt.Sprintf("Unable to successfully decrypt token %q in %q: %v.", match[1], match[0], err)
+		e := fmt.Sprintf("Unable to successfully decrypt token %q: %v.", reply.token, err)
 		log.Errorf(ctx, e)
 		return sendEmailError(ctx, from, e)
 	}
 
 	parts := strings.Split(plainToken, ",")
 	if len(parts) != 2 {
-		e := fmt.Sprintf("Decrypted token %q is not two strings joined by ','.", fromToken)
+		e := fmt.Sprintf("Decrypted token %q is not two strings joined by ','.", reply.token)
 		log.Errorf(ctx, e)
 		return sendEmailError(ctx, from, e)
 	}
@@ -1318,11 +1922,26 @@ func receiveMail(w ResponseWriter, r Request) error {
 		return sendEmailError(ctx, from, e)
 	}
 
+	game := &Game{}
+	if err := datastore.Get(ctx, message.GameID, game); err != nil {
+		e := fmt.Sprintf("Unable to load game from datastore, unable to create reply: %v", err)
+		log.Errorf(ctx, e)
+		return sendEmailError(ctx, from, e)
+	}
+
+	// The token only proves that the mail replies to a notification, so make sure the claimed member sent it.
+	member, found := game.GetMemberByNation(godip.Nation(fromNation))
+	if !found || !strings.EqualFold(TrimSpace(member.User.Email), reply.fromAddress) {
+		e := fmt.Sprintf("Sender %q is not the member playing %v.", reply.fromAddress, fromNation)
+		log.Errorf(ctx, e)
+		return sendEmailError(ctx, from, e)
+	}
+
 	newMessage := &Message{
 		GameID:         message.GameID,
 		ChannelMembers: message.ChannelMembers,
 		Sender:         godip.Nation(fromNation),
-		Body:           mailstrip.Parse(enmsg.Text).String(),
+		Body:           reply.body,
 	}
 
 	log.Infof(ctx, "Received %v via email", PP(newMessage))
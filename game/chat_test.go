@@ -0,0 +1,55 @@
+package game
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zond/enmime"
+)
+
+func readEnvelope(t *testing.T, raw string) *enmime.Envelope {
+	enmsg, err := enmime.ReadEnvelope(strings.NewReader(strings.Replace(raw, "\n", "\r\n", -1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enmsg
+}
+
+func TestParsePressReply(t *testing.T) {
+	enmsg := readEnvelope(t, `From: Some Player <Player@Example.com>
+To: "Diplicity" <replies+abc123@diplicity-engine.appspotmail.com>
+Subject: Re: Austria, England
+Content-Type: text/plain; charset=utf-8
+
+Let's take Munich together.
+
+On Mon, Jan 1, 2024 at 10:00 AM Diplicity <replies+abc123@diplicity-engine.appspotmail.com> wrote:
+> England: I propose an alliance.
+`)
+	reply, err := parsePressReply(enmsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.fromAddress != "player@example.com" {
+		t.Errorf("Got from address %q, wanted %q", reply.fromAddress, "player@example.com")
+	}
+	if reply.token != "abc123" {
+		t.Errorf("Got token %q, wanted %q", reply.token, "abc123")
+	}
+	if reply.body != "Let's take Munich together." {
+		t.Errorf("Got body %q, wanted only the reply text", reply.body)
+	}
+}
+
+func TestParsePressReplyWithoutToken(t *testing.T) {
+	enmsg := readEnvelope(t, `From: player@example.com
+To: someone@example.com
+Subject: Hello
+Content-Type: text/plain; charset=utf-8
+
+Hello.
+`)
+	if _, err := parsePressReply(enmsg); err == nil {
+		t.Errorf("Wanted an error for mail without a reply token")
+	}
+}
@@ -0,0 +1,169 @@
+package game
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// gzipMinBytes is the smallest response body worth compressing.
+	gzipMinBytes = 1024
+)
+
+// precompressedTypes are content types that are already compressed, and don't shrink when gzipped.
+var precompressedTypes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"application/gzip",
+	"application/zip",
+	"application/x-gzip",
+}
+
+/*
+ * CompressResponses gzips responses of at least gzipMinBytes to clients accepting gzip.
+ * Responses already having a Content-Encoding, or an already compressed content type, are
+ * left alone. Headers set by the handler, like the CORS headers, are kept as they are.
+ */
+func CompressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == "HEAD" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip returns whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil && q == 0 {
+					accepted = false
+				}
+			}
+		}
+		if accepted {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * gzipResponseWriter buffers the start of the response until it knows whether the body
+ * is big enough to compress, and then either compresses or passes through the rest.
+ */
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(b)
+		}
+		return g.ResponseWriter.Write(b)
+	}
+	n, _ := g.buf.Write(b)
+	if g.buf.Len() >= gzipMinBytes {
+		if err := g.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// decide writes the headers and the buffered body, compressed if big enough is true and the content allows it.
+func (g *gzipResponseWriter) decide(bigEnough bool) error {
+	g.decided = true
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if bigEnough && g.compressible() {
+		g.Header().Del("Content-Length")
+		g.Header().Set("Content-Encoding", "gzip")
+		g.ResponseWriter.WriteHeader(g.status)
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+		_, err := g.gz.Write(g.buf.Bytes())
+		return err
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf.Bytes())
+	return err
+}
+
+func (g *gzipResponseWriter) compressible() bool {
+	if g.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	if g.status < 200 || g.status == http.StatusNoContent || g.status == http.StatusNotModified {
+		return false
+	}
+	contentType := strings.ToLower(g.Header().Get("Content-Type"))
+	for _, prefix := range precompressedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Flush sends what has been written so far. Handlers only flush responses they stream, so the body is expected
+// to grow, and is compressed unless the content doesn't allow it.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		if err := g.decide(true); err != nil {
+			return
+		}
+	}
+	if g.gz != nil {
+		if err := g.gz.Flush(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close writes anything still buffered, and finishes the compressed stream if there is one.
+func (g *gzipResponseWriter) Close() error {
+	if !g.decided {
+		if g.status == 0 && g.buf.Len() == 0 {
+			return nil
+		}
+		if err := g.decide(false); err != nil {
+			return err
+		}
+	}
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	return nil
+}
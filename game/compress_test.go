@@ -0,0 +1,117 @@
+package game
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressResponses(t *testing.T) {
+	big := strings.Repeat("diplicity ", gzipMinBytes)
+	handler := CompressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		if r.URL.Query().Get("encoded") != "" {
+			w.Header().Set("Content-Encoding", "br")
+		}
+		body := big
+		if r.URL.Query().Get("small") != "" {
+			body = "small"
+		}
+		w.Write([]byte(body))
+	}))
+	serve := func(url string, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/?type=application/json", "deflate, gzip")
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Got Content-Encoding %q, wanted gzip", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Got Access-Control-Allow-Origin %q, wanted the CORS header kept", got)
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != big {
+		t.Errorf("Got a decompressed body of %v bytes, wanted the original %v bytes", len(body), len(big))
+	}
+
+	for _, tc := range []struct {
+		url            string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"/?type=application/json", "", ""},
+		{"/?type=application/json", "gzip;q=0", ""},
+		{"/?type=application/json&small=true", "gzip", ""},
+		{"/?type=image/png", "gzip", ""},
+		{"/?type=application/json&encoded=true", "gzip", "br"},
+	} {
+		rec := serve(tc.url, tc.acceptEncoding)
+		if got := rec.Header().Get("Content-Encoding"); got != tc.wantEncoding {
+			t.Errorf("Got Content-Encoding %q for %q with %q, wanted %q", got, tc.url, tc.acceptEncoding, tc.wantEncoding)
+		}
+		if tc.wantEncoding == "" && rec.Body.Len() == 0 {
+			t.Errorf("Got an empty body for %q with %q", tc.url, tc.acceptEncoding)
+		}
+	}
+}
+
+func TestCompressResponsesFlush(t *testing.T) {
+	var flushed []byte
+	handler := CompressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		flushed = append(flushed, w.(*gzipResponseWriter).ResponseWriter.(*httptest.ResponseRecorder).Body.Bytes()...)
+		w.Write([]byte("data: second\n\n"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Errorf("Wanted the underlying writer flushed")
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Got Content-Encoding %q, wanted gzip", got)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(flushed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(reader, first); err != nil || string(first) != "data: first\n\n" {
+		t.Errorf("Got %q (%v) before the handler finished, wanted the first event", first, err)
+	}
+	reader, err = gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "data: first\n\ndata: second\n\n" {
+		t.Errorf("Got %q, wanted both events", body)
+	}
+}
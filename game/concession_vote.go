@@ -0,0 +1,160 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+// ConcessionVote is the vote of a nation to concede the game to Winner.
+type ConcessionVote struct {
+	Nation godip.Nation
+	Winner godip.Nation `methods:"POST"`
+}
+
+// concessionLeaders returns the active nations owning the most supply centers.
+func concessionLeaders(scCounts map[godip.Nation]int, active Nations) Nations {
+	most := 0
+	for _, nation := range active {
+		if scCounts[nation] > most {
+			most = scCounts[nation]
+		}
+	}
+	result := Nations{}
+	for _, nation := range active {
+		if scCounts[nation] == most {
+			result = append(result, nation)
+		}
+	}
+	return result
+}
+
+// eligibleConcessionWinner returns whether the game can be conceded to winner: an active nation, that is also
+// among the leaders unless the game allows conceding to any nation.
+func (g *Game) eligibleConcessionWinner(winner godip.Nation, scCounts map[godip.Nation]int, active Nations) bool {
+	if !active.Includes(winner) {
+		return false
+	}
+	return g.ConcedeToAnyNation || concessionLeaders(scCounts, active).Includes(winner)
+}
+
+// concessionQuorum returns whether all active nations except winner have voted to concede to winner.
+func concessionQuorum(votes []ConcessionVote, winner godip.Nation, active Nations) bool {
+	votedFor := map[godip.Nation]godip.Nation{}
+	for _, vote := range votes {
+		votedFor[vote.Nation] = vote.Winner
+	}
+	for _, nation := range active {
+		if nation != winner && votedFor[nation] != winner {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutConcessionVoteBy returns votes without the vote of nation, and whether there was one.
+func withoutConcessionVoteBy(votes []ConcessionVote, nation godip.Nation) ([]ConcessionVote, bool) {
+	result := []ConcessionVote{}
+	found := false
+	for _, vote := range votes {
+		if vote.Nation == nation {
+			found = true
+		} else {
+			result = append(result, vote)
+		}
+	}
+	return result, found
+}
+
+func voteConcession(w ResponseWriter, r Request) error {
+	vote := &ConcessionVote{}
+	if err := Copy(vote, r, "POST"); err != nil {
+		return err
+	}
+	return changeConcessionVote(w, r, vote)
+}
+
+func withdrawConcessionVote(w ResponseWriter, r Request) error {
+	return changeConcessionVote(w, r, nil)
+}
+
+/*
+ * changeConcessionVote replaces the concession vote of the member with vote, or removes it if vote is nil. When all other
+ * survivors have voted to concede to the same nation, the game finishes with that nation as the winner.
+ */
+func changeConcessionVote(w ResponseWriter, r Request, vote *ConcessionVote) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		*game = Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+		game.ID = gameID
+
+		if !game.Started || !game.Mustered || game.Finished || len(game.NewestPhaseMeta) != 1 {
+			return HTTPErr{"can only vote for concessions in running games", http.StatusPreconditionFailed}
+		}
+		member, isMember := game.GetMemberByUserId(user.Id)
+		if !isMember {
+			return HTTPErr{"can only vote for concessions in member games", http.StatusNotFound}
+		}
+		active := game.activeNations()
+		if !active.Includes(member.Nation) {
+			return HTTPErr{"only survivors can vote for concessions", http.StatusPreconditionFailed}
+		}
+
+		var hadVote bool
+		game.ConcessionVotes, hadVote = withoutConcessionVoteBy(game.ConcessionVotes, member.Nation)
+		if vote == nil {
+			if !hadVote {
+				return HTTPErr{"can only withdraw concession votes you have made", http.StatusNotFound}
+			}
+			return game.DBSave(ctx)
+		}
+
+		if vote.Winner == member.Nation {
+			return HTTPErr{"can't concede to yourself", http.StatusBadRequest}
+		}
+		phase, err := loadNewestPhase(ctx, game)
+		if err != nil {
+			return err
+		}
+		if !game.eligibleConcessionWinner(vote.Winner, scCountsOf(phase), active) {
+			if game.ConcedeToAnyNation {
+				return HTTPErr{fmt.Sprintf("can only concede to surviving nations, not %q", vote.Winner), http.StatusBadRequest}
+			}
+			return HTTPErr{fmt.Sprintf("can only concede to the surviving nations with the most supply centers, not %q", vote.Winner), http.StatusBadRequest}
+		}
+		vote.Nation = member.Nation
+		game.ConcessionVotes = append(game.ConcessionVotes, *vote)
+		if !concessionQuorum(game.ConcessionVotes, vote.Winner, active) {
+			return game.DBSave(ctx)
+		}
+		return finishVotedGame(ctx, r.Req().Host, game, phase, vote.Winner, nil, fmt.Sprintf("The other nations have conceded the game to %s.", vote.Winner))
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
+		return err
+	}
+
+	game.Redact(user, viewerIsSuperuser(ctx, user), r)
+	w.SetContent(game.Item(r))
+	return nil
+}
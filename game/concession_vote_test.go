@@ -0,0 +1,46 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/godip"
+)
+
+func TestConcessionWinner(t *testing.T) {
+	active := Nations{godip.England, godip.France, godip.Russia}
+	scCounts := map[godip.Nation]int{godip.England: 3, godip.France: 3, godip.Russia: 4, godip.Austria: 0}
+	g := &Game{}
+	if !g.eligibleConcessionWinner(godip.Russia, scCounts, active) {
+		t.Errorf("Got the leader ineligible, wanted eligible")
+	}
+	if g.eligibleConcessionWinner(godip.England, scCounts, active) {
+		t.Errorf("Got a non leader eligible, wanted ineligible")
+	}
+	g.ConcedeToAnyNation = true
+	if !g.eligibleConcessionWinner(godip.England, scCounts, active) {
+		t.Errorf("Got a non leader ineligible when conceding to any nation, wanted eligible")
+	}
+	if g.eligibleConcessionWinner(godip.Austria, scCounts, active) {
+		t.Errorf("Got an eliminated nation eligible, wanted ineligible")
+	}
+}
+
+func TestConcessionQuorum(t *testing.T) {
+	active := Nations{godip.England, godip.France, godip.Russia}
+	votes := []ConcessionVote{{Nation: godip.England, Winner: godip.Russia}}
+	if concessionQuorum(votes, godip.Russia, active) {
+		t.Errorf("Got quorum with one of two votes, wanted no quorum")
+	}
+	votes = append(votes, ConcessionVote{Nation: godip.France, Winner: godip.England})
+	if concessionQuorum(votes, godip.Russia, active) {
+		t.Errorf("Got quorum with votes for different winners, wanted no quorum")
+	}
+	votes, found := withoutConcessionVoteBy(votes, godip.France)
+	if !found || len(votes) != 1 {
+		t.Fatalf("Got %+v, %v after removing the vote of France, wanted one vote left", votes, found)
+	}
+	votes = append(votes, ConcessionVote{Nation: godip.France, Winner: godip.Russia})
+	if !concessionQuorum(votes, godip.Russia, active) {
+		t.Errorf("Got no quorum when all other survivors voted for the winner, wanted quorum")
+	}
+}
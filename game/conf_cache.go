@@ -0,0 +1,48 @@
+package game
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/datastore"
+)
+
+const (
+	// How long instances remember configuration that can be replaced, or that it's missing, before loading it again.
+	confCacheTTL = time.Minute
+)
+
+// confCache keeps a configuration entity in the instance for confCacheTTL, so that it isn't loaded for every request,
+// while replaced configuration still takes effect without restarting the instances.
+type confCache struct {
+	lock     sync.RWMutex
+	conf     interface{}
+	err      error
+	loadedAt time.Time
+}
+
+// get returns the cached configuration, or loads the entity at key into conf and caches it.
+// Missing configuration is cached as datastore.ErrNoSuchEntity.
+func (c *confCache) get(ctx context.Context, key *datastore.Key, conf interface{}) (interface{}, error) {
+	c.lock.RLock()
+	if time.Since(c.loadedAt) < confCacheTTL {
+		defer c.lock.RUnlock()
+		return c.conf, c.err
+	}
+	c.lock.RUnlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if time.Since(c.loadedAt) < confCacheTTL {
+		return c.conf, c.err
+	}
+	if err := datastore.Get(ctx, key, conf); err == datastore.ErrNoSuchEntity {
+		c.conf, c.err = nil, err
+	} else if err != nil {
+		return nil, err
+	} else {
+		c.conf, c.err = conf, nil
+	}
+	c.loadedAt = time.Now()
+	return c.conf, c.err
+}
@@ -0,0 +1,150 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+const (
+	corsConfKind = "CORSConf"
+)
+
+var (
+	prodCORSConf = &confCache{}
+)
+
+// CORSConf restricts which origins browsers let read the responses of the server.
+type CORSConf struct {
+	// AllowedOrigins are the origins, like https://diplicity.com, allowed to make requests with credentials.
+	AllowedOrigins []string
+}
+
+func (c *CORSConf) Validate() error {
+	if len(c.AllowedOrigins) == 0 {
+		return fmt.Errorf("AllowedOrigins can't be empty")
+	}
+	for _, origin := range c.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Scheme+"://"+u.Host != origin {
+			return fmt.Errorf("%q is not an origin like https://example.com", origin)
+		}
+	}
+	return nil
+}
+
+func (c *CORSConf) allows(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func getCORSConfKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, corsConfKind, prodKey, 0, nil)
+}
+
+// SetCORS creates or replaces the CORS configuration. Must be called inside a transaction.
+func SetCORS(ctx context.Context, corsConf *CORSConf) error {
+	if _, err := datastore.Put(ctx, getCORSConfKey(ctx), corsConf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getCORSConf(ctx context.Context) (*CORSConf, error) {
+	conf, err := prodCORSConf.get(ctx, getCORSConfKey(ctx), &CORSConf{})
+	if err != nil {
+		return nil, err
+	}
+	return conf.(*CORSConf), nil
+}
+
+// configuredCORSConf returns the configured CORS restrictions, or nil if none are configured.
+func configuredCORSConf(r *http.Request) (*CORSConf, error) {
+	conf, err := getCORSConf(appengine.NewContext(r))
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+/*
+ * RestrictCORSOrigins replaces the wildcard CORS headers set by the handlers, including the OPTIONS
+ * preflight handler, when CORS is configured. Allowed origins are echoed back and allowed to send
+ * credentials, and other origins get no Access-Control-Allow-Origin header at all. Without any
+ * configuration the wildcard headers are kept.
+ */
+func RestrictCORSOrigins(next http.Handler) http.Handler {
+	return restrictCORSOrigins(next, configuredCORSConf)
+}
+
+func restrictCORSOrigins(next http.Handler, loadConf func(*http.Request) (*CORSConf, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		// Browsers send Origin with all cross origin requests, and only enforce CORS for those.
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		conf, err := loadConf(r)
+		if err != nil {
+			log.Errorf(appengine.NewContext(r), "Unable to load CORS configuration: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if conf == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &corsResponseWriter{ResponseWriter: w, conf: conf, origin: origin}
+		next.ServeHTTP(cw, r)
+		// Handlers not writing anything get their headers written after they return.
+		cw.restrict()
+	})
+}
+
+// corsResponseWriter restricts the CORS headers set by the handler before they are written.
+type corsResponseWriter struct {
+	http.ResponseWriter
+	conf       *CORSConf
+	origin     string
+	restricted bool
+}
+
+func (c *corsResponseWriter) restrict() {
+	if c.restricted {
+		return
+	}
+	c.restricted = true
+	if c.Header().Get("Access-Control-Allow-Origin") == "" {
+		return
+	}
+	if c.conf.allows(c.origin) {
+		c.Header().Set("Access-Control-Allow-Origin", c.origin)
+		c.Header().Set("Access-Control-Allow-Credentials", "true")
+	} else {
+		c.Header().Del("Access-Control-Allow-Origin")
+		c.Header().Del("Access-Control-Allow-Credentials")
+	}
+}
+
+func (c *corsResponseWriter) WriteHeader(status int) {
+	c.restrict()
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *corsResponseWriter) Write(b []byte) (int, error) {
+	c.restrict()
+	return c.ResponseWriter.Write(b)
+}
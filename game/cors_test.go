@@ -0,0 +1,81 @@
+package game
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/zond/goaeoas"
+)
+
+func TestCORSConfValidate(t *testing.T) {
+	if err := (&CORSConf{AllowedOrigins: []string{"https://diplicity.com", "http://localhost:8080"}}).Validate(); err != nil {
+		t.Errorf("Got %v, wanted no error", err)
+	}
+	for _, origins := range [][]string{
+		nil,
+		{"*"},
+		{"diplicity.com"},
+		{"https://diplicity.com/"},
+		{"https://diplicity.com/path"},
+		{"ftp://diplicity.com"},
+	} {
+		if err := (&CORSConf{AllowedOrigins: origins}).Validate(); err == nil {
+			t.Errorf("Got no error for %v, wanted one", origins)
+		}
+	}
+}
+
+func TestRestrictCORSOrigins(t *testing.T) {
+	conf := &CORSConf{AllowedOrigins: []string{"https://allowed.com"}}
+	handler := func(conf *CORSConf) http.Handler {
+		return restrictCORSOrigins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Like the goaeoas handlers and the OPTIONS preflight handler.
+			CORSHeaders(w)
+			if r.Method != "OPTIONS" {
+				w.Write([]byte("{}"))
+			}
+		}), func(*http.Request) (*CORSConf, error) {
+			return conf, nil
+		})
+	}
+	serve := func(conf *CORSConf, method string, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		handler(conf).ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		conf            *CORSConf
+		method          string
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{conf, "GET", "https://allowed.com", "https://allowed.com", "true"},
+		{conf, "OPTIONS", "https://allowed.com", "https://allowed.com", "true"},
+		{conf, "GET", "https://disallowed.com", "", ""},
+		{conf, "OPTIONS", "https://disallowed.com", "", ""},
+		{nil, "GET", "https://disallowed.com", "*", ""},
+		{nil, "OPTIONS", "https://disallowed.com", "*", ""},
+	} {
+		rec := serve(tc.conf, tc.method, tc.origin)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+			t.Errorf("Got Access-Control-Allow-Origin %q for %v from %q with %+v, wanted %q", got, tc.method, tc.origin, tc.conf, tc.wantOrigin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tc.wantCredentials {
+			t.Errorf("Got Access-Control-Allow-Credentials %q for %v from %q with %+v, wanted %q", got, tc.method, tc.origin, tc.conf, tc.wantCredentials)
+		}
+		if got := rec.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("Got Vary %q for %v from %q with %+v, wanted Origin", got, tc.method, tc.origin, tc.conf)
+		}
+	}
+
+	if rec := serve(conf, "OPTIONS", "https://allowed.com"); rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("Got status %v and headers %+v for an allowed preflight, wanted 200 and the allowed methods", rec.Code, rec.Header())
+	}
+}
@@ -0,0 +1,340 @@
+package game
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/go-fcm"
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	deadlineReminderKind = "DeadlineReminder"
+)
+
+var (
+	sendDeadlineReminderMailFunc *DelayFunc
+	sendDeadlineReminderFCMFunc  *DelayFunc
+)
+
+func init() {
+	sendDeadlineReminderMailFunc = NewDelayFunc("game-sendDeadlineReminderMail", sendDeadlineReminderMail)
+	sendDeadlineReminderFCMFunc = NewDelayFunc("game-sendDeadlineReminderFCM", sendDeadlineReminderFCM)
+}
+
+// DeadlineReminder marks that a member has been sent deadline reminders
+// for a phase, so that a rescheduled phase deadline warning never reminds anyone twice.
+type DeadlineReminder struct {
+	GameID       *datastore.Key
+	PhaseOrdinal int64
+	Nation       godip.Nation
+	UserId       string
+	CreatedAt    time.Time
+}
+
+func DeadlineReminderID(ctx context.Context, phaseID *datastore.Key, nation godip.Nation) (*datastore.Key, error) {
+	if phaseID == nil || nation == "" {
+		return nil, fmt.Errorf("deadline reminders must have phases and nations")
+	}
+	return datastore.NewKey(ctx, deadlineReminderKind, string(nation), 0, phaseID), nil
+}
+
+// scheduleDeadlineReminders schedules a mail and an FCM deadline reminder for the member, when sending its
+// phase deadline warning, unless the member has already given orders or been reminded about the phase.
+func scheduleDeadlineReminders(ctx context.Context, phaseID *datastore.Key, member *Member) error {
+	if member.NewestPhaseState.NoOrders || member.NewestPhaseState.Eliminated {
+		return nil
+	}
+	orderIDs, err := datastore.NewQuery(orderKind).Ancestor(phaseID).Filter("Nation=", member.Nation).KeysOnly().Limit(1).GetAll(ctx, nil)
+	if err != nil {
+		log.Errorf(ctx, "Unable to load orders of %v for %v: %v; hope datastore gets fixed", member.Nation, phaseID, err)
+		return err
+	}
+	if len(orderIDs) > 0 {
+		log.Infof(ctx, "%v already has orders for %v, no need to remind", member.Nation, phaseID)
+		return nil
+	}
+	reminderID, err := DeadlineReminderID(ctx, phaseID, member.Nation)
+	if err != nil {
+		log.Errorf(ctx, "DeadlineReminderID(..., %v, %v): %v; fix the DeadlineReminderID func", phaseID, member.Nation, err)
+		return err
+	}
+	gameID := phaseID.Parent()
+	phaseOrdinal := phaseID.IntID()
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := datastore.Get(ctx, reminderID, &DeadlineReminder{}); err == nil {
+			log.Infof(ctx, "%v already reminded about %v, skipping", member.Nation, phaseID)
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if _, err := datastore.Put(ctx, reminderID, &DeadlineReminder{
+			GameID:       gameID,
+			PhaseOrdinal: phaseOrdinal,
+			Nation:       member.Nation,
+			UserId:       member.User.Id,
+			CreatedAt:    time.Now(),
+		}); err != nil {
+			return err
+		}
+		if err := sendDeadlineReminderMailFunc.EnqueueIn(ctx, 0, gameID, phaseOrdinal, member.User.Id); err != nil {
+			return err
+		}
+		return sendDeadlineReminderFCMFunc.EnqueueIn(ctx, 0, gameID, phaseOrdinal, member.User.Id)
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		log.Errorf(ctx, "Unable to mark and schedule deadline reminder for %v: %v; hope datastore gets fixed", member.Nation, err)
+		return err
+	}
+	return nil
+}
+
+func sendDeadlineReminderMail(ctx context.Context, gameID *datastore.Key, phaseOrdinal int64, userId string) error {
+	log.Infof(ctx, "sendDeadlineReminderMail(..., %v, %v, %q)", gameID, phaseOrdinal, userId)
+
+	phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		log.Errorf(ctx, "PhaseID(..., %v, %v): %v, %v; fix the PhaseID func", gameID, phaseOrdinal, phaseID, err)
+		return err
+	}
+
+	userID := auth.UserID(ctx, userId)
+	game := &Game{}
+	phase := &Phase{}
+	user := &auth.User{}
+	userConfig := &auth.UserConfig{}
+	if err := datastore.GetMulti(
+		ctx,
+		[]*datastore.Key{gameID, phaseID, userID, auth.UserConfigID(ctx, userID)},
+		[]interface{}{game, phase, user, userConfig},
+	); err != nil {
+		if merr, ok := err.(appengine.MultiError); ok && merr[0] == nil && merr[1] == nil && merr[2] == nil && merr[3] == datastore.ErrNoSuchEntity {
+			log.Infof(ctx, "%q has no configuration, will skip sending reminder", userId)
+			return nil
+		} else if ok && (merr[0] == datastore.ErrNoSuchEntity || merr[1] == datastore.ErrNoSuchEntity) {
+			log.Warningf(ctx, "Game or Phase is missing, manually deleted or whatever - giving up")
+			return nil
+		}
+		log.Errorf(ctx, "Unable to load game, phase, user and user config: %v; hope datastore gets fixed", err)
+		return err
+	}
+	game.ID = gameID
+
+	if game.Finished || phase.Resolved {
+		log.Infof(ctx, "Game finished or phase resolved, no need to remind %q", userId)
+		return nil
+	}
+
+	if !userConfig.WantsMail(auth.NotificationDeadlineReminder) {
+		log.Infof(ctx, "%q doesn't want deadline reminder mail, will skip sending reminder", userId)
+		return nil
+	}
+
+	member, isMember := game.GetMemberByUserId(userId)
+	if !isMember {
+		log.Infof(ctx, "%q is no longer a member of %v, will skip sending reminder", userId, gameID)
+		return nil
+	}
+
+	gameState, err := loadMemberGameState(ctx, gameID, member.Nation)
+	if err != nil {
+		log.Errorf(ctx, "Unable to load game state of %v in %v: %v; hope datastore gets fixed", member.Nation, gameID, err)
+		return err
+	}
+	if gameState.NotificationSettings.MuteDeadlineReminders {
+		log.Infof(ctx, "%v has muted deadline reminders for %v, will skip sending reminder", member.Nation, gameID)
+		return nil
+	}
+
+	recipEmail, err := mail.ParseAddress(user.Email)
+	if err != nil {
+		log.Errorf(ctx, "Unable to parse email address of %v: %v; unable to recover, exiting", PP(user), err)
+		return nil
+	}
+
+	ordersURL, err := router.Get(ListOrdersRoute).URL("game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phaseOrdinal))
+	if err != nil {
+		log.Errorf(ctx, "Unable to create orders URL for game %v and phase %v: %v; wtf?", gameID, phaseOrdinal, err)
+		return err
+	}
+	ordersURL.Host = phase.Host
+	ordersURL.Scheme = DefaultScheme
+
+	unsubscribeURL, err := auth.GetUnsubscribeURL(ctx, router, phase.Host, userId)
+	if err != nil {
+		log.Errorf(ctx, "Unable to create unsubscribe URL for %q: %v; fix auth.GetUnsubscribeURL", userId, err)
+		return err
+	}
+	unsubscribeAddress, err := auth.GetUnsubscribeAddress(ctx, userId)
+	if err != nil {
+		log.Errorf(ctx, "Unable to create unsubscribe address for %q: %v; fix auth.GetUnsubscribeAddress", userId, err)
+		return err
+	}
+
+	msg := &auth.EMail{
+		ToAddr: recipEmail.Address,
+		ToName: string(member.Nation),
+		Subject: fmt.Sprintf(
+			"%s: %s %d, %s resolves in %v",
+			game.DescFor(member.Nation),
+			phase.Season,
+			phase.Year,
+			phase.Type,
+			phase.DeadlineAt.Sub(time.Now()).Round(time.Minute),
+		),
+		TextBody: fmt.Sprintf(
+			"You haven't given any orders for %s %d, %s in %s, and it resolves at %v.\n\nVisit %s to give your orders.\n\nVisit %s to stop receiving email like this.",
+			phase.Season,
+			phase.Year,
+			phase.Type,
+			game.DescFor(member.Nation),
+			phase.DeadlineAt.Format(time.RFC822),
+			ordersURL.String(),
+			unsubscribeURL.String(),
+		),
+		UnsubscribeURL:     unsubscribeURL.String(),
+		UnsubscribeAddress: unsubscribeAddress,
+	}
+	if err := msg.Send(ctx); err != nil {
+		log.Errorf(ctx, "Unable to send %v: %v; hope sendgrid gets fixed", msg, err)
+		return err
+	}
+	log.Infof(ctx, "Successfully sent %v", PP(msg))
+
+	log.Infof(ctx, "sendDeadlineReminderMail(..., %v, %v, %q) *** SUCCESS ***", gameID, phaseOrdinal, userId)
+
+	return nil
+}
+
+func sendDeadlineReminderFCM(ctx context.Context, gameID *datastore.Key, phaseOrdinal int64, userId string) error {
+	log.Infof(ctx, "sendDeadlineReminderFCM(..., %v, %v, %q)", gameID, phaseOrdinal, userId)
+
+	phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		log.Errorf(ctx, "PhaseID(..., %v, %v): %v, %v; fix the PhaseID func", gameID, phaseOrdinal, phaseID, err)
+		return err
+	}
+
+	userID := auth.UserID(ctx, userId)
+	game := &Game{}
+	phase := &Phase{}
+	userConfig := &auth.UserConfig{}
+	if err := datastore.GetMulti(
+		ctx,
+		[]*datastore.Key{gameID, phaseID, auth.UserConfigID(ctx, userID)},
+		[]interface{}{game, phase, userConfig},
+	); err != nil {
+		if merr, ok := err.(appengine.MultiError); ok && merr[0] == nil && merr[1] == nil && merr[2] == datastore.ErrNoSuchEntity {
+			log.Infof(ctx, "%q has no configuration, will skip sending reminder", userId)
+			return nil
+		} else if ok && (merr[0] == datastore.ErrNoSuchEntity || merr[1] == datastore.ErrNoSuchEntity) {
+			log.Warningf(ctx, "Game or Phase is missing, manually deleted or whatever - giving up")
+			return nil
+		}
+		log.Errorf(ctx, "Unable to load game, phase and user config: %v; hope datastore gets fixed", err)
+		return err
+	}
+	game.ID = gameID
+
+	if game.Finished || phase.Resolved {
+		log.Infof(ctx, "Game finished or phase resolved, no need to remind %q", userId)
+		return nil
+	}
+
+	if userConfig.NotificationPreferences.Mutes(auth.NotificationDeadlineReminder) {
+		log.Infof(ctx, "%q has muted deadline reminders, will skip sending reminder", userId)
+		return nil
+	}
+
+	member, isMember := game.GetMemberByUserId(userId)
+	if !isMember {
+		log.Infof(ctx, "%q is no longer a member of %v, will skip sending reminder", userId, gameID)
+		return nil
+	}
+
+	gameState, err := loadMemberGameState(ctx, gameID, member.Nation)
+	if err != nil {
+		log.Errorf(ctx, "Unable to load game state of %v in %v: %v; hope datastore gets fixed", member.Nation, gameID, err)
+		return err
+	}
+	if gameState.NotificationSettings.MuteDeadlineReminders {
+		log.Infof(ctx, "%v has muted deadline reminders for %v, will skip sending reminder", member.Nation, gameID)
+		return nil
+	}
+
+	ordersURL, err := router.Get(ListOrdersRoute).URL("game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phaseOrdinal))
+	if err != nil {
+		log.Errorf(ctx, "Unable to create orders URL for game %v and phase %v: %v; wtf?", gameID, phaseOrdinal, err)
+		return err
+	}
+	ordersURL.Host = phase.Host
+	ordersURL.Scheme = DefaultScheme
+
+	remaining := phase.DeadlineAt.Sub(time.Now()).Round(time.Minute)
+	notificationPayload := &fcm.NotificationPayload{
+		Title: fmt.Sprintf(
+			"%s: %s %d, %s resolves in %v",
+			game.DescFor(member.Nation),
+			phase.Season,
+			phase.Year,
+			phase.Type,
+			remaining,
+		),
+		Body:        fmt.Sprintf("You haven't given any orders yet, and %s resolves at %v.", game.DescFor(member.Nation), phase.DeadlineAt.Format(time.RFC822)),
+		Tag:         "diplicity-engine-deadline-reminder",
+		ClickAction: ordersURL.String(),
+	}
+
+	if !hasEnabledFCMTokens(userConfig) {
+		log.Infof(ctx, "%q hasn't registered any enabled FCM tokens, will fall back to web push", userId)
+		return sendWebPushFallback(ctx, userId, userConfig, notificationPayload)
+	}
+
+	dataPayload, err := NewFCMData(map[string]interface{}{
+		"type":             "deadlineReminder",
+		"gameID":           gameID,
+		"phaseOrdinal":     phaseOrdinal,
+		"deadlineAt":       phase.DeadlineAt,
+		"remainingSeconds": int64(remaining.Seconds()),
+	})
+	if err != nil {
+		log.Errorf(ctx, "Unable to encode FCM data payload: %v; fix NewFCMData", err)
+		return err
+	}
+
+	batches := fcmBatches{}
+	for _, fcmToken := range userConfig.FCMTokens {
+		if fcmToken.Disabled || fcmToken.Value == "" {
+			continue
+		}
+		tokenNotification := notificationPayload
+		tokenData := dataPayload
+		if fcmToken.PhaseConfig.DontSendData {
+			tokenData = nil
+		}
+		if fcmToken.PhaseConfig.DontSendNotification {
+			tokenNotification = nil
+		}
+		if err := batches.add(userId, fcmToken.Value, tokenNotification, tokenData); err != nil {
+			log.Errorf(ctx, "Unable to batch reminder to %v/%v: %v; fix fcmBatches", userId, fcmToken.Value, err)
+			return err
+		}
+	}
+	if err := batches.each(func(batch *fcmBatch) error {
+		return FCMSendToTokensFunc.EnqueueIn(ctx, 0, time.Duration(0), batch.notif, batch.data, batch.tokens)
+	}); err != nil {
+		log.Errorf(ctx, "Unable to enqueue actual sending of reminder to %q: %v; hope datastore gets fixed", userId, err)
+		return err
+	}
+
+	log.Infof(ctx, "sendDeadlineReminderFCM(..., %v, %v, %q) *** SUCCESS ***", gameID, phaseOrdinal, userId)
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	// DrawRuleDIAS needs votes from all surviving nations, counting nations on probation as voting, and the draw includes all survivors.
+	// Games without a DrawRule use it.
+	DrawRuleDIAS = "DIAS"
+	// DrawRuleUnanimous needs explicit votes from all surviving nations, and the draw includes all survivors.
+	DrawRuleUnanimous = "Unanimous"
+	// DrawRuleMajority needs explicit votes from more than half of the surviving nations, and the draw includes only the voters.
+	DrawRuleMajority = "Majority"
+)
+
+var drawRules = []string{DrawRuleDIAS, DrawRuleUnanimous, DrawRuleMajority}
+
+// validDrawRule returns whether rule is empty or one of the draw rules.
+func validDrawRule(rule string) bool {
+	if rule == "" {
+		return true
+	}
+	for _, drawRule := range drawRules {
+		if drawRule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// onProbationNations returns the nations of members on probation in the newest phase.
+func (g *Game) onProbationNations() Nations {
+	result := Nations{}
+	for _, member := range g.Members {
+		if member.NewestPhaseState.OnProbation {
+			result = append(result, member.Nation)
+		}
+	}
+	return result
+}
+
+// tallyDrawVotes returns the nations sharing the draw, and whether votes reach the threshold of rule given the active nations and
+// the nations on probation among them.
+func tallyDrawVotes(rule string, votes Nations, active Nations, onProbation Nations) (Nations, bool) {
+	voters := Nations{}
+	for _, nation := range active {
+		if votes.Includes(nation) || (rule != DrawRuleUnanimous && rule != DrawRuleMajority && onProbation.Includes(nation)) {
+			voters = append(voters, nation)
+		}
+	}
+	if len(active) == 0 {
+		return nil, false
+	}
+	if rule == DrawRuleMajority {
+		return voters, len(voters)*2 > len(active)
+	}
+	return active, len(voters) == len(active)
+}
+
+// loadNewestPhase loads the newest phase of the started game.
+func loadNewestPhase(ctx context.Context, game *Game) (*Phase, error) {
+	phaseID, err := PhaseID(ctx, game.ID, game.NewestPhaseMeta[0].PhaseOrdinal)
+	if err != nil {
+		return nil, err
+	}
+	phase := &Phase{}
+	if err := datastore.Get(ctx, phaseID, phase); err != nil {
+		return nil, err
+	}
+	return phase, nil
+}
+
+// scCountsOf returns the number of supply centers each nation owns in phase.
+func scCountsOf(phase *Phase) map[godip.Nation]int {
+	result := map[godip.Nation]int{}
+	for _, sc := range phase.SCs {
+		result[sc.Owner]++
+	}
+	return result
+}
+
+/*
+ * finishVotedGame finishes the game in phase, the newest phase, after a successful vote. The game is won by soloWinner if
+ * it isn't empty, otherwise it is drawn between drawers. Saves the game result, and notifies the members with notificationBody.
+ * Must be run inside a transaction.
+ */
+func finishVotedGame(ctx context.Context, host string, game *Game, phase *Phase, soloWinner godip.Nation, drawers Nations, notificationBody string) error {
+	// Just to ensure we don't try to resolve it, even by mistake.
+	phase.Resolved = true
+	phase.ResolvedAt = time.Now()
+	if err := phase.DBSave(ctx); err != nil {
+		return err
+	}
+
+	game.Finished = true
+	game.FinishedAt = time.Now()
+	game.Closed = true
+	game.ResultType = gameResultType(soloWinner, soloWinner != "")
+	game.DrawVotes = nil
+	game.ConcessionVotes = nil
+	game.NewestPhaseMeta = []PhaseMeta{phase.PhaseMeta}
+
+	scCounts := scCountsOf(phase)
+	gameResult := &GameResult{
+		GameID:           game.ID,
+		SoloWinnerMember: soloWinner,
+		ResultType:       game.ResultType,
+		Private:          game.Private,
+		CreatedAt:        time.Now(),
+	}
+	uids := []string{}
+	for i := range game.Members {
+		member := &game.Members[i]
+		member.NewestPhaseState.ZippedOptions = nil
+		eliminated := scCounts[member.Nation] == 0
+		drawer := !eliminated && soloWinner == "" && drawers.Includes(member.Nation)
+		nmr := !eliminated && !drawer && member.Nation != soloWinner && member.NewestPhaseState.OnProbation
+		switch {
+		case eliminated:
+			gameResult.EliminatedMembers = append(gameResult.EliminatedMembers, member.Nation)
+		case nmr:
+			gameResult.NMRMembers = append(gameResult.NMRMembers, member.Nation)
+		case drawer:
+			gameResult.DIASMembers = append(gameResult.DIASMembers, member.Nation)
+		}
+		// Abandoned nations nobody took over don't have anyone to score.
+		if member.Vacant() {
+			continue
+		}
+		if member.Nation == soloWinner {
+			gameResult.SoloWinnerUser = member.User.Id
+		}
+		uids = append(uids, member.User.Id)
+		gameResult.AllUsers = append(gameResult.AllUsers, member.User.Id)
+		switch {
+		case eliminated:
+			gameResult.EliminatedUsers = append(gameResult.EliminatedUsers, member.User.Id)
+		case nmr:
+			gameResult.NMRUsers = append(gameResult.NMRUsers, member.User.Id)
+		case drawer:
+			gameResult.DIASUsers = append(gameResult.DIASUsers, member.User.Id)
+		}
+		gameResult.Scores = append(gameResult.Scores, GameScore{
+			UserId: member.User.Id,
+			Member: member.Nation,
+			SCs:    scCounts[member.Nation],
+		})
+	}
+	gameResult.AssignScores()
+	if err := gameResult.DBSave(ctx, game); err != nil {
+		return err
+	}
+	if err := game.DBSave(ctx); err != nil {
+		return err
+	}
+
+	if game.Private {
+		if err := UpdateUserStatsASAP(ctx, uids); err != nil {
+			return err
+		}
+	} else if err := UpdateTrueSkillsASAP(ctx); err != nil {
+		return err
+	}
+
+	members := make([]string, len(game.Members))
+	for idx := range game.Members {
+		members[idx] = string(game.Members[idx].Nation)
+	}
+	if err := AsyncSendMsgFunc.EnqueueIn(
+		ctx, 0,
+		game.ID,
+		DiplicitySender,
+		members,
+		notificationBody,
+		host,
+	); err != nil {
+		log.Errorf(ctx, "AsyncSendMsgFunc(..., %v, %v, %+v, %q, %q): %v; fix it?", game.ID, DiplicitySender, members, notificationBody, host, err)
+		return err
+	}
+
+	return nil
+}
+
+// nationNames returns the nations separated by commas.
+func nationNames(nations Nations) string {
+	names := make([]string, len(nations))
+	for idx := range nations {
+		names[idx] = string(nations[idx])
+	}
+	return strings.Join(names, ", ")
+}
+
+func voteDraw(w ResponseWriter, r Request) error {
+	return changeDrawVote(w, r, true)
+}
+
+func withdrawDrawVote(w ResponseWriter, r Request) error {
+	return changeDrawVote(w, r, false)
+}
+
+// changeDrawVote adds or removes the draw vote of the member, and finishes the game with a draw when the votes reach the threshold of the draw rule.
+func changeDrawVote(w ResponseWriter, r Request, vote bool) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		*game = Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+		game.ID = gameID
+
+		if !game.Started || !game.Mustered || game.Finished || len(game.NewestPhaseMeta) != 1 {
+			return HTTPErr{"can only vote for draws in running games", http.StatusPreconditionFailed}
+		}
+		member, isMember := game.GetMemberByUserId(user.Id)
+		if !isMember {
+			return HTTPErr{"can only vote for draws in member games", http.StatusNotFound}
+		}
+		if member.NewestPhaseState.Eliminated {
+			return HTTPErr{"eliminated nations can't vote for draws", http.StatusPreconditionFailed}
+		}
+
+		if !vote {
+			if !game.DrawVotes.Includes(member.Nation) {
+				return HTTPErr{"can only withdraw draw votes you have made", http.StatusNotFound}
+			}
+			remaining := Nations{}
+			for _, nation := range game.DrawVotes {
+				if nation != member.Nation {
+					remaining = append(remaining, nation)
+				}
+			}
+			game.DrawVotes = remaining
+			return game.DBSave(ctx)
+		}
+
+		if !game.DrawVotes.Includes(member.Nation) {
+			game.DrawVotes = append(game.DrawVotes, member.Nation)
+		}
+		drawers, drawn := tallyDrawVotes(game.DrawRule, game.DrawVotes, game.activeNations(), game.onProbationNations())
+		if !drawn {
+			return game.DBSave(ctx)
+		}
+		phase, err := loadNewestPhase(ctx, game)
+		if err != nil {
+			return err
+		}
+		return finishVotedGame(ctx, r.Req().Host, game, phase, "", drawers, fmt.Sprintf("The game has ended in a draw between %s.", nationNames(drawers)))
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
+		return err
+	}
+
+	game.Redact(user, viewerIsSuperuser(ctx, user), r)
+	w.SetContent(game.Item(r))
+	return nil
+}
@@ -0,0 +1,45 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zond/godip"
+)
+
+func TestTallyDrawVotes(t *testing.T) {
+	active := Nations{godip.England, godip.France, godip.Germany}
+	for _, tc := range []struct {
+		rule        string
+		votes       Nations
+		onProbation Nations
+		wantDrawers Nations
+		wantDrawn   bool
+	}{
+		{"", Nations{godip.England, godip.France}, nil, active, false},
+		{"", Nations{godip.England, godip.France}, Nations{godip.Germany}, active, true},
+		{DrawRuleDIAS, Nations{godip.England, godip.France, godip.Germany}, nil, active, true},
+		{DrawRuleUnanimous, Nations{godip.England, godip.France}, Nations{godip.Germany}, active, false},
+		{DrawRuleUnanimous, Nations{godip.England, godip.France, godip.Germany}, nil, active, true},
+		{DrawRuleMajority, Nations{godip.England}, Nations{godip.Germany}, Nations{godip.England}, false},
+		{DrawRuleMajority, Nations{godip.England, godip.France}, nil, Nations{godip.England, godip.France}, true},
+		// Votes from nations no longer active don't count.
+		{DrawRuleMajority, Nations{godip.England, godip.Austria}, nil, Nations{godip.England}, false},
+	} {
+		drawers, drawn := tallyDrawVotes(tc.rule, tc.votes, active, tc.onProbation)
+		if drawn != tc.wantDrawn || !reflect.DeepEqual(drawers, tc.wantDrawers) {
+			t.Errorf("tallyDrawVotes(%q, %v, %v, %v) = %v, %v, wanted %v, %v", tc.rule, tc.votes, active, tc.onProbation, drawers, drawn, tc.wantDrawers, tc.wantDrawn)
+		}
+	}
+}
+
+func TestValidDrawRule(t *testing.T) {
+	for _, rule := range []string{"", DrawRuleDIAS, DrawRuleUnanimous, DrawRuleMajority} {
+		if !validDrawRule(rule) {
+			t.Errorf("Got %q invalid, wanted valid", rule)
+		}
+	}
+	if validDrawRule("Plurality") {
+		t.Errorf("Got Plurality valid, wanted invalid")
+	}
+}
@@ -0,0 +1,125 @@
+package game
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/zond/diplicity/auth"
+
+	. "github.com/zond/goaeoas"
+)
+
+// contentCapture keeps the content set by a handler, so that it can be inspected before it's rendered.
+type contentCapture struct {
+	ResponseWriter
+	content Content
+}
+
+func (c *contentCapture) SetContent(content Content) {
+	c.content = content
+}
+
+/*
+ * etagCached wraps handler to set a weak ETag on the content it renders, and to respond
+ * 304 Not Modified instead of rendering it if the request has a matching If-None-Match.
+ * The ETag includes the viewing user, since lists are filtered and redacted per user.
+ */
+func etagCached(handler func(ResponseWriter, Request) error) func(ResponseWriter, Request) error {
+	return func(w ResponseWriter, r Request) error {
+		capture := &contentCapture{ResponseWriter: w}
+		if err := handler(capture, r); err != nil {
+			return err
+		}
+		if capture.content == nil {
+			return nil
+		}
+		userId := ""
+		if user, ok := r.Values()["user"].(*auth.User); ok {
+			userId = user.Id
+		}
+		media, _ := Media(r.Req(), "Accept")
+		etag, err := contentETag(fmt.Sprintf("user:%s,media:%s", userId, media), capture.content)
+		if err != nil {
+			return err
+		}
+		// 304 responses must include the ETag too, so that clients keep revalidating with it.
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Req().Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		w.SetContent(capture.content)
+		return nil
+	}
+}
+
+/*
+ * contentETag returns a weak ETag of the JSON encoding of content, prefixed by scope.
+ * Ticker fields only count the time since or until other fields of the content, and are
+ * ignored so that the ETag doesn't change every time it's computed.
+ */
+func contentETag(scope string, content Content) (string, error) {
+	restore := zeroTickers(reflect.ValueOf(content))
+	b, err := json.Marshal(content)
+	restore()
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	h.Write([]byte(scope))
+	h.Write(b)
+	return fmt.Sprintf("W/\"%x\"", h.Sum(nil)), nil
+}
+
+// zeroTickers zeroes all settable fields tagged `ticker:"true"` reachable from v, and returns a func restoring them.
+func zeroTickers(v reflect.Value) func() {
+	restores := []func(){}
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				field := v.Field(i)
+				if v.Type().Field(i).Tag.Get("ticker") == "true" {
+					if field.CanSet() {
+						old := reflect.ValueOf(field.Interface())
+						field.Set(reflect.Zero(field.Type()))
+						restores = append(restores, func() { field.Set(old) })
+					}
+				} else if field.CanInterface() {
+					walk(field)
+				}
+			}
+		}
+	}
+	walk(v)
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// etagMatches returns whether the If-None-Match header lists etag, using weak comparison.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package game
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/zond/goaeoas"
+)
+
+func TestEtagMatches(t *testing.T) {
+	for _, tc := range []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`W/"def", W/"abc"`, true},
+		{`W/"def"`, false},
+		{"*", true},
+	} {
+		if got := etagMatches(tc.ifNoneMatch, `W/"abc"`); got != tc.want {
+			t.Errorf("Got %v for %q, wanted %v", got, tc.ifNoneMatch, tc.want)
+		}
+	}
+}
+
+func TestContentETag(t *testing.T) {
+	game := &Game{
+		Desc:            "blapp",
+		NewestPhaseMeta: []PhaseMeta{{DeadlineAt: time.Now().Add(time.Hour)}},
+	}
+	content := NewItem(List{NewItem(game)})
+
+	game.Refresh()
+	game.NewestPhaseMeta[0].Refresh()
+	before, err := contentETag("user:a", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextDeadlineIn := game.NewestPhaseMeta[0].NextDeadlineIn
+	if nextDeadlineIn == 0 {
+		t.Fatalf("Got zero NextDeadlineIn after computing the ETag, wanted it restored")
+	}
+
+	time.Sleep(time.Millisecond)
+	game.NewestPhaseMeta[0].Refresh()
+	if after, err := contentETag("user:a", content); err != nil || after != before {
+		t.Errorf("Got %q, %v after the tickers changed, wanted %q", after, err, before)
+	}
+	if other, err := contentETag("user:b", content); err != nil || other == before {
+		t.Errorf("Got %q, %v for another user, wanted something else than %q", other, err, before)
+	}
+	game.Desc = "blepp"
+	if changed, err := contentETag("user:a", content); err != nil || changed == before {
+		t.Errorf("Got %q, %v for changed content, wanted something else than %q", changed, err, before)
+	}
+}
+
+type testResponseWriter struct {
+	*httptest.ResponseRecorder
+	content Content
+}
+
+func (t *testResponseWriter) SetContent(content Content) {
+	t.content = content
+}
+
+type testRequest struct {
+	req    *http.Request
+	values map[string]interface{}
+}
+
+func (t *testRequest) Req() *http.Request             { return t.req }
+func (t *testRequest) Vars() map[string]string        { return nil }
+func (t *testRequest) NewLink(link Link) Link         { return link }
+func (t *testRequest) Values() map[string]interface{} { return t.values }
+func (t *testRequest) DecorateLinks(LinkDecorator)    {}
+func (t *testRequest) Media() string                  { return "application/json" }
+
+func TestEtagCached(t *testing.T) {
+	handler := etagCached(func(w ResponseWriter, r Request) error {
+		w.SetContent(NewItem(List{}).SetName("games"))
+		return nil
+	})
+	serve := func(ifNoneMatch string) *testResponseWriter {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", "application/json")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := &testResponseWriter{ResponseRecorder: httptest.NewRecorder()}
+		if err := handler(w, &testRequest{req: req, values: map[string]interface{}{}}); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	first := serve("")
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.content == nil {
+		t.Fatalf("Got ETag %q and content %v, wanted both", etag, first.content)
+	}
+	second := serve(etag)
+	if second.Code != http.StatusNotModified || second.content != nil {
+		t.Errorf("Got status %v and content %v with a matching If-None-Match, wanted 304 and no content", second.Code, second.content)
+	}
+	if got := second.Header().Get("ETag"); got != etag {
+		t.Errorf("Got ETag %q in the 304 response, wanted %q", got, etag)
+	}
+	if third := serve(`W/"other"`); third.content == nil {
+		t.Errorf("Got no content with a mismatching If-None-Match, wanted the content")
+	}
+}
@@ -0,0 +1,469 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"github.com/zond/godip/variants"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	// maxImportBytes caps the size of imported export documents, which are saved in a single transaction.
+	maxImportBytes = 8 << 20
+)
+
+type ExportMember struct {
+	UserId string
+	Name   string
+	Nation godip.Nation
+}
+
+type ExportPhase struct {
+	Phase       *Phase
+	Orders      Orders
+	PhaseStates PhaseStates
+	PhaseResult *PhaseResult
+}
+
+// ExportDocument is the format written by exportGame and read by importGame.
+type ExportDocument struct {
+	GameID     *datastore.Key
+	Variant    string
+	Desc       string
+	Members    []ExportMember
+	GameResult *GameResult
+	Phases     []ExportPhase
+}
+
+// loadFinishedGame loads the game of the request, and makes sure it is finished
+// so that exports don't leak the orders of running games.
+func loadFinishedGame(ctx context.Context, r Request) (*Game, error) {
+	return loadExportableGame(ctx, r, false)
+}
+
+// loadExportableGame loads the game of the request, and makes sure it is finished,
+// or - if allowMembers - started and has the requesting user as member.
+func loadExportableGame(ctx context.Context, r Request, allowMembers bool) (*Game, error) {
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return nil, HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return nil, err
+	}
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return nil, err
+	}
+	game.ID = gameID
+
+	if !game.Finished {
+		if !allowMembers || !game.Started {
+			return nil, HTTPErr{"can only export finished games", http.StatusForbidden}
+		}
+		if _, isMember := game.GetMemberByUserId(user.Id); !isMember {
+			return nil, HTTPErr{"can only export finished games, or running games you are a member of", http.StatusForbidden}
+		}
+	}
+
+	game.Redact(user, viewerIsSuperuser(ctx, user), r)
+
+	return game, nil
+}
+
+// exportGame returns a game as a single JSON document, with the game, variant, members and result
+// followed by each phase with its orders, phase states and phase result.
+// The whole document is built before anything is written, so that failures result in an error status
+// instead of a truncated document.
+// Members of running games get the resolved phases only, and no phase results
+// since they contain user IDs that would break the anonymity of anonymous games.
+func exportGame(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	game, err := loadExportableGame(ctx, r, true)
+	if err != nil {
+		return err
+	}
+	gameID := game.ID
+
+	doc := &ExportDocument{
+		GameID:  gameID,
+		Variant: game.Variant,
+		Desc:    game.Desc,
+		Members: make([]ExportMember, 0, len(game.Members)),
+		Phases:  []ExportPhase{},
+	}
+
+	doc.GameResult = &GameResult{}
+	if err := datastore.Get(ctx, GameResultID(ctx, gameID), doc.GameResult); err == datastore.ErrNoSuchEntity {
+		doc.GameResult = nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, member := range game.Members {
+		doc.Members = append(doc.Members, ExportMember{
+			UserId: member.User.Id,
+			Name:   member.User.Name,
+			Nation: member.Nation,
+		})
+	}
+
+	var lastOrdinal int64
+	if len(game.NewestPhaseMeta) > 0 {
+		lastOrdinal = game.NewestPhaseMeta[0].PhaseOrdinal
+		if !game.Finished && !game.NewestPhaseMeta[0].Resolved {
+			lastOrdinal--
+		}
+	}
+
+	for ordinal := int64(1); ordinal <= lastOrdinal; ordinal++ {
+		phaseID, err := PhaseID(ctx, gameID, ordinal)
+		if err != nil {
+			return err
+		}
+		exportPhase := ExportPhase{
+			Phase:       &Phase{},
+			Orders:      Orders{},
+			PhaseStates: PhaseStates{},
+		}
+		if err := datastore.Get(ctx, phaseID, exportPhase.Phase); err != nil {
+			log.Errorf(ctx, "Unable to load phase %v: %v; aborting export", phaseID, err)
+			return err
+		}
+		if _, err := datastore.NewQuery(orderKind).Ancestor(phaseID).GetAll(ctx, &exportPhase.Orders); err != nil {
+			log.Errorf(ctx, "Unable to load orders for %v: %v; aborting export", phaseID, err)
+			return err
+		}
+		if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &exportPhase.PhaseStates); err != nil {
+			log.Errorf(ctx, "Unable to load phase states for %v: %v; aborting export", phaseID, err)
+			return err
+		}
+		if game.Finished {
+			if exportPhase.PhaseResult, err = loadExportPhaseResult(ctx, gameID, ordinal); err != nil {
+				log.Errorf(ctx, "Unable to load phase result for %v: %v; aborting export", phaseID, err)
+				return err
+			}
+		}
+		doc.Phases = append(doc.Phases, exportPhase)
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+gameID.Encode()+".json\"")
+	_, err = w.Write(b)
+	return err
+}
+
+// loadExportPhaseResult returns the phase result of the phase, or nil if the phase has none.
+func loadExportPhaseResult(ctx context.Context, gameID *datastore.Key, phaseOrdinal int64) (*PhaseResult, error) {
+	phaseResultID, err := PhaseResultID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		return nil, err
+	}
+	phaseResult := &PhaseResult{}
+	if err := datastore.Get(ctx, phaseResultID, phaseResult); err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if phaseResult.MessagesSentJSON != "" {
+		if err := json.Unmarshal([]byte(phaseResult.MessagesSentJSON), &phaseResult.MessagesSent); err != nil {
+			return nil, err
+		}
+	}
+	return phaseResult, nil
+}
+
+// validate returns a descriptive error if the document can't be imported.
+func (d *ExportDocument) validate() error {
+	variant, found := variants.Variants[d.Variant]
+	if !found {
+		return fmt.Errorf("unknown variant %q", d.Variant)
+	}
+	nations := map[godip.Nation]bool{}
+	for _, nation := range variant.Nations {
+		nations[nation] = true
+	}
+	for idx, member := range d.Members {
+		if !nations[member.Nation] {
+			return fmt.Errorf("member %d has nation %q, not part of %v", idx, member.Nation, d.Variant)
+		}
+	}
+	if len(d.Phases) == 0 {
+		return fmt.Errorf("no phases")
+	}
+	for idx, exportPhase := range d.Phases {
+		wantOrdinal := int64(idx + 1)
+		if exportPhase.Phase == nil {
+			return fmt.Errorf("phase %d is missing", wantOrdinal)
+		}
+		if exportPhase.Phase.PhaseOrdinal != wantOrdinal {
+			return fmt.Errorf("phase %d has ordinal %d", wantOrdinal, exportPhase.Phase.PhaseOrdinal)
+		}
+		for _, order := range exportPhase.Orders {
+			if !nations[order.Nation] {
+				return fmt.Errorf("phase %d has an order for nation %q, not part of %v", wantOrdinal, order.Nation, d.Variant)
+			}
+			if len(order.Parts) == 0 {
+				return fmt.Errorf("phase %d has an empty order for %v", wantOrdinal, order.Nation)
+			}
+		}
+		for _, phaseState := range exportPhase.PhaseStates {
+			if !nations[phaseState.Nation] {
+				return fmt.Errorf("phase %d has a phase state for nation %q, not part of %v", wantOrdinal, phaseState.Nation, d.Variant)
+			}
+		}
+	}
+	return nil
+}
+
+// importGame creates a replay of an exported game under a fresh game ID, to debug reported adjudication bugs.
+// Replays have no member users, so they don't show up for the original members or affect their stats,
+// and they are never resolved.
+// The game result and phase results are left out, since they would affect ratings and stats.
+func importGame(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	if !appengine.IsDevAppServer() {
+		user, ok := r.Values()["user"].(*auth.User)
+		if !ok {
+			return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+		}
+
+		superusers, err := auth.GetSuperusers(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !superusers.Includes(user.Id) {
+			return HTTPErr{"unauthorized", http.StatusForbidden}
+		}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Req().Body, maxImportBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxImportBytes {
+		return HTTPErr{fmt.Sprintf("export documents can't be larger than %v bytes", maxImportBytes), http.StatusRequestEntityTooLarge}
+	}
+	doc := &ExportDocument{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		return HTTPErr{fmt.Sprintf("malformed export document: %v", err), http.StatusBadRequest}
+	}
+	if err := doc.validate(); err != nil {
+		return HTTPErr{fmt.Sprintf("invalid export document: %v", err), http.StatusBadRequest}
+	}
+
+	low, _, err := datastore.AllocateIDs(ctx, gameKind, nil, 1)
+	if err != nil {
+		return err
+	}
+	gameID := datastore.NewKey(ctx, gameKind, "", low, nil)
+
+	now := time.Now()
+	game := &Game{
+		ID:        gameID,
+		Started:   true,
+		Mustered:  true,
+		Closed:    true,
+		Replay:    true,
+		Private:   true,
+		NoMerge:   true,
+		Desc:      doc.Desc,
+		Variant:   doc.Variant,
+		CreatedAt: now,
+		StartedAt: now,
+	}
+	for _, member := range doc.Members {
+		game.Members = append(game.Members, Member{
+			User:   auth.User{Name: member.Name},
+			Nation: member.Nation,
+		})
+	}
+
+	// The phases, orders and phase states are all descendants of the game, so a single group transaction
+	// is enough to make sure a failed import leaves nothing behind.
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		for _, exportPhase := range doc.Phases {
+			phase := exportPhase.Phase
+			phase.GameID = gameID
+			phaseID, err := phase.ID(ctx)
+			if err != nil {
+				return err
+			}
+			if err := phase.Recalc(); err != nil {
+				return err
+			}
+			game.NewestPhaseMeta = []PhaseMeta{phase.PhaseMeta}
+			phase.PhaseMeta.UnitsJSON = ""
+			phase.PhaseMeta.SCsJSON = ""
+
+			keys := []*datastore.Key{phaseID}
+			values := []interface{}{phase}
+			for idx := range exportPhase.Orders {
+				order := &exportPhase.Orders[idx]
+				order.GameID = gameID
+				order.PhaseOrdinal = phase.PhaseOrdinal
+				orderID, err := OrderID(ctx, phaseID, godip.Province(order.Parts[0]))
+				if err != nil {
+					return err
+				}
+				keys = append(keys, orderID)
+				values = append(values, order)
+			}
+			for idx := range exportPhase.PhaseStates {
+				phaseState := &exportPhase.PhaseStates[idx]
+				phaseState.GameID = gameID
+				phaseState.PhaseOrdinal = phase.PhaseOrdinal
+				phaseStateID, err := PhaseStateID(ctx, phaseID, phaseState.Nation)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, phaseStateID)
+				values = append(values, phaseState)
+				for memberIdx := range game.Members {
+					if game.Members[memberIdx].Nation == phaseState.Nation {
+						game.Members[memberIdx].NewestPhaseState = *phaseState
+					}
+				}
+			}
+			if _, err := datastore.PutMulti(ctx, keys, values); err != nil {
+				return err
+			}
+		}
+
+		return game.DBSave(ctx)
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return err
+	}
+	log.Infof(ctx, "Imported %v phases of a %v game as replay %v", len(doc.Phases), doc.Variant, gameID)
+
+	w.SetContent(game.Item(r))
+	return nil
+}
+
+// exportTranscript streams a finished game as a plain text transcript.
+// Nations, orders and dislodged units are sorted, so transcripts of the same
+// game are always identical.
+func exportTranscript(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	game, err := loadFinishedGame(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	gameResult := &GameResult{}
+	if err := datastore.Get(ctx, GameResultID(ctx, game.ID), gameResult); err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+	scores := make(GameScores, len(gameResult.Scores))
+	copy(scores, gameResult.Scores)
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Member < scores[j].Member
+	})
+	scoreParts := make([]string, len(scores))
+	for i, score := range scores {
+		scoreParts[i] = fmt.Sprintf("%s %.2f (%d SCs)", score.Member, score.Score, score.SCs)
+	}
+
+	var lastOrdinal int64
+	if len(game.NewestPhaseMeta) > 0 {
+		lastOrdinal = game.NewestPhaseMeta[0].PhaseOrdinal
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+
+	if _, err := fmt.Fprintf(w, "Variant: %s; Scores: %s\n", game.Variant, strings.Join(scoreParts, ", ")); err != nil {
+		return err
+	}
+
+	// From here on the status is already sent, so errors can only be logged.
+	for ordinal := int64(1); ordinal <= lastOrdinal; ordinal++ {
+		phaseID, err := PhaseID(ctx, game.ID, ordinal)
+		if err != nil {
+			log.Errorf(ctx, "Unable to create phase ID for %v/%v: %v; aborting transcript", game.ID, ordinal, err)
+			return nil
+		}
+		phase := &Phase{}
+		if err := datastore.Get(ctx, phaseID, phase); err != nil {
+			log.Errorf(ctx, "Unable to load phase %v: %v; aborting transcript", phaseID, err)
+			return nil
+		}
+		orders := Orders{}
+		if _, err := datastore.NewQuery(orderKind).Ancestor(phaseID).GetAll(ctx, &orders); err != nil {
+			log.Errorf(ctx, "Unable to load orders for %v: %v; aborting transcript", phaseID, err)
+			return nil
+		}
+		if _, err := w.Write([]byte(phaseTranscript(phase, orders))); err != nil {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func phaseTranscript(phase *Phase, orders Orders) string {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "\n%s %d, %s\n", phase.Season, phase.Year, phase.Type)
+
+	dislodgeds := make([]string, len(phase.Dislodgeds))
+	for i, dislodged := range phase.Dislodgeds {
+		dislodgeds[i] = fmt.Sprintf("%s %s %s", dislodged.Dislodged.Nation, dislodged.Dislodged.Type, dislodged.Province)
+	}
+	sort.Strings(dislodgeds)
+	for _, dislodged := range dislodgeds {
+		fmt.Fprintf(buf, "Dislodged: %s\n", dislodged)
+	}
+
+	resolutions := map[godip.Province]string{}
+	for _, resolution := range phase.Resolutions {
+		resolutions[resolution.Province] = resolution.Resolution
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].Nation != orders[j].Nation {
+			return orders[i].Nation < orders[j].Nation
+		}
+		return strings.Join(orders[i].Parts, " ") < strings.Join(orders[j].Parts, " ")
+	})
+	var nation godip.Nation
+	for _, order := range orders {
+		if order.Nation != nation {
+			nation = order.Nation
+			fmt.Fprintf(buf, "%s:\n", nation)
+		}
+		line := strings.Join(order.Parts, " ")
+		if len(order.Parts) > 0 {
+			if resolution, found := resolutions[godip.Province(order.Parts[0])]; found {
+				line = fmt.Sprintf("%s: %s", line, resolution)
+			}
+		}
+		fmt.Fprintf(buf, "  %s\n", line)
+	}
+
+	return buf.String()
+}
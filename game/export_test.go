@@ -0,0 +1,76 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/godip"
+)
+
+func TestPhaseTranscript(t *testing.T) {
+	phase := &Phase{
+		PhaseMeta: PhaseMeta{
+			Season: godip.Spring,
+			Year:   1901,
+			Type:   godip.Movement,
+		},
+		Dislodgeds: []Dislodged{
+			{"vie", godip.Unit{godip.Army, godip.Austria}},
+			{"bud", godip.Unit{godip.Army, godip.Austria}},
+		},
+		Resolutions: []Resolution{
+			{"lon", "OK"},
+			{"tri", "ErrBounce:ven"},
+		},
+	}
+	orders := Orders{
+		{Nation: godip.England, Parts: []string{"lon", "Move", "nth"}},
+		{Nation: godip.Austria, Parts: []string{"tri", "Move", "ven"}},
+		{Nation: godip.Austria, Parts: []string{"bud", "Hold"}},
+	}
+	want := `
+Spring 1901, Movement
+Dislodged: Austria Army bud
+Dislodged: Austria Army vie
+Austria:
+  bud Hold
+  tri Move ven: ErrBounce:ven
+England:
+  lon Move nth: OK
+`
+	if got := phaseTranscript(phase, orders); got != want {
+		t.Errorf("Got transcript %q, wanted %q", got, want)
+	}
+}
+
+func TestExportDocumentValidate(t *testing.T) {
+	valid := func() *ExportDocument {
+		return &ExportDocument{
+			Variant: "Classical",
+			Members: []ExportMember{{Name: "a", Nation: godip.England}},
+			Phases: []ExportPhase{
+				{
+					Phase:  &Phase{PhaseMeta: PhaseMeta{PhaseOrdinal: 1}},
+					Orders: Orders{{Nation: godip.England, Parts: []string{"lon", "Hold"}}},
+				},
+			},
+		}
+	}
+	if err := valid().validate(); err != nil {
+		t.Errorf("Got %v, wanted valid document", err)
+	}
+	for name, mutate := range map[string]func(d *ExportDocument){
+		"unknown variant":       func(d *ExportDocument) { d.Variant = "Not a variant" },
+		"unknown member nation": func(d *ExportDocument) { d.Members[0].Nation = "Atlantis" },
+		"no phases":             func(d *ExportDocument) { d.Phases = nil },
+		"missing phase":         func(d *ExportDocument) { d.Phases[0].Phase = nil },
+		"wrong ordinal":         func(d *ExportDocument) { d.Phases[0].Phase.PhaseOrdinal = 2 },
+		"empty order":           func(d *ExportDocument) { d.Phases[0].Orders[0].Parts = nil },
+		"unknown order nation":  func(d *ExportDocument) { d.Phases[0].Orders[0].Nation = "Atlantis" },
+	} {
+		doc := valid()
+		mutate(doc)
+		if err := doc.validate(); err == nil {
+			t.Errorf("Got valid document with %v", name)
+		}
+	}
+}
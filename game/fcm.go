@@ -13,6 +13,7 @@ import (
 	"github.com/zond/diplicity/auth"
 	"github.com/zond/go-fcm"
 	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
 	"google.golang.org/appengine/v2/datastore"
 	"google.golang.org/appengine/v2/log"
 	"google.golang.org/appengine/v2/urlfetch"
@@ -21,8 +22,9 @@ import (
 )
 
 const (
-	fcmConfKind = "FCMConf"
-	prodKey     = "prod"
+	fcmConfKind       = "FCMConf"
+	prodKey           = "prod"
+	announcementTopic = "/topics/announcements"
 )
 
 func init() {
@@ -41,21 +43,27 @@ type FCMConf struct {
 	ServerKey string
 }
 
+func (f *FCMConf) Validate() error {
+	if f.ServerKey == "" {
+		return fmt.Errorf("missing ServerKey")
+	}
+	return nil
+}
+
 func getFCMConfKey(ctx context.Context) *datastore.Key {
 	return datastore.NewKey(ctx, fcmConfKind, prodKey, 0, nil)
 }
 
+// SetFCMConf must be called inside a transaction.
 func SetFCMConf(ctx context.Context, fcmConf *FCMConf) error {
-	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
-		currentFCMConf := &FCMConf{}
-		if err := datastore.Get(ctx, getFCMConfKey(ctx), currentFCMConf); err == nil {
-			return HTTPErr{"FCMConf already configured", http.StatusBadRequest}
-		}
-		if _, err := datastore.Put(ctx, getFCMConfKey(ctx), fcmConf); err != nil {
-			return err
-		}
-		return nil
-	}, &datastore.TransactionOptions{XG: false})
+	currentFCMConf := &FCMConf{}
+	if err := datastore.Get(ctx, getFCMConfKey(ctx), currentFCMConf); err == nil {
+		return HTTPErr{"FCMConf already configured", http.StatusBadRequest}
+	}
+	if _, err := datastore.Put(ctx, getFCMConfKey(ctx), fcmConf); err != nil {
+		return err
+	}
+	return nil
 }
 
 func getFCMConf(ctx context.Context) (*FCMConf, error) {
@@ -162,6 +170,87 @@ func manageFCMTokens(ctx context.Context, tokensToRemove, tokensToUpdate map[str
 	return nil
 }
 
+// Announcement is the outcome of broadcasting a site-wide announcement to the announcement topic.
+type Announcement struct {
+	Title     string
+	Body      string
+	Sent      bool
+	MessageID int
+	Error     string
+}
+
+func handleSendAnnouncement(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	if !appengine.IsDevAppServer() {
+		superusers, err := auth.GetSuperusers(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !superusers.Includes(user.Id) {
+			return HTTPErr{"unauthorized", http.StatusForbidden}
+		}
+	}
+
+	announcement := &Announcement{
+		Title: r.Req().FormValue("title"),
+		Body:  r.Req().FormValue("body"),
+	}
+	if announcement.Title == "" || announcement.Body == "" {
+		return HTTPErr{"announcements must have a title and a body", http.StatusBadRequest}
+	}
+
+	fcmConf, err := getFCMConf(ctx)
+	if err == datastore.ErrNoSuchEntity {
+		return HTTPErr{"FCM not configured", http.StatusPreconditionFailed}
+	} else if err != nil {
+		return err
+	}
+
+	data, err := NewFCMData(map[string]interface{}{
+		"type":  "announcement",
+		"title": announcement.Title,
+		"body":  announcement.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := fcm.NewFcmClient(fcmConf.ServerKey)
+	client.SetHTTPClient(urlfetch.Client(ctx))
+	client.NewFcmMsgTo(announcementTopic, data)
+	client.SetNotificationPayload(&fcm.NotificationPayload{
+		Title: announcement.Title,
+		Body:  announcement.Body,
+		Tag:   "diplicity-engine-announcement",
+	})
+
+	log.Infof(ctx, "%q is sending announcement %+v to %q", user.Id, announcement, announcementTopic)
+
+	// Errors from FCM are reported in the response, since the request itself was fine.
+	resp, err := client.Send()
+	if err != nil {
+		log.Errorf(ctx, "%v unable to send: %v", PP(client), err)
+		announcement.Error = err.Error()
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.Err != "" {
+		log.Errorf(ctx, "%v unable to send, received %v in response", PP(client), PP(resp))
+		announcement.Error = fmt.Sprintf("FCM responded %v: %v", resp.StatusCode, resp.Err)
+	} else {
+		log.Infof(ctx, "Sent %v, received %v in response", PP(client), PP(resp))
+		announcement.Sent = true
+		announcement.MessageID = resp.MsgId
+	}
+
+	w.SetContent(NewItem(announcement).SetName("announcement"))
+	return nil
+}
+
 type FCMData struct {
 	DiplicityJSON []byte
 }
@@ -189,6 +278,52 @@ func nestPut(m1 map[string]map[string]string, k1, k2, v string) {
 	m1[k1] = m2
 }
 
+// maxFCMTokensPerRequest is the number of registration ids FCM accepts in one multicast request.
+const maxFCMTokensPerRequest = 1000
+
+type fcmBatch struct {
+	notif   *fcm.NotificationPayload
+	data    *FCMData
+	tokens  map[string][]string
+	nTokens int
+}
+
+// fcmBatches groups tokens that should receive identical notifications, so that
+// each group can be sent in as few multicast requests as possible.
+type fcmBatches map[string][]*fcmBatch
+
+func (f fcmBatches) add(uid string, token string, notif *fcm.NotificationPayload, data *FCMData) error {
+	b, err := json.Marshal([]interface{}{notif, data})
+	if err != nil {
+		return err
+	}
+	key := string(b)
+	batches := f[key]
+	if len(batches) == 0 || batches[len(batches)-1].nTokens >= maxFCMTokensPerRequest {
+		batches = append(batches, &fcmBatch{
+			notif:  notif,
+			data:   data,
+			tokens: map[string][]string{},
+		})
+		f[key] = batches
+	}
+	batch := batches[len(batches)-1]
+	batch.tokens[uid] = append(batch.tokens[uid], token)
+	batch.nTokens++
+	return nil
+}
+
+func (f fcmBatches) each(fun func(*fcmBatch) error) error {
+	for _, batches := range f {
+		for _, batch := range batches {
+			if err := fun(batch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func fcmSendToTokens(ctx context.Context, lastDelay time.Duration, notif *fcm.NotificationPayload, data *FCMData, tokens map[string][]string) error {
 	log.Infof(ctx, "fcmSendToTokens(..., %v, %v, %+v)", PP(notif), PP(data), tokens)
 
@@ -0,0 +1,57 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zond/go-fcm"
+)
+
+func countFCMBatches(f fcmBatches) (requests int, tokens int) {
+	f.each(func(batch *fcmBatch) error {
+		requests++
+		for _, userTokens := range batch.tokens {
+			tokens += len(userTokens)
+		}
+		return nil
+	})
+	return
+}
+
+func TestFCMBatchesGroupIdenticalNotifications(t *testing.T) {
+	batches := fcmBatches{}
+	for i := 0; i < 7; i++ {
+		notif := &fcm.NotificationPayload{Title: "Game: Spring 1901, Movement"}
+		if err := batches.add(fmt.Sprintf("user%d", i), fmt.Sprintf("token%d", i), notif, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batches.add("user0", "token7", &fcm.NotificationPayload{Title: "Game: Spring 1901, Movement"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests, tokens := countFCMBatches(batches); requests != 1 || tokens != 8 {
+		t.Errorf("Got %v requests with %v tokens, wanted 1 request with 8 tokens", requests, tokens)
+	}
+
+	if err := batches.add("user1", "token8", &fcm.NotificationPayload{Title: "Alias: Spring 1901, Movement"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := batches.add("user2", "token9", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests, tokens := countFCMBatches(batches); requests != 3 || tokens != 10 {
+		t.Errorf("Got %v requests with %v tokens, wanted 3 requests with 10 tokens", requests, tokens)
+	}
+}
+
+func TestFCMBatchesSplitLargeBatches(t *testing.T) {
+	batches := fcmBatches{}
+	for i := 0; i < maxFCMTokensPerRequest+1; i++ {
+		if err := batches.add(fmt.Sprintf("user%d", i), fmt.Sprintf("token%d", i), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests, tokens := countFCMBatches(batches); requests != 2 || tokens != maxFCMTokensPerRequest+1 {
+		t.Errorf("Got %v requests with %v tokens, wanted 2 requests with %v tokens", requests, tokens, maxFCMTokensPerRequest+1)
+	}
+}
@@ -0,0 +1,198 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	feedbackKind = "Feedback"
+)
+
+var FeedbackResource *Resource
+
+func init() {
+	FeedbackResource = &Resource{
+		Create:     createFeedback,
+		CreatePath: "/Game/{game_id}/Feedback",
+		Listers: []Lister{
+			{
+				Path:    "/Game/{game_id}/Feedbacks",
+				Route:   ListFeedbackRoute,
+				Handler: listFeedback,
+			},
+		},
+	}
+}
+
+type Feedbacks []Feedback
+
+func (f Feedbacks) Item(r Request, game *Game) *Item {
+	feedbackItems := make(List, len(f))
+	for i := range f {
+		feedbackItems[i] = f[i].Item(r)
+	}
+	feedbacksItem := NewItem(feedbackItems).SetName("feedback").AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       ListFeedbackRoute,
+		RouteParams: []string{"game_id", game.ID.Encode()},
+	})).SetDesc([][]string{
+		[]string{
+			"Feedback",
+			"When a game is finished, each member can give feedback once about each other member, by marking them as FunToPlayWith, Reliable, and/or a Backstabber.",
+			"Giving the same feedback again changes nothing, but feedback can't be changed once given.",
+			"The feedback received is counted in the user stats of each player.",
+		},
+		[]string{
+			"Listing feedback",
+			"The list contains the feedback you gave in this game.",
+		},
+	})
+	if game.Finished {
+		feedbacksItem.AddLink(r.NewLink(FeedbackResource.Link("create", Create, []string{"game_id", game.ID.Encode()})))
+	}
+	return feedbacksItem
+}
+
+// Feedback is what one member of a finished game thought about another member.
+type Feedback struct {
+	GameID        *datastore.Key
+	Private       bool
+	RaterId       string
+	RateeId       string `methods:"POST"`
+	FunToPlayWith bool   `methods:"POST"`
+	Reliable      bool   `methods:"POST"`
+	Backstabber   bool   `methods:"POST"`
+	CreatedAt     time.Time
+}
+
+func FeedbackID(ctx context.Context, gameID *datastore.Key, raterId string, rateeId string) (*datastore.Key, error) {
+	if gameID == nil || raterId == "" || rateeId == "" {
+		return nil, fmt.Errorf("feedback must have games, raters and ratees")
+	}
+	return datastore.NewKey(ctx, feedbackKind, fmt.Sprintf("%s:%s", raterId, rateeId), 0, gameID), nil
+}
+
+func (f *Feedback) Item(r Request) *Item {
+	return NewItem(f).SetName(f.RateeId)
+}
+
+// sameRatings returns whether f and o rate the same way.
+func (f *Feedback) sameRatings(o *Feedback) bool {
+	return f.FunToPlayWith == o.FunToPlayWith && f.Reliable == o.Reliable && f.Backstabber == o.Backstabber
+}
+
+// validateFeedback makes sure raterId can give feedback about rateeId in game.
+func validateFeedback(game *Game, raterId string, rateeId string) error {
+	if !game.Finished {
+		return HTTPErr{"can only give feedback in finished games", http.StatusPreconditionFailed}
+	}
+	if _, isMember := game.GetMemberByUserId(raterId); !isMember {
+		return HTTPErr{"can only give feedback in member games", http.StatusNotFound}
+	}
+	if rateeId == raterId {
+		return HTTPErr{"can't give feedback about yourself", http.StatusBadRequest}
+	}
+	if _, isMember := game.GetMemberByUserId(rateeId); !isMember {
+		return HTTPErr{"can only give feedback about other members", http.StatusBadRequest}
+	}
+	return nil
+}
+
+func createFeedback(w ResponseWriter, r Request) (*Feedback, error) {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return nil, HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return nil, err
+	}
+
+	feedback := &Feedback{}
+	if err := Copy(feedback, r, "POST"); err != nil {
+		return nil, err
+	}
+	feedback.GameID = gameID
+	feedback.RaterId = user.Id
+
+	feedbackID, err := FeedbackID(ctx, gameID, feedback.RaterId, feedback.RateeId)
+	if err != nil {
+		return nil, HTTPErr{"feedback must have a RateeId", http.StatusBadRequest}
+	}
+
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		game := &Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+		game.ID = gameID
+		if err := validateFeedback(game, feedback.RaterId, feedback.RateeId); err != nil {
+			return err
+		}
+
+		existing := &Feedback{}
+		if err := datastore.Get(ctx, feedbackID, existing); err == nil {
+			if !existing.sameRatings(feedback) {
+				return HTTPErr{"feedback already given, and can't be changed", http.StatusConflict}
+			}
+			*feedback = *existing
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		feedback.Private = game.Private
+		feedback.CreatedAt = time.Now()
+		if _, err := datastore.Put(ctx, feedbackID, feedback); err != nil {
+			return err
+		}
+		return UpdateUserStatsASAP(ctx, []string{feedback.RateeId})
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return nil, err
+	}
+
+	return feedback, nil
+}
+
+func listFeedback(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return err
+	}
+	game.ID = gameID
+	if _, isMember := game.GetMemberByUserId(user.Id); !isMember {
+		return HTTPErr{"can only list feedback in member games", http.StatusNotFound}
+	}
+
+	feedbacks := Feedbacks{}
+	if _, err := datastore.NewQuery(feedbackKind).Ancestor(gameID).Filter("RaterId=", user.Id).GetAll(ctx, &feedbacks); err != nil {
+		return err
+	}
+
+	w.SetContent(feedbacks.Item(r, game))
+	return nil
+}
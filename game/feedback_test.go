@@ -0,0 +1,48 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/diplicity/auth"
+
+	. "github.com/zond/goaeoas"
+)
+
+func TestValidateFeedback(t *testing.T) {
+	g := &Game{
+		Started:  true,
+		Finished: true,
+		Members:  Members{{User: auth.User{Id: "a"}}, {User: auth.User{Id: "b"}}},
+	}
+	if err := validateFeedback(g, "a", "b"); err != nil {
+		t.Errorf("Got %v, wanted no error", err)
+	}
+	for _, tc := range []struct {
+		rater  string
+		ratee  string
+		status int
+	}{
+		{"a", "a", 400},
+		{"a", "c", 400},
+		{"c", "a", 404},
+	} {
+		err := validateFeedback(g, tc.rater, tc.ratee)
+		if httpErr, ok := err.(HTTPErr); !ok || httpErr.Status != tc.status {
+			t.Errorf("Got %v for %q rating %q, wanted a %d", err, tc.rater, tc.ratee, tc.status)
+		}
+	}
+	g.Finished = false
+	if err, ok := validateFeedback(g, "a", "b").(HTTPErr); !ok || err.Status != 412 {
+		t.Errorf("Got %v for an unfinished game, wanted a 412", err)
+	}
+}
+
+func TestFeedbackSameRatings(t *testing.T) {
+	f := &Feedback{RateeId: "b", Reliable: true}
+	if !f.sameRatings(&Feedback{RateeId: "b", Reliable: true, RaterId: "a"}) {
+		t.Errorf("Got different ratings for equal feedback")
+	}
+	if f.sameRatings(&Feedback{RateeId: "b", Reliable: true, Backstabber: true}) {
+		t.Errorf("Got same ratings for different feedback")
+	}
+}
@@ -6,12 +6,12 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
-	"net/url"
 	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/zond/diplicity/auth"
@@ -49,10 +49,10 @@ var (
 
 	noConfigError      = errors.New("user has no config")
 	noGameError        = errors.New("game does not exist")
+	mutedSenderError   = errors.New("user has muted the sender")
+	mutedNotifError    = errors.New("user has muted these notifications for the game")
 	fromAddressPattern = "replies+%s@diplicity-engine.appspotmail.com"
 	fromAddressReg     = regexp.MustCompile("^replies\\+([^@]+)@diplicity-engine.appspotmail.com")
-	noreplyFromAddr    = "noreply@oort.se"
-	noreplyFromName    = "Diplicity"
 
 	GameResource *Resource
 )
@@ -61,6 +61,7 @@ func init() {
 	gameListerParams := []string{
 		"cursor",
 		"limit",
+		"direction",
 		"variant",
 		"min-reliability",
 		"min-quickness",
@@ -74,6 +75,13 @@ func init() {
 		"conference-chat-disabled",
 		"group-chat-disabled",
 		"private-chat-disabled",
+		"min-member-rating",
+		"minPhaseLength",
+		"maxPhaseLength",
+		"sort",
+		"count",
+		"withCount",
+		"result",
 	}
 	GameResource = &Resource{
 		Load:   loadGame,
@@ -87,6 +95,30 @@ func init() {
 				Handler:     openGamesHandler.handle,
 				QueryParams: gameListerParams,
 			},
+			{
+				Path:        "/Games/Replaceable",
+				Route:       replaceableGamesHandler.route,
+				Handler:     replaceableGamesHandler.handle,
+				QueryParams: gameListerParams,
+			},
+			{
+				Path:        "/User/{user_id}/FinishedGames",
+				Route:       userFinishedGamesHandler.route,
+				Handler:     userFinishedGamesHandler.handle,
+				QueryParams: gameListerParams,
+			},
+			{
+				Path:        "/Users/{user_id}/Games",
+				Route:       userGamesHandler.route,
+				Handler:     userGamesHandler.handle,
+				QueryParams: gameListerParams,
+			},
+			{
+				Path:        "/Games/Search",
+				Route:       searchGamesHandler.route,
+				Handler:     searchGamesHandler.handle,
+				QueryParams: append([]string{"q"}, gameListerParams...),
+			},
 			{
 				Path:        "/Games/Started",
 				Route:       startedGamesHandler.route,
@@ -129,6 +161,18 @@ func init() {
 				Handler:     myStartedGamesHandler.handle,
 				QueryParams: gameListerParams,
 			},
+			{
+				Path:        "/Games/My/Active",
+				Route:       myActiveGamesHandler.route,
+				Handler:     handleListMyActiveGames,
+				QueryParams: gameListerParams,
+			},
+			{
+				Path:        "/Games/My/NeedsOrders",
+				Route:       myNeedsOrdersGamesHandler.route,
+				Handler:     myNeedsOrdersGamesHandler.handle,
+				QueryParams: gameListerParams,
+			},
 			{
 				Path:        "/Games/My/Finished",
 				Route:       myFinishedGamesHandler.route,
@@ -252,6 +296,98 @@ func (g *Games) RemoveCustomFiltered(filters []func(g *Game) bool) {
 	*g = newGames
 }
 
+// RemoveBelowMemberRating removes started games where any member has a TrueSkill rating below minRating.
+// Staging games are kept, since their rosters aren't committed yet.
+func (g *Games) RemoveBelowMemberRating(ctx context.Context, minRating float64) error {
+	statsIDs := []*datastore.Key{}
+	gameIndices := []int{}
+	for gameIndex, game := range *g {
+		if !game.Started {
+			continue
+		}
+		for _, member := range game.Members {
+			if member.Vacant() {
+				continue
+			}
+			statsIDs = append(statsIDs, UserStatsID(ctx, member.User.Id))
+			gameIndices = append(gameIndices, gameIndex)
+		}
+	}
+	if len(statsIDs) == 0 {
+		return nil
+	}
+
+	stats := make([]UserStats, len(statsIDs))
+	err := datastore.GetMulti(ctx, statsIDs, stats)
+	var merr appengine.MultiError
+	if err != nil {
+		var ok bool
+		if merr, ok = err.(appengine.MultiError); !ok {
+			return err
+		}
+	}
+
+	tooLow := map[int]bool{}
+	for statsIndex := range stats {
+		if merr != nil && merr[statsIndex] != nil {
+			if merr[statsIndex] != datastore.ErrNoSuchEntity {
+				return err
+			}
+			// Members without stats have no rating.
+			if minRating > 0 {
+				tooLow[gameIndices[statsIndex]] = true
+			}
+			continue
+		}
+		if stats[statsIndex].TrueSkill.Rating < minRating {
+			tooLow[gameIndices[statsIndex]] = true
+		}
+	}
+
+	newGames := make(Games, 0, len(*g))
+	for gameIndex, game := range *g {
+		if !tooLow[gameIndex] {
+			newGames = append(newGames, game)
+		}
+	}
+	*g = newGames
+	return nil
+}
+
+// LoadResults populates the Result field of the finished games.
+func (g Games) LoadResults(ctx context.Context) error {
+	resultIDs := []*datastore.Key{}
+	gameIndices := []int{}
+	for gameIndex := range g {
+		if g[gameIndex].Finished {
+			resultIDs = append(resultIDs, GameResultID(ctx, g[gameIndex].ID))
+			gameIndices = append(gameIndices, gameIndex)
+		}
+	}
+	if len(resultIDs) == 0 {
+		return nil
+	}
+	results := make([]GameResult, len(resultIDs))
+	err := datastore.GetMulti(ctx, resultIDs, results)
+	var merr appengine.MultiError
+	if err != nil {
+		var ok bool
+		if merr, ok = err.(appengine.MultiError); !ok {
+			return err
+		}
+	}
+	for resultIndex := range results {
+		if merr != nil && merr[resultIndex] != nil {
+			if merr[resultIndex] != datastore.ErrNoSuchEntity {
+				return err
+			}
+			continue
+		}
+		g[gameIndices[resultIndex]].Result = &results[resultIndex]
+	}
+	return nil
+}
+
 type filterReason int
 
 const (
@@ -381,46 +517,54 @@ func (g *Games) RemoveBanned(ctx context.Context, uid string, actuallyRemove boo
 	return gameBans, nil
 }
 
-func (g Games) Item(r Request, user *auth.User, cursor *datastore.Cursor, limit int, name string, desc []string, route string) *Item {
+func (g Games) Item(r Request, user *auth.User, cursors pageCursors, limit int, name string, desc []string, route string) *Item {
 	gameItems := make(List, len(g))
+	superuser := viewerIsSuperuser(appengine.NewContext(r.Req()), user)
 	for i := range g {
-		g[i].Redact(user, r)
+		g[i].Redact(user, superuser, r)
 		gameItems[i] = g[i].Item(r)
 	}
+	max, err := configuredMaxLimit(appengine.NewContext(r.Req()))
+	if err != nil {
+		max = maxLimit
+	}
 	gamesItem := NewItem(gameItems).SetName(name).SetDesc([][]string{
 		desc,
 		[]string{
 			"Cursor and limit",
-			fmt.Sprintf("The list contains at most %d games.", maxLimit),
+			fmt.Sprintf("The list contains at most %d games.", max),
 			"If there are additional matching games, a 'next' link will be available with a 'cursor' query parameter.",
 			"Use the 'next' link to list the next batch of matching games.",
-			fmt.Sprintf("To list fewer than %d games, add an explicit 'limit' query parameter.", maxLimit),
+			"Pages after the first also have a 'prev' link, which uses `direction=backward` to list the batch before. Lists that aren't sorted, like search results, can't be listed backward.",
+			fmt.Sprintf("To list fewer than %d games, add an explicit 'limit' query parameter.", max),
+			"Add `count=true` (or `withCount=true`) to a request without 'cursor' to get a 'TotalCount' of matching games. It is cached for a short while, and only takes the `variant`, `nation-allocation`, `only-private` and chat filters into account.",
 		},
 		[]string{
 			"Filters",
 			"To show only games matching certain criteria, add query parameter filters.",
 			"`variant=X` filters on variant X.",
+			fmt.Sprintf("`variant` can be given up to %d times, to show games of any of the given variants.", maxVariantFilters),
 			"`min-reliability=X:Y` filters on min reliability between X and Y.",
 			"`min-quickness=X:Y` filters on min quickness between X and Y.",
 			"`max-hated=X:Y` filters on max hated between X and Y.",
 			"`max-hater=X:Y` filters on max hater between X and Y.",
 			"`min-rating=X:Y` filters on min rating between X and Y.",
 			"`max-rating=X:Y` filters on max rating between X and Y.",
+			"`phase-length-minutes=X:Y` filters on phase length between X and Y minutes. Either X or Y can be left out, so `phase-length-minutes=:X` finds games with phase length of at most X minutes. It can be combined with `variant`, to for example find fast games of a given variant.",
+			"`minPhaseLength=X` and `maxPhaseLength=Y` filter on phase length of at least X and at most Y minutes, and can be used separately.",
+			"`min-member-rating=X` hides started games where any member has a rating below X. Games that haven't started yet are not affected.",
 		},
-	}).AddLink(r.NewLink(Link{
-		Rel:   "self",
-		Route: route,
+	})
+	routeParams := []string{}
+	for k, v := range r.Vars() {
+		routeParams = append(routeParams, k, v)
+	}
+	gamesItem.AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       route,
+		RouteParams: routeParams,
 	}))
-	if cursor != nil {
-		gamesItem.AddLink(r.NewLink(Link{
-			Rel:   "next",
-			Route: route,
-			QueryParams: url.Values{
-				"cursor": []string{cursor.String()},
-				"limit":  []string{fmt.Sprint(limit)},
-			},
-		}))
-	}
+	cursors.addLinks(r, gamesItem, route, routeParams, limit)
 	return gamesItem
 }
 
@@ -431,6 +575,7 @@ type Game struct {
 	Mustered bool // Game has mustered all players.
 	Closed   bool // Game is no longer joinable.
 	Finished bool // Game has reached its end.
+	Replay   bool // Game is an imported copy of an exported game, hidden from game lists and never resolved.
 
 	Desc                          string           `methods:"POST,PUT" datastore:",noindex"`
 	Variant                       string           `methods:"POST"`
@@ -449,24 +594,51 @@ type Game struct {
 	DisablePrivateChat            bool             `methods:"POST,PUT"`
 	NationAllocation              AllocationMethod `methods:"POST"`
 	Anonymous                     bool             `methods:"POST"`
+	DisablePress                  bool             `methods:"POST"`
+	BroadcastOnly                 bool             `methods:"POST"`
 	LastYear                      int              `methods:"POST,PUT"`
 	SkipMuster                    bool             `methods:"POST,PUT"`
 	ChatLanguageISO639_1          string           `methods:"POST,PUT"`
 	GameMasterEnabled             bool             `methods:"POST"`
 	RequireGameMasterInvitation   bool             `methods:"POST,PUT"`
+	ExtensionQuorum               int              `methods:"POST"`
+	AllowSpectators               bool             `methods:"POST"` // Whether non members can join the game as spectators.
+	SpectatorDelayMinutes         time.Duration    `methods:"POST"` // How old phases and messages must be before non members, spectating or not, see them.
+	DrawRule                      string           `methods:"POST"` // How many votes draws need, and who they include, see draw_vote.go.
+	StickyDrawVotes               bool             `methods:"POST"` // Whether draw and concession votes are kept when new phases start.
+	ConcedeToAnyNation            bool             `methods:"POST"` // Whether concession votes can award the game to any survivor, not only the leaders.
 
 	GameMasterInvitations GameMasterInvitations
 	GameMaster            auth.User
+	CreatorId             string `json:"-"` // The user who created the game, allowed to kick members before it starts.
 
-	NMembers int
-	Members  Members
-	StartETA time.Time
+	NMembers       int
+	Members        Members
+	Spectators     Members // Users watching the game without playing, see spectator.go.
+	StartETA       time.Time
+	LastActivityAt time.Time // When the newest phase was created, or when the game was created if it has no phases.
+	SearchTokens   []string  `json:"-"` // Lowercased words of Desc, for /Games/Search.
 
 	NewestPhaseMeta []PhaseMeta
 
-	ActiveBans         []Ban    `datastore:"-"`
-	FailedRequirements []string `datastore:"-"`
-	FirstMember        *Member  `datastore:"-" json:",omitempty" methods:"POST"`
+	// Paused games don't resolve phases until resumed by the game master or all active members.
+	Paused      bool
+	PausedAt    time.Time
+	PauseVotes  Nations
+	ResumeVotes Nations
+	DrawVotes   Nations
+
+	ConcessionVotes []ConcessionVote
+
+	ResignedUserIds []string `json:"-"` // Users who resigned from the game, and may not rejoin it.
+
+	ResultType string `json:",omitempty"` // How a finished game ended, one of the GameResultType constants.
+
+	ActiveBans         []Ban            `datastore:"-"`
+	FailedRequirements []string         `datastore:"-"`
+	FirstMember        *Member          `datastore:"-" json:",omitempty" methods:"POST"`
+	Result             *GameResult      `datastore:"-" json:",omitempty"`
+	UserHistory        *UserGameHistory `datastore:"-" json:",omitempty"`
 
 	CreatedAt   time.Time
 	CreatedAgo  time.Duration `datastore:"-" ticker:"true"`
@@ -476,7 +648,28 @@ type Game struct {
 	FinishedAgo time.Duration `datastore:"-" ticker:"true"`
 }
 
+// searchTokens returns the unique lowercased words of s, without punctuation.
+func searchTokens(s string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, token := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[token] {
+			seen[token] = true
+			result = append(result, token)
+		}
+	}
+	return result
+}
+
 func (g *Game) Save() ([]datastore.Property, error) {
+	if len(g.NewestPhaseMeta) > 0 && !g.NewestPhaseMeta[0].CreatedAt.IsZero() {
+		g.LastActivityAt = g.NewestPhaseMeta[0].CreatedAt
+	} else {
+		g.LastActivityAt = g.CreatedAt
+	}
+	g.SearchTokens = searchTokens(g.Desc)
 	return datastore.SaveStruct(g)
 }
 func (g *Game) Load(props []datastore.Property) error {
@@ -545,6 +738,24 @@ func (g *Game) canMergeInto(o *Game, avoid *auth.User) bool {
 	if g.Anonymous != o.Anonymous {
 		return false
 	}
+	if g.DisablePress != o.DisablePress {
+		return false
+	}
+	if g.BroadcastOnly != o.BroadcastOnly {
+		return false
+	}
+	if g.AllowSpectators != o.AllowSpectators {
+		return false
+	}
+	if g.SpectatorDelayMinutes != o.SpectatorDelayMinutes {
+		return false
+	}
+	if g.DrawRule != o.DrawRule || g.StickyDrawVotes != o.StickyDrawVotes {
+		return false
+	}
+	if g.ConcedeToAnyNation != o.ConcedeToAnyNation {
+		return false
+	}
 	if g.GameMasterEnabled || o.GameMasterEnabled {
 		return false
 	}
@@ -560,6 +771,9 @@ func (g *Game) canMergeInto(o *Game, avoid *auth.User) bool {
 	if g.ChatLanguageISO639_1 != o.ChatLanguageISO639_1 {
 		return false
 	}
+	if g.ExtensionQuorum != o.ExtensionQuorum {
+		return false
+	}
 	for _, member := range o.Members {
 		if member.User.Id == avoid.Id {
 			return false
@@ -632,9 +846,10 @@ func (g *Game) GetMemberByNation(nation godip.Nation) (*Member, bool) {
 	return nil, false
 }
 
+// GetMemberByUserId returns the member playing for the user, which resigned players no longer are.
 func (g *Game) GetMemberByUserId(userID string) (*Member, bool) {
 	for i := range g.Members {
-		if g.Members[i].User.Id == userID {
+		if g.Members[i].User.Id == userID && !g.Members[i].Abandoned {
 			return &g.Members[i], true
 		}
 	}
@@ -671,6 +886,9 @@ func (g *Game) Joinable(user *auth.User) bool {
 		if g.GameMasterEnabled && g.HasReplaceableMember() && (!g.RequireGameMasterInvitation || g.IsInvitedByGameMaster(user.Email)) {
 			return true
 		}
+		if !g.GameMasterEnabled && !g.Finished && g.HasAbandonedMember() {
+			return true
+		}
 		return false
 	} else {
 		if g.GameMasterEnabled && g.RequireGameMasterInvitation && !g.IsInvitedByGameMaster(user.Email) {
@@ -688,26 +906,152 @@ func (g *Game) Item(r Request) *Item {
 			if g.Leavable() {
 				gameItem.AddLink(r.NewLink(MemberResource.Link("leave", Delete, []string{"game_id", g.ID.Encode(), "user_id", user.Id})))
 			}
+			if !g.Started && !g.GameMasterEnabled && g.CreatorId == user.Id {
+				for _, member := range g.Members {
+					if member.User.Id != user.Id {
+						gameItem.AddLink(r.NewLink(Link{
+							Rel:         "kick-" + member.User.Id,
+							Route:       KickMemberRoute,
+							RouteParams: []string{"game_id", g.ID.Encode(), "user_id", member.User.Id},
+							Method:      "POST",
+						}))
+					}
+				}
+			}
 			gameItem.AddLink(r.NewLink(MemberResource.Link("update-membership", Update, []string{"game_id", g.ID.Encode(), "user_id", user.Id})))
 		} else {
 			if g.Joinable(user) {
 				gameItem.AddLink(r.NewLink(MemberResource.Link("join", Create, []string{"game_id", g.ID.Encode()})))
 			}
 		}
-		gameItem.AddLink(r.NewLink(Link{
-			Rel:         "channels",
-			Route:       ListChannelsRoute,
-			RouteParams: []string{"game_id", g.ID.Encode()},
-		}))
+		if !g.pressDisabled() {
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "channels",
+				Route:       ListChannelsRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+			}))
+		}
 		if g.Started {
 			gameItem.AddLink(r.NewLink(Link{
 				Rel:         "phases",
 				Route:       ListPhasesRoute,
 				RouteParams: []string{"game_id", g.ID.Encode()},
 			}))
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "all-phase-states",
+				Route:       ListAllPhaseStatesRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+			}))
 		}
 		if g.Finished {
 			gameItem.AddLink(r.NewLink(GameResultResource.Link("game-result", Load, []string{"game_id", g.ID.Encode()})))
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "export",
+				Route:       ExportGameRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+			}))
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "transcript",
+				Route:       ExportTranscriptRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+			}))
+			if _, isMember := g.GetMemberByUserId(user.Id); isMember {
+				gameItem.AddLink(r.NewLink(Link{
+					Rel:         "feedback",
+					Route:       ListFeedbackRoute,
+					RouteParams: []string{"game_id", g.ID.Encode()},
+				}))
+			}
+		} else if _, isMember := g.GetMemberByUserId(user.Id); isMember && g.Started {
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "export",
+				Route:       ExportGameRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+			}))
+		}
+		if _, isMember := g.GetMemberByUserId(user.Id); (isMember || (g.GameMasterEnabled && user.Id == g.GameMaster.Id)) && g.Started && !g.Finished {
+			if g.Paused {
+				gameItem.AddLink(r.NewLink(Link{
+					Rel:         "resume",
+					Route:       ResumeGameRoute,
+					RouteParams: []string{"game_id", g.ID.Encode()},
+					Method:      "POST",
+				}))
+			} else {
+				gameItem.AddLink(r.NewLink(Link{
+					Rel:         "pause",
+					Route:       PauseGameRoute,
+					RouteParams: []string{"game_id", g.ID.Encode()},
+					Method:      "POST",
+				}))
+			}
+		}
+		if member, isMember := g.GetMemberByUserId(user.Id); isMember && g.Started && g.Mustered && !g.Finished && !member.NewestPhaseState.Eliminated {
+			if g.DrawVotes.Includes(member.Nation) {
+				gameItem.AddLink(r.NewLink(Link{
+					Rel:         "withdraw-draw-vote",
+					Route:       WithdrawDrawVoteRoute,
+					RouteParams: []string{"game_id", g.ID.Encode()},
+					Method:      "DELETE",
+				}))
+			} else {
+				gameItem.AddLink(r.NewLink(Link{
+					Rel:         "draw-vote",
+					Route:       DrawVoteRoute,
+					RouteParams: []string{"game_id", g.ID.Encode()},
+					Method:      "POST",
+				}))
+			}
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "concession-vote",
+				Route:       ConcessionVoteRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+				Method:      "POST",
+			}))
+			if _, hasVote := withoutConcessionVoteBy(g.ConcessionVotes, member.Nation); hasVote {
+				gameItem.AddLink(r.NewLink(Link{
+					Rel:         "withdraw-concession-vote",
+					Route:       WithdrawConcessionVoteRoute,
+					RouteParams: []string{"game_id", g.ID.Encode()},
+					Method:      "DELETE",
+				}))
+			}
+		}
+		if g.Spectatable(user) {
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "spectate",
+				Route:       SpectateGameRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+				Method:      "POST",
+			}))
+		} else if _, isSpectator := g.GetSpectatorByUserId(user.Id); isSpectator {
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "stop-spectating",
+				Route:       StopSpectatingGameRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+				Method:      "DELETE",
+			}))
+		}
+		if g.CreatorId == user.Id && !g.Finished {
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "phase-webhook",
+				Route:       PhaseWebhookRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+			}))
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "update-phase-webhook",
+				Route:       UpdatePhaseWebhookRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+				Method:      "PUT",
+			}))
+		}
+		if member, isMember := g.GetMemberByUserId(user.Id); isMember && g.Resignable(member) {
+			gameItem.AddLink(r.NewLink(Link{
+				Rel:         "resign",
+				Route:       ResignGameRoute,
+				RouteParams: []string{"game_id", g.ID.Encode()},
+				Method:      "POST",
+			}))
 		}
 		if g.Started {
 			gameItem.AddLink(r.NewLink(Link{
@@ -756,7 +1100,7 @@ func (g *Game) Item(r Request) *Item {
 			}
 			uniqueMemberIds := map[string]bool{}
 			for _, member := range g.Members {
-				if member.User.Id != "" {
+				if !member.Vacant() {
 					uniqueMemberIds[member.User.Id] = true
 				}
 			}
@@ -896,6 +1240,14 @@ func createGame(w ResponseWriter, r Request) (*Game, error) {
 	}
 
 	game := &Game{}
+	// The body replaces the settings of the preset, so that fields missing from the body keep the values of the preset.
+	if presetName := r.Req().URL.Query().Get("preset"); presetName != "" {
+		preset, err := loadGamePreset(ctx, presetName)
+		if err != nil {
+			return nil, err
+		}
+		preset.applyTo(game)
+	}
 	err := Copy(game, r, "POST")
 	if err != nil {
 		return nil, err
@@ -912,12 +1264,22 @@ func createGame(w ResponseWriter, r Request) (*Game, error) {
 	if game.PhaseLengthMinutes > MAX_PHASE_DEADLINE {
 		return nil, HTTPErr{"no games with more than 30 day deadlines allowed", http.StatusBadRequest}
 	}
+	if game.ExtensionQuorum < 0 {
+		return nil, HTTPErr{"no games with negative extension quorum allowed", http.StatusBadRequest}
+	}
+	if game.SpectatorDelayMinutes < 0 || game.SpectatorDelayMinutes > MAX_PHASE_DEADLINE {
+		return nil, HTTPErr{"no games with negative spectator delays, or delays longer than 30 days, allowed", http.StatusBadRequest}
+	}
+	if !validDrawRule(game.DrawRule) {
+		return nil, HTTPErr{fmt.Sprintf("DrawRule must be one of %v", strings.Join(drawRules, ", ")), http.StatusBadRequest}
+	}
 	if game.GameMasterEnabled {
 		if !game.Private {
 			return nil, HTTPErr{"only private games can have game master", http.StatusBadRequest}
 		}
 		game.GameMaster = *user
 	}
+	game.CreatorId = user.Id
 	game.CreatedAt = time.Now()
 
 	if !game.NoMerge && !game.Private {
@@ -969,7 +1331,19 @@ func createGame(w ResponseWriter, r Request) (*Game, error) {
 	return game, nil
 }
 
-func (g *Game) Redact(viewer *auth.User, r Request) {
+// viewerIsSuperuser returns whether viewer is a superuser, who sees the members of anonymous games.
+// If that can't be determined, the error is logged and viewer is treated as any other user.
+func viewerIsSuperuser(ctx context.Context, viewer *auth.User) bool {
+	superuser, err := isSuperuser(ctx, viewer.Id)
+	if err != nil {
+		log.Errorf(ctx, "Unable to check if %q is a superuser, anonymizing the members of anonymous games: %v", viewer.Id, err)
+		return false
+	}
+	return superuser
+}
+
+// Redact hides what viewer isn't allowed to see. superuser is whether viewer is a superuser, looked up once per request using viewerIsSuperuser.
+func (g *Game) Redact(viewer *auth.User, superuser bool, r Request) {
 	if viewer.Id == g.GameMaster.Id {
 		return
 	}
@@ -978,7 +1352,9 @@ func (g *Game) Redact(viewer *auth.User, r Request) {
 			g.GameMasterInvitations[index].Email = ""
 		}
 	}
-	if !g.Finished && ((g.Private && g.Anonymous) || (!g.Private && g.DisablePrivateChat && g.DisableGroupChat && g.DisableConferenceChat)) {
+	// Superusers moderate anonymous games, so they see who plays them.
+	anonymize := g.anonymizesMembers() && !superuser
+	if anonymize {
 		for index := range g.Members {
 			if g.Members[index].User.Id == viewer.Id {
 				g.Members[index].Redact(viewer, g.Mustered && g.Started)
@@ -991,6 +1367,20 @@ func (g *Game) Redact(viewer *auth.User, r Request) {
 			g.Members[index].Redact(viewer, g.Mustered && g.Started)
 		}
 	}
+	for index := range g.Spectators {
+		if anonymize && g.Spectators[index].User.Id != viewer.Id {
+			g.Spectators[index].Anonymize(r)
+		} else {
+			g.Spectators[index].Redact(viewer, false)
+		}
+	}
+	if cutoff, delayed := g.nonMemberCutoff(viewer.Id, time.Now()); delayed && g.ID != nil {
+		ctx := appengine.NewContext(r.Req())
+		if err := g.delayNewestPhaseMetaTo(ctx, cutoff); err != nil {
+			log.Errorf(ctx, "Unable to delay the newest phase of %v for %q, hiding it: %v", g.ID, viewer.Id, err)
+			g.NewestPhaseMeta = nil
+		}
+	}
 }
 
 type Preferer interface {
@@ -1131,6 +1521,11 @@ func asyncStartGame(ctx context.Context, gameID *datastore.Key, host string) err
 		}
 		g.ID = gameID
 
+		if g.Started {
+			log.Infof(ctx, "%v is already started, someone must have started it before we got here?", g.ID)
+			return nil
+		}
+
 		variant := variants.Variants[g.Variant]
 		if len(g.Members) != len(variant.Nations) {
 			log.Warningf(ctx, "Variant %v has %v nations, game %v has %v nations, someone must have dropped out before we got here?", g.Variant, len(variant.Nations), g.ID, len(g.Members))
@@ -1310,6 +1705,88 @@ func asyncStartGame(ctx context.Context, gameID *datastore.Key, host string) err
 	return nil
 }
 
+// devForceMuster starts the game if it is still staging, and then resolves the mustering phase
+// as if all members were ready, so that the game has allocated nations and a proper first phase.
+func devForceMuster(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	if !appengine.IsDevAppServer() {
+		return fmt.Errorf("only accessible in local dev mode")
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return err
+	}
+
+	if !game.Started {
+		if len(game.Members) != len(variants.Variants[game.Variant].Nations) {
+			return HTTPErr{"game needs one member per nation to muster", http.StatusPreconditionFailed}
+		}
+		if err := asyncStartGame(ctx, gameID, r.Req().Host); err != nil {
+			return err
+		}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+	}
+
+	if !game.Mustered {
+		phaseOrdinal := game.NewestPhaseMeta[0].PhaseOrdinal
+		phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+		if err != nil {
+			return err
+		}
+		if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+			phase := &Phase{}
+			if err := datastore.Get(ctx, phaseID, phase); err != nil {
+				return err
+			}
+			phase.DeadlineAt = time.Now()
+			phaseStates := PhaseStates{}
+			phaseStateIDs, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &phaseStates)
+			if err != nil {
+				return err
+			}
+			toSave := []interface{}{phase}
+			keys := []*datastore.Key{phaseID}
+			for idx := range phaseStates {
+				phaseStates[idx].ReadyToResolve = true
+				toSave = append(toSave, &phaseStates[idx])
+				keys = append(keys, phaseStateIDs[idx])
+			}
+			_, err = datastore.PutMulti(ctx, keys, toSave)
+			return err
+		}, &datastore.TransactionOptions{XG: false}); err != nil {
+			return err
+		}
+		for err = timeoutResolvePhase(ctx, gameID, phaseOrdinal); err == datastore.ErrConcurrentTransaction; err = timeoutResolvePhase(ctx, gameID, phaseOrdinal) {
+			time.Sleep(time.Second)
+		}
+		if err != nil {
+			return err
+		}
+		game = &Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+	}
+
+	game.ID = gameID
+	for i := range game.NewestPhaseMeta {
+		game.NewestPhaseMeta[i].Refresh()
+	}
+	game.Refresh()
+
+	w.SetContent(game.Item(r))
+	return nil
+}
+
 func gameMasterUpdateGame(w ResponseWriter, r Request) (*Game, error) {
 	ctx := appengine.NewContext(r.Req())
 
@@ -1402,7 +1879,7 @@ func loadGame(w ResponseWriter, r Request) (*Game, error) {
 		}
 	}
 
-	game.Redact(user, r)
+	filtered[0].Redact(user, viewerIsSuperuser(ctx, user), r)
 
 	return &filtered[0], nil
 }
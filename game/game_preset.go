@@ -0,0 +1,176 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zond/godip/variants"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	gamePresetKind = "GamePreset"
+	// How many presets can be configured at once, to stay within the entity groups of the configuration transaction.
+	maxConfiguredGamePresets = 10
+)
+
+type GamePresets []GamePreset
+
+func (g GamePresets) Item(r Request) *Item {
+	presetItems := make(List, len(g))
+	for i := range g {
+		presetItems[i] = NewItem(g[i]).SetName(g[i].Name)
+	}
+	return NewItem(presetItems).SetName("game-presets").AddLink(r.NewLink(Link{
+		Rel:   "self",
+		Route: ListGamePresetsRoute,
+	})).SetDesc([][]string{
+		[]string{
+			"Game presets",
+			"Named sets of game settings, managed by the operators of the server.",
+			"Add `preset=<Name>` to the URL when creating a game to use the settings of the preset for all fields not in the body.",
+		},
+	})
+}
+
+// GamePreset is a named set of defaults for creating games.
+type GamePreset struct {
+	Name                          string
+	Desc                          string `datastore:",noindex"`
+	Variant                       string
+	PhaseLengthMinutes            time.Duration
+	NonMovementPhaseLengthMinutes time.Duration
+	Private                       bool
+	Anonymous                     bool
+	DisableConferenceChat         bool
+	DisableGroupChat              bool
+	DisablePrivateChat            bool
+	DisablePress                  bool
+	BroadcastOnly                 bool
+	NationAllocation              AllocationMethod
+}
+
+func GamePresetID(ctx context.Context, name string) *datastore.Key {
+	return datastore.NewKey(ctx, gamePresetKind, name, 0, nil)
+}
+
+// Validate makes sure the preset would create a valid game.
+func (g *GamePreset) Validate() error {
+	if g.Name == "" {
+		return fmt.Errorf("Name can't be empty")
+	}
+	if _, found := variants.Variants[g.Variant]; !found {
+		return fmt.Errorf("%q: unknown variant %q", g.Name, g.Variant)
+	}
+	if g.PhaseLengthMinutes < 1 || g.PhaseLengthMinutes > MAX_PHASE_DEADLINE {
+		return fmt.Errorf("%q: PhaseLengthMinutes must be between 1 and %d", g.Name, MAX_PHASE_DEADLINE)
+	}
+	if g.NonMovementPhaseLengthMinutes < 0 || g.NonMovementPhaseLengthMinutes > MAX_PHASE_DEADLINE {
+		return fmt.Errorf("%q: NonMovementPhaseLengthMinutes must be between 0 and %d", g.Name, MAX_PHASE_DEADLINE)
+	}
+	if g.NationAllocation != RandomAllocation && g.NationAllocation != PreferenceAllocation {
+		return fmt.Errorf("%q: unknown allocation method %v, pick %v or %v", g.Name, g.NationAllocation, RandomAllocation, PreferenceAllocation)
+	}
+	return nil
+}
+
+// applyTo sets the settings of the preset in game.
+func (g *GamePreset) applyTo(game *Game) {
+	game.Variant = g.Variant
+	game.PhaseLengthMinutes = g.PhaseLengthMinutes
+	game.NonMovementPhaseLengthMinutes = g.NonMovementPhaseLengthMinutes
+	game.Private = g.Private
+	game.Anonymous = g.Anonymous
+	game.DisableConferenceChat = g.DisableConferenceChat
+	game.DisableGroupChat = g.DisableGroupChat
+	game.DisablePrivateChat = g.DisablePrivateChat
+	game.DisablePress = g.DisablePress
+	game.BroadcastOnly = g.BroadcastOnly
+	game.NationAllocation = g.NationAllocation
+}
+
+// validateGamePresets validates each preset, and makes sure no two presets have the same name.
+func validateGamePresets(presets GamePresets) error {
+	if len(presets) > maxConfiguredGamePresets {
+		return fmt.Errorf("can configure at most %d presets at once", maxConfiguredGamePresets)
+	}
+	names := map[string]bool{}
+	for i := range presets {
+		if err := presets[i].Validate(); err != nil {
+			return err
+		}
+		if names[presets[i].Name] {
+			return fmt.Errorf("%q: more than one preset with the same name", presets[i].Name)
+		}
+		names[presets[i].Name] = true
+	}
+	return nil
+}
+
+// SetGamePresets creates or replaces the presets. Unlike the other configuration sections, presets can be changed after they are
+// first configured, so only superusers may configure them. Must be called inside a transaction.
+func SetGamePresets(ctx context.Context, presets GamePresets) error {
+	ids := make([]*datastore.Key, len(presets))
+	for i := range presets {
+		ids[i] = GamePresetID(ctx, presets[i].Name)
+	}
+	_, err := datastore.PutMulti(ctx, ids, presets)
+	return err
+}
+
+// gamePresetsChange describes what storing the presets would do, for configuration dry runs.
+func gamePresetsChange(ctx context.Context, presets GamePresets) (string, error) {
+	ids := make([]*datastore.Key, len(presets))
+	for i := range presets {
+		ids[i] = GamePresetID(ctx, presets[i].Name)
+	}
+	created, replaced := 0, 0
+	err := datastore.GetMulti(ctx, ids, make(GamePresets, len(presets)))
+	if merr, ok := err.(appengine.MultiError); ok {
+		for _, serr := range merr {
+			if serr == nil {
+				replaced++
+			} else if serr == datastore.ErrNoSuchEntity {
+				created++
+			} else {
+				return "", serr
+			}
+		}
+	} else if err != nil {
+		return "", err
+	} else {
+		replaced = len(presets)
+	}
+	return fmt.Sprintf("would create %d and replace %d presets", created, replaced), nil
+}
+
+func loadGamePreset(ctx context.Context, name string) (*GamePreset, error) {
+	preset := &GamePreset{}
+	if err := datastore.Get(ctx, GamePresetID(ctx, name), preset); err == datastore.ErrNoSuchEntity {
+		return nil, HTTPErr{fmt.Sprintf("no game preset named %q", name), http.StatusNotFound}
+	} else if err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+func listGamePresets(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	presets := GamePresets{}
+	if _, err := datastore.NewQuery(gamePresetKind).GetAll(ctx, &presets); err != nil {
+		return err
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+
+	w.SetContent(presets.Item(r))
+	return nil
+}
@@ -0,0 +1,49 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestGamePresetValidate(t *testing.T) {
+	valid := GamePreset{
+		Name:               "Blitz",
+		Variant:            "Classical",
+		PhaseLengthMinutes: 15,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Got %v, wanted a valid preset", err)
+	}
+	for _, invalid := range []func(*GamePreset){
+		func(p *GamePreset) { p.Name = "" },
+		func(p *GamePreset) { p.Variant = "not a variant" },
+		func(p *GamePreset) { p.PhaseLengthMinutes = 0 },
+		func(p *GamePreset) { p.NonMovementPhaseLengthMinutes = MAX_PHASE_DEADLINE + 1 },
+		func(p *GamePreset) { p.NationAllocation = 7 },
+	} {
+		preset := valid
+		invalid(&preset)
+		if err := preset.Validate(); err == nil {
+			t.Errorf("Got %+v valid, wanted invalid", preset)
+		}
+	}
+	if err := validateGamePresets(GamePresets{valid, valid}); err == nil {
+		t.Errorf("Got presets with the same name valid, wanted invalid")
+	}
+}
+
+func TestGamePresetApplyTo(t *testing.T) {
+	preset := &GamePreset{
+		Name:               "Gunboat",
+		Variant:            "Classical",
+		PhaseLengthMinutes: 60 * 24,
+		Private:            true,
+		Anonymous:          true,
+		DisablePrivateChat: true,
+		DisablePress:       true,
+	}
+	game := &Game{Desc: "kept"}
+	preset.applyTo(game)
+	if game.Variant != "Classical" || game.PhaseLengthMinutes != 60*24 || !game.Anonymous || !game.DisablePrivateChat || !game.DisablePress || game.Desc != "kept" {
+		t.Errorf("Got %+v, wanted the settings of %+v", game, preset)
+	}
+}
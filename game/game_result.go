@@ -111,12 +111,32 @@ func (gs GameScores) Assign() {
 	}
 }
 
+const (
+	GameResultTypeSolo       = "solo"
+	GameResultTypeDraw       = "draw"
+	GameResultTypeConcession = "concession"
+)
+
+var gameResultTypes = []string{GameResultTypeSolo, GameResultTypeDraw, GameResultTypeConcession}
+
+// gameResultType returns how a game with soloWinner ended. Games won because the only opponent conceded are concessions.
+func gameResultType(soloWinner godip.Nation, conceded bool) string {
+	switch {
+	case conceded:
+		return GameResultTypeConcession
+	case soloWinner != "":
+		return GameResultTypeSolo
+	}
+	return GameResultTypeDraw
+}
+
 type GameResults []GameResult
 
 type GameResult struct {
 	GameID               *datastore.Key
 	SoloWinnerMember     godip.Nation
 	SoloWinnerUser       string
+	ResultType           string
 	DIASMembers          []godip.Nation
 	DIASUsers            []string
 	NMRMembers           []godip.Nation
@@ -146,6 +166,7 @@ func (r *GameResult) Save() ([]datastore.Property, error) {
 type player struct {
 	score             GameScore
 	player            trueskill.Player
+	variantPlayer     trueskill.Player
 	previousTrueSkill TrueSkill
 }
 
@@ -193,6 +214,12 @@ func (g *GameResult) TrueSkillRate(ctx context.Context, onlyUnrated bool, update
 		}
 	}
 
+	// We need the variant to rate the players within the variant as well.
+	game := &Game{}
+	if err := datastore.Get(ctx, g.GameID, game); err != nil {
+		return err
+	}
+
 	// We make a slice of players, consisting of GameScores and TrueSkill players.
 	players := make(players, len(g.Scores))
 	for idx := range players {
@@ -200,9 +227,14 @@ func (g *GameResult) TrueSkillRate(ctx context.Context, onlyUnrated bool, update
 		if err != nil {
 			return err
 		}
+		variantTrueSkill, err := GetVariantTrueSkill(ctx, g.Scores[idx].UserId, game.Variant)
+		if err != nil {
+			return err
+		}
 		players[idx] = player{
 			score:             g.Scores[idx],
 			player:            trueskill.NewPlayer(trueSkill.Mu, trueSkill.Sigma),
+			variantPlayer:     trueskill.NewPlayer(variantTrueSkill.VariantMu, variantTrueSkill.VariantSigma),
 			previousTrueSkill: *trueSkill,
 		}
 	}
@@ -227,6 +259,13 @@ func (g *GameResult) TrueSkillRate(ctx context.Context, onlyUnrated bool, update
 	newTSPlayers, prob := ts.AdjustSkillsWithDraws(tsPlayers, draws)
 	log.Infof(ctx, "AdjustSkillsWithDraws(%+v, %+v): %+v", tsPlayers, draws, newTSPlayers)
 
+	// Do the same within the variant.
+	variantTSPlayers := make([]trueskill.Player, len(players))
+	for idx := range players {
+		variantTSPlayers[idx] = players[idx].variantPlayer
+	}
+	newVariantTSPlayers, _ := ts.AdjustSkillsWithDraws(variantTSPlayers, draws)
+
 	// Create new TrueSkill entities for this game.
 	newTrueSkills := make([]TrueSkill, len(players))
 	newTrueSkillIDs := make([]*datastore.Key, len(players))
@@ -242,6 +281,11 @@ func (g *GameResult) TrueSkillRate(ctx context.Context, onlyUnrated bool, update
 				Mu:        newTSPlayers[idx].Mu(),
 				Sigma:     newTSPlayers[idx].Sigma(),
 				Rating:    ts.TrueSkill(newTSPlayers[idx]),
+
+				Variant:       game.Variant,
+				VariantMu:     newVariantTSPlayers[idx].Mu(),
+				VariantSigma:  newVariantTSPlayers[idx].Sigma(),
+				VariantRating: ts.TrueSkill(newVariantTSPlayers[idx]),
 			},
 			Previous: []TrueSkillContent{players[idx].previousTrueSkill.TrueSkillContent},
 		}
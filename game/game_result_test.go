@@ -263,3 +263,42 @@ func TestAssign_SanityTesting_VietnamWar(t *testing.T) {
 func TestAssign_SanityTesting_AncientMed(t *testing.T) {
 	sanityTestAllPositions(t, 5, 34, 18)
 }
+
+func TestGameResultSummary(t *testing.T) {
+	result := &GameResult{
+		DIASMembers: []godip.Nation{godip.France, godip.England},
+		Scores: GameScores{
+			{Member: godip.England, SCs: 10},
+			{Member: godip.Austria, SCs: 0},
+			{Member: godip.France, SCs: 12},
+			{Member: godip.Germany, SCs: 12},
+		},
+	}
+	if got, want := result.summary(), "Draw between France, England.\nFrance: 12 SCs\nGermany: 12 SCs\nEngland: 10 SCs\nAustria: 0 SCs"; got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+	if result.Scores[0].Member != godip.England {
+		t.Errorf("Got scores reordered to %+v, wanted them untouched", result.Scores)
+	}
+
+	result.SoloWinnerMember = godip.France
+	if got, want := result.summary(), "Solo victory by France.\nFrance: 12 SCs\nGermany: 12 SCs\nEngland: 10 SCs\nAustria: 0 SCs"; got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+}
+
+func TestGameResultType(t *testing.T) {
+	for _, tc := range []struct {
+		soloWinner godip.Nation
+		conceded   bool
+		want       string
+	}{
+		{"", false, GameResultTypeDraw},
+		{godip.France, false, GameResultTypeSolo},
+		{godip.France, true, GameResultTypeConcession},
+	} {
+		if got := gameResultType(tc.soloWinner, tc.conceded); got != tc.want {
+			t.Errorf("gameResultType(%q, %v) = %q, wanted %q", tc.soloWinner, tc.conceded, got, tc.want)
+		}
+	}
+}
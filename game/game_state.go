@@ -1,6 +1,7 @@
 package game
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -30,7 +31,7 @@ func init() {
 			{
 				Path:    "/Game/{game_id}/GameStates",
 				Route:   ListGameStatesRoute,
-				Handler: listGameStates,
+				Handler: etagCached(listGameStates),
 			},
 		},
 	}
@@ -55,16 +56,38 @@ func (g GameStates) Item(r Request, gameID *datastore.Key) *Item {
 		[]string{
 			"Muting",
 			"Adding another member nation to the 'Muted' list will hide all press from that member.",
-			"Note that messages from muted members will still count towards the totals in the channel listings.",
+			"Adding the user ID of another member to the 'MutedUsers' list will hide all press from that user, even before the game has mustered and the nations are known.",
+			"Note that messages from muted members will still count towards the totals in the channel listings, but not towards the unread counts.",
+			"To clear both 'Muted' and 'MutedUsers', POST to the 'unmute-all' link of your game state.",
+			"To add or remove a single nation without replacing the whole 'Muted' list, POST `{ 'Nation': [nation] }` to the 'mute' or 'unmute' link of your game state.",
+		},
+		[]string{
+			"Notification settings",
+			"The 'NotificationSettings' mute phase change, press and deadline reminder notifications for the game. Only the member can see their own settings.",
+			"PUTting the game state replaces all of it. To only change the settings, PUT them to the 'update-notification-settings' link of your game state.",
+		},
+		[]string{
+			"Nation preferences",
+			"The 'NationPreferences' list is a ranked list of the nations the member prefers to play.",
+			"Until the game has mustered, only the member can see their own preferences.",
 		},
 	})
 	return gameStatesItem
 }
 
+type NotificationSettings struct {
+	MutePhaseChanges      bool `methods:"PUT"`
+	MutePress             bool `methods:"PUT"`
+	MuteDeadlineReminders bool `methods:"PUT"`
+}
+
 type GameState struct {
-	GameID *datastore.Key
-	Nation godip.Nation
-	Muted  []godip.Nation `methods:"PUT"`
+	GameID               *datastore.Key
+	Nation               godip.Nation
+	Muted                []godip.Nation       `methods:"PUT"`
+	MutedUsers           []string             `methods:"PUT"`
+	NationPreferences    []godip.Nation       `methods:"PUT"`
+	NotificationSettings NotificationSettings `methods:"PUT"`
 }
 
 func (g *GameState) HasMuted(nat godip.Nation) bool {
@@ -76,6 +99,78 @@ func (g *GameState) HasMuted(nat godip.Nation) bool {
 	return false
 }
 
+func (g *GameState) HasMutedUser(userId string) bool {
+	for _, mut := range g.MutedUsers {
+		if mut == userId {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * loadMutedNations returns the nations in game whose press the user doesn't want to see.
+ * It combines the Muted nations and MutedUsers of the game state of the user with the
+ * MutedUsers of the user config, which apply to all games.
+ */
+func loadMutedNations(ctx context.Context, game *Game, userId string) (map[godip.Nation]struct{}, error) {
+	mutedNats := map[godip.Nation]struct{}{}
+
+	mutedUsers := []string{}
+	userConfig := &auth.UserConfig{}
+	if err := datastore.Get(ctx, auth.UserConfigID(ctx, auth.UserID(ctx, userId)), userConfig); err == nil {
+		mutedUsers = append(mutedUsers, userConfig.MutedUsers...)
+	} else if err != datastore.ErrNoSuchEntity {
+		return nil, err
+	}
+
+	if member, found := game.GetMemberByUserId(userId); game.Started && found {
+		gameStateID, err := GameStateID(ctx, game.ID, member.Nation)
+		if err != nil {
+			return nil, err
+		}
+		gameState := &GameState{}
+		if err = datastore.Get(ctx, gameStateID, gameState); err == nil {
+			if game.Mustered {
+				for _, nat := range gameState.Muted {
+					mutedNats[nat] = struct{}{}
+				}
+			}
+			mutedUsers = append(mutedUsers, gameState.MutedUsers...)
+		} else if err != datastore.ErrNoSuchEntity {
+			return nil, err
+		}
+	}
+
+	// Users can be muted before the nations are known, so resolve them via the members.
+	for _, mutedUser := range mutedUsers {
+		if mutedMember, found := game.GetMemberByUserId(mutedUser); found && mutedMember.Nation != "" {
+			mutedNats[mutedMember.Nation] = struct{}{}
+		}
+	}
+
+	return mutedNats, nil
+}
+
+/*
+ * loadMemberGameState returns the game state of the nation in game, or an empty game state
+ * (with all notifications enabled) if the nation is unknown or hasn't saved a game state.
+ */
+func loadMemberGameState(ctx context.Context, gameID *datastore.Key, nation godip.Nation) (*GameState, error) {
+	gameState := &GameState{GameID: gameID, Nation: nation}
+	if nation == "" {
+		return gameState, nil
+	}
+	gameStateID, err := GameStateID(ctx, gameID, nation)
+	if err != nil {
+		return nil, err
+	}
+	if err := datastore.Get(ctx, gameStateID, gameState); err != nil && err != datastore.ErrNoSuchEntity {
+		return nil, err
+	}
+	return gameState, nil
+}
+
 func GameStateID(ctx context.Context, gameID *datastore.Key, nation godip.Nation) (*datastore.Key, error) {
 	if gameID == nil || nation == "" {
 		return nil, fmt.Errorf("game states must have games and nations")
@@ -102,11 +197,128 @@ func (p *GameState) Item(r Request) *Item {
 	if isMember && memberNation == p.Nation {
 		gameStateItem.AddLink(r.NewLink(GameStateResource.Link("update", Update, []string{"game_id", p.GameID.Encode(), "nation", fmt.Sprint(memberNation)})))
 		gameStateItem.AddLink(r.NewLink(GameStateResource.Link("self", Load, []string{"game_id", p.GameID.Encode(), "nation", fmt.Sprint(memberNation)})))
+		gameStateItem.AddLink(r.NewLink(Link{
+			Rel:         "unmute-all",
+			Route:       UnmuteAllGameStateRoute,
+			Method:      "POST",
+			RouteParams: []string{"game_id", p.GameID.Encode(), "nation", fmt.Sprint(memberNation)},
+		}))
+		gameStateItem.AddLink(r.NewLink(Link{
+			Rel:         "mute",
+			Route:       MuteGameStateRoute,
+			Method:      "POST",
+			RouteParams: []string{"game_id", p.GameID.Encode(), "nation", fmt.Sprint(memberNation)},
+		}))
+		gameStateItem.AddLink(r.NewLink(Link{
+			Rel:         "unmute",
+			Route:       UnmuteGameStateRoute,
+			Method:      "POST",
+			RouteParams: []string{"game_id", p.GameID.Encode(), "nation", fmt.Sprint(memberNation)},
+		}))
+		gameStateItem.AddLink(r.NewLink(Link{
+			Rel:         "update-notification-settings",
+			Route:       UpdateNotificationSettingsRoute,
+			Method:      "PUT",
+			RouteParams: []string{"game_id", p.GameID.Encode(), "nation", fmt.Sprint(memberNation)},
+		}))
 	}
 	return gameStateItem
 }
 
 func updateGameState(w ResponseWriter, r Request) (*GameState, error) {
+	bodyBytes, err := ioutil.ReadAll(r.Req().Body)
+	if err != nil {
+		return nil, err
+	}
+	return mutateGameState(r, func(gameState *GameState) error {
+		*gameState = GameState{}
+		return CopyBytes(gameState, r, bodyBytes, "PUT")
+	})
+}
+
+// updateNotificationSettings replaces only the notification settings of the game state, leaving the muted lists alone.
+func updateNotificationSettings(w ResponseWriter, r Request) error {
+	bodyBytes, err := ioutil.ReadAll(r.Req().Body)
+	if err != nil {
+		return err
+	}
+	gameState, err := mutateGameState(r, func(gameState *GameState) error {
+		gameState.NotificationSettings = NotificationSettings{}
+		return CopyBytes(&gameState.NotificationSettings, r, bodyBytes, "PUT")
+	})
+	if err != nil {
+		return err
+	}
+	w.SetContent(gameState.Item(r))
+	return nil
+}
+
+func unmuteAllGameState(w ResponseWriter, r Request) error {
+	gameState, err := mutateGameState(r, func(gameState *GameState) error {
+		gameState.Muted = nil
+		gameState.MutedUsers = nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.SetContent(gameState.Item(r))
+	return nil
+}
+
+type muteRequest struct {
+	Nation godip.Nation
+}
+
+func muteGameState(w ResponseWriter, r Request) error {
+	return toggleMutedNation(w, r, true)
+}
+
+func unmuteGameState(w ResponseWriter, r Request) error {
+	return toggleMutedNation(w, r, false)
+}
+
+/*
+ * toggleMutedNation adds or removes a single nation in the Muted list of the game state,
+ * so that clients don't have to PUT the whole list and risk overwriting concurrent updates.
+ */
+func toggleMutedNation(w ResponseWriter, r Request, mute bool) error {
+	req := &muteRequest{}
+	if err := json.NewDecoder(r.Req().Body).Decode(req); err != nil {
+		return HTTPErr{fmt.Sprintf("unable to parse body: %v", err), http.StatusBadRequest}
+	}
+	if req.Nation == "" {
+		return HTTPErr{"must specify a nation", http.StatusBadRequest}
+	}
+	gameState, err := mutateGameState(r, func(gameState *GameState) error {
+		if gameState.HasMuted(req.Nation) == mute {
+			return nil
+		}
+		if mute {
+			gameState.Muted = append(gameState.Muted, req.Nation)
+			return nil
+		}
+		var muted []godip.Nation
+		for _, nat := range gameState.Muted {
+			if nat != req.Nation {
+				muted = append(muted, nat)
+			}
+		}
+		gameState.Muted = muted
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.SetContent(gameState.Item(r))
+	return nil
+}
+
+/*
+ * mutateGameState runs mutate on the game state of the requesting member inside a transaction,
+ * validates the result and saves it.
+ */
+func mutateGameState(r Request, mutate func(gameState *GameState) error) (*GameState, error) {
 	ctx := appengine.NewContext(r.Req())
 
 	user, ok := r.Values()["user"].(*auth.User)
@@ -121,10 +333,6 @@ func updateGameState(w ResponseWriter, r Request) (*GameState, error) {
 
 	nation := godip.Nation(r.Vars()["nation"])
 
-	bodyBytes, err := ioutil.ReadAll(r.Req().Body)
-	if err != nil {
-		return nil, err
-	}
 	gameState := &GameState{}
 	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
 		game := &Game{}
@@ -141,14 +349,41 @@ func updateGameState(w ResponseWriter, r Request) (*GameState, error) {
 			return HTTPErr{"can only update own game state", http.StatusNotFound}
 		}
 
-		err = CopyBytes(gameState, r, bodyBytes, "PUT")
+		gameStateID, err := GameStateID(ctx, gameID, member.Nation)
 		if err != nil {
 			return err
 		}
+		*gameState = GameState{}
+		if err := datastore.Get(ctx, gameStateID, gameState); err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		if err := mutate(gameState); err != nil {
+			return err
+		}
+
+		seenNations := map[godip.Nation]bool{}
+		for _, preference := range gameState.NationPreferences {
+			if !Nations(variants.Variants[game.Variant].Nations).Includes(preference) {
+				return HTTPErr{fmt.Sprintf("%q is not a nation of %v", preference, game.Variant), http.StatusBadRequest}
+			}
+			if seenNations[preference] {
+				return HTTPErr{fmt.Sprintf("%q is preferred more than once", preference), http.StatusBadRequest}
+			}
+			seenNations[preference] = true
+		}
+
+		for _, mutedUser := range gameState.MutedUsers {
+			if _, found := game.GetMemberByUserId(mutedUser); !found {
+				return HTTPErr{fmt.Sprintf("%q is not a member of the game", mutedUser), http.StatusBadRequest}
+			}
+		}
 
 		gameState.GameID = gameID
 		gameState.Nation = member.Nation
 
+		r.Values()[memberNationFlag] = member.Nation
+
 		return gameState.Save(ctx)
 	}, &datastore.TransactionOptions{XG: false}); err != nil {
 		return nil, err
@@ -196,15 +431,27 @@ func loadGameState(w ResponseWriter, r Request) (*GameState, error) {
 	}
 	game.ID = gameID
 
-	if !game.Mustered {
-		gameState.Nation = ""
-	}
-
 	member, isMember := game.GetMemberByUserId(user.Id)
 	if isMember {
 		r.Values()[memberNationFlag] = member.Nation
 	}
 
+	isOwner := isMember && member.Nation != "" && member.Nation == gameState.Nation
+	if !isOwner {
+		gameState.NotificationSettings = NotificationSettings{}
+		// Muted users are the user IDs of members, which anonymous games hide.
+		if game.anonymizesMembers() {
+			gameState.MutedUsers = nil
+		}
+	}
+
+	if !game.Mustered {
+		if !isOwner {
+			gameState.NationPreferences = nil
+		}
+		gameState.Nation = ""
+	}
+
 	return gameState, nil
 }
 
@@ -252,8 +499,18 @@ func listGameStates(w ResponseWriter, r Request) error {
 		}
 	}
 
-	if !game.Mustered {
-		for idx := range gameStates {
+	for idx := range gameStates {
+		isOwner := isMember && member.Nation != "" && member.Nation == gameStates[idx].Nation
+		if !isOwner {
+			gameStates[idx].NotificationSettings = NotificationSettings{}
+			if game.anonymizesMembers() {
+				gameStates[idx].MutedUsers = nil
+			}
+		}
+		if !game.Mustered {
+			if !isOwner {
+				gameStates[idx].NationPreferences = nil
+			}
 			gameStates[idx].Nation = ""
 		}
 	}
@@ -261,3 +518,82 @@ func listGameStates(w ResponseWriter, r Request) error {
 	w.SetContent(gameStates.Item(r, gameID))
 	return nil
 }
+
+type MuteAudit struct {
+	GameID *datastore.Key
+	Muted  map[godip.Nation][]godip.Nation
+}
+
+func (m *MuteAudit) Item(r Request) *Item {
+	return NewItem(m).SetName("mute-audit").AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       MuteAuditRoute,
+		RouteParams: []string{"game_id", m.GameID.Encode()},
+	})).SetDesc([][]string{
+		[]string{
+			"Mute audit",
+			"The mute audit maps each nation of the game to the nations it has muted, either via the 'Muted' or the 'MutedUsers' list of its game state.",
+			"Nations that haven't muted anyone are left out.",
+			"Only available to superusers.",
+		},
+	})
+}
+
+func loadMuteAudit(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	superusers, err := auth.GetSuperusers(ctx)
+	if err == datastore.ErrNoSuchEntity {
+		return HTTPErr{"unauthorized", http.StatusForbidden}
+	} else if err != nil {
+		return err
+	}
+
+	if !superusers.Includes(user.Id) {
+		return HTTPErr{"unauthorized", http.StatusForbidden}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return err
+	}
+
+	gameStates := GameStates{}
+	if _, err := datastore.NewQuery(gameStateKind).Ancestor(gameID).GetAll(ctx, &gameStates); err != nil {
+		return err
+	}
+
+	audit := &MuteAudit{
+		GameID: gameID,
+		Muted:  map[godip.Nation][]godip.Nation{},
+	}
+	for _, gameState := range gameStates {
+		mutedNats := map[godip.Nation]bool{}
+		for _, nat := range gameState.Muted {
+			mutedNats[nat] = true
+		}
+		for _, mutedUser := range gameState.MutedUsers {
+			if mutedMember, found := game.GetMemberByUserId(mutedUser); found && mutedMember.Nation != "" {
+				mutedNats[mutedMember.Nation] = true
+			}
+		}
+		for _, nat := range variants.Variants[game.Variant].Nations {
+			if mutedNats[nat] {
+				audit.Muted[gameState.Nation] = append(audit.Muted[gameState.Nation], nat)
+			}
+		}
+	}
+
+	w.SetContent(audit.Item(r))
+	return nil
+}
@@ -1,9 +1,12 @@
 package game
 
 import (
+	"crypto/sha1"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
 	"sort"
 	"strconv"
@@ -18,6 +21,7 @@ import (
 	"google.golang.org/appengine/v2"
 	"google.golang.org/appengine/v2/datastore"
 	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
 
 	dipVariants "github.com/zond/godip/variants"
 
@@ -36,6 +40,7 @@ var (
 		gameKind:        func() interface{} { return &Game{} },
 		gameResultKind:  func() interface{} { return &GameResult{} },
 		phaseResultKind: func() interface{} { return &PhaseResult{} },
+		messageKind:     func() interface{} { return &Message{} },
 	}
 
 	AllocationResource *Resource
@@ -56,6 +61,10 @@ func init() {
 
 const (
 	maxLimit                    = 128
+	maxVariantFilters           = 8
+	maxSearchTokens             = 5
+	messageEditWindow           = 5 * time.Minute
+	gamesCountTTL               = time.Minute
 	MAX_STAGING_GAME_INACTIVITY = 30 * 24 * time.Hour
 	DiplicitySender             = "Diplicity"
 )
@@ -66,11 +75,17 @@ const (
 	ConfigureRoute                      = "AuthConfigure"
 	IndexRoute                          = "Index"
 	ListOpenGamesRoute                  = "ListOpenGames"
+	ListReplaceableGamesRoute           = "ListReplaceableGames"
 	ListStartedGamesRoute               = "ListStartedGames"
 	ListFinishedGamesRoute              = "ListFinishedGames"
 	ListMasteredStagingGamesRoute       = "ListMasteredStagingGames"
 	ListMasteredStartedGamesRoute       = "ListMasteredStartedGames"
 	ListMasteredFinishedGamesRoute      = "ListMasteredFinishedGames"
+	ListMyActiveGamesRoute              = "ListMyActiveGames"
+	SearchGamesRoute                    = "SearchGames"
+	ListUserFinishedGamesRoute          = "ListUserFinishedGames"
+	ListUserGamesRoute                  = "ListUserGames"
+	ListMyNeedsOrdersGamesRoute         = "ListMyNeedsOrdersGames"
 	ListMyStagingGamesRoute             = "ListMyStagingGames"
 	ListMyStartedGamesRoute             = "ListMyStartedGames"
 	ListMyFinishedGamesRoute            = "ListMyFinishedGames"
@@ -80,29 +95,69 @@ const (
 	ListOrdersRoute                     = "ListOrders"
 	ListPhasesRoute                     = "ListPhases"
 	ListPhaseStatesRoute                = "ListPhaseStates"
+	ListAllPhaseStatesRoute             = "ListAllPhaseStates"
 	ListGameStatesRoute                 = "ListGameStates"
+	UnmuteAllGameStateRoute             = "UnmuteAllGameState"
+	MuteGameStateRoute                  = "MuteGameState"
+	UnmuteGameStateRoute                = "UnmuteGameState"
+	UpdateNotificationSettingsRoute     = "UpdateNotificationSettings"
+	MuteAuditRoute                      = "MuteAudit"
 	ListOptionsRoute                    = "ListOptions"
+	GetOptionsDiffRoute                 = "GetOptionsDiff"
 	ListChannelsRoute                   = "ListChannels"
 	ListMessagesRoute                   = "ListMessages"
+	SearchMessagesRoute                 = "SearchMessages"
+	UpdateSeenMarkerRoute               = "UpdateSeenMarker"
+	ExportGameRoute                     = "ExportGame"
+	ExportTranscriptRoute               = "ExportTranscript"
+	KickMemberRoute                     = "KickMember"
+	PauseGameRoute                      = "PauseGame"
+	ResumeGameRoute                     = "ResumeGame"
+	ResignGameRoute                     = "ResignGame"
 	ListBansRoute                       = "ListBans"
 	ListTopRatedPlayersRoute            = "ListTopRatedPlayers"
 	ListTopReliablePlayersRoute         = "ListTopReliablePlayers"
 	ListTopHatedPlayersRoute            = "ListTopHatedPlayers"
 	ListTopHaterPlayersRoute            = "ListTopHaterPlayers"
+	ListTopNetHatedPlayersRoute         = "ListTopNetHatedPlayers"
 	ListTopQuickPlayersRoute            = "ListTopQuickPlayers"
 	ListFlaggedMessagesRoute            = "ListFlaggedMessages"
 	ListGameResultTrueSkillsRoute       = "ListGameResultTrueSkills"
 	DevResolvePhaseTimeoutRoute         = "DevResolvePhaseTimeout"
 	DevUserStatsUpdateRoute             = "DevUserStatsUpdate"
+	DevForceMusterRoute                 = "DevForceMuster"
+	ImportGameRoute                     = "ImportGame"
+	DryRunPhaseRoute                    = "DryRunPhase"
+	ReplaceOrdersRoute                  = "ReplaceOrders"
+	ValidateOrdersRoute                 = "ValidateOrders"
+	ListFeedbackRoute                   = "ListFeedback"
+	ListOrderRevisionsRoute             = "ListOrderRevisions"
+	SpectateGameRoute                   = "SpectateGame"
+	StopSpectatingGameRoute             = "StopSpectatingGame"
+	DrawVoteRoute                       = "DrawVote"
+	WithdrawDrawVoteRoute               = "WithdrawDrawVote"
+	ConcessionVoteRoute                 = "ConcessionVote"
+	WithdrawConcessionVoteRoute         = "WithdrawConcessionVote"
+	ListGamePresetsRoute                = "ListGamePresets"
+	PhaseWebhookRoute                   = "PhaseWebhook"
+	UpdatePhaseWebhookRoute             = "UpdatePhaseWebhook"
+	DeletePhaseWebhookRoute             = "DeletePhaseWebhook"
+	LiftBanRoute                        = "LiftBan"
+	CreateAttachmentUploadRoute         = "CreateAttachmentUpload"
 	ReceiveMailRoute                    = "ReceiveMail"
 	RenderPhaseMapRoute                 = "RenderPhaseMap"
 	ReGameResultRoute                   = "ReGameResult"
+	SendAnnouncementRoute               = "SendAnnouncement"
 	ReScoreRoute                        = "ReScore"
 	ReRateTrueSkillsRoute               = "ReRateTrueSkills"
 	UpdateAllUserStatsRoute             = "UpdateAllUserStats"
 	DeleteTrueSkillsRoute               = "DeleteTrueSkills"
 	GlobalStatsRoute                    = "GlobalStats"
 	RssRoute                            = "Rss"
+	CalendarRoute                       = "Calendar"
+	GetCalendarTokenRoute               = "GetCalendarToken"
+	RotateCalendarTokenRoute            = "RotateCalendarToken"
+	FinishedGamesAtomRoute              = "FinishedGamesAtom"
 	ReSaveRoute                         = "ReSave"
 	AllocateNationsRoute                = "AllocateNations"
 	ReapInactiveWaitingPlayersRoute     = "ReapInactiveWaitingPlayersRoute"
@@ -117,6 +172,11 @@ const (
 	CorroboratePhaseRoute               = "CorroboratePhase"
 	CreateAndCorroborateRoute           = "CreateAndCorroborate"
 	GetUserRatingHistogramRoute         = "GetUserRatingHistogram"
+	GetUserRankRoute                    = "GetUserRank"
+	GetRatingHistoryRoute               = "GetRatingHistory"
+	GetQuicknessRoute                   = "GetQuickness"
+	GetHeadToHeadRoute                  = "GetHeadToHead"
+	GetHateRoute                        = "GetHate"
 	GlobalSystemMessageRoute            = "GlobalSystemMessage"
 	MusterAllRunningGamesRoute          = "MusterAllRunningGames"
 	MusterAllFinishedGamesRoute         = "MusterAllFinishedGame"
@@ -127,12 +187,21 @@ const (
 
 type userStatsHandler struct {
 	query *datastore.Query
-	name  string
-	desc  []string
-	route string
+	order string
+	// variantQuery, if set, lists VariantUserStats sorted by variantOrder when the list is filtered on variant.
+	variantQuery *datastore.Query
+	variantOrder string
+	name         string
+	desc         []string
+	route        string
 }
 
+// handle lists the user stats, letting clients that already have the same list skip downloading it again.
 func (h *userStatsHandler) handle(w ResponseWriter, r Request) error {
+	return etagCached(h.list)(w, r)
+}
+
+func (h *userStatsHandler) list(w ResponseWriter, r Request) error {
 	ctx := appengine.NewContext(r.Req())
 
 	_, ok := r.Values()["user"].(*auth.User)
@@ -140,15 +209,32 @@ func (h *userStatsHandler) handle(w ResponseWriter, r Request) error {
 		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
 	}
 
-	limit, err := strconv.ParseInt(r.Req().URL.Query().Get("limit"), 10, 64)
-	if err != nil || limit > maxLimit {
-		limit = maxLimit
-		err = nil
+	uq := r.Req().URL.Query()
+	max, err := configuredMaxLimit(ctx)
+	if err != nil {
+		return err
 	}
+	limit := capLimit(uq.Get("limit"), max)
 
 	query := h.query
+	order := h.order
+
+	variant := uq.Get("variant")
+	if variant != "" {
+		if h.variantQuery == nil {
+			return HTTPErr{fmt.Sprintf("%v can't be filtered on variant", h.name), http.StatusBadRequest}
+		}
+		query = h.variantQuery.Filter("Variant=", variant)
+		order = h.variantOrder
+	}
+
+	backward := uq.Get("direction") == "backward"
+	if backward {
+		order = reverseOrder(order)
+	}
+	query = query.Order(order)
 
-	cursor := r.Req().URL.Query().Get("cursor")
+	cursor := uq.Get("cursor")
 	if cursor != "" {
 		decoded, err := datastore.DecodeCursor(cursor)
 		if err != nil {
@@ -159,33 +245,195 @@ func (h *userStatsHandler) handle(w ResponseWriter, r Request) error {
 
 	iter := query.Run(ctx)
 
+	// reverseCursor is right after the first stat, and lists the adjacent page when used in the opposite direction.
+	reverseCursor := ""
+	next := func(dst interface{}) error {
+		if _, err := iter.Next(dst); err != nil {
+			return err
+		}
+		if reverseCursor == "" {
+			curs, err := iter.Cursor()
+			if err != nil {
+				return err
+			}
+			reverseCursor = curs.String()
+		}
+		return nil
+	}
+
 	stats := UserStatsSlice{}
-	for err == nil && len(stats) < int(limit) {
-		stat := &UserStats{}
-		_, err = iter.Next(stat)
-		if err == nil {
-			stats = append(stats, *stat)
+	if variant == "" {
+		for err == nil && len(stats) < int(limit) {
+			stat := &UserStats{}
+			err = next(stat)
+			if err == nil {
+				stats = append(stats, *stat)
+			}
+		}
+	} else {
+		variantStats := []VariantUserStats{}
+		for err == nil && len(variantStats) < int(limit) {
+			variantStat := &VariantUserStats{}
+			err = next(variantStat)
+			if err == nil {
+				variantStats = append(variantStats, *variantStat)
+			}
 		}
+		stats, err = variantUserStatsSlice(ctx, variantStats, err)
+	}
+	if err != nil && err != datastore.Done {
+		return err
 	}
 
 	for i := range stats {
 		stats[i].Redact()
 	}
 
-	var cursP *datastore.Cursor
+	cursors := pageCursors{}
 	if err == nil {
+		// The cursor must be taken before peeking, so that the next page starts with the peeked stat.
 		curs, err := iter.Cursor()
 		if err != nil {
 			return err
 		}
-		cursP = &curs
+		var peeked interface{} = &UserStats{}
+		if variant != "" {
+			peeked = &VariantUserStats{}
+		}
+		if _, err := iter.Next(peeked); err == nil {
+			cursors.next = curs.String()
+			cursors.hasNext = true
+		} else if err != datastore.Done {
+			return err
+		}
+	}
+	if cursor != "" {
+		cursors.prev = reverseCursor
+		cursors.hasPrev = true
+	}
+	if backward {
+		cursors = cursors.reversed()
+		for i, j := 0, len(stats)-1; i < j; i, j = i+1, j-1 {
+			stats[i], stats[j] = stats[j], stats[i]
+		}
 	}
 
-	w.SetContent(stats.Item(r, cursP, limit, h.name, h.desc, h.route))
+	w.SetContent(annotatedItem{
+		Item:        stats.Item(r, cursors, limit, h.name, h.desc, h.route),
+		Annotations: cursors.annotations(int(limit)),
+	})
 
 	return nil
 }
 
+// reverseOrder returns the datastore sort order opposite to order.
+func reverseOrder(order string) string {
+	if strings.HasPrefix(order, "-") {
+		return strings.TrimPrefix(order, "-")
+	}
+	return "-" + order
+}
+
+/*
+ * pageCursors are the cursors to the pages before and after a page of a list.
+ * The next cursor is used going forward, and the prev cursor with `direction=backward`.
+ * An empty cursor of an existing page lists the page at the far end of the list in that direction.
+ */
+type pageCursors struct {
+	next    string
+	hasNext bool
+	prev    string
+	hasPrev bool
+}
+
+func (p pageCursors) reversed() pageCursors {
+	return pageCursors{
+		next:    p.prev,
+		hasNext: p.hasPrev,
+		prev:    p.next,
+		hasPrev: p.hasNext,
+	}
+}
+
+// addLinks adds 'next' and 'prev' links to item, keeping the other query parameters of the request.
+func (p pageCursors) addLinks(r Request, item *Item, route string, routeParams []string, limit int) {
+	addLink := func(rel string, cursor string, backward bool) {
+		params := url.Values{}
+		for k, v := range r.Req().URL.Query() {
+			params[k] = v
+		}
+		params.Del("cursor")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		params.Del("direction")
+		if backward {
+			params.Set("direction", "backward")
+		}
+		params.Set("limit", fmt.Sprint(limit))
+		item.AddLink(r.NewLink(Link{
+			Rel:         rel,
+			Route:       route,
+			RouteParams: routeParams,
+			QueryParams: params,
+		}))
+	}
+	if p.hasNext {
+		addLink("next", p.next, false)
+	}
+	if p.hasPrev {
+		addLink("prev", p.prev, true)
+	}
+}
+
+// annotations returns the pagination metadata added to list responses next to the links.
+func (p pageCursors) annotations(limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"HasMore": p.hasNext,
+		"Limit":   limit,
+	}
+}
+
+/*
+ * variantUserStatsSlice loads the UserStats for the variant stats, replacing their TrueSkill
+ * with the one for the variant.
+ * iterErr is the error from iterating the variant stats, and is returned unless loading fails.
+ */
+func variantUserStatsSlice(ctx context.Context, variantStats []VariantUserStats, iterErr error) (UserStatsSlice, error) {
+	stats := make(UserStatsSlice, len(variantStats))
+	if len(variantStats) == 0 {
+		return stats, iterErr
+	}
+	ids := make([]*datastore.Key, len(variantStats))
+	for i := range variantStats {
+		ids[i] = UserStatsID(ctx, variantStats[i].UserId)
+	}
+	if err := datastore.GetMulti(ctx, ids, stats); err != nil {
+		merr, ok := err.(appengine.MultiError)
+		if !ok {
+			return nil, err
+		}
+		for _, serr := range merr {
+			if serr != nil && serr != datastore.ErrNoSuchEntity {
+				return nil, err
+			}
+		}
+	}
+	for i := range variantStats {
+		stats[i].UserId = variantStats[i].UserId
+		stats[i].TrueSkill = TrueSkill{
+			TrueSkillContent: TrueSkillContent{
+				UserId:  variantStats[i].UserId,
+				Variant: variantStats[i].Variant,
+				Mu:      variantStats[i].Mu,
+				Sigma:   variantStats[i].Sigma,
+				Rating:  variantStats[i].Rating,
+			},
+		}
+	}
+	return stats, iterErr
+}
+
 type handlerScope int
 
 const (
@@ -204,23 +452,47 @@ const (
 
 type gamesHandler struct {
 	query       *datastore.Query
+	order       string
 	name        string
 	desc        []string
 	route       string
 	scope       handlerScope
 	joinability handlerJoinability
+	// userFilter, if set, removes games not matching the viewing user.
+	userFilter func(g *Game, user *auth.User) bool
+	// sortable handlers allow reversing order using the sort query parameter.
+	sortable bool
+	// search handlers only list games with descriptions containing all words in the q query parameter.
+	search bool
+	// hideBanned handlers remove games with members the viewer has bans with.
+	hideBanned bool
+	// withResults handlers include the GameResult of each game.
+	withResults bool
+	// withUserHistory handlers include the nation and outcome of the user_id user in each game.
+	withUserHistory bool
+	// privateFromOthers handlers only list unfinished private games to the user_id user and superusers.
+	privateFromOthers bool
 }
 
 type gamesReq struct {
-	ctx                context.Context
-	w                  ResponseWriter
-	r                  Request
-	user               *auth.User
-	userStats          *UserStats
-	iter               *datastore.Iterator
-	limit              int
+	ctx       context.Context
+	w         ResponseWriter
+	r         Request
+	user      *auth.User
+	userStats *UserStats
+	iter      gameIterator
+	limit     int
+	// totalCount, if set, is the number of games matching the datastore filters of the request.
+	totalCount *int
+	// cursorPrefix is prepended to returned cursors, to avoid replaying them against a query with different order.
+	cursorPrefix string
+	// hadCursor is true if the request continued from a cursor, so that there is a page in the opposite direction.
+	hadCursor bool
+	// backward is true if the request lists the page before the cursor, using the reverse order.
+	backward           bool
 	h                  *gamesHandler
 	detailFilters      []func(g *Game) bool
+	minMemberRating    *float64
 	viewerStatsFilter  bool
 	viewerBanFilter    bool
 	viewerFilterRemove bool
@@ -237,17 +509,8 @@ func (req *gamesReq) handle() error {
 	for err == nil && len(games) < req.limit {
 		var nextBatch Games
 		nextBatch, err = req.h.fetch(req.iter, req.limit-len(games))
-		// Remove those not matching programmatic filters.
-		nextBatch.RemoveCustomFiltered(req.detailFilters)
-		// Mark failed requirements for games if required.
-		if req.viewerStatsFilter {
-			nextBatch.RemoveFiltered(toJoin, req.userStats, req.viewerFilterRemove)
-		}
-		// Mark bans for games if required, and remove them if required.
-		if req.viewerBanFilter {
-			if _, filtErr := nextBatch.RemoveBanned(req.ctx, req.user.Id, req.viewerFilterRemove); filtErr != nil {
-				return filtErr
-			}
+		if filtErr := req.filter(&nextBatch); filtErr != nil {
+			return filtErr
 		}
 		games = append(games, nextBatch...)
 	}
@@ -255,27 +518,212 @@ func (req *gamesReq) handle() error {
 		return err
 	}
 
-	curs, err := req.cursor(err)
-	if err != nil {
-		return err
+	// The cursor must be taken before peeking, so that the next page starts with the peeked game.
+	curs, cursErr := req.cursor(err)
+	if cursErr != nil {
+		return cursErr
+	}
+	hasMore := false
+	if err == nil {
+		if hasMore, err = req.peek(); err != nil {
+			return err
+		}
 	}
 
-	req.w.SetContent(games.Item(req.r, req.user, curs, req.limit, req.h.name, req.h.desc, req.h.route))
+	cursors := pageCursors{
+		next:    curs,
+		hasNext: hasMore && curs != "",
+	}
+	if req.hadCursor {
+		reverseCurs, err := req.iter.ReverseCursor()
+		if err != nil {
+			return err
+		}
+		if reverseCurs != "" {
+			reverseCurs = req.cursorPrefix + reverseCurs
+		}
+		cursors.prev = reverseCurs
+		cursors.hasPrev = true
+	}
+	if req.backward {
+		cursors = cursors.reversed()
+		for i, j := 0, len(games)-1; i < j; i, j = i+1, j-1 {
+			games[i], games[j] = games[j], games[i]
+		}
+	}
+
+	if req.h.withResults {
+		if err := games.LoadResults(req.ctx); err != nil {
+			return err
+		}
+	}
+	if req.h.withUserHistory {
+		superuser, err := isSuperuser(req.ctx, req.user.Id)
+		if err != nil {
+			return err
+		}
+		for i := range games {
+			games[i].UserHistory = games[i].userHistory(req.r.Vars()["user_id"], req.user, superuser)
+		}
+	}
+
+	item := games.Item(req.r, req.user, cursors, req.limit, req.h.name, req.h.desc, req.h.route)
+	annotations := cursors.annotations(req.limit)
+	if req.totalCount != nil {
+		annotations["TotalCount"] = *req.totalCount
+	}
+	req.w.SetContent(annotatedItem{Item: item, Annotations: annotations})
 	return nil
 }
 
-func (r *gamesReq) cursor(err error) (*datastore.Cursor, error) {
-	if err == nil {
-		curs, err := r.iter.Cursor()
+// filter removes the games of batch not matching the filters of the request, and marks failed requirements and bans.
+func (req *gamesReq) filter(batch *Games) error {
+	// Remove those not matching programmatic filters.
+	batch.RemoveCustomFiltered(req.detailFilters)
+	// Remove started games with members rated too low, if required.
+	if req.minMemberRating != nil {
+		if err := batch.RemoveBelowMemberRating(req.ctx, *req.minMemberRating); err != nil {
+			return err
+		}
+	}
+	// Mark failed requirements for games if required.
+	if req.viewerStatsFilter {
+		batch.RemoveFiltered(toJoin, req.userStats, req.viewerFilterRemove)
+	}
+	// Mark bans for games if required, and remove them if required.
+	if req.viewerBanFilter {
+		if _, err := batch.RemoveBanned(req.ctx, req.user.Id, req.viewerFilterRemove); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peek returns whether the iterator has at least one more game passing the filters of the request.
+func (req *gamesReq) peek() (bool, error) {
+	for {
+		batch, err := req.h.fetch(req.iter, 1)
+		if filtErr := req.filter(&batch); filtErr != nil {
+			return false, filtErr
+		}
+		if len(batch) > 0 {
+			return true, nil
+		}
+		if err == datastore.Done {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+}
+
+/*
+ * count sets totalCount to the sum of the counts of the queries, using memcache
+ * to avoid counting more often than every gamesCountTTL.
+ */
+func (req *gamesReq) count(queries []*datastore.Query, variantFilters []string) error {
+	// Memcache keys are limited to 250 bytes, so use a hash of the signature.
+	key := fmt.Sprintf("gamesCount/%x", sha1.Sum([]byte(req.filterSignature(variantFilters))))
+
+	total := 0
+	if _, err := memcache.JSON.Get(req.ctx, key, &total); err == nil {
+		req.totalCount = &total
+		return nil
+	} else if err != memcache.ErrCacheMiss {
+		log.Warningf(req.ctx, "Unable to load cached games count %q: %v; will count again", key, err)
+	}
+
+	for _, q := range queries {
+		count, err := q.Count(req.ctx)
 		if err != nil {
+			return err
+		}
+		total += count
+	}
+
+	if err := memcache.JSON.Set(req.ctx, &memcache.Item{
+		Key:        key,
+		Object:     total,
+		Expiration: gamesCountTTL,
+	}); err != nil {
+		log.Warningf(req.ctx, "Unable to cache games count %q: %v; will count again next time", key, err)
+	}
+	req.totalCount = &total
+	return nil
+}
+
+// countFilterParams are the query parameters that affect the datastore queries of a gamesHandler.
+var countFilterParams = []string{
+	"q",
+	"nation-allocation",
+	"conference-chat-disabled",
+	"group-chat-disabled",
+	"private-chat-disabled",
+	"only-private",
+	"result",
+}
+
+// filterSignature identifies the datastore queries of a request, for caching counts.
+func (req *gamesReq) filterSignature(variantFilters []string) string {
+	scopeID := ""
+	switch req.h.scope {
+	case scopeMember, scopeGameMaster:
+		scopeID = req.user.Id
+	case scopeOtherIsMember:
+		scopeID = req.r.Vars()["user_id"]
+	}
+	sortedVariants := append([]string{}, variantFilters...)
+	sort.Strings(sortedVariants)
+	signature := url.Values{
+		"handler": []string{req.h.name},
+		"scope":   []string{scopeID},
+		"variant": sortedVariants,
+	}
+	uq := req.r.Req().URL.Query()
+	for _, param := range countFilterParams {
+		if value := uq.Get(param); value != "" {
+			signature.Set(param, value)
+		}
+	}
+	// Encode sorts by key, making the signature stable.
+	return signature.Encode()
+}
+
+// annotatedItem is an Item with extra top level fields, like the total number of matching games, added.
+type annotatedItem struct {
+	*Item
+	Annotations map[string]interface{}
+}
+
+func (a annotatedItem) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(a.Item)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range a.Annotations {
+		if m[k], err = json.Marshal(v); err != nil {
 			return nil, err
 		}
-		return &curs, nil
+	}
+	return json.Marshal(m)
+}
+
+func (r *gamesReq) cursor(err error) (string, error) {
+	if err == nil {
+		curs, err := r.iter.Cursor()
+		if err != nil || curs == "" {
+			return curs, err
+		}
+		return r.cursorPrefix + curs, nil
 	}
 	if err == datastore.Done {
-		return nil, nil
+		return "", nil
 	}
-	return nil, err
+	return "", err
 }
 
 func (req *gamesReq) boolFilter(fieldName, paramName string, q *datastore.Query) *datastore.Query {
@@ -298,15 +746,55 @@ func (req *gamesReq) intervalFilter(ctx context.Context, fieldName, paramName st
 		return nil
 	}
 
+	return rangeFilter(fieldName, parts[0], parts[1])
+}
+
+/*
+ * phaseLengthFilter filters the games on the minPhaseLength and maxPhaseLength parameters.
+ * Datastore only allows inequality filters on the property of the first sort order, so if the
+ * list is sorted on anything else the games are filtered in memory instead. The cursors still
+ * point after the last game looked at, so pages with only filtered out games don't stall paging.
+ */
+func (req *gamesReq) phaseLengthFilter(q *datastore.Query, order string) (*datastore.Query, error) {
+	uq := req.r.Req().URL.Query()
+	bounds := []struct {
+		param  string
+		filter string
+	}{
+		{"minPhaseLength", "PhaseLengthMinutes>="},
+		{"maxPhaseLength", "PhaseLengthMinutes<="},
+	}
+	inDatastore := order == "" || strings.TrimPrefix(order, "-") == "PhaseLengthMinutes"
+	for _, bound := range bounds {
+		param := uq.Get(bound.param)
+		if param == "" {
+			continue
+		}
+		minutes, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return nil, HTTPErr{fmt.Sprintf("unparseable %s %q: %v", bound.param, param, err), http.StatusBadRequest}
+		}
+		if inDatastore {
+			q = q.Filter(bound.filter, minutes)
+		} else if bound.param == "minPhaseLength" {
+			req.detailFilters = append(req.detailFilters, rangeFilter("PhaseLengthMinutes", param, ""))
+		} else {
+			req.detailFilters = append(req.detailFilters, rangeFilter("PhaseLengthMinutes", "", param))
+		}
+	}
+	return q, nil
+}
+
+func rangeFilter(fieldName, minString, maxString string) func(*Game) bool {
 	var min *float64 = nil
 	var max *float64 = nil
 
-	mi, err := strconv.ParseFloat(parts[0], 64)
+	mi, err := strconv.ParseFloat(minString, 64)
 	if err == nil {
 		min = &mi
 	}
 
-	ma, err := strconv.ParseFloat(parts[1], 64)
+	ma, err := strconv.ParseFloat(maxString, 64)
 	if err == nil {
 		max = &ma
 	}
@@ -333,19 +821,24 @@ func (req *gamesReq) intervalFilter(ctx context.Context, fieldName, paramName st
 	}
 }
 
+// handle lists the games, letting clients that already have the same list skip downloading it again.
+func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
+	return etagCached(h.list)(w, r)
+}
+
 /*
  * WARNING: If you add filtering here, you should both add it to the gameListerParams in game.go
  *          and add some testing in diptest/game_test.go/TestGameListFilters and /TestIndexCreation.
  */
-func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
+func (h *gamesHandler) list(w ResponseWriter, r Request) error {
 	req := &gamesReq{
 		ctx:                appengine.NewContext(r.Req()),
 		w:                  w,
 		r:                  r,
 		h:                  h,
 		viewerStatsFilter:  h.joinability == joinabilityOpen,
-		viewerBanFilter:    h.joinability == joinabilityOpen,
-		viewerFilterRemove: h.joinability == joinabilityOpen && h.scope == scopePublic,
+		viewerBanFilter:    h.joinability == joinabilityOpen || h.hideBanned,
+		viewerFilterRemove: (h.joinability == joinabilityOpen && h.scope == scopePublic) || h.hideBanned,
 	}
 
 	user, ok := r.Values()["user"].(*auth.User)
@@ -363,14 +856,31 @@ func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
 	req.userStats = userStats
 
 	uq := r.Req().URL.Query()
-	limit, err := strconv.ParseInt(uq.Get("limit"), 10, 64)
-	if err != nil || limit > maxLimit {
-		limit = maxLimit
-		err = nil
+	max, err := configuredMaxLimit(req.ctx)
+	if err != nil {
+		return err
 	}
-	req.limit = int(limit)
+	req.limit = int(capLimit(uq.Get("limit"), max))
 
 	q := h.query
+	if h.search {
+		tokens := searchTokens(uq.Get("q"))
+		if len(tokens) == 0 {
+			w.SetContent(annotatedItem{
+				Item:        Games{}.Item(r, user, pageCursors{}, req.limit, h.name, h.desc, h.route),
+				Annotations: pageCursors{}.annotations(req.limit),
+			})
+			return nil
+		}
+		if len(tokens) > maxSearchTokens {
+			tokens = tokens[:maxSearchTokens]
+		}
+		for _, token := range tokens {
+			q = q.Filter("SearchTokens=", token)
+		}
+	}
+	// Every scope filter also keeps replays out of the query, since replays are private and have
+	// neither member users nor a game master.
 	switch h.scope {
 	case scopeMember:
 		q = q.Filter("Members.User.Id=", user.Id)
@@ -384,6 +894,24 @@ func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
 		return HTTPErr{fmt.Sprintf("unrecognized scope %v", h.scope), http.StatusInternalServerError}
 	}
 
+	if h.privateFromOthers && r.Vars()["user_id"] != user.Id {
+		superusers, err := auth.GetSuperusers(req.ctx)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if err == datastore.ErrNoSuchEntity || !superusers.Includes(user.Id) {
+			req.detailFilters = append(req.detailFilters, func(g *Game) bool {
+				return g.Finished || !g.Private
+			})
+		}
+	}
+
+	if h.userFilter != nil {
+		req.detailFilters = append(req.detailFilters, func(g *Game) bool {
+			return h.userFilter(g, user)
+		})
+	}
+
 	apiLevel := auth.APILevel(r)
 	req.detailFilters = append(req.detailFilters, func(g *Game) bool {
 		if launchLevel, found := variants.LaunchSchedule[g.Variant]; found {
@@ -391,8 +919,24 @@ func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
 		}
 		return true
 	})
-	if variantFilter := uq.Get("variant"); variantFilter != "" {
-		q = q.Filter("Variant=", variantFilter)
+	variantFilters := []string{}
+	for _, variantFilter := range uq["variant"] {
+		if variantFilter == "" {
+			continue
+		}
+		found := false
+		for _, existing := range variantFilters {
+			if existing == variantFilter {
+				found = true
+				break
+			}
+		}
+		if !found {
+			variantFilters = append(variantFilters, variantFilter)
+		}
+	}
+	if len(variantFilters) > maxVariantFilters {
+		return HTTPErr{fmt.Sprintf("can't filter on more than %d variants", maxVariantFilters), http.StatusBadRequest}
 	}
 	if allocFilter := uq.Get("nation-allocation"); allocFilter != "" {
 		wantedAlloc, err := strconv.Atoi(allocFilter)
@@ -404,6 +948,16 @@ func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
 	q = req.boolFilter("DisableGroupChat", "group-chat-disabled", q)
 	q = req.boolFilter("DisablePrivateChat", "private-chat-disabled", q)
 	q = req.boolFilter("Private", "only-private", q)
+	if resultFilter := uq.Get("result"); resultFilter != "" {
+		found := false
+		for _, resultType := range gameResultTypes {
+			found = found || resultType == resultFilter
+		}
+		if !found {
+			return HTTPErr{fmt.Sprintf("result must be one of %v", strings.Join(gameResultTypes, ", ")), http.StatusBadRequest}
+		}
+		q = q.Filter("ResultType=", resultFilter)
+	}
 	if f := req.intervalFilter(req.ctx, "PhaseLengthMinutes", "phase-length-minutes"); f != nil {
 		req.detailFilters = append(req.detailFilters, f)
 	}
@@ -428,10 +982,84 @@ func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
 	if f := req.intervalFilter(req.ctx, "MaxRating", "max-rating"); f != nil {
 		req.detailFilters = append(req.detailFilters, f)
 	}
+	if minMemberRatingFilter := uq.Get("min-member-rating"); minMemberRatingFilter != "" {
+		minMemberRating, err := strconv.ParseFloat(minMemberRatingFilter, 64)
+		if err != nil {
+			return HTTPErr{fmt.Sprintf("unparseable min-member-rating %q: %v", minMemberRatingFilter, err), http.StatusBadRequest}
+		}
+		req.minMemberRating = &minMemberRating
+	}
 
 	cursor := uq.Get("cursor")
+
+	order := h.order
+	if q, err = req.phaseLengthFilter(q, order); err != nil {
+		return err
+	}
+	if h.sortable {
+		sort := uq.Get("sort")
+		if sort != "asc" {
+			sort = "desc"
+		}
+		req.cursorPrefix = sort + ":"
+		if cursor != "" {
+			if !strings.HasPrefix(cursor, req.cursorPrefix) {
+				return HTTPErr{fmt.Sprintf("cursor doesn't match sort order %q", sort), http.StatusBadRequest}
+			}
+			cursor = strings.TrimPrefix(cursor, req.cursorPrefix)
+		}
+		if strings.HasPrefix(order, "-") != (sort == "desc") {
+			order = reverseOrder(order)
+		}
+	}
+
+	req.hadCursor = cursor != ""
+	if uq.Get("direction") == "backward" {
+		if order == "" {
+			return HTTPErr{fmt.Sprintf("%v isn't sorted, and can't be listed backward", h.name), http.StatusBadRequest}
+		}
+		req.backward = true
+		order = reverseOrder(order)
+	}
+
+	wantCount := (uq.Get("count") == "true" || uq.Get("withCount") == "true") && cursor == ""
+
+	if len(variantFilters) > 1 {
+		queries := map[string]*datastore.Query{}
+		countQueries := []*datastore.Query{}
+		for _, variantFilter := range variantFilters {
+			queries[variantFilter] = q.Filter("Variant=", variantFilter)
+			if order != "" {
+				queries[variantFilter] = queries[variantFilter].Order(order)
+			}
+			countQueries = append(countQueries, queries[variantFilter])
+		}
+		if wantCount {
+			if err := req.count(countQueries, variantFilters); err != nil {
+				return err
+			}
+		}
+		if req.iter, err = newMultiGameIterator(req.ctx, order, queries, cursor); err != nil {
+			return err
+		}
+		return req.handle()
+	}
+
+	if len(variantFilters) == 1 {
+		q = q.Filter("Variant=", variantFilters[0])
+	}
+	if order != "" {
+		q = q.Order(order)
+	}
+
+	if wantCount {
+		if err := req.count([]*datastore.Query{q}, variantFilters); err != nil {
+			return err
+		}
+	}
+
 	if cursor == "" {
-		req.iter = q.Run(req.ctx)
+		req.iter = &singleGameIterator{iter: q.Run(req.ctx)}
 		return req.handle()
 	}
 
@@ -439,13 +1067,14 @@ func (h *gamesHandler) handle(w ResponseWriter, r Request) error {
 	if err != nil {
 		return err
 	}
-	req.iter = q.Start(decoded).Run(req.ctx)
+	req.iter = &singleGameIterator{iter: q.Start(decoded).Run(req.ctx)}
 	return req.handle()
 }
 
-func (h *gamesHandler) fetch(iter *datastore.Iterator, max int) (Games, error) {
+func (h *gamesHandler) fetch(iter gameIterator, max int) (Games, error) {
 	var err error
 	result := make(Games, 0, max)
+	seen := map[string]bool{}
 	for err == nil && len(result) < max {
 		game := Game{}
 		game.ID, err = iter.Next(&game)
@@ -453,13 +1082,239 @@ func (h *gamesHandler) fetch(iter *datastore.Iterator, max int) (Games, error) {
 			game.NewestPhaseMeta[i].Refresh()
 		}
 		game.Refresh()
-		if err == nil {
+		if err == nil && !seen[game.ID.Encode()] {
+			seen[game.ID.Encode()] = true
 			result = append(result, game)
 		}
 	}
 	return result, err
 }
 
+// gameIterator is what gamesReq uses to iterate over the games of a
+// gamesHandler query, and to produce cursors for the next batch and,
+// when used with the reverse order, the previous batch.
+type gameIterator interface {
+	Next(g *Game) (*datastore.Key, error)
+	Cursor() (string, error)
+	// ReverseCursor returns a cursor right after the first game returned,
+	// or an empty cursor if no games were returned.
+	ReverseCursor() (string, error)
+}
+
+type singleGameIterator struct {
+	iter  *datastore.Iterator
+	first string
+}
+
+func (s *singleGameIterator) Next(g *Game) (*datastore.Key, error) {
+	key, err := s.iter.Next(g)
+	if err == nil && s.first == "" {
+		curs, err := s.iter.Cursor()
+		if err != nil {
+			return nil, err
+		}
+		s.first = curs.String()
+	}
+	return key, err
+}
+
+func (s *singleGameIterator) ReverseCursor() (string, error) {
+	return s.first, nil
+}
+
+func (s *singleGameIterator) Cursor() (string, error) {
+	curs, err := s.iter.Cursor()
+	if err != nil {
+		return "", err
+	}
+	return curs.String(), nil
+}
+
+type multiGameIteratorPart struct {
+	iter *datastore.Iterator
+	// cursor points to right before next.
+	cursor string
+	// afterNext points to right after next.
+	afterNext string
+	// first points to right after the first game returned from this part.
+	first string
+	next  *Game
+	done  bool
+}
+
+func (m *multiGameIteratorPart) peek() error {
+	if m.done || m.next != nil {
+		return nil
+	}
+	curs, err := m.iter.Cursor()
+	if err != nil {
+		return err
+	}
+	m.cursor = curs.String()
+	game := &Game{}
+	game.ID, err = m.iter.Next(game)
+	if err == datastore.Done {
+		m.done = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if curs, err = m.iter.Cursor(); err != nil {
+		return err
+	}
+	m.afterNext = curs.String()
+	m.next = game
+	return nil
+}
+
+/*
+ * multiGameIterator merges the results of one query per variant,
+ * keeping the ordering of the gamesHandler, since datastore can't
+ * OR across values of a single field in one query.
+ *
+ * The cursor it produces is a base64 encoded JSON map from variant
+ * to the cursor of the corresponding query, where an empty cursor
+ * means the query is exhausted.
+ */
+type multiGameIterator struct {
+	order string
+	parts map[string]*multiGameIteratorPart
+}
+
+func newMultiGameIterator(ctx context.Context, order string, queries map[string]*datastore.Query, cursor string) (*multiGameIterator, error) {
+	cursors := map[string]string{}
+	if cursor != "" {
+		b, err := base64.URLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, HTTPErr{"unable to decode cursor", http.StatusBadRequest}
+		}
+		if err := json.Unmarshal(b, &cursors); err != nil {
+			return nil, HTTPErr{"unable to decode cursor", http.StatusBadRequest}
+		}
+	}
+	result := &multiGameIterator{
+		order: order,
+		parts: map[string]*multiGameIteratorPart{},
+	}
+	for variant, q := range queries {
+		partCursor, found := cursors[variant]
+		if cursor != "" && found && partCursor == "" {
+			result.parts[variant] = &multiGameIteratorPart{done: true}
+			continue
+		}
+		if partCursor != "" {
+			decoded, err := datastore.DecodeCursor(partCursor)
+			if err != nil {
+				return nil, err
+			}
+			q = q.Start(decoded)
+		}
+		result.parts[variant] = &multiGameIteratorPart{iter: q.Run(ctx)}
+	}
+	return result, nil
+}
+
+// orderValue returns the value of the (possibly nested) time field the games are sorted on.
+// Slices, like NewestPhaseMeta, are represented by their first element.
+func (m *multiGameIterator) orderValue(g *Game) time.Time {
+	val := reflect.ValueOf(g).Elem()
+	for _, field := range strings.Split(strings.TrimPrefix(m.order, "-"), ".") {
+		if val.Kind() == reflect.Slice {
+			if val.Len() == 0 {
+				return time.Time{}
+			}
+			val = val.Index(0)
+		}
+		val = val.FieldByName(field)
+	}
+	return val.Interface().(time.Time)
+}
+
+func (m *multiGameIterator) before(g1, g2 *Game) bool {
+	if m.order == "" {
+		return false
+	}
+	t1 := m.orderValue(g1)
+	t2 := m.orderValue(g2)
+	if strings.HasPrefix(m.order, "-") {
+		return t1.After(t2)
+	}
+	return t1.Before(t2)
+}
+
+func (m *multiGameIterator) Next(g *Game) (*datastore.Key, error) {
+	var best *multiGameIteratorPart
+	for _, part := range m.parts {
+		if err := part.peek(); err != nil {
+			return nil, err
+		}
+		if part.next != nil && (best == nil || m.before(part.next, best.next)) {
+			best = part
+		}
+	}
+	if best == nil {
+		return nil, datastore.Done
+	}
+	*g = *best.next
+	best.next = nil
+	if best.first == "" {
+		best.first = best.afterNext
+	}
+	return g.ID, nil
+}
+
+/*
+ * ReverseCursor leaves out the parts that neither returned games nor have more games,
+ * which makes them start from the far end when used with the reverse order.
+ */
+func (m *multiGameIterator) ReverseCursor() (string, error) {
+	cursors := map[string]string{}
+	for variant, part := range m.parts {
+		if part.first != "" {
+			cursors[variant] = part.first
+			continue
+		}
+		if err := part.peek(); err != nil {
+			return "", err
+		}
+		if part.next != nil {
+			cursors[variant] = part.afterNext
+		}
+	}
+	if len(cursors) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(cursors)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+func (m *multiGameIterator) Cursor() (string, error) {
+	cursors := map[string]string{}
+	allDone := true
+	for variant, part := range m.parts {
+		if err := part.peek(); err != nil {
+			return "", err
+		}
+		if part.done {
+			cursors[variant] = ""
+		} else {
+			cursors[variant] = part.cursor
+			allDone = false
+		}
+	}
+	if allDone {
+		return "", nil
+	}
+	b, err := json.Marshal(cursors)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
 func addGamesHandlerLink(r Request, item *Item, handler *gamesHandler) *Item {
 	return item.AddLink(r.NewLink(Link{
 		Rel:   handler.name,
@@ -469,47 +1324,98 @@ func addGamesHandlerLink(r Request, item *Item, handler *gamesHandler) *Item {
 
 var (
 	finishedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Finished=", true).Order("-FinishedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Finished=", true),
+		order:       "-FinishedAt",
 		name:        "finished-games",
-		desc:        []string{"Finished games", "Public finished games, sorted with newest first."},
+		desc:        []string{"Finished games", "Public finished games, sorted with newest first. Add `sort=asc` to sort with oldest first. Add `result=solo`, `result=draw` or `result=concession` to only list games that ended that way."},
 		route:       ListFinishedGamesRoute,
 		scope:       scopePublic,
 		joinability: joinabilityClosed,
+		sortable:    true,
 	}
 	startedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false).Order("-StartedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false),
+		order:       "-StartedAt",
 		name:        "started-games",
 		desc:        []string{"Started games", "Public started games, sorted with oldest first."},
 		route:       ListStartedGamesRoute,
 		scope:       scopePublic,
 		joinability: joinabilityClosed,
 	}
+	searchGamesHandler = &gamesHandler{
+		query:       datastore.NewQuery(gameKind),
+		name:        "search-games",
+		desc:        []string{"Search games", fmt.Sprintf("Public games with descriptions containing all the words in the `q` query parameter. Punctuation and case are ignored, and only the first %d words are used.", maxSearchTokens)},
+		route:       SearchGamesRoute,
+		scope:       scopePublic,
+		joinability: joinabilityClosed,
+	}
 	openGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Closed=", false).Order("StartETA"),
+		query:       datastore.NewQuery(gameKind).Filter("Closed=", false),
+		order:       "StartETA",
 		name:        "open-games",
 		desc:        []string{"Open games", "Public open games, sorted with those expected to start soonest first."},
 		route:       ListOpenGamesRoute,
 		scope:       scopePublic,
 		joinability: joinabilityOpen,
 	}
+	replaceableGamesHandler = &gamesHandler{
+		query:       datastore.NewQuery(gameKind).Filter("Members.Abandoned=", true).Filter("Finished=", false),
+		order:       "-StartedAt",
+		name:        "replaceable-games",
+		desc:        []string{"Replaceable games", "Public started games where a player resigned, and a replacement can take over their nation. Sorted with newest first."},
+		route:       ListReplaceableGamesRoute,
+		scope:       scopePublic,
+		joinability: joinabilityOpen,
+	}
 	myFinishedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Finished=", true).Order("-FinishedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Finished=", true),
+		order:       "-FinishedAt",
 		name:        "my-finished-games",
-		desc:        []string{"My finished games", "Finished games you are a member of, sorted with newest first."},
+		desc:        []string{"My finished games", "Finished games you are a member of, sorted with newest first. Add `sort=asc` to sort with oldest first."},
 		route:       ListMyFinishedGamesRoute,
 		scope:       scopeMember,
 		joinability: joinabilityClosed,
+		sortable:    true,
 	}
 	myStartedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false).Order("-StartedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false),
+		order:       "-StartedAt",
 		name:        "my-started-games",
 		desc:        []string{"My started games", "Started games you are a member of, sorted with oldest first."},
 		route:       ListMyStartedGamesRoute,
 		scope:       scopeMember,
 		joinability: joinabilityClosed,
 	}
+	myActiveGamesHandler = &gamesHandler{
+		query:       datastore.NewQuery(gameKind).Filter("Finished=", false),
+		order:       "-LastActivityAt",
+		name:        "my-active-games",
+		desc:        []string{"My active games", "Unstarted and started games you are a member of, sorted with the most recently active first. Use the Started field of each game to tell them apart."},
+		route:       ListMyActiveGamesRoute,
+		scope:       scopeMember,
+		joinability: joinabilityClosed,
+	}
+	myNeedsOrdersGamesHandler = &gamesHandler{
+		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false),
+		order:       "NewestPhaseMeta.DeadlineAt",
+		name:        "my-needs-orders-games",
+		desc:        []string{"My games needing orders", "Started games you are a member of where you haven't yet marked your orders ready, sorted with the nearest deadline first. NewestPhaseMeta.NextDeadlineIn is the time left until the deadline."},
+		route:       ListMyNeedsOrdersGamesRoute,
+		scope:       scopeMember,
+		joinability: joinabilityClosed,
+		userFilter: func(g *Game, user *auth.User) bool {
+			member, found := g.GetMemberByUserId(user.Id)
+			if !found {
+				return false
+			}
+			state := member.NewestPhaseState
+			return !state.ReadyToResolve && !state.NoOrders && !state.Eliminated
+		},
+	}
 	myStagingGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Started=", false).Order("StartETA"),
+		query:       datastore.NewQuery(gameKind).Filter("Started=", false),
+		order:       "StartETA",
 		name:        "my-staging-games",
 		desc:        []string{"My staging games", "Unstarted games you are a member of, sorted with those expected to start soonest first."},
 		route:       ListMyStagingGamesRoute,
@@ -517,7 +1423,8 @@ var (
 		joinability: joinabilityClosed,
 	}
 	masteredStagingGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Started=", false).Order("StartETA"),
+		query:       datastore.NewQuery(gameKind).Filter("Started=", false),
+		order:       "StartETA",
 		name:        "mastered-staging-games",
 		desc:        []string{"Mastered staging games", "Unstarted games you are game master of, sorted with those expected to start soonest first."},
 		route:       ListMasteredStagingGamesRoute,
@@ -525,15 +1432,18 @@ var (
 		joinability: joinabilityOpen,
 	}
 	masteredFinishedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Finished=", true).Order("-FinishedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Finished=", true),
+		order:       "-FinishedAt",
 		name:        "mastered-finished-games",
-		desc:        []string{"Mastered finished games", "Finished games you are game master of, sorted with newest first."},
+		desc:        []string{"Mastered finished games", "Finished games you are game master of, sorted with newest first. Add `sort=asc` to sort with oldest first."},
 		route:       ListMasteredFinishedGamesRoute,
 		scope:       scopeGameMaster,
 		joinability: joinabilityClosed,
+		sortable:    true,
 	}
 	masteredStartedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false).Order("-StartedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false),
+		order:       "-StartedAt",
 		name:        "mastered-started-games",
 		desc:        []string{"Mastered started games", "Started games you are game master of, sorted with oldest first."},
 		route:       ListMasteredStartedGamesRoute,
@@ -541,7 +1451,8 @@ var (
 		joinability: joinabilityOpen,
 	}
 	otherMemberStagingGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Started=", false).Order("StartETA"),
+		query:       datastore.NewQuery(gameKind).Filter("Started=", false),
+		order:       "StartETA",
 		name:        "other-member-staging-games",
 		desc:        []string{"Other member staging games", "Unstarted games someone else is a member of, sorted with those expected to start soonest first."},
 		route:       ListOtherStagingGamesRoute,
@@ -549,15 +1460,42 @@ var (
 		joinability: joinabilityOpen,
 	}
 	otherMemberFinishedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Finished=", true).Order("-FinishedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Finished=", true),
+		order:       "-FinishedAt",
 		name:        "other-member-finished-games",
-		desc:        []string{"Other member finished games", "Finished games someone else is a member of, sorted with newest first."},
+		desc:        []string{"Other member finished games", "Finished games someone else is a member of, sorted with newest first. Add `sort=asc` to sort with oldest first."},
 		route:       ListOtherFinishedGamesRoute,
 		scope:       scopeOtherIsMember,
 		joinability: joinabilityClosed,
+		sortable:    true,
+	}
+	userFinishedGamesHandler = &gamesHandler{
+		query:       datastore.NewQuery(gameKind).Filter("Finished=", true),
+		order:       "-FinishedAt",
+		name:        "user-finished-games",
+		desc:        []string{"User finished games", "Finished games someone else is a member of, with their results, sorted with newest first. Games with members you have bans with are not listed."},
+		route:       ListUserFinishedGamesRoute,
+		scope:       scopeOtherIsMember,
+		joinability: joinabilityClosed,
+		hideBanned:  true,
+		withResults: true,
+	}
+	userGamesHandler = &gamesHandler{
+		query:             datastore.NewQuery(gameKind).Filter("Started=", true),
+		order:             "-StartedAt",
+		name:              "user-games",
+		desc:              []string{"User games", "Started and finished games someone is or was a member of, sorted with the most recently started first. Add `sort=asc` to sort with oldest first. Unfinished private games are only listed to the user themselves.", "Each game includes the UserHistory of the user, with their nation and outcome (Playing, Solo, DIAS, Eliminated, Dropped or Survived), and their SCs and score in finished games."},
+		route:             ListUserGamesRoute,
+		scope:             scopeOtherIsMember,
+		joinability:       joinabilityClosed,
+		sortable:          true,
+		withResults:       true,
+		withUserHistory:   true,
+		privateFromOthers: true,
 	}
 	otherMemberStartedGamesHandler = &gamesHandler{
-		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false).Order("-StartedAt"),
+		query:       datastore.NewQuery(gameKind).Filter("Started=", true).Filter("Finished=", false),
+		order:       "-StartedAt",
 		name:        "other-member-started-games",
 		desc:        []string{"Other member started games", "Started games someone else is a member of, sorted with oldest first."},
 		route:       ListOtherStartedGamesRoute,
@@ -565,33 +1503,47 @@ var (
 		joinability: joinabilityOpen,
 	}
 	topRatedPlayersHandler = userStatsHandler{
-		query: datastore.NewQuery(userStatsKind).Order("-TrueSkill.Rating"),
-		name:  "top-rated-players",
-		desc:  []string{"Top rated alayers", "Players sorted by TrueSkill rating"},
-		route: ListTopRatedPlayersRoute,
+		query:        datastore.NewQuery(userStatsKind),
+		order:        "-TrueSkill.Rating",
+		variantQuery: datastore.NewQuery(variantUserStatsKind),
+		variantOrder: "-Rating",
+		name:         "top-rated-players",
+		desc:         []string{"Top rated alayers", "Players sorted by TrueSkill rating. Add `variant=X` to sort players by their rating in games of variant X, which will then replace the TrueSkill of each player."},
+		route:        ListTopRatedPlayersRoute,
 	}
 	topReliablePlayersHandler = userStatsHandler{
-		query: datastore.NewQuery(userStatsKind).Order("-Reliability"),
+		query: datastore.NewQuery(userStatsKind),
+		order: "-Reliability",
 		name:  "top-reliable-players",
 		desc:  []string{"Top reliable players", "Players sorted by Reliability"},
 		route: ListTopReliablePlayersRoute,
 	}
 	topHatedPlayersHandler = userStatsHandler{
-		query: datastore.NewQuery(userStatsKind).Order("-Hated"),
+		query: datastore.NewQuery(userStatsKind),
+		order: "-Hated",
 		name:  "top-hated-players",
 		desc:  []string{"Top hated players", "Players sorted by Hated"},
 		route: ListTopHatedPlayersRoute,
 	}
 	topHaterPlayersHandler = userStatsHandler{
-		query: datastore.NewQuery(userStatsKind).Order("-Hater"),
+		query: datastore.NewQuery(userStatsKind),
+		order: "-Hater",
 		name:  "top-hater-players",
 		desc:  []string{"Top hater players", "Players sorted by Hater"},
 		route: ListTopHaterPlayersRoute,
 	}
+	topNetHatedPlayersHandler = userStatsHandler{
+		query: datastore.NewQuery(userStatsKind),
+		order: "-NetHate",
+		name:  "top-net-hated-players",
+		desc:  []string{"Top net hated players", "Players sorted by NetHate, which is Hated - Hater. Hated and Hater are included in each player for a breakdown."},
+		route: ListTopNetHatedPlayersRoute,
+	}
 	topQuickPlayersHandler = userStatsHandler{
-		query: datastore.NewQuery(userStatsKind).Order("-Quickness"),
+		query: datastore.NewQuery(userStatsKind).Filter("HasResponseSamples=", true),
+		order: "-Quickness",
 		name:  "top-quick-players",
-		desc:  []string{"Top quick players", "Players sorted by Quickness"},
+		desc:  []string{"Top quick players", "Players sorted by Quickness. AverageResponseMinutes and SampleCount of each player show how long they took to declare ready, on average over SampleCount phases not resolved on timeout. Players without samples are not listed."},
 		route: ListTopQuickPlayersRoute,
 	}
 )
@@ -655,10 +1607,18 @@ func createAllocation(w ResponseWriter, r Request) (*Allocation, error) {
 }
 
 type configuration struct {
-	OAuth      *auth.OAuth
-	FCMConf    *FCMConf
-	SendGrid   *auth.SendGrid
-	Superusers *auth.Superusers
+	OAuth       *auth.OAuth
+	FCMConf     *FCMConf
+	WebPush     *WebPushConf
+	RateLimit   *RateLimitConf
+	Attachment  *AttachmentConf
+	ListLimit   *ListLimitConf
+	Reliability *ReliabilityConf
+	SendGrid    *auth.SendGrid
+	Superusers  *auth.Superusers
+	CORS        *CORSConf
+	GamePresets GamePresets
+	APIKeys     auth.APIKeys
 }
 
 func handleConfigure(w ResponseWriter, r Request) error {
@@ -668,29 +1628,249 @@ func handleConfigure(w ResponseWriter, r Request) error {
 	if err := json.NewDecoder(r.Req().Body).Decode(conf); err != nil {
 		return err
 	}
-	if conf.OAuth != nil {
-		if err := auth.SetOAuth(ctx, conf.OAuth); err != nil {
+	// The other sections can only be configured once, but these can be replaced at any time.
+	if conf.GamePresets != nil || conf.APIKeys != nil || conf.CORS != nil || conf.ListLimit != nil ||
+		conf.RateLimit != nil || conf.Attachment != nil || conf.Reliability != nil || conf.WebPush != nil {
+		if err := requireSuperuser(ctx, r, "only superusers can configure GamePresets, APIKeys, CORS, ListLimit, RateLimit, Attachment, Reliability and WebPush"); err != nil {
 			return err
 		}
 	}
+	if conf.OAuth != nil {
+		if err := conf.OAuth.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("OAuth: %v", err), http.StatusBadRequest}
+		}
+	}
 	if conf.FCMConf != nil {
-		if err := SetFCMConf(ctx, conf.FCMConf); err != nil {
-			return err
+		if err := conf.FCMConf.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("FCMConf: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.WebPush != nil {
+		if err := conf.WebPush.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("WebPush: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.RateLimit != nil {
+		if err := conf.RateLimit.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("RateLimit: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.Attachment != nil {
+		if err := conf.Attachment.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("Attachment: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.ListLimit != nil {
+		if err := conf.ListLimit.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("ListLimit: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.Reliability != nil {
+		if err := conf.Reliability.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("Reliability: %v", err), http.StatusBadRequest}
 		}
 	}
 	if conf.SendGrid != nil {
-		if err := auth.SetSendGrid(ctx, conf.SendGrid); err != nil {
-			return err
+		if err := conf.SendGrid.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("SendGrid: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.CORS != nil {
+		if err := conf.CORS.Validate(); err != nil {
+			return HTTPErr{fmt.Sprintf("CORS: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.GamePresets != nil {
+		if err := validateGamePresets(conf.GamePresets); err != nil {
+			return HTTPErr{fmt.Sprintf("GamePresets: %v", err), http.StatusBadRequest}
+		}
+	}
+	if conf.APIKeys != nil {
+		if err := auth.ValidateAPIKeys(conf.APIKeys); err != nil {
+			return HTTPErr{fmt.Sprintf("APIKeys: %v", err), http.StatusBadRequest}
+		}
+	}
+	if r.Req().URL.Query().Get("dryRun") == "true" {
+		return handleConfigureDryRun(ctx, w, r, conf)
+	}
+	// All sections but the API keys are stored in the same transaction, so that a failure leaves nothing half configured.
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		if conf.GamePresets != nil {
+			if err := SetGamePresets(ctx, conf.GamePresets); err != nil {
+				return configurationErr("GamePresets", err)
+			}
+		}
+		if conf.OAuth != nil {
+			if err := auth.SetOAuth(ctx, conf.OAuth); err != nil {
+				return configurationErr("OAuth", err)
+			}
+		}
+		if conf.FCMConf != nil {
+			if err := SetFCMConf(ctx, conf.FCMConf); err != nil {
+				return configurationErr("FCMConf", err)
+			}
+		}
+		if conf.WebPush != nil {
+			if err := SetWebPush(ctx, conf.WebPush); err != nil {
+				return configurationErr("WebPush", err)
+			}
+		}
+		if conf.RateLimit != nil {
+			if err := SetRateLimit(ctx, conf.RateLimit); err != nil {
+				return configurationErr("RateLimit", err)
+			}
+		}
+		if conf.Attachment != nil {
+			if err := SetAttachment(ctx, conf.Attachment); err != nil {
+				return configurationErr("Attachment", err)
+			}
+		}
+		if conf.ListLimit != nil {
+			if err := SetListLimit(ctx, conf.ListLimit); err != nil {
+				return configurationErr("ListLimit", err)
+			}
+		}
+		if conf.Reliability != nil {
+			if err := SetReliability(ctx, conf.Reliability); err != nil {
+				return configurationErr("Reliability", err)
+			}
+		}
+		if conf.SendGrid != nil {
+			if err := auth.SetSendGrid(ctx, conf.SendGrid); err != nil {
+				return configurationErr("SendGrid", err)
+			}
+		}
+		if conf.Superusers != nil {
+			if err := auth.SetSuperusers(ctx, conf.Superusers); err != nil {
+				return configurationErr("Superusers", err)
+			}
+		}
+		if conf.CORS != nil {
+			if err := SetCORS(ctx, conf.CORS); err != nil {
+				return configurationErr("CORS", err)
+			}
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
+		return err
+	}
+	// Each key is its own entity group, so storing them in the transaction would limit how many can be configured at once.
+	// Since keys can be replaced, a failure here can be fixed by configuring them again.
+	if conf.APIKeys != nil {
+		if err := auth.SetAPIKeys(ctx, conf.APIKeys); err != nil {
+			return configurationErr("APIKeys", err)
+		}
+	}
+	return nil
+}
+
+// handleConfigureDryRun responds with what storing the already validated configuration would change, without storing it.
+func handleConfigureDryRun(ctx context.Context, w ResponseWriter, r Request, conf *configuration) error {
+	summary := map[string]string{}
+	if conf.OAuth != nil {
+		_, err := auth.GetOAuth(ctx)
+		if summary["OAuth"], err = configurationChange(err); err != nil {
+			return configurationErr("OAuth", err)
+		}
+	}
+	if conf.FCMConf != nil {
+		_, err := getFCMConf(ctx)
+		if summary["FCMConf"], err = configurationChange(err); err != nil {
+			return configurationErr("FCMConf", err)
+		}
+	}
+	if conf.WebPush != nil {
+		_, err := getWebPushConf(ctx)
+		if summary["WebPush"], err = replaceableConfigurationChange(err); err != nil {
+			return configurationErr("WebPush", err)
+		}
+	}
+	if conf.RateLimit != nil {
+		_, err := getRateLimitConf(ctx)
+		if summary["RateLimit"], err = replaceableConfigurationChange(err); err != nil {
+			return configurationErr("RateLimit", err)
+		}
+	}
+	if conf.Attachment != nil {
+		_, err := getAttachmentConf(ctx)
+		if summary["Attachment"], err = replaceableConfigurationChange(err); err != nil {
+			return configurationErr("Attachment", err)
+		}
+	}
+	if conf.ListLimit != nil {
+		_, err := getListLimitConf(ctx)
+		if summary["ListLimit"], err = replaceableConfigurationChange(err); err != nil {
+			return configurationErr("ListLimit", err)
+		}
+	}
+	if conf.Reliability != nil {
+		_, err := getReliabilityConf(ctx)
+		if summary["Reliability"], err = replaceableConfigurationChange(err); err != nil {
+			return configurationErr("Reliability", err)
+		}
+	}
+	if conf.SendGrid != nil {
+		_, err := auth.GetSendGrid(ctx)
+		if summary["SendGrid"], err = configurationChange(err); err != nil {
+			return configurationErr("SendGrid", err)
 		}
 	}
 	if conf.Superusers != nil {
-		if err := auth.SetSuperusers(ctx, conf.Superusers); err != nil {
-			return err
+		_, err := auth.GetSuperusers(ctx)
+		if summary["Superusers"], err = configurationChange(err); err != nil {
+			return configurationErr("Superusers", err)
+		}
+	}
+	if conf.CORS != nil {
+		_, err := getCORSConf(ctx)
+		if summary["CORS"], err = replaceableConfigurationChange(err); err != nil {
+			return configurationErr("CORS", err)
 		}
 	}
+	if conf.GamePresets != nil {
+		var err error
+		if summary["GamePresets"], err = gamePresetsChange(ctx, conf.GamePresets); err != nil {
+			return configurationErr("GamePresets", err)
+		}
+	}
+	if conf.APIKeys != nil {
+		var err error
+		if summary["APIKeys"], err = auth.APIKeysChange(ctx, conf.APIKeys); err != nil {
+			return configurationErr("APIKeys", err)
+		}
+	}
+	w.SetContent(NewItem(summary).SetName("configuration-dry-run"))
 	return nil
 }
 
+// configurationChange describes what storing a section would do, given the error from loading the current one.
+func configurationChange(loadErr error) (string, error) {
+	if loadErr == nil {
+		return "already configured, would fail", nil
+	} else if loadErr == datastore.ErrNoSuchEntity {
+		return "would be configured", nil
+	}
+	return "", loadErr
+}
+
+// replaceableConfigurationChange describes what storing a section that can be replaced would do, given the error from loading the current one.
+func replaceableConfigurationChange(loadErr error) (string, error) {
+	if loadErr == nil {
+		return "would be replaced", nil
+	} else if loadErr == datastore.ErrNoSuchEntity {
+		return "would be configured", nil
+	}
+	return "", loadErr
+}
+
+// configurationErr names the configuration section that failed to be stored.
+func configurationErr(section string, err error) error {
+	if herr, ok := err.(HTTPErr); ok {
+		return HTTPErr{fmt.Sprintf("%s: %s", section, herr.Body), herr.Status}
+	}
+	return fmt.Errorf("%s: %v", section, err)
+}
+
 func reGameResult(ctx context.Context, withRepair bool, counter int, valid int, invalid int, cursorString string) error {
 	log.Infof(ctx, "reGameResult(..., %v, %v, %v, %v, %q)", withRepair, counter, valid, invalid, cursorString)
 
@@ -1918,6 +3098,16 @@ func ejectMember(ctx context.Context, gameID *datastore.Key, userId string) erro
 
 func SetupRouter(r *mux.Router) {
 	router = r
+	// Dashboards with API keys can only list public games and leaderboards.
+	auth.AllowAPIKeyRoutes(
+		ListOpenGamesRoute,
+		ListTopRatedPlayersRoute,
+		ListTopReliablePlayersRoute,
+		ListTopHatedPlayersRoute,
+		ListTopHaterPlayersRoute,
+		ListTopNetHatedPlayersRoute,
+		ListTopQuickPlayersRoute,
+	)
 	Handle(r, "/_reap-inactive-waiting-players", []string{"GET"}, ReapInactiveWaitingPlayersRoute, handleReapInactiveWaitingPlayers)
 	Handle(r, "/_test_reap-inactive-waiting-players", []string{"GET"}, TestReapInactiveWaitingPlayersRoute, handleTestReapInactiveWaitingPlayers)
 	Handle(r, "/_re-save", []string{"GET"}, ReSaveRoute, handleReSave)
@@ -1938,14 +3128,26 @@ func SetupRouter(r *mux.Router) {
 	Handle(r, "/_remove-zipped-options", []string{"GET"}, RemoveZippedOptionsRoute, handleRemoveZippedOptions)
 	Handle(r, "/_remove-dias-from-solo-games", []string{"GET"}, RemoveDIASFromSoloGamesRoute, handleRemoveDIASFromSoloGames)
 	Handle(r, "/_global-system-message", []string{"POST"}, GlobalSystemMessageRoute, handleGlobalSystemMessage)
+	Handle(r, "/_send-announcement", []string{"POST"}, SendAnnouncementRoute, handleSendAnnouncement)
 	Handle(r, "/Game/{game_id}/Channel/{recipients}/_system-message", []string{"POST"}, SendSystemMessageRoute, handleSendSystemMessage)
 	Handle(r, "/_re-compute-all-dias-users", []string{"GET"}, ReComputeAllDIASUsersRoute, handleReComputeAllDIASUsers)
 	Handle(r, "/_ah/mail/{recipient}", []string{"POST"}, ReceiveMailRoute, receiveMail)
 	Handle(r, "/", []string{"GET"}, IndexRoute, handleIndex)
 	Handle(r, "/Game/{game_id}/GameResults/TrueSkills", []string{"GET"}, ListGameResultTrueSkillsRoute, listGameResultTrueSkills)
-	Handle(r, "/Game/{game_id}/Channels", []string{"GET"}, ListChannelsRoute, listChannels)
+	Handle(r, "/Game/{game_id}/Channels", []string{"GET"}, ListChannelsRoute, etagCached(listChannels))
+	Handle(r, "/Game/{game_id}/Channel/{channel_members}/Messages/Search", []string{"GET"}, SearchMessagesRoute, searchMessages)
+	Handle(r, "/Game/{game_id}/Channel/{channel_members}/SeenMarker", []string{"PUT"}, UpdateSeenMarkerRoute, updateSeenMarker)
+	Handle(r, "/Game/{game_id}/Channel/{channel_members}/AttachmentUpload", []string{"POST"}, CreateAttachmentUploadRoute, createAttachmentUpload)
+	Handle(r, "/Game/{game_id}/Export", []string{"GET"}, ExportGameRoute, exportGame)
+	Handle(r, "/_import-game", []string{"POST"}, ImportGameRoute, importGame)
+	Handle(r, "/Game/{game_id}/Transcript", []string{"GET"}, ExportTranscriptRoute, exportTranscript)
+	Handle(r, "/Game/{game_id}/Member/{user_id}/Kick", []string{"POST"}, KickMemberRoute, kickMember)
+	Handle(r, "/Game/{game_id}/Pause", []string{"POST"}, PauseGameRoute, pauseGame)
+	Handle(r, "/Game/{game_id}/Resume", []string{"POST"}, ResumeGameRoute, resumeGame)
+	Handle(r, "/Game/{game_id}/Resign", []string{"POST"}, ResignGameRoute, resignGame)
 	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/_dev_resolve_timeout", []string{"GET"}, DevResolvePhaseTimeoutRoute, devResolvePhaseTimeout)
 	Handle(r, "/User/{user_id}/Stats/_dev_update", []string{"PUT"}, DevUserStatsUpdateRoute, devUserStatsUpdate)
+	Handle(r, "/Game/{game_id}/_dev_force_muster", []string{"GET"}, DevForceMusterRoute, devForceMuster)
 	// TODO(zond): Remove this when the Android client no longer uses the old API.
 	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/PhaseState/{nation}", []string{"PUT"}, "deprecatedUpdatePhaseState",
 		func(w ResponseWriter, r Request) error {
@@ -1957,12 +3159,36 @@ func SetupRouter(r *mux.Router) {
 			return nil
 		})
 	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/Options", []string{"GET"}, ListOptionsRoute, listOptions)
+	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/OptionsDiff", []string{"GET"}, GetOptionsDiffRoute, getOptionsDiff)
 	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/Map", []string{"GET"}, RenderPhaseMapRoute, renderPhaseMap)
 	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/Corroborate", []string{"GET"}, CorroboratePhaseRoute, corroboratePhase)
 	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/CreateAndCorroborate", []string{"POST"}, CreateAndCorroborateRoute, createAndCorroborate)
+	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/_dryrun", []string{"POST"}, DryRunPhaseRoute, dryRunPhase)
+	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/Orders", []string{"PUT"}, ReplaceOrdersRoute, replaceOrders)
+	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/ValidateOrders", []string{"POST"}, ValidateOrdersRoute, validateOrdersHandler)
+	Handle(r, "/Game/{game_id}/Phase/{phase_ordinal}/OrderRevisions", []string{"GET"}, ListOrderRevisionsRoute, listOrderRevisions)
 	Handle(r, "/GlobalStats", []string{"GET"}, GlobalStatsRoute, handleGlobalStats)
+	Handle(r, "/GamePresets", []string{"GET"}, ListGamePresetsRoute, listGamePresets)
 	Handle(r, "/Rss", []string{"GET"}, RssRoute, handleRss)
+	Handle(r, "/Calendar/{user_id}.ics", []string{"GET"}, CalendarRoute, handleCalendar)
+	Handle(r, "/User/{user_id}/CalendarToken", []string{"GET"}, GetCalendarTokenRoute, getCalendarToken)
+	Handle(r, "/User/{user_id}/CalendarToken", []string{"POST"}, RotateCalendarTokenRoute, rotateCalendarToken)
+	Handle(r, "/Games/Finished.atom", []string{"GET"}, FinishedGamesAtomRoute, handleFinishedGamesAtom)
 	Handle(r, "/Users/Ratings/Histogram", []string{"GET"}, GetUserRatingHistogramRoute, getUserRatingHistogram)
+	Handle(r, "/Users/{user_id}/Rank/{stat}", []string{"GET"}, GetUserRankRoute, getUserRank)
+	Handle(r, "/User/{user_id}/RatingHistory", []string{"GET"}, GetRatingHistoryRoute, getRatingHistory)
+	Handle(r, "/User/{user_id}/Quickness", []string{"GET"}, GetQuicknessRoute, getQuickness)
+	Handle(r, "/User/{user_id}/Vs/{other_user_id}", []string{"GET"}, GetHeadToHeadRoute, getHeadToHead)
+	Handle(r, "/User/{user_id}/Hate", []string{"GET"}, GetHateRoute, getHate)
+	Handle(r, "/Game/{game_id}/Spectate", []string{"POST"}, SpectateGameRoute, spectateGame)
+	Handle(r, "/Game/{game_id}/Spectate", []string{"DELETE"}, StopSpectatingGameRoute, stopSpectatingGame)
+	Handle(r, "/Game/{game_id}/DrawVote", []string{"POST"}, DrawVoteRoute, voteDraw)
+	Handle(r, "/Game/{game_id}/DrawVote", []string{"DELETE"}, WithdrawDrawVoteRoute, withdrawDrawVote)
+	Handle(r, "/Game/{game_id}/ConcessionVote", []string{"POST"}, ConcessionVoteRoute, voteConcession)
+	Handle(r, "/Game/{game_id}/ConcessionVote", []string{"DELETE"}, WithdrawConcessionVoteRoute, withdrawConcessionVote)
+	Handle(r, "/Game/{game_id}/PhaseWebhook", []string{"GET"}, PhaseWebhookRoute, loadPhaseWebhook)
+	Handle(r, "/Game/{game_id}/PhaseWebhook", []string{"PUT"}, UpdatePhaseWebhookRoute, updatePhaseWebhook)
+	Handle(r, "/Game/{game_id}/PhaseWebhook", []string{"DELETE"}, DeletePhaseWebhookRoute, deletePhaseWebhook)
 	HandleResource(r, ForumMailResource)
 	HandleResource(r, GameResource)
 	HandleResource(r, AllocationResource)
@@ -1971,11 +3197,18 @@ func SetupRouter(r *mux.Router) {
 	HandleResource(r, MemberResource)
 	HandleResource(r, PhaseResource)
 	HandleResource(r, OrderResource)
+	HandleResource(r, FeedbackResource)
 	HandleResource(r, MessageResource)
 	HandleResource(r, PhaseStateResource)
 	HandleResource(r, GameStateResource)
+	Handle(r, "/Game/{game_id}/GameState/{nation}/_unmute_all", []string{"POST"}, UnmuteAllGameStateRoute, unmuteAllGameState)
+	Handle(r, "/Game/{game_id}/GameState/{nation}/Mute", []string{"POST"}, MuteGameStateRoute, muteGameState)
+	Handle(r, "/Game/{game_id}/GameState/{nation}/Unmute", []string{"POST"}, UnmuteGameStateRoute, unmuteGameState)
+	Handle(r, "/Game/{game_id}/GameState/{nation}/NotificationSettings", []string{"PUT"}, UpdateNotificationSettingsRoute, updateNotificationSettings)
+	Handle(r, "/Game/{game_id}/_mute-audit", []string{"GET"}, MuteAuditRoute, loadMuteAudit)
 	HandleResource(r, GameResultResource)
 	HandleResource(r, BanResource)
+	Handle(r, "/User/{user_id}/Ban/{banned_id}/Lift", []string{"POST"}, LiftBanRoute, liftBan)
 	HandleResource(r, PhaseResultResource)
 	HandleResource(r, UserStatsResource)
 	HandleResource(r, MessageFlagResource)
@@ -0,0 +1,47 @@
+package game
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSetupRouter(t *testing.T) {
+	// goaeoas panics when setting up routes for handlers or resources with the wrong signatures.
+	SetupRouter(mux.NewRouter())
+}
+
+func TestPhaseLengthFilter(t *testing.T) {
+	newReq := func(query string) *gamesReq {
+		return &gamesReq{r: &testRequest{req: httptest.NewRequest("GET", "/Games/Open?"+query, nil)}}
+	}
+
+	// Lists sorted on something else than the phase length are filtered in memory.
+	req := newReq("minPhaseLength=60&maxPhaseLength=120")
+	if _, err := req.phaseLengthFilter(nil, "-CreatedAt"); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.detailFilters) != 2 {
+		t.Fatalf("Got %v filters, wanted 2", len(req.detailFilters))
+	}
+	for _, tc := range []struct {
+		minutes time.Duration
+		want    bool
+	}{
+		{59, false},
+		{60, true},
+		{120, true},
+		{121, false},
+	} {
+		game := &Game{PhaseLengthMinutes: tc.minutes}
+		if got := req.detailFilters[0](game) && req.detailFilters[1](game); got != tc.want {
+			t.Errorf("Got %v for %v minutes, wanted %v", got, tc.minutes, tc.want)
+		}
+	}
+
+	if _, err := newReq("maxPhaseLength=soon").phaseLengthFilter(nil, "-CreatedAt"); err == nil {
+		t.Errorf("Got no error for an unparseable maxPhaseLength, wanted one")
+	}
+}
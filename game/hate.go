@@ -0,0 +1,107 @@
+package game
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+// HateRelation is a ban between the user of a HateBreakdown and another user.
+type HateRelation struct {
+	User  auth.User
+	Since time.Time
+	// Mutual is whether both users signed the ban.
+	Mutual bool
+}
+
+// HateBreakdown lists the bans behind the Hated and Hater user stats of a user.
+type HateBreakdown struct {
+	UserId string
+	Hated  float64
+	Hater  float64
+	// HatedBy are the users who signed bans against the user.
+	HatedBy []HateRelation
+	// Hates are the users the user signed bans against.
+	Hates []HateRelation
+}
+
+func (h *HateBreakdown) Item(r Request) *Item {
+	return NewItem(h).SetName("hate").SetDesc([][]string{
+		[]string{
+			"Hate",
+			"The bans behind the Hated and Hater stats of the user. Hated counts the bans other users signed against the user, and Hater counts the bans the user signed, both divided by the number of started games of the user plus one.",
+			"Only the user and superusers can see this.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       GetHateRoute,
+		RouteParams: []string{"user_id", h.UserId},
+	}))
+}
+
+// hateRelations splits the bans containing userId into the ones others signed against userId, and the ones userId signed, oldest first.
+func hateRelations(bans Bans, userId string) (hatedBy []HateRelation, hates []HateRelation) {
+	hatedBy, hates = []HateRelation{}, []HateRelation{}
+	for _, ban := range bans {
+		relation := HateRelation{Since: ban.CreatedAt}
+		for _, user := range ban.Users {
+			if user.Id != userId {
+				relation.User = user
+				relation.User.Email = ""
+			}
+		}
+		signedByUser := ban.OwnedBy(userId)
+		signedByOther := relation.User.Id != "" && ban.OwnedBy(relation.User.Id)
+		relation.Mutual = signedByUser && signedByOther
+		if signedByOther {
+			hatedBy = append(hatedBy, relation)
+		}
+		if signedByUser {
+			hates = append(hates, relation)
+		}
+	}
+	for _, relations := range [][]HateRelation{hatedBy, hates} {
+		sort.SliceStable(relations, func(i, j int) bool {
+			return relations[i].Since.Before(relations[j].Since)
+		})
+	}
+	return hatedBy, hates
+}
+
+func getHate(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	userId := r.Vars()["user_id"]
+	if err := requireSelfOrSuperuser(ctx, user, userId, "can only see your own hate breakdown"); err != nil {
+		return err
+	}
+
+	bans := Bans{}
+	if _, err := datastore.NewQuery(banKind).Filter("UserIds=", userId).GetAll(ctx, &bans); err != nil {
+		return err
+	}
+	userStats := &UserStats{}
+	if err := datastore.Get(ctx, UserStatsID(ctx, userId), userStats); err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+
+	breakdown := &HateBreakdown{
+		UserId: userId,
+		Hated:  userStats.Hated,
+		Hater:  userStats.Hater,
+	}
+	breakdown.HatedBy, breakdown.Hates = hateRelations(bans, userId)
+	w.SetContent(breakdown.Item(r))
+	return nil
+}
@@ -0,0 +1,33 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+)
+
+func TestHateRelations(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := auth.User{Id: "a", Email: "a@example.com"}
+	b := auth.User{Id: "b", Email: "b@example.com"}
+	c := auth.User{Id: "c", Email: "c@example.com"}
+	d := auth.User{Id: "d", Email: "d@example.com"}
+	bans := Bans{
+		{UserIds: []string{"a", "c"}, OwnerIds: []string{"a", "c"}, Users: []auth.User{a, c}, CreatedAt: now.Add(time.Hour)},
+		{UserIds: []string{"a", "b"}, OwnerIds: []string{"b"}, Users: []auth.User{a, b}, CreatedAt: now},
+		{UserIds: []string{"a", "d"}, OwnerIds: []string{"a"}, Users: []auth.User{a, d}, CreatedAt: now},
+	}
+	hatedBy, hates := hateRelations(bans, "a")
+	if len(hatedBy) != 2 || hatedBy[0].User.Id != "b" || hatedBy[1].User.Id != "c" || hatedBy[0].Mutual || !hatedBy[1].Mutual {
+		t.Errorf("Got hated by %+v, wanted b and then mutually c", hatedBy)
+	}
+	if len(hates) != 2 || hates[0].User.Id != "d" || hates[1].User.Id != "c" {
+		t.Errorf("Got hates %+v, wanted d and then c", hates)
+	}
+	for _, relation := range append(hatedBy, hates...) {
+		if relation.User.Email != "" {
+			t.Errorf("Got email %q for %v, wanted it redacted", relation.User.Email, relation.User.Id)
+		}
+	}
+}
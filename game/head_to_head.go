@@ -0,0 +1,90 @@
+package game
+
+import (
+	"net/http"
+
+	"github.com/zond/diplicity/auth"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+// HeadToHead is the record of two users in the public finished games they both played.
+type HeadToHead struct {
+	UserId      string
+	OtherUserId string
+	SharedGames int
+	// Ahead is the number of shared games where UserId finished with more supply centers than OtherUserId.
+	Ahead int
+	// Behind is the number of shared games where OtherUserId finished with more supply centers than UserId.
+	Behind int
+	Tied   int
+}
+
+func (h *HeadToHead) Item(r Request) *Item {
+	return NewItem(h).SetName("head-to-head").SetDesc([][]string{
+		[]string{
+			"Head to head",
+			"How the two users did against each other in the public finished games they both played, by their final supply center counts.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       GetHeadToHeadRoute,
+		RouteParams: []string{"user_id", h.UserId, "other_user_id", h.OtherUserId},
+	}))
+}
+
+// headToHead returns the record of userId against otherUserId in the game results.
+func headToHead(gameResults []GameResult, userId, otherUserId string) *HeadToHead {
+	result := &HeadToHead{
+		UserId:      userId,
+		OtherUserId: otherUserId,
+	}
+	for _, gameResult := range gameResults {
+		var userScore, otherScore *GameScore
+		for idx := range gameResult.Scores {
+			switch gameResult.Scores[idx].UserId {
+			case userId:
+				userScore = &gameResult.Scores[idx]
+			case otherUserId:
+				otherScore = &gameResult.Scores[idx]
+			}
+		}
+		if userScore == nil || otherScore == nil {
+			continue
+		}
+		result.SharedGames++
+		if userScore.SCs > otherScore.SCs {
+			result.Ahead++
+		} else if userScore.SCs < otherScore.SCs {
+			result.Behind++
+		} else {
+			result.Tied++
+		}
+	}
+	return result
+}
+
+func getHeadToHead(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	_, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	userId := r.Vars()["user_id"]
+	otherUserId := r.Vars()["other_user_id"]
+	if userId == otherUserId {
+		return HTTPErr{"can only compare two different users", http.StatusBadRequest}
+	}
+
+	gameResults := []GameResult{}
+	if _, err := datastore.NewQuery(gameResultKind).Filter("AllUsers=", userId).Filter("AllUsers=", otherUserId).Filter("Private=", false).GetAll(ctx, &gameResults); err != nil {
+		return err
+	}
+
+	w.SetContent(headToHead(gameResults, userId, otherUserId).Item(r))
+	return nil
+}
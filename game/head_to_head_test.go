@@ -0,0 +1,22 @@
+package game
+
+import "testing"
+
+func TestHeadToHead(t *testing.T) {
+	gameResults := []GameResult{
+		{Scores: GameScores{{UserId: "a", SCs: 10}, {UserId: "b", SCs: 5}, {UserId: "c", SCs: 19}}},
+		{Scores: GameScores{{UserId: "a", SCs: 3}, {UserId: "b", SCs: 3}}},
+		{Scores: GameScores{{UserId: "a", SCs: 0}, {UserId: "b", SCs: 18}}},
+		{Scores: GameScores{{UserId: "a", SCs: 8}, {UserId: "c", SCs: 8}}},
+	}
+	got := headToHead(gameResults, "a", "b")
+	want := HeadToHead{UserId: "a", OtherUserId: "b", SharedGames: 3, Ahead: 1, Behind: 1, Tied: 1}
+	if *got != want {
+		t.Errorf("Got %+v, wanted %+v", *got, want)
+	}
+	got = headToHead(nil, "a", "d")
+	want = HeadToHead{UserId: "a", OtherUserId: "d"}
+	if *got != want {
+		t.Errorf("Got %+v for users without shared games, wanted %+v", *got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package game
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	lastActivityBackfillKind = "LastActivityBackfill"
+)
+
+var (
+	lastActivityBackfilled     bool
+	lastActivityBackfilledLock = sync.RWMutex{}
+)
+
+// LastActivityBackfill records that all games have been re-saved to get a LastActivityAt.
+type LastActivityBackfill struct {
+	EnqueuedAt time.Time
+}
+
+func getLastActivityBackfillKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, lastActivityBackfillKind, prodKey, 0, nil)
+}
+
+// ensureLastActivityBackfill re-saves all games once, since games saved before LastActivityAt existed
+// don't have it, and are therefore missing from lists sorted on it.
+func ensureLastActivityBackfill(ctx context.Context) error {
+	lastActivityBackfilledLock.RLock()
+	if lastActivityBackfilled {
+		defer lastActivityBackfilledLock.RUnlock()
+		return nil
+	}
+	lastActivityBackfilledLock.RUnlock()
+	lastActivityBackfilledLock.Lock()
+	defer lastActivityBackfilledLock.Unlock()
+	if lastActivityBackfilled {
+		return nil
+	}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		backfill := &LastActivityBackfill{}
+		if err := datastore.Get(ctx, getLastActivityBackfillKey(ctx), backfill); err == nil {
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		backfill.EnqueuedAt = time.Now()
+		if _, err := datastore.Put(ctx, getLastActivityBackfillKey(ctx), backfill); err != nil {
+			return err
+		}
+		log.Infof(ctx, "Enqueueing reSave of all games to give them a LastActivityAt")
+		return reSaveFunc.EnqueueIn(ctx, 0, gameKind, 0, "")
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return err
+	}
+	lastActivityBackfilled = true
+	return nil
+}
+
+// handleListMyActiveGames lists the active games of the user, after making sure older games get a LastActivityAt.
+func handleListMyActiveGames(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+	if err := ensureLastActivityBackfill(ctx); err != nil {
+		log.Errorf(ctx, "Unable to enqueue reSave of all games to give them a LastActivityAt: %v", err)
+	}
+	return myActiveGamesHandler.handle(w, r)
+}
@@ -0,0 +1,75 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/datastore"
+)
+
+const (
+	listLimitConfKind = "ListLimitConf"
+	// maxConfigurableLimit stops operators from configuring lists larger than the instances can serve.
+	maxConfigurableLimit = 1024
+)
+
+var (
+	prodListLimitConf = &confCache{}
+)
+
+// ListLimitConf configures how many items the game and user stats lists return at most.
+type ListLimitConf struct {
+	// MaxLimit replaces maxLimit as the largest page size.
+	MaxLimit int
+}
+
+func (c *ListLimitConf) Validate() error {
+	if c.MaxLimit < 1 {
+		return fmt.Errorf("MaxLimit must be at least 1")
+	}
+	if c.MaxLimit > maxConfigurableLimit {
+		return fmt.Errorf("MaxLimit must be at most %d", maxConfigurableLimit)
+	}
+	return nil
+}
+
+func getListLimitConfKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, listLimitConfKind, prodKey, 0, nil)
+}
+
+// SetListLimit creates or replaces the ListLimit configuration. Must be called inside a transaction.
+func SetListLimit(ctx context.Context, listLimitConf *ListLimitConf) error {
+	if _, err := datastore.Put(ctx, getListLimitConfKey(ctx), listLimitConf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getListLimitConf(ctx context.Context) (*ListLimitConf, error) {
+	conf, err := prodListLimitConf.get(ctx, getListLimitConfKey(ctx), &ListLimitConf{})
+	if err != nil {
+		return nil, err
+	}
+	return conf.(*ListLimitConf), nil
+}
+
+// configuredMaxLimit returns the configured largest page size, or maxLimit if none is configured.
+func configuredMaxLimit(ctx context.Context) (int, error) {
+	conf, err := getListLimitConf(ctx)
+	if err == datastore.ErrNoSuchEntity {
+		return maxLimit, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return conf.MaxLimit, nil
+}
+
+// capLimit returns the 'limit' query parameter, or max if it's missing, unparseable or larger than max.
+func capLimit(param string, max int) int64 {
+	limit, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || limit > int64(max) {
+		return int64(max)
+	}
+	return limit
+}
@@ -0,0 +1,35 @@
+package game
+
+import "testing"
+
+func TestListLimitConfValidate(t *testing.T) {
+	for _, limit := range []int{1, maxLimit, maxConfigurableLimit} {
+		if err := (&ListLimitConf{MaxLimit: limit}).Validate(); err != nil {
+			t.Errorf("Got %v for %v, wanted no error", err, limit)
+		}
+	}
+	for _, limit := range []int{-1, 0, maxConfigurableLimit + 1} {
+		if err := (&ListLimitConf{MaxLimit: limit}).Validate(); err == nil {
+			t.Errorf("Got no error for %v, wanted one", limit)
+		}
+	}
+}
+
+func TestCapLimit(t *testing.T) {
+	for _, tc := range []struct {
+		param string
+		max   int
+		want  int64
+	}{
+		{"", 64, 64},
+		{"blapp", 64, 64},
+		{"10", 64, 10},
+		{"100", 64, 64},
+		{"100", 256, 100},
+		{"300", 256, 256},
+	} {
+		if got := capLimit(tc.param, tc.max); got != tc.want {
+			t.Errorf("Got %v for %q capped to %v, wanted %v", got, tc.param, tc.max, tc.want)
+		}
+	}
+}
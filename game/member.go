@@ -4,16 +4,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/mail"
 	"strings"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/zond/diplicity/auth"
+	fcm "github.com/zond/go-fcm"
 	"github.com/zond/godip"
 	"github.com/zond/godip/variants"
 	"golang.org/x/net/context"
 	"google.golang.org/appengine/v2"
 	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
 
 	. "github.com/zond/goaeoas"
 )
@@ -21,9 +24,13 @@ import (
 var (
 	MemberResource               *Resource
 	GameMasterInvitationResource *Resource
+
+	sendKickNotificationFunc *DelayFunc
 )
 
 func init() {
+	sendKickNotificationFunc = NewDelayFunc("game-sendKickNotification", sendKickNotification)
+
 	MemberResource = &Resource{
 		Create:     createMember,
 		Delete:     deleteMember,
@@ -59,6 +66,11 @@ type Member struct {
 	NewestPhaseState  PhaseState
 	UnreadMessages    int
 	Replaceable       bool
+	Abandoned         bool // The previous player resigned, and the nation is in civil disorder until replaced.
+	// CivilDisorderPhases is the number of phases where the nation had units to order but got no orders.
+	CivilDisorderPhases int
+	// Role is empty for players, and MemberRoleSpectator for the Spectators of a game.
+	Role string
 }
 
 type Members []Member
@@ -81,6 +93,12 @@ func (m Member) Preferences() godip.Nations {
 	return result
 }
 
+// Vacant returns whether nobody plays the nation, because the game master removed the player or the player resigned.
+// Resigned players keep their user until a replacement joins.
+func (m *Member) Vacant() bool {
+	return m.User.Id == "" || m.Abandoned
+}
+
 func (m *Member) Item(r Request) *Item {
 	return NewItem(m).SetName(m.User.Name)
 }
@@ -185,6 +203,8 @@ type deleteMemberRequest struct {
 	actorId    string
 	toRemoveId string
 	systemReq  bool
+	creatorReq bool
+	host       string
 }
 
 func deleteMemberHelper(ctx context.Context, gameID *datastore.Key, delReq deleteMemberRequest, idempotent bool) (*Member, error) {
@@ -205,7 +225,21 @@ func deleteMemberHelper(ctx context.Context, gameID *datastore.Key, delReq delet
 			return HTTPErr{"can only remove existing members", http.StatusNotFound}
 		}
 
-		if !delReq.systemReq && (!game.Leavable() || delReq.actorId != delReq.toRemoveId) && game.GameMaster.Id != delReq.actorId {
+		if delReq.creatorReq {
+			if game.CreatorId == "" || game.CreatorId != delReq.actorId {
+				return HTTPErr{"only the creator of the game can kick members", http.StatusForbidden}
+			}
+			if game.Started {
+				return HTTPErr{"can only kick members before the game starts", http.StatusPreconditionFailed}
+			}
+			if delReq.actorId == delReq.toRemoveId {
+				return HTTPErr{"can not kick yourself, leave the game instead", http.StatusBadRequest}
+			}
+		} else if !delReq.systemReq && !game.Leavable() && delReq.actorId == delReq.toRemoveId && game.GameMaster.Id != delReq.actorId {
+			return HTTPErr{"can not leave games that have already started", http.StatusPreconditionFailed}
+		}
+
+		if !delReq.systemReq && !delReq.creatorReq && (!game.Leavable() || delReq.actorId != delReq.toRemoveId) && game.GameMaster.Id != delReq.actorId {
 			return HTTPErr{"member not removable, or actor not game master", http.StatusPreconditionFailed}
 		}
 
@@ -218,6 +252,8 @@ func deleteMemberHelper(ctx context.Context, gameID *datastore.Key, delReq delet
 				}
 			}
 			game.Members = newMembers
+			// Staging games aren't normally closed, but make sure the vacated spot can be taken.
+			game.Closed = false
 		} else if !game.Finished {
 			member.GameAlias = ""
 			member.User = auth.User{
@@ -232,6 +268,12 @@ func deleteMemberHelper(ctx context.Context, gameID *datastore.Key, delReq delet
 			return err
 		}
 
+		if delReq.creatorReq {
+			if err := sendKickNotificationFunc.EnqueueIn(ctx, 0, delReq.host, game.Desc, delReq.toRemoveId); err != nil {
+				return err
+			}
+		}
+
 		if !game.GameMasterEnabled && len(game.Members) == 0 && !game.Started {
 			return datastore.Delete(ctx, gameID)
 		}
@@ -263,6 +305,119 @@ func deleteMember(w ResponseWriter, r Request) (*Member, error) {
 	return deleteMemberHelper(ctx, gameID, deleteMemberRequest{actorId: user.Id, toRemoveId: r.Vars()["user_id"]}, false)
 }
 
+func kickMember(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	member, err := deleteMemberHelper(ctx, gameID, deleteMemberRequest{
+		actorId:    user.Id,
+		toRemoveId: r.Vars()["user_id"],
+		creatorReq: true,
+		host:       r.Req().Host,
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	w.SetContent(member.Item(r))
+	return nil
+}
+
+func sendKickNotification(ctx context.Context, host string, gameDesc string, userId string) error {
+	log.Infof(ctx, "sendKickNotification(..., %q, %q, %q)", host, gameDesc, userId)
+
+	userID := auth.UserID(ctx, userId)
+	user := &auth.User{}
+	userConfig := &auth.UserConfig{}
+	if err := datastore.GetMulti(ctx, []*datastore.Key{userID, auth.UserConfigID(ctx, userID)}, []interface{}{user, userConfig}); err != nil {
+		if merr, ok := err.(appengine.MultiError); ok && merr[0] == nil && merr[1] == datastore.ErrNoSuchEntity {
+			log.Infof(ctx, "%q has no configuration, will skip sending notification", userId)
+			return nil
+		}
+		log.Errorf(ctx, "Unable to load user and user config of %q: %v; hope datastore gets fixed", userId, err)
+		return err
+	}
+
+	body := fmt.Sprintf("The creator of %q removed you from the game before it started.", gameDesc)
+
+	tokens := []string{}
+	for _, fcmToken := range userConfig.FCMTokens {
+		if !fcmToken.Disabled {
+			tokens = append(tokens, fcmToken.Value)
+		}
+	}
+	if len(tokens) > 0 {
+		data, err := NewFCMData(map[string]interface{}{
+			"type":     "kicked",
+			"gameDesc": gameDesc,
+		})
+		if err != nil {
+			log.Errorf(ctx, "Unable to encode FCM data payload: %v; fix NewFCMData", err)
+			return err
+		}
+		if err := FCMSendToTokensFunc.EnqueueIn(
+			ctx,
+			0,
+			time.Duration(0),
+			&fcm.NotificationPayload{
+				Title: "Removed from game",
+				Body:  body,
+				Tag:   "diplicity-engine-kicked",
+			},
+			data,
+			map[string][]string{
+				userId: tokens,
+			},
+		); err != nil {
+			log.Errorf(ctx, "Unable to enqueue sending of notification to %q: %v; hope datastore gets fixed", userId, err)
+			return err
+		}
+	}
+
+	if userConfig.WantsMail(auth.NotificationKicked) {
+		recipEmail, err := mail.ParseAddress(user.Email)
+		if err != nil {
+			log.Errorf(ctx, "Unable to parse email address of %v: %v; unable to recover, exiting", PP(user), err)
+			return nil
+		}
+		unsubscribeURL, err := auth.GetUnsubscribeURL(ctx, router, host, userId)
+		if err != nil {
+			log.Errorf(ctx, "Unable to create unsubscribe URL for %q: %v; fix auth.GetUnsubscribeURL", userId, err)
+			return err
+		}
+		unsubscribeAddress, err := auth.GetUnsubscribeAddress(ctx, userId)
+		if err != nil {
+			log.Errorf(ctx, "Unable to create unsubscribe address for %q: %v; fix auth.GetUnsubscribeAddress", userId, err)
+			return err
+		}
+		msg := &auth.EMail{
+			ToAddr:             recipEmail.Address,
+			ToName:             user.Name,
+			Subject:            fmt.Sprintf("%s: Removed from game", gameDesc),
+			TextBody:           fmt.Sprintf("%s\n\nVisit %s to stop receiving email like this.", body, unsubscribeURL.String()),
+			UnsubscribeURL:     unsubscribeURL.String(),
+			UnsubscribeAddress: unsubscribeAddress,
+		}
+		if err := msg.Send(ctx); err != nil {
+			log.Errorf(ctx, "Unable to send %v: %v; hope sendgrid gets fixed", msg, err)
+			return err
+		}
+	}
+
+	log.Infof(ctx, "sendKickNotification(..., %q, %q, %q) *** SUCCESS ***", host, gameDesc, userId)
+
+	return nil
+}
+
 func createMemberHelper(
 	ctx context.Context,
 	r Request,
@@ -288,6 +443,10 @@ func createMemberHelper(
 			return HTTPErr{"game not joinable", http.StatusPreconditionFailed}
 		}
 
+		if game.HasResigned(user.Id) {
+			return HTTPErr{"can't rejoin a game you resigned from", http.StatusPreconditionFailed}
+		}
+
 		if game.Started {
 			replaced := false
 			for memberIdx := range game.Members {
@@ -296,6 +455,12 @@ func createMemberHelper(
 					oldMember.User = *user
 					oldMember.GameAlias = member.GameAlias
 					oldMember.Replaceable = false
+					if oldMember.Abandoned {
+						if err := reclaimNation(ctx, game, oldMember); err != nil {
+							return err
+						}
+						oldMember.Abandoned = false
+					}
 					replaced = true
 					break
 				}
@@ -318,6 +483,9 @@ func createMemberHelper(
 
 		}
 
+		// Spectators joining as players stop spectating.
+		game.removeSpectator(user.Id)
+
 		if err := game.DBSave(ctx); err != nil {
 			return err
 		}
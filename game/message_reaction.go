@@ -0,0 +1,167 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	messageReactionKind = "MessageReaction"
+	maxReactionRunes    = 8
+)
+
+var MessageReactionResource *Resource
+
+func init() {
+	MessageReactionResource = &Resource{
+		Create:     createMessageReaction,
+		CreatePath: "/Game/{game_id}/Channel/{channel_members}/Messages/{message_id}/Reactions",
+	}
+}
+
+type MessageReaction struct {
+	GameID         *datastore.Key
+	ChannelMembers Nations
+	MessageID      *datastore.Key
+	Nation         godip.Nation
+	Emoji          string `methods:"POST"`
+	CreatedAt      time.Time
+}
+
+// MessageReactionID keys reactions by message, reacting nation and emoji, so
+// that reacting twice with the same emoji just replaces the old reaction.
+func MessageReactionID(ctx context.Context, messageID *datastore.Key, nation godip.Nation, emoji string) (*datastore.Key, error) {
+	if messageID == nil || nation == "" || emoji == "" {
+		return nil, fmt.Errorf("message reactions must have messages, nations and emojis")
+	}
+	return datastore.NewKey(ctx, messageReactionKind, fmt.Sprintf("%s,%s", nation, emoji), 0, messageID), nil
+}
+
+func (m *MessageReaction) ID(ctx context.Context) (*datastore.Key, error) {
+	return MessageReactionID(ctx, m.MessageID, m.Nation, m.Emoji)
+}
+
+func (m *MessageReaction) Item(r Request) *Item {
+	return NewItem(m).SetName(m.Emoji)
+}
+
+func createMessageReaction(w ResponseWriter, r Request) (*MessageReaction, error) {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return nil, HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return nil, err
+	}
+
+	channelMembers := Nations{}
+	channelMembers.FromString(r.Vars()["channel_members"])
+
+	channelID, err := ChannelID(ctx, gameID, channelMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := datastore.DecodeKey(r.Vars()["message_id"])
+	if err != nil {
+		return nil, err
+	}
+	if messageID.Kind() != messageKind || !channelID.Equal(messageID.Parent()) {
+		return nil, HTTPErr{"message not found in channel", http.StatusNotFound}
+	}
+
+	reaction := &MessageReaction{}
+	if err := Copy(reaction, r, "POST"); err != nil {
+		return nil, err
+	}
+	reaction.Emoji = strings.TrimSpace(reaction.Emoji)
+	if reaction.Emoji == "" || utf8.RuneCountInString(reaction.Emoji) > maxReactionRunes {
+		return nil, HTTPErr{fmt.Sprintf("reactions must be between 1 and %d characters", maxReactionRunes), http.StatusBadRequest}
+	}
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return nil, err
+	}
+	game.ID = gameID
+
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if !isMember || !game.Started || !game.Mustered {
+		return nil, HTTPErr{"can only react to messages in started member games", http.StatusForbidden}
+	}
+	if !channelMembers.Includes(member.Nation) {
+		return nil, HTTPErr{"can only react to messages in member channels", http.StatusForbidden}
+	}
+
+	reaction.GameID = gameID
+	reaction.ChannelMembers = channelMembers
+	reaction.MessageID = messageID
+	reaction.Nation = member.Nation
+	reaction.CreatedAt = time.Now()
+
+	reactionID, err := reaction.ID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		message := &Message{}
+		if err := datastore.Get(ctx, messageID, message); err != nil {
+			return err
+		}
+		if !message.Reacted {
+			message.Reacted = true
+			if _, err := datastore.Put(ctx, messageID, message); err != nil {
+				return err
+			}
+		}
+		_, err := datastore.Put(ctx, reactionID, reaction)
+		return err
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return nil, err
+	}
+
+	return reaction, nil
+}
+
+// countReactions sets the Reactions of the messages to the number of reactions
+// per emoji, ignoring reactions from muted nations. Only the reactions of the messages
+// anyone reacted to are loaded.
+func countReactions(ctx context.Context, messages Messages, mutedNats map[godip.Nation]struct{}) error {
+	for i := range messages {
+		messages[i].Reactions = map[string]int{}
+		if messages[i].ID == nil || !messages[i].Reacted {
+			continue
+		}
+		// The key of a reaction contains both the nation and the emoji, so the keys are enough.
+		reactionIDs, err := datastore.NewQuery(messageReactionKind).Ancestor(messages[i].ID).KeysOnly().GetAll(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, reactionID := range reactionIDs {
+			parts := strings.SplitN(reactionID.StringID(), ",", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			if _, isMuted := mutedNats[godip.Nation(parts[0])]; isMuted {
+				continue
+			}
+			messages[i].Reactions[parts[1]] += 1
+		}
+	}
+	return nil
+}
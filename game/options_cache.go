@@ -0,0 +1,74 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+const (
+	optionsCacheExpiration = 24 * time.Hour
+)
+
+// optionsCache stores zipped options, see zipOptions.
+type optionsCache interface {
+	get(key string) ([]byte, bool)
+	set(key string, zippedOptions []byte)
+}
+
+type memcacheOptionsCache struct {
+	ctx context.Context
+}
+
+func (m memcacheOptionsCache) get(key string) ([]byte, bool) {
+	item, err := memcache.Get(m.ctx, key)
+	if err == memcache.ErrCacheMiss {
+		return nil, false
+	} else if err != nil {
+		log.Warningf(m.ctx, "memcache.Get(..., %q): %v", key, err)
+		return nil, false
+	}
+	return item.Value, true
+}
+
+func (m memcacheOptionsCache) set(key string, zippedOptions []byte) {
+	if err := memcache.Set(m.ctx, &memcache.Item{
+		Key:        key,
+		Value:      zippedOptions,
+		Expiration: optionsCacheExpiration,
+	}); err != nil {
+		log.Warningf(m.ctx, "memcache.Set(..., %q, ...): %v", key, err)
+	}
+}
+
+/*
+ * optionsCacheKey is the cache key of the options of nation in a phase. Options are only
+ * ever cached per nation, so members never get the options of other nations. The resolved
+ * state of the phase is part of the key, so that resolving the phase invalidates the entry.
+ */
+func optionsCacheKey(encodedGameID string, phase *Phase, nation godip.Nation) string {
+	return fmt.Sprintf("options/%s/%d/%s/resolved:%v", encodedGameID, phase.PhaseOrdinal, nation, phase.Resolved)
+}
+
+// cachedOptions returns the options cached under key, or the options returned by load after caching them.
+func cachedOptions(ctx context.Context, cache optionsCache, key string, load func() (interface{}, error)) (interface{}, error) {
+	if zippedOptions, found := cache.get(key); found {
+		if options, err := unzipOptions(ctx, zippedOptions); err == nil {
+			return options, nil
+		}
+	}
+	options, err := load()
+	if err != nil {
+		return nil, err
+	}
+	zippedOptions, err := zipOptions(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	cache.set(key, zippedOptions)
+	return options, nil
+}
@@ -0,0 +1,90 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/godip"
+	"github.com/zond/godip/variants"
+	"golang.org/x/net/context"
+)
+
+type mapOptionsCache map[string][]byte
+
+func (m mapOptionsCache) get(key string) ([]byte, bool) {
+	b, found := m[key]
+	return b, found
+}
+
+func (m mapOptionsCache) set(key string, zippedOptions []byte) {
+	m[key] = zippedOptions
+}
+
+// countingOptionsLoader returns a loader generating the options of Russia in a new Classical game, counting the godip calls.
+func countingOptionsLoader(tb testing.TB, calls *int) func() (interface{}, error) {
+	s, err := variants.Variants["Classical"].Start()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return func() (interface{}, error) {
+		*calls++
+		return s.Phase().Options(s, godip.Russia), nil
+	}
+}
+
+func TestCachedOptions(t *testing.T) {
+	calls := 0
+	load := countingOptionsLoader(t, &calls)
+	cache := mapOptionsCache{}
+	phase := &Phase{PhaseMeta: PhaseMeta{PhaseOrdinal: 1}}
+	for i := 0; i < 3; i++ {
+		options, err := cachedOptions(context.Background(), cache, optionsCacheKey("game", phase, godip.Russia), load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if options, err = normalizeOptions(options); err != nil {
+			t.Fatal(err)
+		}
+		if len(optionOrders(options)) == 0 {
+			t.Errorf("Got no orders from %v, wanted some", options)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Got %v godip calls, wanted 1", calls)
+	}
+	if _, err := cachedOptions(context.Background(), cache, optionsCacheKey("game", phase, godip.England), load); err != nil {
+		t.Fatal(err)
+	}
+	phase.Resolved = true
+	if _, err := cachedOptions(context.Background(), cache, optionsCacheKey("game", phase, godip.Russia), load); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("Got %v godip calls, wanted other nations and resolved phases to miss the cache", calls)
+	}
+}
+
+func BenchmarkUncachedOptions(b *testing.B) {
+	calls := 0
+	load := countingOptionsLoader(b, &calls)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := load(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(calls)/float64(b.N), "godip-calls/op")
+}
+
+func BenchmarkCachedOptions(b *testing.B) {
+	calls := 0
+	load := countingOptionsLoader(b, &calls)
+	cache := mapOptionsCache{}
+	key := optionsCacheKey("game", &Phase{PhaseMeta: PhaseMeta{PhaseOrdinal: 1}}, godip.Russia)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cachedOptions(context.Background(), cache, key, load); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(calls)/float64(b.N), "godip-calls/op")
+}
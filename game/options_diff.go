@@ -0,0 +1,202 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+// ProvinceOptionsDiff contains the orders that became possible and impossible for a province between two phases.
+type ProvinceOptionsDiff struct {
+	Province godip.Province
+	Added    []string
+	Removed  []string
+}
+
+type OptionsDiff struct {
+	GameID    *datastore.Key
+	Nation    godip.Nation
+	From      int64
+	To        int64
+	Provinces []ProvinceOptionsDiff
+}
+
+func (o *OptionsDiff) Item(r Request) *Item {
+	return NewItem(o).SetName("options-diff").SetDesc([][]string{
+		[]string{
+			"Options diff",
+			"The orders the member can give in phase `To` but not in phase `From` (Added), and the other way around (Removed), grouped by the province they are given for.",
+			"Each order is the list of strings defining it, separated by spaces, as described in the options of the phases.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       GetOptionsDiffRoute,
+		RouteParams: []string{"game_id", o.GameID.Encode(), "phase_ordinal", fmt.Sprint(o.To)},
+		QueryParams: url.Values{"from": []string{fmt.Sprint(o.From)}},
+	}))
+}
+
+// optionOrders flattens an options tree, as produced by unzipOptions, into the orders it allows, grouped by the province they are given for.
+func optionOrders(options interface{}) map[godip.Province]map[string]bool {
+	result := map[godip.Province]map[string]bool{}
+	var walk func(province godip.Province, parts []string, node interface{})
+	walk = func(province godip.Province, parts []string, node interface{}) {
+		children, _ := node.(map[string]interface{})
+		if len(children) == 0 {
+			if result[province] == nil {
+				result[province] = map[string]bool{}
+			}
+			result[province][strings.Join(parts, " ")] = true
+			return
+		}
+		for value, child := range children {
+			childMap, _ := child.(map[string]interface{})
+			childParts := append(append([]string{}, parts...), value)
+			if childMap["Type"] == "SrcProvince" && len(parts) > 0 {
+				// SrcProvince replaces the first Province value instead of adding a part.
+				childParts = append([]string{value}, parts[1:]...)
+			}
+			childProvince := province
+			if len(parts) == 0 {
+				childProvince = godip.Province(value)
+			}
+			walk(childProvince, childParts, childMap["Next"])
+		}
+	}
+	if root, ok := options.(map[string]interface{}); ok && len(root) > 0 {
+		walk("", nil, root)
+	}
+	return result
+}
+
+// diffOptionOrders returns the orders in to but not in from, and the other way around, per province, sorted by province.
+func diffOptionOrders(from, to map[godip.Province]map[string]bool) []ProvinceOptionsDiff {
+	provinces := map[godip.Province]bool{}
+	for province := range from {
+		provinces[province] = true
+	}
+	for province := range to {
+		provinces[province] = true
+	}
+	result := []ProvinceOptionsDiff{}
+	for province := range provinces {
+		diff := ProvinceOptionsDiff{
+			Province: province,
+			Added:    []string{},
+			Removed:  []string{},
+		}
+		for order := range to[province] {
+			if !from[province][order] {
+				diff.Added = append(diff.Added, order)
+			}
+		}
+		for order := range from[province] {
+			if !to[province][order] {
+				diff.Removed = append(diff.Removed, order)
+			}
+		}
+		if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+			sort.Strings(diff.Added)
+			sort.Strings(diff.Removed)
+			result = append(result, diff)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Province < result[j].Province
+	})
+	return result
+}
+
+// normalizeOptions turns generated godip.Options into the same shape as options loaded with unzipOptions.
+func normalizeOptions(options interface{}) (interface{}, error) {
+	b, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func getOptionsDiff(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	toOrdinal, err := strconv.ParseInt(r.Vars()["phase_ordinal"], 10, 64)
+	if err != nil {
+		return err
+	}
+	fromOrdinal, err := strconv.ParseInt(r.Req().URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		return HTTPErr{"from must be a phase ordinal", http.StatusBadRequest}
+	}
+
+	fromID, err := PhaseID(ctx, gameID, fromOrdinal)
+	if err != nil {
+		return err
+	}
+	toID, err := PhaseID(ctx, gameID, toOrdinal)
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	fromPhase := &Phase{}
+	toPhase := &Phase{}
+	if err := datastore.GetMulti(ctx, []*datastore.Key{gameID, fromID, toID}, []interface{}{game, fromPhase, toPhase}); err != nil {
+		return err
+	}
+	game.ID = gameID
+
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if !isMember {
+		return HTTPErr{"can only load options for member games", http.StatusNotFound}
+	}
+	if nation := r.Req().URL.Query().Get("nation"); nation != "" && godip.Nation(nation) != member.Nation {
+		return HTTPErr{"can only load options for your own nation", http.StatusForbidden}
+	}
+
+	orders := []map[godip.Province]map[string]bool{}
+	for _, phase := range []*Phase{fromPhase, toPhase} {
+		options, err := memberOptions(ctx, game, phase, member)
+		if err != nil {
+			return err
+		}
+		if options, err = normalizeOptions(options); err != nil {
+			return err
+		}
+		orders = append(orders, optionOrders(options))
+	}
+
+	diff := &OptionsDiff{
+		GameID:    gameID,
+		Nation:    member.Nation,
+		From:      fromOrdinal,
+		To:        toOrdinal,
+		Provinces: diffOptionOrders(orders[0], orders[1]),
+	}
+	w.SetContent(diff.Item(r))
+	return nil
+}
@@ -0,0 +1,52 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/zond/godip"
+	"github.com/zond/godip/variants"
+)
+
+func TestDiffOptionOrders(t *testing.T) {
+	s, err := variants.Variants["Classical"].Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalized, err := normalizeOptions(s.Phase().Options(s, godip.Russia))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := optionOrders(normalized)
+	for _, order := range []string{"mos Hold", "mos Move ukr", "stp/sc Move bot"} {
+		found := false
+		for _, orders := range from {
+			found = found || orders[order]
+		}
+		if !found {
+			t.Errorf("Got no %q in %v, wanted it", order, from)
+		}
+	}
+	if diff := diffOptionOrders(from, from); len(diff) != 0 {
+		t.Errorf("Got %+v diffing identical options, wanted nothing", diff)
+	}
+
+	var to interface{}
+	if err := json.Unmarshal([]byte(`{"mos": {"Type": "Province", "Next": {"Hold": {"Type": "OrderType", "Next": {}}}}}`), &to); err != nil {
+		t.Fatal(err)
+	}
+	diff := diffOptionOrders(from, optionOrders(to))
+	for _, provinceDiff := range diff {
+		if len(provinceDiff.Added) != 0 {
+			t.Errorf("Got added %v, wanted only removed orders", provinceDiff.Added)
+		}
+		for _, order := range provinceDiff.Removed {
+			if order == "mos Hold" {
+				t.Errorf("Got mos Hold removed, wanted it kept")
+			}
+		}
+	}
+	if len(diff) != len(from) {
+		t.Errorf("Got %v provinces with differences, wanted %v", len(diff), len(from))
+	}
+}
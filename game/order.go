@@ -1,14 +1,17 @@
 package game
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/zond/diplicity/auth"
 	"github.com/zond/godip"
+	"github.com/zond/godip/state"
 	"github.com/zond/godip/variants"
 	"golang.org/x/net/context"
 	"google.golang.org/appengine/v2"
@@ -21,7 +24,13 @@ const (
 	orderKind = "Order"
 )
 
-var OrderResource *Resource
+var (
+	OrderResource *Resource
+
+	// Orders in these variants are saved even when they aren't among the options of the phase,
+	// since the variants intentionally leave validation to the adjudication.
+	lateOrderValidationVariants = map[string]bool{}
+)
 
 func init() {
 	OrderResource = &Resource{
@@ -34,7 +43,7 @@ func init() {
 			{
 				Path:    "/Game/{game_id}/Phase/{phase_ordinal}/Orders",
 				Route:   ListOrdersRoute,
-				Handler: listOrders,
+				Handler: etagCached(listOrders),
 			},
 		},
 	}
@@ -54,7 +63,14 @@ func (o Orders) Item(r Request, gameID *datastore.Key, phase *Phase) *Item {
 		Rel:         "self",
 		Route:       ListOrdersRoute,
 		RouteParams: []string{"game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phase.PhaseOrdinal)},
-	}))
+	})).SetDesc([][]string{
+		[]string{
+			"Order conditions",
+			"Orders can have Conditions, each with an If and a Then order. Conditions are only applied when the phase resolves, and are checked in the order they were given.",
+			"When If is the order of another unit, e.g. 'ber Move kie', and that unit was given that order (units without orders match '<province> Hold'), Then replaces the order. If no condition matches, the order is used as given.",
+			fmt.Sprintf("When If is '<province of the ordered unit> %s' and the unit is dislodged in a movement phase, Then (a 'Move' or 'Disband', e.g. 'par Move bur') becomes its retreat order in the following phase. If every unit needing an order in the following phase gets one this way, the member is automatically ready to resolve it. Orders that turn out to be invalid in the following phase are ignored.", ConditionDislodged),
+		},
+	})
 	return ordersItem
 }
 
@@ -63,6 +79,9 @@ type Order struct {
 	PhaseOrdinal int64
 	Nation       godip.Nation
 	Parts        []string `methods:"POST,PUT" separator:" "`
+	// Conditions can replace Parts when the phase resolves, see OrderCondition.
+	Conditions     []OrderCondition `methods:"POST,PUT" datastore:"-"`
+	ConditionsJSON string           `datastore:",noindex" json:"-"`
 }
 
 func OrderID(ctx context.Context, phaseID *datastore.Key, srcProvince godip.Province) (*datastore.Key, error) {
@@ -80,7 +99,7 @@ func (o *Order) ID(ctx context.Context) (*datastore.Key, error) {
 	return OrderID(ctx, phaseID, godip.Province(o.Parts[0]))
 }
 
-func (o *Order) Save(ctx context.Context) error {
+func (o *Order) DBSave(ctx context.Context) error {
 	key, err := o.ID(ctx)
 	if err != nil {
 		return err
@@ -147,6 +166,10 @@ func deleteOrder(w ResponseWriter, r Request) (*Order, error) {
 			return HTTPErr{"can only delete your own orders", http.StatusForbidden}
 		}
 
+		if err := recordOrderRevision(ctx, gameID, phaseOrdinal, member.Nation, false, nil, godip.Province(srcProvince)); err != nil {
+			return err
+		}
+
 		return datastore.Delete(ctx, orderID)
 	}, &datastore.TransactionOptions{XG: false}); err != nil {
 		return nil, err
@@ -217,31 +240,24 @@ func updateOrder(w ResponseWriter, r Request) (*Order, error) {
 		order.PhaseOrdinal = phaseOrdinal
 		order.Nation = member.Nation
 
-		variant := variants.Variants[game.Variant]
-
-		parsedOrder, err := variant.Parser.Parse(order.Parts)
-		if err != nil {
-			return err
-		}
-
-		s, err := phase.State(ctx, variant, nil)
+		s, err := phase.State(ctx, variants.Variants[game.Variant], nil)
 		if err != nil {
 			return err
 		}
 
-		validNation, err := parsedOrder.Validate(s)
-		if err != nil {
+		if err := order.validate(game.Variant, s, member.Nation); err != nil {
 			return err
 		}
-		if validNation != member.Nation {
-			return HTTPErr{"can't issue orders for others", http.StatusForbidden}
-		}
 
 		if godip.Province(order.Parts[0]).Super() != godip.Province(srcProvince).Super() {
 			return HTTPErr{"unable to change source province for order", http.StatusBadRequest}
 		}
 
-		return order.Save(ctx)
+		if err := recordOrderRevision(ctx, gameID, phaseOrdinal, member.Nation, false, Orders{*order}); err != nil {
+			return err
+		}
+
+		return order.DBSave(ctx)
 	}, &datastore.TransactionOptions{XG: false}); err != nil {
 		return nil, err
 	}
@@ -249,6 +265,125 @@ func updateOrder(w ResponseWriter, r Request) (*Order, error) {
 	return order, nil
 }
 
+// validateOrder makes sure parts is an order nation can give in s.
+func validateOrder(variantName string, s *state.State, nation godip.Nation, parts []string) error {
+	if len(parts) == 0 {
+		return HTTPErr{"orders must have parts", http.StatusBadRequest}
+	}
+
+	parsedOrder, err := variants.Variants[variantName].Parser.Parse(parts)
+	if err != nil {
+		return HTTPErr{fmt.Sprintf("unable to parse order %v: %v", parts, err), http.StatusBadRequest}
+	}
+
+	validNation, err := parsedOrder.Validate(s)
+	if err != nil {
+		return HTTPErr{fmt.Sprintf("invalid order %v: %v", parts, err), http.StatusBadRequest}
+	}
+	if validNation != nation {
+		return HTTPErr{"can't issue orders for others", http.StatusForbidden}
+	}
+
+	if !lateOrderValidationVariants[variantName] {
+		if err := validateOrderOptions(s.Phase().Options(s, nation), parts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// optionChild returns the child of options with a value, ignoring filters, printing as part.
+func optionChild(options godip.Options, part string) (godip.Options, bool) {
+	for value, child := range options {
+		if filtered, ok := value.(godip.FilteredOptionValue); ok {
+			value = filtered.Value
+		}
+		if fmt.Sprint(value) == part {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+// optionValues returns the sorted values of options, ignoring filters, for error messages.
+func optionValues(options godip.Options) []string {
+	result := []string{}
+	for value := range options {
+		if filtered, ok := value.(godip.FilteredOptionValue); ok {
+			value = filtered.Value
+		}
+		result = append(result, fmt.Sprint(value))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// validateOrderOptions returns a 400 explaining the first part of the order not found in the options tree of the phase.
+// The tree is keyed by province, order type, and then the remaining parts, where the SrcProvince node
+// matches the (possibly coastal) first part of the order.
+func validateOrderOptions(options godip.Options, parts []string) error {
+	if len(parts) < 2 {
+		return HTTPErr{"orders need at least a province and an order type", http.StatusBadRequest}
+	}
+	src := godip.Province(parts[0])
+	provinceCandidates := []godip.Province{src}
+	if src.Super() != src {
+		provinceCandidates = append(provinceCandidates, src.Super())
+	}
+	var provinceOptions godip.Options
+	for _, candidate := range provinceCandidates {
+		if child, found := optionChild(options, string(candidate)); found {
+			if provinceOptions == nil {
+				provinceOptions = godip.Options{}
+			}
+			for value, grandChild := range child {
+				provinceOptions[value] = grandChild
+			}
+		}
+	}
+	if provinceOptions == nil {
+		return HTTPErr{fmt.Sprintf("%v has no possible orders this phase", src), http.StatusBadRequest}
+	}
+	node, found := optionChild(provinceOptions, parts[1])
+	if !found {
+		return HTTPErr{fmt.Sprintf("%v is not a possible order type for %v, possible are %v", parts[1], src, optionValues(provinceOptions)), http.StatusBadRequest}
+	}
+	rest := parts[2:]
+	for len(node) > 0 {
+		isSrcLevel := false
+		for value := range node {
+			if filtered, ok := value.(godip.FilteredOptionValue); ok {
+				value = filtered.Value
+			}
+			if _, ok := value.(godip.SrcProvince); ok {
+				isSrcLevel = true
+			}
+		}
+		if isSrcLevel {
+			child, found := optionChild(node, string(src))
+			if !found {
+				return HTTPErr{fmt.Sprintf("%v is not a possible source for %v orders, possible are %v", src, parts[1], optionValues(node)), http.StatusBadRequest}
+			}
+			node = child
+			continue
+		}
+		if len(rest) == 0 {
+			return HTTPErr{fmt.Sprintf("%v order for %v is incomplete, next part should be one of %v", parts[1], src, optionValues(node)), http.StatusBadRequest}
+		}
+		child, found := optionChild(node, rest[0])
+		if !found {
+			return HTTPErr{fmt.Sprintf("%v is not possible in %v order for %v, possible are %v", rest[0], parts[1], src, optionValues(node)), http.StatusBadRequest}
+		}
+		node = child
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		return HTTPErr{fmt.Sprintf("%v order for %v has superfluous parts %v", parts[1], src, rest), http.StatusBadRequest}
+	}
+	return nil
+}
+
 func createAndCorroborate(w ResponseWriter, r Request) error {
 	_, err := createOrder(w, r)
 	if err != nil {
@@ -329,28 +464,21 @@ func createOrder(w ResponseWriter, r Request) (*Order, error) {
 		order.PhaseOrdinal = phaseOrdinal
 		order.Nation = member.Nation
 
-		variant := variants.Variants[game.Variant]
-
-		parsedOrder, err := variant.Parser.Parse(order.Parts)
+		s, err := phase.State(ctx, variants.Variants[game.Variant], nil)
 		if err != nil {
 			return err
 		}
 
-		s, err := phase.State(ctx, variant, nil)
-		if err != nil {
+		if err := order.validate(game.Variant, s, member.Nation); err != nil {
 			return err
 		}
 
-		validNation, err := parsedOrder.Validate(s)
+		orderID, err := OrderID(ctx, phaseID, godip.Province(order.Parts[0]))
 		if err != nil {
 			return err
 		}
-		if validNation != member.Nation {
-			return HTTPErr{"can't issue orders for others", http.StatusForbidden}
-		}
 
-		orderID, err := OrderID(ctx, phaseID, godip.Province(order.Parts[0]))
-		if err != nil {
+		if err := recordOrderRevision(ctx, gameID, phaseOrdinal, member.Nation, false, Orders{*order}); err != nil {
 			return err
 		}
 
@@ -365,6 +493,143 @@ func createOrder(w ResponseWriter, r Request) (*Order, error) {
 	return order, nil
 }
 
+/*
+ * replaceOrders validates and saves all orders for the nation of the requesting member in one transaction,
+ * deleting any other orders the nation had in the phase. If any order is invalid, nothing is saved.
+ */
+func replaceOrders(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	phaseOrdinal, err := strconv.ParseInt(r.Vars()["phase_ordinal"], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		return err
+	}
+
+	request := &struct {
+		Orders Orders
+	}{}
+	if err := json.NewDecoder(r.Req().Body).Decode(request); err != nil {
+		return HTTPErr{fmt.Sprintf("unable to parse orders: %v", err), http.StatusBadRequest}
+	}
+
+	orders := Orders{}
+	phase := &Phase{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		orders = Orders{}
+		game := &Game{}
+		if err := datastore.GetMulti(ctx, []*datastore.Key{gameID, phaseID}, []interface{}{game, phase}); err != nil {
+			return err
+		}
+		game.ID = gameID
+		if !game.Mustered {
+			return HTTPErr{"can only create orders for mustered games", http.StatusPreconditionFailed}
+		}
+		if phase.Resolved {
+			return HTTPErr{"can only create orders for unresolved phases", http.StatusPreconditionFailed}
+		}
+		member, isMember := game.GetMemberByUserId(user.Id)
+		if !isMember {
+			return HTTPErr{"can only create orders for member games", http.StatusNotFound}
+		}
+
+		s, err := phase.State(ctx, variants.Variants[game.Variant], nil)
+		if err != nil {
+			return err
+		}
+
+		keysToSave := []*datastore.Key{}
+		valuesToSave := []interface{}{}
+		failures := []string{}
+		seenProvinces := map[godip.Province]bool{}
+		for i, requestedOrder := range request.Orders {
+			if err := requestedOrder.validate(game.Variant, s, member.Nation); err != nil {
+				if herr, ok := err.(HTTPErr); ok {
+					failures = append(failures, fmt.Sprintf("order %d %v: %v", i, requestedOrder.Parts, herr.Body))
+					continue
+				}
+				return err
+			}
+			srcProvince := godip.Province(requestedOrder.Parts[0]).Super()
+			if seenProvinces[srcProvince] {
+				failures = append(failures, fmt.Sprintf("order %d %v: more than one order for %v", i, requestedOrder.Parts, srcProvince))
+				continue
+			}
+			seenProvinces[srcProvince] = true
+			orderID, err := OrderID(ctx, phaseID, srcProvince)
+			if err != nil {
+				return err
+			}
+			order := &Order{
+				GameID:       gameID,
+				PhaseOrdinal: phaseOrdinal,
+				Nation:       member.Nation,
+				Parts:        requestedOrder.Parts,
+				Conditions:   requestedOrder.Conditions,
+			}
+			orders = append(orders, *order)
+			keysToSave = append(keysToSave, orderID)
+			valuesToSave = append(valuesToSave, order)
+		}
+		if len(failures) > 0 {
+			return HTTPErr{fmt.Sprintf("no orders saved, %d invalid: %v", len(failures), strings.Join(failures, "; ")), http.StatusBadRequest}
+		}
+
+		existingIDs, err := datastore.NewQuery(orderKind).Ancestor(phaseID).Filter("Nation=", member.Nation).KeysOnly().GetAll(ctx, nil)
+		if err != nil {
+			return err
+		}
+		keysToDelete := []*datastore.Key{}
+		for _, existingID := range existingIDs {
+			if !seenProvinces[godip.Province(existingID.StringID())] {
+				keysToDelete = append(keysToDelete, existingID)
+			}
+		}
+		if err := datastore.DeleteMulti(ctx, keysToDelete); err != nil {
+			return err
+		}
+
+		if err := recordOrderRevision(ctx, gameID, phaseOrdinal, member.Nation, true, orders); err != nil {
+			return err
+		}
+
+		phaseState := &PhaseState{}
+		phaseStateID, err := PhaseStateID(ctx, phaseID, member.Nation)
+		if err != nil {
+			return err
+		}
+		if err := datastore.Get(ctx, phaseStateID, phaseState); err == nil && phaseState.OnProbation {
+			phaseState.OnProbation = false
+			phaseState.ReadyToResolve = false
+			phaseState.Note = fmt.Sprintf("Auto updated to OnProbation = false due to order creation.")
+			keysToSave = append(keysToSave, phaseStateID)
+			valuesToSave = append(valuesToSave, phaseState)
+		}
+
+		_, err = datastore.PutMulti(ctx, keysToSave, valuesToSave)
+		return err
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return err
+	}
+
+	w.SetContent(orders.Item(r, gameID, phase))
+	return nil
+}
+
 func listOrders(w ResponseWriter, r Request) error {
 	ctx := appengine.NewContext(r.Req())
 
@@ -395,6 +660,9 @@ func listOrders(w ResponseWriter, r Request) error {
 		return err
 	}
 	game.ID = gameID
+	if err := game.delayPhaseFor(user.Id, phase); err != nil {
+		return err
+	}
 
 	var nation godip.Nation
 
@@ -0,0 +1,266 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/zond/godip"
+	"github.com/zond/godip/state"
+	"github.com/zond/godip/variants"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	// How many conditions each order can have.
+	maxOrderConditions = 4
+
+	// ConditionDislodged is the order type of conditions, e.g. "par Dislodged", that match when the ordered unit is dislodged
+	// in a movement phase. Then is then given as the retreat order of the unit in the following retreat phase.
+	ConditionDislodged = "Dislodged"
+)
+
+var (
+	// The order types Dislodged conditions can give.
+	dislodgedConditionOrderTypes = map[godip.OrderType]bool{
+		godip.Move:    true,
+		godip.Disband: true,
+	}
+)
+
+/*
+ * OrderCondition makes an order conditional on the order given to another unit, or
+ * gives an order for the following phase if the ordered unit is dislodged.
+ * When the phase resolves, the first condition of an order whose If matches the
+ * unconditional order of the unit in If[0] replaces the order with Then.
+ */
+type OrderCondition struct {
+	// If is the expected order of another unit, e.g. "ber Move kie", or the ordered unit being dislodged, e.g. "par Dislodged".
+	// Units without orders match "<province> Hold".
+	If []string `methods:"POST,PUT" separator:" "`
+	// Then is the order given instead of the unconditional order if the condition matches, or the retreat order for Dislodged conditions.
+	Then []string `methods:"POST,PUT" separator:" "`
+}
+
+func (o *OrderCondition) isDislodged() bool {
+	return len(o.If) == 2 && o.If[1] == ConditionDislodged
+}
+
+func (o *Order) Load(props []datastore.Property) error {
+	err := datastore.LoadStruct(o, props)
+	if _, is := err.(*datastore.ErrFieldMismatch); is {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	o.Conditions = nil
+	if o.ConditionsJSON != "" {
+		return json.Unmarshal([]byte(o.ConditionsJSON), &o.Conditions)
+	}
+	return nil
+}
+
+func (o *Order) Save() ([]datastore.Property, error) {
+	o.ConditionsJSON = ""
+	if len(o.Conditions) > 0 {
+		b, err := json.Marshal(o.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		o.ConditionsJSON = string(b)
+	}
+	return datastore.SaveStruct(o)
+}
+
+// validate makes sure the order, and the orders of its conditions, are orders nation can give in s.
+func (o *Order) validate(variantName string, s *state.State, nation godip.Nation) error {
+	if err := validateOrder(variantName, s, nation, o.Parts); err != nil {
+		return err
+	}
+	return validateOrderConditions(variantName, s, nation, o.Parts, o.Conditions)
+}
+
+// validateOrderConditions makes sure the conditions reference units in s other than the one ordered by parts,
+// and that their orders are valid orders for the same unit as parts.
+func validateOrderConditions(variantName string, s *state.State, nation godip.Nation, parts []string, conditions []OrderCondition) error {
+	if len(conditions) > maxOrderConditions {
+		return HTTPErr{fmt.Sprintf("orders can have at most %d conditions", maxOrderConditions), http.StatusBadRequest}
+	}
+	src := godip.Province(parts[0]).Super()
+	dislodgedConditions := 0
+	for i, condition := range conditions {
+		if condition.isDislodged() {
+			if err := validateDislodgedCondition(s, src, condition); err != nil {
+				herr := err.(HTTPErr)
+				herr.Body = fmt.Sprintf("condition %d: %v", i, herr.Body)
+				return herr
+			}
+			if dislodgedConditions++; dislodgedConditions > 1 {
+				return HTTPErr{fmt.Sprintf("condition %d: orders can have at most one %q condition", i, ConditionDislodged), http.StatusBadRequest}
+			}
+			continue
+		}
+		if len(condition.If) < 2 {
+			return HTTPErr{fmt.Sprintf("condition %d must expect at least a province and an order type", i), http.StatusBadRequest}
+		}
+		if _, err := variants.Variants[variantName].Parser.Parse(condition.If); err != nil {
+			return HTTPErr{fmt.Sprintf("unable to parse condition %d %v: %v", i, condition.If, err), http.StatusBadRequest}
+		}
+		ifProvince := godip.Province(condition.If[0])
+		if ifProvince.Super() == src {
+			return HTTPErr{fmt.Sprintf("condition %d can't depend on the order of the unit it orders", i), http.StatusBadRequest}
+		}
+		_, _, hasUnit := s.Unit(ifProvince)
+		_, _, hasDislodged := s.Dislodged(ifProvince)
+		if !hasUnit && !hasDislodged {
+			return HTTPErr{fmt.Sprintf("condition %d expects an order for %v, which has no unit", i, ifProvince), http.StatusBadRequest}
+		}
+		if len(condition.Then) == 0 || godip.Province(condition.Then[0]).Super() != src {
+			return HTTPErr{fmt.Sprintf("condition %d must give an order for %v", i, src), http.StatusBadRequest}
+		}
+		if err := validateOrder(variantName, s, nation, condition.Then); err != nil {
+			if herr, ok := err.(HTTPErr); ok {
+				herr.Body = fmt.Sprintf("condition %d: %v", i, herr.Body)
+				return herr
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDislodgedCondition makes sure the condition can trigger for the unit in src. The retreat order can only be fully
+// validated once the unit is dislodged.
+func validateDislodgedCondition(s *state.State, src godip.Province, condition OrderCondition) error {
+	if s.Phase().Type() != godip.Movement {
+		return HTTPErr{fmt.Sprintf("%q conditions can only be given in movement phases", ConditionDislodged), http.StatusPreconditionFailed}
+	}
+	if godip.Province(condition.If[0]).Super() != src {
+		return HTTPErr{fmt.Sprintf("%q conditions can only expect the ordered unit to be dislodged", ConditionDislodged), http.StatusBadRequest}
+	}
+	if len(condition.Then) < 2 || godip.Province(condition.Then[0]).Super() != src {
+		return HTTPErr{fmt.Sprintf("%q conditions must give an order for %v", ConditionDislodged, src), http.StatusBadRequest}
+	}
+	if !dislodgedConditionOrderTypes[godip.OrderType(condition.Then[1])] {
+		return HTTPErr{fmt.Sprintf("%q conditions can't give %v orders", ConditionDislodged, condition.Then[1]), http.StatusBadRequest}
+	}
+	return nil
+}
+
+// samePartsFor returns whether parts is the order expected, treating coasts of the ordered province as the same province.
+func samePartsFor(parts []string, expected []string) bool {
+	if len(parts) != len(expected) || godip.Province(parts[0]).Super() != godip.Province(expected[0]).Super() {
+		return false
+	}
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * applyOrderConditions returns orders with the Parts of each conditional order replaced by the Then of its
+ * first matching condition. Conditions are matched against the unconditional orders only, in the order they
+ * were given, so that the result doesn't depend on the order the orders are processed in.
+ */
+func applyOrderConditions(orders []Order) []Order {
+	unconditional := map[godip.Province][]string{}
+	for _, order := range orders {
+		unconditional[godip.Province(order.Parts[0]).Super()] = order.Parts
+	}
+	result := make([]Order, len(orders))
+	for i, order := range orders {
+		result[i] = order
+		for _, condition := range order.Conditions {
+			// Conditions of dry run orders aren't validated, and Dislodged conditions only apply to the following phase.
+			if len(condition.If) < 2 || len(condition.Then) == 0 || condition.isDislodged() {
+				continue
+			}
+			ifProvince := godip.Province(condition.If[0])
+			parts, found := unconditional[ifProvince.Super()]
+			if !found {
+				parts = []string{string(ifProvince), string(godip.Hold)}
+			}
+			if samePartsFor(parts, condition.If) {
+				result[i].Parts = condition.Then
+				break
+			}
+		}
+	}
+	return result
+}
+
+// applyDislodgedConditions saves orders for the new phase from the Dislodged conditions of the orders of the resolved phase whose
+// units were dislodged. s must be the state of the new phase. Returns the provinces given orders, per nation.
+func applyDislodgedConditions(ctx context.Context, resolvedOrders []Order, newPhase *Phase, variantName string, s *state.State) (map[godip.Nation]map[godip.Province]bool, error) {
+	applied := map[godip.Nation]map[godip.Province]bool{}
+	if s.Phase().Type() != godip.Retreat {
+		return applied, nil
+	}
+
+	newPhaseID, err := PhaseID(ctx, newPhase.GameID, newPhase.PhaseOrdinal)
+	if err != nil {
+		return nil, err
+	}
+
+	orderIDs := []*datastore.Key{}
+	orders := Orders{}
+	for _, resolvedOrder := range resolvedOrders {
+		for _, condition := range resolvedOrder.Conditions {
+			if !condition.isDislodged() {
+				continue
+			}
+			unit, prov, found := s.Dislodged(godip.Province(resolvedOrder.Parts[0]))
+			if !found || unit.Nation != resolvedOrder.Nation {
+				break
+			}
+			if err := validateOrder(variantName, s, resolvedOrder.Nation, condition.Then); err != nil {
+				log.Infof(ctx, "Ignoring triggered %q condition of %v, invalid in %v: %v", ConditionDislodged, PP(resolvedOrder), PP(newPhase.PhaseMeta), err)
+				break
+			}
+			orderID, err := OrderID(ctx, newPhaseID, prov)
+			if err != nil {
+				return nil, err
+			}
+			orderIDs = append(orderIDs, orderID)
+			orders = append(orders, Order{
+				GameID:       newPhase.GameID,
+				PhaseOrdinal: newPhase.PhaseOrdinal,
+				Nation:       resolvedOrder.Nation,
+				Parts:        condition.Then,
+			})
+			if applied[resolvedOrder.Nation] == nil {
+				applied[resolvedOrder.Nation] = map[godip.Province]bool{}
+			}
+			applied[resolvedOrder.Nation][prov.Super()] = true
+			break
+		}
+	}
+	if len(orders) > 0 {
+		if _, err := datastore.PutMulti(ctx, orderIDs, orders); err != nil {
+			return nil, err
+		}
+		log.Infof(ctx, "Applied triggered %q conditions %v", ConditionDislodged, PP(orders))
+	}
+	return applied, nil
+}
+
+// optionsCovered returns whether all provinces in the options are among the covered provinces.
+func optionsCovered(options godip.Options, covered map[godip.Province]bool) bool {
+	if len(options) == 0 || len(covered) == 0 {
+		return false
+	}
+	for _, value := range optionValues(options) {
+		if !covered[godip.Province(value).Super()] {
+			return false
+		}
+	}
+	return true
+}
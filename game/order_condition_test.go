@@ -0,0 +1,159 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/godip"
+	"github.com/zond/godip/variants"
+)
+
+func resolveWithConditions(t *testing.T, orders []Order) map[godip.Province]godip.Unit {
+	variant := variants.Variants["Classical"]
+	s, err := variant.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedOrders, err := variant.Parser.ParseAll(orderMapOf(applyOrderConditions(orders)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for prov, order := range parsedOrders {
+		s.SetOrder(prov, order)
+	}
+	if err := s.Next(); err != nil {
+		t.Fatal(err)
+	}
+	return s.Units()
+}
+
+func TestApplyOrderConditions(t *testing.T) {
+	conditional := Order{
+		Nation: godip.Germany,
+		Parts:  []string{"mun", "Hold"},
+		Conditions: []OrderCondition{
+			{If: []string{"ber", "Move", "pru"}, Then: []string{"mun", "Move", "sil"}},
+			{If: []string{"ber", "Move", "kie"}, Then: []string{"mun", "Move", "ber"}},
+		},
+	}
+
+	units := resolveWithConditions(t, []Order{
+		{Nation: godip.Germany, Parts: []string{"ber", "Move", "kie"}},
+		{Nation: godip.Germany, Parts: []string{"kie", "Move", "den"}},
+		conditional,
+	})
+	if unit, found := units["ber"]; !found || unit.Type != godip.Army {
+		t.Errorf("Got %+v in ber, wanted the army from mun after the satisfied condition", unit)
+	}
+	if _, found := units["mun"]; found {
+		t.Errorf("Got a unit in mun, wanted it moved to ber")
+	}
+
+	units = resolveWithConditions(t, []Order{
+		{Nation: godip.Germany, Parts: []string{"ber", "Hold"}},
+		conditional,
+	})
+	if _, found := units["mun"]; !found {
+		t.Errorf("Got no unit in mun, wanted the unconditional hold when no condition is satisfied")
+	}
+	if _, found := units["sil"]; found {
+		t.Errorf("Got a unit in sil, wanted no condition satisfied")
+	}
+
+	units = resolveWithConditions(t, []Order{
+		{Nation: godip.Germany, Parts: []string{"mun", "Hold"}, Conditions: []OrderCondition{
+			{If: []string{"ber", "Hold"}, Then: []string{"mun", "Move", "sil"}},
+		}},
+	})
+	if _, found := units["sil"]; !found {
+		t.Errorf("Got no unit in sil, wanted units without orders to match Hold conditions")
+	}
+}
+
+func TestValidateOrderConditions(t *testing.T) {
+	s, err := variants.Variants["Classical"].Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := []string{"mun", "Hold"}
+	valid := []OrderCondition{
+		{If: []string{"ber", "Move", "kie"}, Then: []string{"mun", "Move", "ber"}},
+		{If: []string{"war", "Move", "sil"}, Then: []string{"mun", "Support", "ber", "sil"}},
+	}
+	if err := validateOrderConditions("Classical", s, godip.Germany, parts, valid); err != nil {
+		t.Errorf("Got %v, wanted no error", err)
+	}
+	for _, condition := range []OrderCondition{
+		{If: []string{"ber"}, Then: []string{"mun", "Move", "ber"}},
+		{If: []string{"mun", "Move", "ber"}, Then: []string{"mun", "Move", "ber"}},
+		{If: []string{"ruh", "Hold"}, Then: []string{"mun", "Move", "ber"}},
+		{If: []string{"ber", "Move", "kie"}, Then: []string{"kie", "Move", "den"}},
+		{If: []string{"ber", "Move", "kie"}, Then: []string{"mun", "Move", "par"}},
+	} {
+		if err := validateOrderConditions("Classical", s, godip.Germany, parts, []OrderCondition{condition}); err == nil {
+			t.Errorf("Got no error for %+v, wanted one", condition)
+		}
+	}
+	tooMany := make([]OrderCondition, maxOrderConditions+1)
+	for i := range tooMany {
+		tooMany[i] = valid[0]
+	}
+	if err := validateOrderConditions("Classical", s, godip.Germany, parts, tooMany); err == nil {
+		t.Errorf("Got no error for %d conditions, wanted one", len(tooMany))
+	}
+}
+
+func TestValidateDislodgedConditions(t *testing.T) {
+	s, err := variants.Variants["Classical"].Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		parts     []string
+		condition OrderCondition
+	}{
+		{[]string{"mos", "Hold"}, OrderCondition{If: []string{"mos", ConditionDislodged}, Then: []string{"mos", "Disband"}}},
+		{[]string{"stp/sc", "Hold"}, OrderCondition{If: []string{"stp", ConditionDislodged}, Then: []string{"stp/sc", "Move", "fin"}}},
+	} {
+		if err := validateOrderConditions("Classical", s, godip.Russia, tc.parts, []OrderCondition{tc.condition}); err != nil {
+			t.Errorf("Got %v for %+v, wanted no error", err, tc.condition)
+		}
+	}
+	parts := []string{"mos", "Hold"}
+	for _, condition := range []OrderCondition{
+		{If: []string{"war", ConditionDislodged}, Then: []string{"mos", "Disband"}},
+		{If: []string{"mos", ConditionDislodged}, Then: []string{"war", "Disband"}},
+		{If: []string{"mos", ConditionDislodged}, Then: []string{"mos", "Hold"}},
+		{If: []string{"mos", ConditionDislodged}, Then: []string{"mos"}},
+	} {
+		if err := validateOrderConditions("Classical", s, godip.Russia, parts, []OrderCondition{condition}); err == nil {
+			t.Errorf("Got no error for %+v, wanted one", condition)
+		}
+	}
+	twice := OrderCondition{If: []string{"mos", ConditionDislodged}, Then: []string{"mos", "Disband"}}
+	if err := validateOrderConditions("Classical", s, godip.Russia, parts, []OrderCondition{twice, twice}); err == nil {
+		t.Errorf("Got no error for two %q conditions, wanted one", ConditionDislodged)
+	}
+
+	units := resolveWithConditions(t, []Order{
+		{Nation: godip.Russia, Parts: []string{"mos", "Move", "ukr"}, Conditions: []OrderCondition{twice}},
+	})
+	if _, found := units["ukr"]; !found {
+		t.Errorf("Got no unit in ukr, wanted %q conditions to leave the order as given", ConditionDislodged)
+	}
+}
+
+func TestOptionsCovered(t *testing.T) {
+	options := godip.Options{
+		godip.Province("stp"): godip.Options{},
+		godip.Province("mos"): godip.Options{},
+	}
+	if optionsCovered(options, map[godip.Province]bool{"stp": true}) {
+		t.Errorf("Got covered with mos uncovered")
+	}
+	if !optionsCovered(options, map[godip.Province]bool{"stp": true, "mos": true}) {
+		t.Errorf("Got uncovered with all provinces covered")
+	}
+	if optionsCovered(godip.Options{}, map[godip.Province]bool{"stp": true}) {
+		t.Errorf("Got covered without options")
+	}
+}
@@ -0,0 +1,196 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	orderRevisionKind = "OrderRevision"
+	// How many times each nation can change its orders each phase.
+	maxOrderRevisionsPerPhase = 200
+)
+
+type OrderRevisions []OrderRevision
+
+func (o OrderRevisions) Item(r Request, gameID *datastore.Key, phaseOrdinal int64, nation godip.Nation) *Item {
+	revisionItems := make(List, len(o))
+	for i := range o {
+		if o[i].Orders == nil {
+			o[i].Orders = []string{}
+		}
+		revisionItems[i] = NewItem(o[i]).SetName(fmt.Sprint(o[i].Revision))
+	}
+	return NewItem(revisionItems).SetName("order-revisions").AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       ListOrderRevisionsRoute,
+		RouteParams: []string{"game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phaseOrdinal)},
+		QueryParams: map[string][]string{"nation": []string{string(nation)}},
+	})).SetDesc([][]string{
+		[]string{
+			"Order revisions",
+			"Each time a member creates, updates, deletes or replaces orders, a revision with all orders of the nation after the change is saved. Revisions can't be changed or removed.",
+			fmt.Sprintf("Each nation can make at most %d revisions per phase.", maxOrderRevisionsPerPhase),
+		},
+		[]string{
+			"Visibility",
+			"Until the phase resolves only the member playing the nation can list its revisions. After that they are public.",
+		},
+	})
+}
+
+// OrderRevision is the orders of a nation after one of its changes.
+type OrderRevision struct {
+	GameID       *datastore.Key
+	PhaseOrdinal int64
+	Nation       godip.Nation
+	Revision     int64
+	CreatedAt    time.Time
+	// Orders contains the parts of each order, separated by spaces.
+	Orders []string `datastore:",noindex"`
+}
+
+func OrderRevisionID(ctx context.Context, phaseID *datastore.Key, nation godip.Nation, revision int64) (*datastore.Key, error) {
+	phaseStateID, err := PhaseStateID(ctx, phaseID, nation)
+	if err != nil {
+		return nil, err
+	}
+	return datastore.NewKey(ctx, orderRevisionKind, "", revision, phaseStateID), nil
+}
+
+// mergeOrders returns the existing orders with the saved orders replacing and adding orders, and the orders for the deleted provinces removed.
+// The result is the space separated parts of each order, sorted.
+func mergeOrders(existing Orders, saved Orders, deleted ...godip.Province) []string {
+	byProvince := map[godip.Province][]string{}
+	for _, orders := range []Orders{existing, saved} {
+		for _, order := range orders {
+			byProvince[godip.Province(order.Parts[0]).Super()] = order.Parts
+		}
+	}
+	for _, prov := range deleted {
+		delete(byProvince, prov.Super())
+	}
+	result := make([]string, 0, len(byProvince))
+	for _, parts := range byProvince {
+		result = append(result, strings.Join(parts, " "))
+	}
+	sort.Strings(result)
+	return result
+}
+
+/*
+ * recordOrderRevision saves a revision with the orders of nation after saving the saved orders and deleting the orders for the deleted provinces.
+ * If replaceAll is true, the saved orders replace all existing orders. Must be run in the transaction changing the orders,
+ * which doesn't see its own changes.
+ */
+func recordOrderRevision(ctx context.Context, gameID *datastore.Key, phaseOrdinal int64, nation godip.Nation, replaceAll bool, saved Orders, deleted ...godip.Province) error {
+	phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		return err
+	}
+	phaseStateID, err := PhaseStateID(ctx, phaseID, nation)
+	if err != nil {
+		return err
+	}
+
+	revisionIDs, err := datastore.NewQuery(orderRevisionKind).Ancestor(phaseStateID).KeysOnly().GetAll(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if len(revisionIDs) >= maxOrderRevisionsPerPhase {
+		return HTTPErr{fmt.Sprintf("orders can be changed at most %d times per phase", maxOrderRevisionsPerPhase), http.StatusTooManyRequests}
+	}
+
+	existing := Orders{}
+	if !replaceAll {
+		if _, err := datastore.NewQuery(orderKind).Ancestor(phaseID).Filter("Nation=", nation).GetAll(ctx, &existing); err != nil {
+			return err
+		}
+	}
+
+	revision := &OrderRevision{
+		GameID:       gameID,
+		PhaseOrdinal: phaseOrdinal,
+		Nation:       nation,
+		Revision:     int64(len(revisionIDs)) + 1,
+		CreatedAt:    time.Now(),
+		Orders:       mergeOrders(existing, saved, deleted...),
+	}
+	revisionID, err := OrderRevisionID(ctx, phaseID, nation, revision.Revision)
+	if err != nil {
+		return err
+	}
+	_, err = datastore.Put(ctx, revisionID, revision)
+	return err
+}
+
+func listOrderRevisions(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	phaseOrdinal, err := strconv.ParseInt(r.Vars()["phase_ordinal"], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	phase := &Phase{}
+	if err := datastore.GetMulti(ctx, []*datastore.Key{gameID, phaseID}, []interface{}{game, phase}); err != nil {
+		return err
+	}
+	game.ID = gameID
+
+	nation := godip.Nation(r.Req().URL.Query().Get("nation"))
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if nation == "" {
+		if !isMember {
+			return HTTPErr{"must provide a nation unless member of the game", http.StatusBadRequest}
+		}
+		nation = member.Nation
+	}
+	if !phase.Resolved && (!isMember || member.Nation != nation) {
+		return HTTPErr{"can only list your own order revisions until the phase resolves", http.StatusForbidden}
+	}
+
+	phaseStateID, err := PhaseStateID(ctx, phaseID, nation)
+	if err != nil {
+		return err
+	}
+
+	revisions := OrderRevisions{}
+	if _, err := datastore.NewQuery(orderRevisionKind).Ancestor(phaseStateID).GetAll(ctx, &revisions); err != nil {
+		return err
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	w.SetContent(revisions.Item(r, gameID, phaseOrdinal, nation))
+	return nil
+}
@@ -0,0 +1,28 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zond/godip"
+)
+
+func TestMergeOrders(t *testing.T) {
+	existing := Orders{
+		{Parts: []string{"stp/sc", "Hold"}},
+		{Parts: []string{"mos", "Hold"}},
+		{Parts: []string{"war", "Hold"}},
+	}
+	saved := Orders{
+		{Parts: []string{"stp/sc", "Move", "bot"}},
+		{Parts: []string{"sev", "Move", "bla"}},
+	}
+	got := mergeOrders(existing, saved, godip.Province("war"))
+	want := []string{"mos Hold", "sev Move bla", "stp/sc Move bot"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, wanted %v", got, want)
+	}
+	if got := mergeOrders(nil, nil, "mos"); len(got) != 0 {
+		t.Errorf("Got %v, wanted no orders", got)
+	}
+}
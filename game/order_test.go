@@ -0,0 +1,42 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/godip"
+	"github.com/zond/godip/variants"
+
+	. "github.com/zond/goaeoas"
+)
+
+func TestValidateOrderOptions(t *testing.T) {
+	s, err := variants.Variants["Classical"].Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := s.Phase().Options(s, godip.Russia)
+	for _, parts := range [][]string{
+		{"mos", "Hold"},
+		{"mos", "Move", "ukr"},
+		{"stp/sc", "Move", "bot"},
+		{"war", "Support", "mos", "ukr"},
+	} {
+		if err := validateOrderOptions(options, parts); err != nil {
+			t.Errorf("Got %v for %v, wanted no error", err, parts)
+		}
+	}
+	for _, parts := range [][]string{
+		{"mos"},
+		{"par", "Hold"},
+		{"mos", "Convoy", "war", "ukr"},
+		{"mos", "Move", "ber"},
+		{"mos", "Move"},
+		{"mos", "Hold", "mos"},
+		{"stp/nc", "Move", "bot"},
+	} {
+		err := validateOrderOptions(options, parts)
+		if httpErr, ok := err.(HTTPErr); !ok || httpErr.Status != 400 {
+			t.Errorf("Got %v for %v, wanted a 400", err, parts)
+		}
+	}
+}
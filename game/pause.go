@@ -0,0 +1,180 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"github.com/zond/godip/variants"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+
+	. "github.com/zond/goaeoas"
+)
+
+// activeNations returns the nations of members not eliminated in the newest phase.
+func (g *Game) activeNations() Nations {
+	result := Nations{}
+	for _, member := range g.Members {
+		if !member.NewestPhaseState.Eliminated {
+			result = append(result, member.Nation)
+		}
+	}
+	return result
+}
+
+// addPauseVote adds nation to votes, and returns the new votes and whether all active nations have voted.
+func addPauseVote(votes Nations, nation godip.Nation, active Nations) (Nations, bool) {
+	if !votes.Includes(nation) {
+		votes = append(votes, nation)
+	}
+	for _, activeNation := range active {
+		if !votes.Includes(activeNation) {
+			return votes, false
+		}
+	}
+	return votes, true
+}
+
+// resumedDeadline returns the deadline of a phase resumed at resumedAt, keeping the time that was left when it was paused.
+func resumedDeadline(deadlineAt, pausedAt, resumedAt time.Time) time.Time {
+	left := deadlineAt.Sub(pausedAt)
+	if left < 0 {
+		left = 0
+	}
+	return resumedAt.Add(left)
+}
+
+func pauseGame(w ResponseWriter, r Request) error {
+	return changeGamePause(w, r, true)
+}
+
+func resumeGame(w ResponseWriter, r Request) error {
+	return changeGamePause(w, r, false)
+}
+
+// changeGamePause pauses or resumes the game immediately if the user is the game master,
+// otherwise it records the vote of the member and changes the game when all active members agree.
+func changeGamePause(w ResponseWriter, r Request, pause bool) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		*game = Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+		game.ID = gameID
+
+		if !game.Started || game.Finished || len(game.NewestPhaseMeta) != 1 {
+			return HTTPErr{"can only pause and resume running games", http.StatusPreconditionFailed}
+		}
+		if game.Paused == pause {
+			return HTTPErr{fmt.Sprintf("game already has Paused = %v", pause), http.StatusPreconditionFailed}
+		}
+
+		isGameMaster := game.GameMasterEnabled && game.GameMaster.Id == user.Id
+		member, isMember := game.GetMemberByUserId(user.Id)
+		if !isGameMaster && !isMember {
+			return HTTPErr{"can only pause and resume member games", http.StatusForbidden}
+		}
+
+		change := isGameMaster
+		if !isGameMaster {
+			if pause {
+				game.PauseVotes, change = addPauseVote(game.PauseVotes, member.Nation, game.activeNations())
+			} else {
+				game.ResumeVotes, change = addPauseVote(game.ResumeVotes, member.Nation, game.activeNations())
+			}
+		}
+		if !change {
+			return game.DBSave(ctx)
+		}
+		return setGamePaused(ctx, r.Req().Host, game, pause)
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
+		return err
+	}
+
+	game.Redact(user, viewerIsSuperuser(ctx, user), r)
+	w.SetContent(game.Item(r))
+	return nil
+}
+
+// setGamePaused pauses or resumes the game and notifies the members. Must be run inside a transaction.
+func setGamePaused(ctx context.Context, host string, game *Game, pause bool) error {
+	phaseID, err := PhaseID(ctx, game.ID, game.NewestPhaseMeta[0].PhaseOrdinal)
+	if err != nil {
+		return err
+	}
+	phase := &Phase{}
+	if err := datastore.Get(ctx, phaseID, phase); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	game.PauseVotes = nil
+	game.ResumeVotes = nil
+	var notificationBody string
+	if pause {
+		game.Paused = true
+		game.PausedAt = now
+		notificationBody = "The game has been paused. The phase will not resolve until the game is resumed."
+	} else {
+		phase.DeadlineAt = resumedDeadline(phase.DeadlineAt, game.PausedAt, now)
+		game.Paused = false
+		game.PausedAt = time.Time{}
+		if _, err := datastore.Put(ctx, phaseID, phase); err != nil {
+			return err
+		}
+		if err := phase.ScheduleResolution(ctx); err != nil {
+			return err
+		}
+		// Members may have declared ready while the game was paused.
+		phaseStates := PhaseStates{}
+		if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &phaseStates); err != nil {
+			return err
+		}
+		if phaseStates.AllReadyToResolve(variants.Variants[game.Variant].Nations) {
+			if err := asyncResolvePhaseFunc.EnqueueIn(ctx, 0, game.ID, phase.PhaseOrdinal); err != nil {
+				return err
+			}
+		}
+		notificationBody = fmt.Sprintf("The game has been resumed. The deadline of the phase is now %v.", phase.DeadlineAt.Format(time.RFC822))
+	}
+	game.NewestPhaseMeta = []PhaseMeta{phase.PhaseMeta}
+	if err := game.DBSave(ctx); err != nil {
+		return err
+	}
+
+	members := make([]string, len(game.Members))
+	for idx := range game.Members {
+		members[idx] = string(game.Members[idx].Nation)
+	}
+	if err := AsyncSendMsgFunc.EnqueueIn(
+		ctx, 0,
+		game.ID,
+		DiplicitySender,
+		members,
+		notificationBody,
+		host,
+	); err != nil {
+		log.Errorf(ctx, "AsyncSendMsgFunc(..., %v, %v, %+v, %q, %q): %v; fix it?", game.ID, DiplicitySender, members, notificationBody, host, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zond/godip"
+)
+
+func TestAddPauseVote(t *testing.T) {
+	active := Nations{godip.England, godip.France}
+	votes, all := addPauseVote(nil, godip.England, active)
+	if all || len(votes) != 1 {
+		t.Errorf("Got %v, %v, wanted one vote and not all", votes, all)
+	}
+	votes, all = addPauseVote(votes, godip.England, active)
+	if all || len(votes) != 1 {
+		t.Errorf("Got %v, %v, wanted repeated votes ignored", votes, all)
+	}
+	votes, all = addPauseVote(votes, godip.France, active)
+	if !all || len(votes) != 2 {
+		t.Errorf("Got %v, %v, wanted two votes and all", votes, all)
+	}
+}
+
+func TestResumedDeadline(t *testing.T) {
+	pausedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	resumedAt := pausedAt.Add(48 * time.Hour)
+	if got := resumedDeadline(pausedAt.Add(time.Hour), pausedAt, resumedAt); !got.Equal(resumedAt.Add(time.Hour)) {
+		t.Errorf("Got %v, wanted an hour after resuming", got)
+	}
+	if got := resumedDeadline(pausedAt.Add(-time.Hour), pausedAt, resumedAt); !got.Equal(resumedAt) {
+		t.Errorf("Got %v, wanted the resume time for passed deadlines", got)
+	}
+}
@@ -37,7 +37,9 @@ var (
 	sendPhaseDeadlineWarningFunc                *DelayFunc
 	sendPhaseNotificationsToUsersFunc           *DelayFunc
 	sendPhaseNotificationsToFCMFunc             *DelayFunc
+	sendBatchedPhaseNotificationsToFCMFunc      *DelayFunc
 	sendPhaseNotificationsToMailFunc            *DelayFunc
+	sendPhaseMailNotificationsToUsersFunc       *DelayFunc
 	ejectProbationariesFunc                     *DelayFunc
 	PhaseResource                               *Resource
 	GameMasterEditNewestPhaseDeadlineAtResource *Resource
@@ -48,7 +50,9 @@ func init() {
 	timeoutResolvePhaseFunc = NewDelayFunc("game-timeoutResolvePhase", timeoutResolvePhase)
 	sendPhaseNotificationsToUsersFunc = NewDelayFunc("game-sendPhaseNotificationsToUsers", sendPhaseNotificationsToUsers)
 	sendPhaseNotificationsToFCMFunc = NewDelayFunc("game-sendPhaseNotificationsToFCM", sendPhaseNotificationsToFCM)
+	sendBatchedPhaseNotificationsToFCMFunc = NewDelayFunc("game-sendBatchedPhaseNotificationsToFCM", sendBatchedPhaseNotificationsToFCM)
 	sendPhaseNotificationsToMailFunc = NewDelayFunc("game-sendPhaseNotificationsToMail", sendPhaseNotificationsToMail)
+	sendPhaseMailNotificationsToUsersFunc = NewDelayFunc("game-sendPhaseMailNotificationsToUsers", sendPhaseMailNotificationsToUsers)
 	ejectProbationariesFunc = NewDelayFunc("game-ejectProbationaries", ejectProbationaries)
 	planPhaseTimeoutFunc = NewDelayFunc("game-planPhaseTimeout", planPhaseTimeout)
 	sendPhaseDeadlineWarningFunc = NewDelayFunc("game-sendPhaseDeadlineWarning", sendPhaseDeadlineWarning)
@@ -60,7 +64,7 @@ func init() {
 			{
 				Path:    "/Game/{game_id}/Phases",
 				Route:   ListPhasesRoute,
-				Handler: listPhases,
+				Handler: etagCached(listPhases),
 			},
 		},
 	}
@@ -123,6 +127,21 @@ type phaseNotificationContext struct {
 	mailData     map[string]interface{}
 }
 
+func (p *phaseNotificationContext) notificationPayload() *fcm.NotificationPayload {
+	return &fcm.NotificationPayload{
+		Title: fmt.Sprintf(
+			"%s: %s %d, %s",
+			p.game.DescFor(p.member.Nation),
+			p.phase.Season,
+			p.phase.Year,
+			p.phase.Type,
+		),
+		Body:        fmt.Sprintf("%s has a new phase.", p.game.Desc),
+		Tag:         "diplicity-engine-new-phase",
+		ClickAction: p.mapURL.String(),
+	}
+}
+
 func getPhaseNotificationContext(ctx context.Context, host string, gameID *datastore.Key, phaseOrdinal int64, userId string) (*phaseNotificationContext, error) {
 	res := &phaseNotificationContext{}
 
@@ -185,6 +204,16 @@ func getPhaseNotificationContext(ctx context.Context, host string, gameID *datas
 		return nil, noConfigError
 	}
 
+	gameState, err := loadMemberGameState(ctx, gameID, res.member.Nation)
+	if err != nil {
+		log.Errorf(ctx, "Unable to load game state of %q in %v: %v; hope datastore gets fixed", userId, gameID, err)
+		return nil, err
+	}
+	if gameState.NotificationSettings.MutePhaseChanges {
+		log.Infof(ctx, "%q has muted phase notifications for %v", userId, gameID)
+		return nil, mutedNotifError
+	}
+
 	res.mapURL, err = router.Get(RenderPhaseMapRoute).URL("game_id", res.game.ID.Encode(), "phase_ordinal", fmt.Sprint(res.phase.PhaseOrdinal))
 	if err != nil {
 		log.Errorf(ctx, "Unable to create map URL for game %v and phase %v: %v; wtf?", res.game.ID, res.phase.PhaseOrdinal, err)
@@ -245,13 +274,22 @@ func sendPhaseNotificationsToMail(ctx context.Context, host string, gameID *data
 	} else if err == noGameError {
 		log.Warningf(ctx, "%q doesn't exist, giving up", gameID)
 		return nil
+	} else if err == mutedNotifError {
+		log.Infof(ctx, "%q has muted phase notifications for %v, will skip sending notification", userId, gameID)
+		return nil
 	} else if err != nil {
 		log.Errorf(ctx, "Unable to get msg notification context: %v; fix getPhaseNotificationContext or hope datastore gets fixed", err)
 		return err
 	}
 
-	if !msgContext.userConfig.MailConfig.Enabled {
-		log.Infof(ctx, "%q hasn't enabled mail notifications for mail, will skip sending notification", userId)
+	notification := auth.NotificationPhaseResolved
+	if msgContext.game.Finished {
+		notification = auth.NotificationGameFinished
+	} else if msgContext.phase.PhaseOrdinal == 1 {
+		notification = auth.NotificationPhaseStarted
+	}
+	if !msgContext.userConfig.WantsMail(notification) {
+		log.Infof(ctx, "%q doesn't want mail notifications for %v, will skip sending notification", userId, notification)
 		return nil
 	}
 
@@ -278,6 +316,11 @@ func sendPhaseNotificationsToMail(ctx context.Context, host string, gameID *data
 	)
 	msg.UnsubscribeURL = unsubscribeURL.String()
 
+	if msg.UnsubscribeAddress, err = auth.GetUnsubscribeAddress(ctx, userId); err != nil {
+		log.Errorf(ctx, "Unable to create unsubscribe address for %q: %v; fix auth.GetUnsubscribeAddress", userId, err)
+		return err
+	}
+
 	msgContext.userConfig.MailConfig.MessageConfig.Customize(ctx, msg, msgContext.mailData)
 
 	recipEmail, err := mail.ParseAddress(msgContext.user.Email)
@@ -288,9 +331,6 @@ func sendPhaseNotificationsToMail(ctx context.Context, host string, gameID *data
 	msg.ToAddr = recipEmail.Address
 	msg.ToName = string(msgContext.member.Nation)
 
-	msg.FromAddr = noreplyFromAddr
-	msg.FromName = noreplyFromName
-
 	if err := msg.Send(ctx); err != nil {
 		log.Errorf(ctx, "Unable to send %v: %v; hope sendgrid gets fixed", msg, err)
 		return err
@@ -302,120 +342,154 @@ func sendPhaseNotificationsToMail(ctx context.Context, host string, gameID *data
 	return nil
 }
 
+// sendPhaseNotificationsToFCM is the old, per user, task. It's kept to run the tasks enqueued before notifications were batched,
+// and sends to the tokens of the user not already in finishedTokens.
 func sendPhaseNotificationsToFCM(ctx context.Context, host string, gameID *datastore.Key, phaseOrdinal int64, userId string, finishedTokens map[string]struct{}) error {
 	log.Infof(ctx, "sendPhaseNotificationsToFCM(..., %q, %v, %v, %q, %+v)", host, gameID, phaseOrdinal, userId, finishedTokens)
 
-	if userId == "" {
-		return nil
-	}
-
-	msgContext, err := getPhaseNotificationContext(ctx, host, gameID, phaseOrdinal, userId)
-	if err == noConfigError {
-		log.Infof(ctx, "%q has no configuration, will skip sending notification", userId)
-		return nil
-	} else if err == noGameError {
-		log.Warningf(ctx, "%q doesn't exists, giving up", gameID)
-		return nil
-	} else if err != nil {
-		log.Errorf(ctx, "Unable to get phase notification context: %v; fix getPhaseNotificationContext or hope datastore gets fixed", err)
+	if err := enqueuePhaseNotificationsToFCM(ctx, host, gameID, phaseOrdinal, []string{userId}, finishedTokens); err != nil {
 		return err
 	}
 
-	dataPayload, err := NewFCMData(msgContext.fcmData)
-	if err != nil {
-		log.Errorf(ctx, "Unable to encode FCM data payload %v: %v; fix NewFCMData", msgContext.fcmData, err)
+	log.Infof(ctx, "sendPhaseNotificationsToFCM(..., %q, %v, %v, %q, %+v) *** SUCCESS ***", host, gameID, phaseOrdinal, userId, finishedTokens)
+
+	return nil
+}
+
+// sendBatchedPhaseNotificationsToFCM notifies all devices of the users at once, with one FCM request per distinct notification.
+func sendBatchedPhaseNotificationsToFCM(ctx context.Context, host string, gameID *datastore.Key, phaseOrdinal int64, uids []string) error {
+	log.Infof(ctx, "sendBatchedPhaseNotificationsToFCM(..., %q, %v, %v, %+v)", host, gameID, phaseOrdinal, uids)
+
+	if err := enqueuePhaseNotificationsToFCM(ctx, host, gameID, phaseOrdinal, uids, nil); err != nil {
 		return err
 	}
 
-	for _, fcmToken := range msgContext.userConfig.FCMTokens {
-		if fcmToken.Disabled {
+	log.Infof(ctx, "sendBatchedPhaseNotificationsToFCM(..., %q, %v, %v, %+v) *** SUCCESS ***", host, gameID, phaseOrdinal, uids)
+
+	return nil
+}
+
+// enqueuePhaseNotificationsToFCM enqueues one FCM request per distinct notification to the devices of the users, skipping finishedTokens.
+func enqueuePhaseNotificationsToFCM(ctx context.Context, host string, gameID *datastore.Key, phaseOrdinal int64, uids []string, finishedTokens map[string]struct{}) error {
+	batches := fcmBatches{}
+	for _, userId := range uids {
+		if userId == "" {
 			continue
 		}
-		if _, done := finishedTokens[fcmToken.Value]; done {
+
+		msgContext, err := getPhaseNotificationContext(ctx, host, gameID, phaseOrdinal, userId)
+		if err == noConfigError {
+			log.Infof(ctx, "%q has no configuration, will skip sending notification", userId)
+			continue
+		} else if err == noGameError {
+			log.Warningf(ctx, "%q doesn't exists, giving up", gameID)
+			return nil
+		} else if err == mutedNotifError {
+			log.Infof(ctx, "%q has muted phase notifications for %v, will skip sending notification", userId, gameID)
 			continue
+		} else if err != nil {
+			log.Errorf(ctx, "Unable to get phase notification context: %v; fix getPhaseNotificationContext or hope datastore gets fixed", err)
+			return err
 		}
-		finishedTokens[fcmToken.Value] = struct{}{}
-		notificationPayload := &fcm.NotificationPayload{
-			Title: fmt.Sprintf(
-				"%s: %s %d, %s",
-				msgContext.game.DescFor(msgContext.member.Nation),
-				msgContext.phase.Season,
-				msgContext.phase.Year,
-				msgContext.phase.Type,
-			),
-			Body:        fmt.Sprintf("%s has a new phase.", msgContext.game.Desc),
-			Tag:         "diplicity-engine-new-phase",
-			ClickAction: msgContext.mapURL.String(),
-		}
-
-		fcmToken.PhaseConfig.Customize(ctx, notificationPayload, msgContext.mailData)
-		if fcmToken.MessageConfig.DontSendData {
-			dataPayload = nil
-		}
-		if fcmToken.MessageConfig.DontSendNotification {
-			notificationPayload = nil
-		}
-
-		if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
-			if err := FCMSendToTokensFunc.EnqueueIn(
-				ctx,
-				0,
-				time.Duration(0),
-				notificationPayload,
-				dataPayload,
-				map[string][]string{
-					userId: []string{fcmToken.Value},
-				},
-			); err != nil {
-				log.Errorf(ctx, "Unable to enqueue actual sending of notification to %v/%v: %v; fix FCMSendToUsers or hope datastore gets fixed", userId, fcmToken.Value, err)
+
+		if !hasEnabledFCMTokens(msgContext.userConfig) {
+			if err := sendWebPushFallback(ctx, userId, msgContext.userConfig, msgContext.notificationPayload()); err != nil {
+				log.Errorf(ctx, "Unable to schedule web push to %q: %v; will keep sending to the others", userId, err)
+			}
+			continue
+		}
+
+		for _, fcmToken := range msgContext.userConfig.FCMTokens {
+			if fcmToken.Disabled {
+				continue
+			}
+			if _, done := finishedTokens[fcmToken.Value]; done {
+				continue
+			}
+			dataPayload, err := NewFCMData(msgContext.fcmData)
+			if err != nil {
+				log.Errorf(ctx, "Unable to encode FCM data payload %v: %v; fix NewFCMData", msgContext.fcmData, err)
 				return err
 			}
+			notificationPayload := msgContext.notificationPayload()
+			fcmToken.PhaseConfig.Customize(ctx, notificationPayload, msgContext.mailData)
+			if fcmToken.MessageConfig.DontSendData {
+				dataPayload = nil
+			}
+			if fcmToken.MessageConfig.DontSendNotification {
+				notificationPayload = nil
+			}
 
-			if len(msgContext.userConfig.FCMTokens) > len(finishedTokens) {
-				if err := sendPhaseNotificationsToFCMFunc.EnqueueIn(ctx, 0, host, gameID, phaseOrdinal, userId, finishedTokens); err != nil {
-					log.Errorf(ctx, "Unable to enqueue sending of rest of notifications: %v; hope datastore gets fixed", err)
-					return err
-				}
+			if err := batches.add(userId, fcmToken.Value, notificationPayload, dataPayload); err != nil {
+				log.Errorf(ctx, "Unable to batch notification to %v/%v: %v; fix fcmBatches", userId, fcmToken.Value, err)
+				return err
 			}
+		}
+	}
 
-			return nil
-		}, &datastore.TransactionOptions{XG: true}); err != nil {
-			log.Errorf(ctx, "Unable to commit send tx: %v", err)
+	return batches.each(func(batch *fcmBatch) error {
+		if err := FCMSendToTokensFunc.EnqueueIn(
+			ctx,
+			0,
+			time.Duration(0),
+			batch.notif,
+			batch.data,
+			batch.tokens,
+		); err != nil {
+			log.Errorf(ctx, "Unable to enqueue actual sending of notification to %+v: %v; hope datastore gets fixed", batch.tokens, err)
+			return err
+		}
+		return nil
+	})
+}
+
+func sendPhaseNotificationsToUsers(ctx context.Context, host string, gameID *datastore.Key, phaseOrdinal int64, uids []string) error {
+	log.Infof(ctx, "sendPhaseNotificationsToUsers(..., %q, %v, %v, %+v)", host, gameID, phaseOrdinal, uids)
+
+	if len(uids) == 0 {
+		log.Infof(ctx, "sendPhaseNotificationsToUsers(..., %q, %v, %v, %+v) *** NO UIDS ***", host, gameID, phaseOrdinal, uids)
+		return nil
+	}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := sendBatchedPhaseNotificationsToFCMFunc.EnqueueIn(ctx, 0, host, gameID, phaseOrdinal, uids); err != nil {
+			log.Errorf(ctx, "Unable to enqueue sending notifications to %+v: %v; hope datastore gets fixed", uids, err)
 			return err
 		}
-		log.Infof(ctx, "Successfully sent a notification and enqueued sending the rest, exiting")
-		break
+		if err := sendPhaseMailNotificationsToUsersFunc.EnqueueIn(ctx, 0, host, gameID, phaseOrdinal, uids); err != nil {
+			log.Errorf(ctx, "Unable to enqueue sending mail to %+v: %v; hope datastore gets fixed", uids, err)
+			return err
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
+		log.Errorf(ctx, "Unable to commit send tx: %v", err)
+		return err
 	}
 
-	log.Infof(ctx, "sendPhaseNotificationsToFCM(..., %q, %v, %v, %q, %+v) *** SUCCESS ***", host, gameID, phaseOrdinal, userId, finishedTokens)
+	log.Infof(ctx, "sendPhaseNotificationsToUsers(..., %q, %v, %v, %+v) *** SUCCESS ***", host, gameID, phaseOrdinal, uids)
 
 	return nil
 }
 
-func sendPhaseNotificationsToUsers(ctx context.Context, host string, gameID *datastore.Key, phaseOrdinal int64, origUids []string) error {
-	log.Infof(ctx, "sendPhaseNotificationsToUsers(..., %q, %v, %v, %+v)", host, gameID, phaseOrdinal, origUids)
+func sendPhaseMailNotificationsToUsers(ctx context.Context, host string, gameID *datastore.Key, phaseOrdinal int64, origUids []string) error {
+	log.Infof(ctx, "sendPhaseMailNotificationsToUsers(..., %q, %v, %v, %+v)", host, gameID, phaseOrdinal, origUids)
 
 	if len(origUids) == 0 {
-		log.Infof(ctx, "sendPhaseNotificationsToUsers(..., %q, %v, %v, %+v) *** NO UIDS ***", host, gameID, phaseOrdinal, origUids)
+		log.Infof(ctx, "sendPhaseMailNotificationsToUsers(..., %q, %v, %v, %+v) *** NO UIDS ***", host, gameID, phaseOrdinal, origUids)
 		return nil
 	}
 	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
 		uids := make([]string, len(origUids))
 		copy(uids, origUids)
-		for i := 0; i < 2 && len(uids) > 0; i++ {
+		for i := 0; i < 4 && len(uids) > 0; i++ {
 			nextUid := uids[0]
 			uids = uids[1:]
-			if err := sendPhaseNotificationsToFCMFunc.EnqueueIn(ctx, 0, host, gameID, phaseOrdinal, nextUid, map[string]struct{}{}); err != nil {
-				log.Errorf(ctx, "Unable to enqueue sending to %q: %v; hope datastore gets fixed", nextUid, err)
-				return err
-			}
 			if err := sendPhaseNotificationsToMailFunc.EnqueueIn(ctx, 0, host, gameID, phaseOrdinal, nextUid); err != nil {
 				log.Errorf(ctx, "Unable to enqueue sending mail to %q: %v; hope datastore gets fixed", nextUid, err)
 				return err
 			}
 		}
 		if len(uids) > 0 {
-			if err := sendPhaseNotificationsToUsersFunc.EnqueueIn(ctx, 0, host, gameID, phaseOrdinal, uids); err != nil {
+			if err := sendPhaseMailNotificationsToUsersFunc.EnqueueIn(ctx, 0, host, gameID, phaseOrdinal, uids); err != nil {
 				log.Errorf(ctx, "Unable to enqueue sending to rest: %v; hope datastore gets fixed", err)
 				return err
 			}
@@ -426,7 +500,7 @@ func sendPhaseNotificationsToUsers(ctx context.Context, host string, gameID *dat
 		return err
 	}
 
-	log.Infof(ctx, "sendPhaseNotificationsToUsers(..., %q, %v, %v, %+v) *** SUCCESS ***", host, gameID, phaseOrdinal, origUids)
+	log.Infof(ctx, "sendPhaseMailNotificationsToUsers(..., %q, %v, %v, %+v) *** SUCCESS ***", host, gameID, phaseOrdinal, origUids)
 
 	return nil
 }
@@ -496,6 +570,15 @@ func sendPhaseDeadlineWarning(ctx context.Context, gameID *datastore.Key, phaseO
 	log.Infof(ctx, "Found member %+v", member)
 
 	if member.User.Id != "" && !game.Finished && !phase.Resolved && !member.NewestPhaseState.ReadyToResolve {
+		gameState, err := loadMemberGameState(ctx, gameID, member.Nation)
+		if err != nil {
+			log.Errorf(ctx, "Unable to load game state of %v in %v: %v; hope datastore gets fixed", member.Nation, gameID, err)
+			return err
+		}
+		if gameState.NotificationSettings.MuteDeadlineReminders {
+			log.Infof(ctx, "%v has muted deadline reminders for %v, skipping", member.Nation, gameID)
+			return nil
+		}
 		userConfigKey := auth.UserConfigID(ctx, auth.UserID(ctx, member.User.Id))
 		userConfig := &auth.UserConfig{}
 		if err := datastore.Get(ctx, userConfigKey, userConfig); err == datastore.ErrNoSuchEntity {
@@ -508,6 +591,11 @@ func sendPhaseDeadlineWarning(ctx context.Context, gameID *datastore.Key, phaseO
 		sendAt := phase.DeadlineAt.Add(-time.Minute * time.Duration(userConfig.PhaseDeadlineWarningMinutesAhead))
 		now := time.Now()
 		if sendAt.Before(now) {
+			// Scheduled before the message, since the reminders are only ever scheduled once even if this task is retried.
+			if err := scheduleDeadlineReminders(ctx, phaseID, member); err != nil {
+				log.Errorf(ctx, "scheduleDeadlineReminders(..., %v, %+v): %v; hope datastore gets fixed", phaseID, member, err)
+				return err
+			}
 			newMessage := &Message{
 				GameID:         gameID,
 				ChannelMembers: Nations{godip.Nation(nation), DiplicitySender},
@@ -570,7 +658,7 @@ func planPhaseTimeout(ctx context.Context, gameID *datastore.Key, phaseOrdinal i
 
 	userConfigKeys := []*datastore.Key{}
 	for _, member := range game.Members {
-		if member.User.Id != "" && !member.NewestPhaseState.Eliminated {
+		if !member.Vacant() && !member.NewestPhaseState.Eliminated {
 			userConfigKeys = append(userConfigKeys, auth.UserConfigID(ctx, auth.UserID(ctx, member.User.Id)))
 		}
 	}
@@ -645,6 +733,11 @@ func resolvePhaseHelper(ctx context.Context, gameID *datastore.Key, phaseOrdinal
 		}
 		game.ID = gameID
 
+		if game.Replay {
+			log.Infof(ctx, "%v is a replay, and replays are never resolved", gameID)
+			return nil
+		}
+
 		phaseStates := PhaseStates{}
 
 		if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &phaseStates); err != nil {
@@ -697,7 +790,8 @@ func (p *PhaseResolver) delayForMissingMembers() (bool, error) {
 	allMembers := sort.StringSlice{}
 	for _, member := range p.Game.Members {
 		allMembers = append(allMembers, string(member.Nation))
-		if member.User.Id == "" {
+		// Abandoned nations are in civil disorder, and don't hold up the game.
+		if member.User.Id == "" && !member.Abandoned {
 			missingMembers = append(missingMembers, string(member.Nation))
 		}
 	}
@@ -771,16 +865,30 @@ func (p *PhaseResolver) Act() error {
 
 	// Sanity check time and resolution status of the phase.
 
-	if p.TimeoutTriggered && p.Phase.DeadlineAt.After(time.Now()) {
-		log.Infof(p.Context, "Resolution postponed to %v by %v; rescheduling task", p.Phase.DeadlineAt, PP(p.Phase))
-		return p.Phase.ScheduleResolution(p.Context)
-	}
-
 	if p.Phase.Resolved {
 		log.Infof(p.Context, "Already resolved; %v; skipping resolution", PP(p.Phase))
 		return nil
 	}
 
+	if p.Game.Paused {
+		log.Infof(p.Context, "%v is paused since %v; skipping resolution until it's resumed", p.Game.ID, p.Game.PausedAt)
+		return nil
+	}
+
+	// Resolve before the deadline only if everyone not eliminated is ready.
+	allReadyToResolve := p.PhaseStates.AllReadyToResolve(p.Variant.Nations)
+	if p.TimeoutTriggered && p.Phase.DeadlineAt.After(time.Now()) {
+		if !allReadyToResolve {
+			log.Infof(p.Context, "Resolution postponed to %v by %v; rescheduling task", p.Phase.DeadlineAt, PP(p.Phase))
+			return p.Phase.ScheduleResolution(p.Context)
+		}
+		log.Infof(p.Context, "Resolving %v before the deadline, since all nations are ready", PP(p.Phase))
+	}
+	if !p.TimeoutTriggered && !allReadyToResolve {
+		log.Infof(p.Context, "Not all nations in %v are ready to resolve any more; skipping early resolution", PP(p.PhaseStates))
+		return nil
+	}
+
 	// Check that all players are "real" players and not empty places after GM kicked someone.
 	delayed, err := p.delayForMissingMembers()
 	if err != nil {
@@ -810,7 +918,9 @@ func (p *PhaseResolver) Act() error {
 				log.Errorf(p.Context, err.Error())
 				return err
 			}
-			nonEliminatedUserIds[member.User.Id] = true
+			if !member.Vacant() {
+				nonEliminatedUserIds[member.User.Id] = true
+			}
 		}
 		p.PhaseStates[i].ZippedOptions = nil
 		phaseStateID, err := p.PhaseStates[i].ID(p.Context)
@@ -836,11 +946,12 @@ func (p *PhaseResolver) Act() error {
 
 	log.Infof(p.Context, "PhaseStates at resolve time: %v", PP(p.PhaseStates))
 
-	orderMap, err := p.Phase.Orders(p.Context)
+	orders, err := p.Phase.loadOrders(p.Context)
 	if err != nil {
-		log.Errorf(p.Context, "Unable to load orders for %v: %v; fix phase.Orders or hope datastore will get fixed", PP(p.Phase), err)
+		log.Errorf(p.Context, "Unable to load orders for %v: %v; fix phase.loadOrders or hope datastore will get fixed", PP(p.Phase), err)
 		return err
 	}
+	orderMap := orderMapOf(applyOrderConditions(orders))
 	log.Infof(p.Context, "Orders at resolve time: %v", PP(orderMap))
 
 	s, err := p.Phase.State(p.Context, p.Variant, orderMap)
@@ -890,6 +1001,14 @@ func (p *PhaseResolver) Act() error {
 		newPhase.DeadlineAt = newPhase.CreatedAt.Add(time.Minute * p.Game.PhaseLengthMinutes)
 	}
 
+	// Give the orders of the conditions triggered by the resolution.
+
+	conditionalOrdersApplied, err := applyDislodgedConditions(p.Context, orders, newPhase, p.Game.Variant, s)
+	if err != nil {
+		log.Errorf(p.Context, "Unable to apply the Dislodged conditions of %v: %v; hope datastore gets fixed", PP(p.Phase), err)
+		return err
+	}
+
 	// Check if we can roll forward again, and potentially create new phase states.
 
 	// Prepare some data to collect.
@@ -904,6 +1023,8 @@ func (p *PhaseResolver) Act() error {
 		GameID:       p.Phase.GameID,
 		PhaseOrdinal: p.Phase.PhaseOrdinal,
 		Private:      p.Game.Private,
+		CreatedAt:    p.Phase.ResolvedAt,
+		PhaseType:    p.Phase.Type,
 	}
 	membersWithOptions := map[string]bool{} // All user Ids with order options.
 
@@ -917,9 +1038,13 @@ func (p *PhaseResolver) Act() error {
 		wantedConcede := false
 		wasOnProbation := false
 		wasEliminated := false
+		hadToOrder := false
+		var readyAt time.Time
 		for _, phaseState := range p.PhaseStates {
 			if phaseState.Nation == member.Nation {
+				hadToOrder = !phaseState.NoOrders && !phaseState.Eliminated
 				wasReady = phaseState.ReadyToResolve
+				readyAt = phaseState.ReadyAt
 				wantedDIAS = phaseState.WantsDIAS
 				wantedConcede = phaseState.WantsConcede
 				if phaseState.WantsDIAS {
@@ -939,9 +1064,17 @@ func (p *PhaseResolver) Act() error {
 				break
 			}
 		}
+		// Nations that had units to order but gave no orders were in civil disorder this phase.
+		if hadToOrder && !hadOrders {
+			member.CivilDisorderPhases++
+		}
 		orderOptions := s.Phase().Options(s, member.Nation)
 		newOptionsCount := len(orderOptions)
-		if newOptionsCount > 0 {
+		// Members whose every unit needing an order got one from a conditional order don't have to do anything.
+		coveredByConditionals := optionsCovered(orderOptions, conditionalOrdersApplied[member.Nation])
+		// Abandoned nations are in civil disorder until a replacement joins.
+		hasUser := !member.Vacant()
+		if newOptionsCount > 0 && hasUser {
 			membersWithOptions[member.User.Id] = true
 		}
 		if scCounts[member.Nation] == 0 {
@@ -957,7 +1090,7 @@ func (p *PhaseResolver) Act() error {
 		}
 
 		// Log what we're doing.
-		stateString := fmt.Sprintf("wasReady = %v, wantedDIAS = %v, wantedConcede = %v, onProbation = %v, hadOrders = %v, newOptionsCount = %v, wasEliminated = %v", wasReady, wantedDIAS, wantedConcede, wasOnProbation, hadOrders, newOptionsCount, wasEliminated)
+		stateString := fmt.Sprintf("wasReady = %v, wantedDIAS = %v, wantedConcede = %v, onProbation = %v, hadOrders = %v, newOptionsCount = %v, coveredByConditionals = %v, wasEliminated = %v", wasReady, wantedDIAS, wantedConcede, wasOnProbation, hadOrders, newOptionsCount, coveredByConditionals, wasEliminated)
 		log.Infof(p.Context, "%v at phase change: %s", member.Nation, stateString)
 
 		// Calculate states for next phase.
@@ -968,15 +1101,17 @@ func (p *PhaseResolver) Act() error {
 		// (i.e. even someone who is ready to resolve can be on probation)
 		// A player should not be on probation once they've been eliminated from the game.
 		autoProbation := (wasOnProbation || (!hadOrders && !wasReady)) && !wasEliminated
-		if autoProbation {
+		if autoProbation && hasUser {
 			probationaries = append(probationaries, member.User.Id)
 		}
-		autoReady := newOptionsCount == 0 || autoProbation
+		autoReady := newOptionsCount == 0 || autoProbation || coveredByConditionals
 		autoDIAS := wantedDIAS || autoProbation
 		allReady = allReady && autoReady
 
 		// Update the old phase result object.
-		if autoProbation {
+		if !hasUser {
+			// Nobody to count anything for.
+		} else if autoProbation {
 			// Users on probation get an NMR count.
 			oldPhaseResult.NMRUsers = append(oldPhaseResult.NMRUsers, member.User.Id)
 		} else if wasReady {
@@ -986,6 +1121,13 @@ func (p *PhaseResolver) Act() error {
 			// Users having orders, but not marked as ready to resolve, get an active count.
 			oldPhaseResult.ActiveUsers = append(oldPhaseResult.ActiveUsers, member.User.Id)
 		}
+		// Users declaring ready in phases that didn't have to wait for the deadline get a response time sample.
+		if hasUser && !p.TimeoutTriggered && wasReady && !readyAt.IsZero() && !readyAt.Before(p.Phase.CreatedAt) {
+			oldPhaseResult.ResponseTimes = append(oldPhaseResult.ResponseTimes, ResponseTime{
+				UserId:  member.User.Id,
+				Minutes: readyAt.Sub(p.Phase.CreatedAt).Minutes(),
+			})
+		}
 
 		// Overwrite DIAS but not eliminated with NMR.
 		if q := quitters[member.Nation]; autoProbation && q.state != eliminatedState {
@@ -1017,24 +1159,27 @@ func (p *PhaseResolver) Act() error {
 
 		member.NewestPhaseState = *newPhaseState
 		newPhaseStates = append(newPhaseStates, *newPhaseState)
-		oldPhaseResult.AllUsers = append(oldPhaseResult.AllUsers, member.User.Id)
+		if hasUser {
+			oldPhaseResult.AllUsers = append(oldPhaseResult.AllUsers, member.User.Id)
+		}
 	}
 
 	log.Infof(p.Context, "Calculated key metrics: allReady: %v, soloWinner: %q, quitters: %v", allReady, soloWinner, PP(quitters))
 
 	// Check if the game should end.
 
-	finishGame := func() {
+	finishGame := func(conceded bool) {
 		// Just to ensure we don't try to resolve it again, even by mistake.
 		newPhase.Resolved = true
 		newPhase.ResolvedAt = time.Now()
 		p.Game.Finished = true
 		p.Game.FinishedAt = time.Now()
 		p.Game.Closed = true
+		p.Game.ResultType = gameResultType(soloWinner, conceded)
 	}
 	if soloWinner != "" || len(quitters) == len(p.Variant.Nations) || (p.Game.LastYear != 0 && newPhase.Year > p.Game.LastYear) {
 		log.Infof(p.Context, "soloWinner: %q, quitters: %v, lastYear: %v => game needs to end", soloWinner, PP(quitters), p.Game.LastYear)
-		finishGame()
+		finishGame(false)
 	} else if len(p.Variant.Nations) == 2 && len(conceders) == 1 {
 		log.Infof(p.Context, "variant nations: 2, conceders: %v => game needs to end", PP(conceders))
 		for _, member := range p.Game.Members {
@@ -1045,11 +1190,19 @@ func (p *PhaseResolver) Act() error {
 				break
 			}
 		}
-		finishGame()
+		finishGame(true)
 	}
 
 	// Save the old phase result.
 
+	// The message counts are only statistics, so failing to count them mustn't stop the phase from resolving.
+	phaseMessages := Messages{}
+	if _, err := datastore.NewQuery(messageKind).Ancestor(p.Phase.GameID).Filter("CreatedAt>=", p.Phase.CreatedAt).GetAll(p.Context, &phaseMessages); err != nil {
+		log.Warningf(p.Context, "Unable to load messages sent during %v: %v; will save the phase result without message counts", PP(p.Phase.PhaseMeta), err)
+	} else {
+		oldPhaseResult.MessagesSent = countMessagesSent(phaseMessages, p.Phase.CreatedAt, time.Now())
+	}
+
 	if err := oldPhaseResult.Save(p.Context); err != nil {
 		log.Errorf(p.Context, "Unable to save old phase result %v: %v; hope datastore gets fixed", PP(oldPhaseResult), err)
 		return err
@@ -1089,13 +1242,26 @@ func (p *PhaseResolver) Act() error {
 			switch state {
 			case nmrState:
 				nmrMembers = append(nmrMembers, member.Nation)
-				nmrUsers = append(nmrUsers, member.User.Id)
 			case eliminatedState:
 				eliminatedMembers = append(eliminatedMembers, member.Nation)
-				eliminatedUsers = append(eliminatedUsers, member.User.Id)
 			default:
 				if soloWinner == "" {
 					diasMembers = append(diasMembers, member.Nation)
+				}
+			}
+
+			// Abandoned nations nobody took over don't have anyone to score.
+			if member.Abandoned {
+				continue
+			}
+
+			switch state {
+			case nmrState:
+				nmrUsers = append(nmrUsers, member.User.Id)
+			case eliminatedState:
+				eliminatedUsers = append(eliminatedUsers, member.User.Id)
+			default:
+				if soloWinner == "" {
 					diasUsers = append(diasUsers, member.User.Id)
 				}
 			}
@@ -1131,6 +1297,7 @@ func (p *PhaseResolver) Act() error {
 			GameID:            p.Game.ID,
 			SoloWinnerMember:  soloWinner,
 			SoloWinnerUser:    soloWinnerUser,
+			ResultType:        p.Game.ResultType,
 			DIASMembers:       diasMembers,
 			DIASUsers:         diasUsers,
 			NMRMembers:        nmrMembers,
@@ -1230,6 +1397,10 @@ func (p *PhaseResolver) Act() error {
 		log.Errorf(p.Context, "Unable to enqueue notification to game members: %v; hope datastore will get fixed", err)
 		return err
 	}
+	if err := enqueuePhaseWebhook(p.Context, p.Game.ID, p.Phase.PhaseOrdinal); err != nil {
+		log.Errorf(p.Context, "Unable to enqueue delivery to the webhook of the game: %v; hope datastore will get fixed", err)
+		return err
+	}
 
 	if p.Game.Finished {
 
@@ -1254,9 +1425,11 @@ func (p *PhaseResolver) Act() error {
 
 		// Enqueue updating of user stats (for NMR/NonNMR purposes).
 
-		uids := make([]string, len(p.Game.Members))
-		for i, m := range p.Game.Members {
-			uids[i] = m.User.Id
+		uids := []string{}
+		for _, m := range p.Game.Members {
+			if m.User.Id != "" {
+				uids = append(uids, m.User.Id)
+			}
 		}
 		if err := UpdateUserStatsASAP(p.Context, uids); err != nil {
 			log.Errorf(p.Context, "Unable to enqueue user stats update tasks: %v; hope datastore gets fixed", err)
@@ -1274,6 +1447,13 @@ func (p *PhaseResolver) Act() error {
 		}
 	}
 
+	// Draw and concession votes are for the board they were made on, unless the game keeps them.
+
+	if !p.Game.StickyDrawVotes {
+		p.Game.DrawVotes = nil
+		p.Game.ConcessionVotes = nil
+	}
+
 	if err := p.Game.DBSave(p.Context); err != nil {
 		log.Errorf(p.Context, "Unable to save game %v: %v; hope datastore will get fixed", PP(p.Game), err)
 		return err
@@ -1580,6 +1760,7 @@ type PhaseMeta struct {
 	NextDeadlineIn time.Duration `datastore:"-" ticker:"true"`
 	UnitsJSON      string        `datastore:",noindex"`
 	SCsJSON        string        `datastore:",noindex"`
+	Extensions     int           // How many times the deadline has been extended by vote.
 }
 
 func (p *PhaseMeta) Refresh() {
@@ -1721,17 +1902,33 @@ func devResolvePhaseTimeout(w ResponseWriter, r Request) error {
 		return err
 	}
 
+	game := &Game{}
 	phase := &Phase{}
-	if err := datastore.Get(ctx, phaseID, phase); err != nil {
+	if err := datastore.GetMulti(ctx, []*datastore.Key{gameID, phaseID}, []interface{}{game, phase}); err != nil {
 		return err
 	}
 
-	phase.DeadlineAt = time.Now()
-	if _, err := datastore.Put(ctx, phaseID, phase); err != nil {
+	if game.Paused {
+		return HTTPErr{"game is paused", http.StatusPreconditionFailed}
+	}
+
+	phaseStates := PhaseStates{}
+	if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &phaseStates); err != nil {
 		return err
 	}
 
-	for err = timeoutResolvePhase(ctx, gameID, phaseOrdinal); err == datastore.ErrConcurrentTransaction; err = timeoutResolvePhase(ctx, gameID, phaseOrdinal) {
+	// If everyone is ready anyway, resolve the phase the same way as when the last member declares ready.
+	resolve := timeoutResolvePhase
+	if phaseStates.AllReadyToResolve(variants.Variants[game.Variant].Nations) {
+		resolve = asyncResolvePhase
+	} else {
+		phase.DeadlineAt = time.Now()
+		if _, err := datastore.Put(ctx, phaseID, phase); err != nil {
+			return err
+		}
+	}
+
+	for err = resolve(ctx, gameID, phaseOrdinal); err == datastore.ErrConcurrentTransaction; err = resolve(ctx, gameID, phaseOrdinal) {
 		time.Sleep(time.Second)
 	}
 	return err
@@ -1766,6 +1963,9 @@ func loadPhase(w ResponseWriter, r Request) (*Phase, error) {
 		return nil, err
 	}
 	game.ID = gameID
+	if err := game.delayPhaseFor(user.Id, phase); err != nil {
+		return nil, err
+	}
 	phase.Refresh()
 	phase.Score(variants.Variants[game.Variant].Nations)
 
@@ -1794,11 +1994,26 @@ func (p *Phase) Item(r Request) *Item {
 			RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
 		}))
 	}
+	if isMember {
+		phaseItem.AddLink(r.NewLink(Link{
+			Rel:         "order-revisions",
+			Route:       ListOrderRevisionsRoute,
+			RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
+		}))
+	}
 	phaseItem.AddLink(r.NewLink(Link{
 		Rel:         "corroborate",
 		Route:       CorroboratePhaseRoute,
 		RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
 	}))
+	if isMember && p.PhaseOrdinal > 1 {
+		phaseItem.AddLink(r.NewLink(Link{
+			Rel:         "options-diff",
+			Route:       GetOptionsDiffRoute,
+			RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
+			QueryParams: url.Values{"from": []string{fmt.Sprint(p.PhaseOrdinal - 1)}},
+		}))
+	}
 	if isMember && !p.Resolved {
 		phaseItem.AddLink(r.NewLink(Link{
 			Rel:         "options",
@@ -1812,6 +2027,24 @@ func (p *Phase) Item(r Request) *Item {
 			Route:       CreateAndCorroborateRoute,
 			RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
 		}))
+		phaseItem.AddLink(r.NewLink(Link{
+			Rel:         "replace-orders",
+			Method:      "PUT",
+			Route:       ReplaceOrdersRoute,
+			RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
+		}))
+		phaseItem.AddLink(r.NewLink(Link{
+			Rel:         "validate-orders",
+			Method:      "POST",
+			Route:       ValidateOrdersRoute,
+			RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
+		}))
+		phaseItem.AddLink(r.NewLink(Link{
+			Rel:         "dry-run",
+			Method:      "POST",
+			Route:       DryRunPhaseRoute,
+			RouteParams: []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)},
+		}))
 	}
 	if isMember || p.Resolved {
 		phaseItem.AddLink(r.NewLink(Link{
@@ -1923,11 +2156,66 @@ func listOptions(w ResponseWriter, r Request) error {
 		return HTTPErr{"can only load options for member games", http.StatusNotFound}
 	}
 
-	phaseStateID, err := PhaseStateID(ctx, phaseID, member.Nation)
+	options, err := memberOptions(ctx, game, phase, member)
 	if err != nil {
 		return err
 	}
 
+	w.SetContent(NewItem(options).SetName("options").SetDesc([][]string{
+		[]string{
+			"Options explained",
+			"The options consist of a decision tree where each node represents a decision a player has to make when defining an order.",
+			"Each child set contains one or more alternatives of the same decision type, viz. `Province`, `OrderType`, `UnitType` or `SrcProvince`.",
+			"To guide the player towards defining an order, present the alternatives for each node, then the sub tree pointed to by `Next`, etc. until a leaf node is reached.",
+			"When a leaf is reached, the value nodes between root and leaf contain the list of strings defining an order the server will understand.",
+		},
+		[]string{
+			"Province",
+			"`Province` decisions represent picking a province from the game map.",
+			"The children of the root of the options tree indicate that the user needs to select which province to define an order for.",
+			"The first `Province` option just indicates which province the order is meant for.",
+		},
+		[]string{
+			"OrderType",
+			"`OrderType` decisions represent picking a type of order for a province.",
+		},
+		[]string{
+			"UnitType",
+			"`UnitType` decisions represent picking a type of unit for an order.",
+		},
+		[]string{
+			"SrcProvince",
+			"`SrcProvince` indicates that the value should replace the first `Province` value in the order list without presenting the player with a choice.",
+			"This is useful e.g. when the order has a coast as source province, but the click should be accepted in the entire province.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       ListOptionsRoute,
+		RouteParams: []string{"game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phaseOrdinal)},
+	})))
+
+	return nil
+}
+
+// memberOptions returns the options of member in phase, from memcache or the phase state if they are pre-cooked there,
+// otherwise generated and saved in the phase state for the future.
+func memberOptions(ctx context.Context, game *Game, phase *Phase, member *Member) (interface{}, error) {
+	return cachedOptions(ctx, memcacheOptionsCache{ctx}, optionsCacheKey(game.ID.Encode(), phase, member.Nation), func() (interface{}, error) {
+		return loadMemberOptions(ctx, game, phase, member)
+	})
+}
+
+func loadMemberOptions(ctx context.Context, game *Game, phase *Phase, member *Member) (interface{}, error) {
+	phaseID, err := phase.ID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	phaseStateID, err := PhaseStateID(ctx, phaseID, member.Nation)
+	if err != nil {
+		return nil, err
+	}
+
 	var options interface{}
 
 	// First try to load pre-cooked options.
@@ -1935,10 +2223,10 @@ func listOptions(w ResponseWriter, r Request) error {
 	phaseState := &PhaseState{}
 	if err := datastore.Get(ctx, phaseStateID, phaseState); err == datastore.ErrNoSuchEntity {
 		phaseState.GameID = game.ID
-		phaseState.PhaseOrdinal = phaseOrdinal
+		phaseState.PhaseOrdinal = phase.PhaseOrdinal
 		phaseState.Nation = member.Nation
 	} else if err != nil {
-		return err
+		return nil, err
 	} else {
 		options, err = unzipOptions(ctx, phaseState.ZippedOptions)
 		if err != nil {
@@ -1951,7 +2239,7 @@ func listOptions(w ResponseWriter, r Request) error {
 	if options == nil {
 		state, err := phase.State(ctx, variants.Variants[game.Variant], nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		options = state.Phase().Options(state, member.Nation)
@@ -1965,50 +2253,17 @@ func listOptions(w ResponseWriter, r Request) error {
 		log.Warningf(ctx, "Found PhaseState without ZippedOptions! Saving the generated options.")
 		zippedOptions, err := zipOptions(ctx, options)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		phaseState.ZippedOptions = zippedOptions
 		if _, err := datastore.Put(ctx, phaseStateID, phaseState); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	w.SetContent(NewItem(options).SetName("options").SetDesc([][]string{
-		[]string{
-			"Options explained",
-			"The options consist of a decision tree where each node represents a decision a player has to make when defining an order.",
-			"Each child set contains one or more alternatives of the same decision type, viz. `Province`, `OrderType`, `UnitType` or `SrcProvince`.",
-			"To guide the player towards defining an order, present the alternatives for each node, then the sub tree pointed to by `Next`, etc. until a leaf node is reached.",
-			"When a leaf is reached, the value nodes between root and leaf contain the list of strings defining an order the server will understand.",
-		},
-		[]string{
-			"Province",
-			"`Province` decisions represent picking a province from the game map.",
-			"The children of the root of the options tree indicate that the user needs to select which province to define an order for.",
-			"The first `Province` option just indicates which province the order is meant for.",
-		},
-		[]string{
-			"OrderType",
-			"`OrderType` decisions represent picking a type of order for a province.",
-		},
-		[]string{
-			"UnitType",
-			"`UnitType` decisions represent picking a type of unit for an order.",
-		},
-		[]string{
-			"SrcProvince",
-			"`SrcProvince` indicates that the value should replace the first `Province` value in the order list without presenting the player with a choice.",
-			"This is useful e.g. when the order has a coast as source province, but the click should be accepted in the entire province.",
-		},
-	}).AddLink(r.NewLink(Link{
-		Rel:         "self",
-		Route:       ListOptionsRoute,
-		RouteParams: []string{"game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phaseOrdinal)},
-	})))
-
-	return nil
+	return options, nil
 }
 
-func (p *Phase) Orders(ctx context.Context) (map[godip.Nation]map[godip.Province][]string, error) {
+func (p *Phase) loadOrders(ctx context.Context) ([]Order, error) {
 	phaseID, err := PhaseID(ctx, p.GameID, p.PhaseOrdinal)
 	if err != nil {
 		return nil, err
@@ -2018,7 +2273,21 @@ func (p *Phase) Orders(ctx context.Context) (map[godip.Nation]map[godip.Province
 	if _, err := datastore.NewQuery(orderKind).Ancestor(phaseID).GetAll(ctx, &orders); err != nil {
 		return nil, err
 	}
+	return orders, nil
+}
 
+// Orders returns the orders as given, without applying their conditions. Only resolving the phase applies them,
+// since which conditions matched reveals the orders of other nations.
+func (p *Phase) Orders(ctx context.Context) (map[godip.Nation]map[godip.Province][]string, error) {
+	orders, err := p.loadOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return orderMapOf(orders), nil
+}
+
+// orderMapOf returns the parts of the orders, grouped by nation and source province, as parsed by godip.
+func orderMapOf(orders []Order) map[godip.Nation]map[godip.Province][]string {
 	orderMap := map[godip.Nation]map[godip.Province][]string{}
 	for _, order := range orders {
 		nationMap, found := orderMap[order.Nation]
@@ -2028,8 +2297,7 @@ func (p *Phase) Orders(ctx context.Context) (map[godip.Nation]map[godip.Province
 		}
 		nationMap[godip.Province(order.Parts[0])] = order.Parts[1:]
 	}
-
-	return orderMap, nil
+	return orderMap
 }
 
 func (p *Phase) State(ctx context.Context, variant vrt.Variant, orderMap map[godip.Nation]map[godip.Province][]string) (*state.State, error) {
@@ -2114,6 +2382,9 @@ func renderPhaseMap(w ResponseWriter, r Request) error {
 		}
 	}
 	game.ID = gameID
+	if err := game.delayPhaseFor(user.Id, phase); err != nil {
+		return err
+	}
 
 	var nation godip.Nation
 
@@ -2216,6 +2487,129 @@ func corroboratePhase(w ResponseWriter, r Request) error {
 	return nil
 }
 
+type DryRunResponse struct {
+	Orders        Orders
+	Resolutions   []Resolution
+	ForceDisbands []godip.Province
+	// Phase is the phase that would follow if only the dry run orders were given, with the resulting units, dislodgeds and bounces.
+	Phase *Phase
+}
+
+func (d *DryRunResponse) Item(r Request, gameID *datastore.Key, phaseOrdinal int64) *Item {
+	return NewItem(d).SetName("dry-run").AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       DryRunPhaseRoute,
+		RouteParams: []string{"game_id", gameID.Encode(), "phase_ordinal", fmt.Sprint(phaseOrdinal)},
+	})).SetDesc([][]string{
+		[]string{
+			"Dry run",
+			"Shows how the phase would resolve if the given orders were the only orders given. All other units get their default orders, since the orders of other members are secret until the phase resolves. Nothing is saved.",
+		},
+	})
+}
+
+/*
+ * dryRunPhase adjudicates a candidate set of orders for the units of the requesting member,
+ * without saving anything.
+ */
+func dryRunPhase(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	phaseOrdinal, err := strconv.ParseInt(r.Vars()["phase_ordinal"], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	phase := &Phase{}
+	if err := datastore.GetMulti(ctx, []*datastore.Key{gameID, phaseID}, []interface{}{game, phase}); err != nil {
+		return err
+	}
+	game.ID = gameID
+
+	if !game.Mustered {
+		return HTTPErr{"can only dry run orders for mustered games", http.StatusPreconditionFailed}
+	}
+	if phase.Resolved {
+		return HTTPErr{"can only dry run orders for unresolved phases", http.StatusPreconditionFailed}
+	}
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if !isMember {
+		return HTTPErr{"can only dry run orders for member games", http.StatusNotFound}
+	}
+
+	request := &struct {
+		Orders Orders
+	}{}
+	if err := json.NewDecoder(r.Req().Body).Decode(request); err != nil {
+		return HTTPErr{fmt.Sprintf("unable to parse orders: %v", err), http.StatusBadRequest}
+	}
+	response := &DryRunResponse{}
+	for _, order := range request.Orders {
+		if len(order.Parts) == 0 {
+			return HTTPErr{"orders must have parts", http.StatusBadRequest}
+		}
+		response.Orders = append(response.Orders, Order{
+			GameID:       gameID,
+			PhaseOrdinal: phaseOrdinal,
+			Nation:       member.Nation,
+			Parts:        order.Parts,
+			Conditions:   order.Conditions,
+		})
+	}
+	// Only the dry run orders are known, so conditions on the units of other nations match holding units.
+	orderPartsByProvince := map[godip.Province][]string{}
+	for _, order := range applyOrderConditions(response.Orders) {
+		orderPartsByProvince[godip.Province(order.Parts[0])] = order.Parts[1:]
+	}
+
+	variant := variants.Variants[game.Variant]
+	s, err := phase.State(ctx, variant, map[godip.Nation]map[godip.Province][]string{
+		member.Nation: orderPartsByProvince,
+	})
+	if err != nil {
+		return HTTPErr{fmt.Sprintf("unable to parse orders: %v", err), http.StatusBadRequest}
+	}
+	for prov, order := range s.Orders() {
+		if nation, err := order.Validate(s); err == nil && nation != member.Nation {
+			return HTTPErr{fmt.Sprintf("can only dry run orders for %v, not for %v in %v", member.Nation, nation, prov), http.StatusForbidden}
+		}
+	}
+	if err := s.Next(); err != nil {
+		return err
+	}
+
+	for prov, err := range s.Resolutions() {
+		if err == nil {
+			response.Resolutions = append(response.Resolutions, Resolution{prov, "OK"})
+		} else {
+			response.Resolutions = append(response.Resolutions, Resolution{prov, err.Error()})
+		}
+	}
+	for prov := range s.ForceDisbands() {
+		response.ForceDisbands = append(response.ForceDisbands, prov)
+	}
+	response.Phase = NewPhase(s, gameID, phaseOrdinal+1, r.Req().Host)
+
+	w.SetContent(response.Item(r, gameID, phaseOrdinal))
+	return nil
+}
+
 func listPhases(w ResponseWriter, r Request) error {
 	ctx := appengine.NewContext(r.Req())
 
@@ -2243,6 +2637,15 @@ func listPhases(w ResponseWriter, r Request) error {
 	if err != nil {
 		return err
 	}
+	if cutoff, delayed := game.nonMemberCutoff(user.Id, time.Now()); delayed {
+		visible := Phases{}
+		for _, phase := range phases {
+			if phase.delayTo(cutoff) {
+				visible = append(visible, phase)
+			}
+		}
+		phases = visible
+	}
 	for i := range phases {
 		phases[i].Refresh()
 		phases[i].Score(variants.Variants[game.Variant].Nations)
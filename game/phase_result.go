@@ -1,10 +1,14 @@
 package game
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
+	"github.com/zond/godip"
 	"golang.org/x/net/context"
 	"google.golang.org/appengine/v2"
 	"google.golang.org/appengine/v2/datastore"
@@ -25,6 +29,83 @@ type PhaseResult struct {
 	ReadyUsers   []string
 	AllUsers     []string
 	Private      bool
+	// MessagesSent counts the messages each nation sent during the phase, including messages to members that muted them.
+	MessagesSent     map[godip.Nation]int `datastore:"-"`
+	MessagesSentJSON string               `datastore:",noindex" json:"-"`
+	// ResponseTimes contains how long each user took to declare ready, only for phases not resolved on timeout.
+	ResponseTimes []ResponseTime
+	// CreatedAt is when the phase resolved, zero for phases resolved before it was recorded.
+	CreatedAt time.Time
+	// PhaseType is the type of the phase, empty for phases resolved before it was recorded.
+	PhaseType godip.PhaseType
+}
+
+// ResponseTime is how many minutes after the start of a phase a user declared ready to resolve it.
+type ResponseTime struct {
+	UserId  string
+	Minutes float64 `datastore:",noindex"`
+}
+
+// averageResponseMinutes returns the average response time of the user in the phase results, and the number of samples.
+func averageResponseMinutes(phaseResults []PhaseResult, userId string) (float64, int) {
+	sum := 0.0
+	count := 0
+	for _, phaseResult := range phaseResults {
+		for _, responseTime := range phaseResult.ResponseTimes {
+			if responseTime.UserId == userId {
+				sum += responseTime.Minutes
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return sum / float64(count), count
+}
+
+// PhaseTypeResponseTime is the average response time of a user in phases of one type.
+type PhaseTypeResponseTime struct {
+	PhaseType              godip.PhaseType
+	AverageResponseMinutes float64
+	SampleCount            int
+}
+
+// responseMinutesByPhaseType returns the average response times of the user in the phase results per phase type, sorted by phase type.
+// Phase results without a phase type are skipped.
+func responseMinutesByPhaseType(phaseResults []PhaseResult, userId string) []PhaseTypeResponseTime {
+	byType := map[godip.PhaseType][]PhaseResult{}
+	for _, phaseResult := range phaseResults {
+		if phaseResult.PhaseType != "" {
+			byType[phaseResult.PhaseType] = append(byType[phaseResult.PhaseType], phaseResult)
+		}
+	}
+	result := []PhaseTypeResponseTime{}
+	for phaseType, typeResults := range byType {
+		if average, count := averageResponseMinutes(typeResults, userId); count > 0 {
+			result = append(result, PhaseTypeResponseTime{
+				PhaseType:              phaseType,
+				AverageResponseMinutes: average,
+				SampleCount:            count,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PhaseType < result[j].PhaseType
+	})
+	return result
+}
+
+// countMessagesSent counts the messages sent by each nation between from and to.
+func countMessagesSent(messages Messages, from, to time.Time) map[godip.Nation]int {
+	result := map[godip.Nation]int{}
+	for _, message := range messages {
+		if message.Sender == DiplicitySender || message.CreatedAt.Before(from) || !message.CreatedAt.Before(to) {
+			continue
+		}
+		result[message.Sender] += 1
+	}
+	return result
 }
 
 var PhaseResultResource = &Resource{
@@ -59,6 +140,11 @@ func loadPhaseResult(w ResponseWriter, r Request) (*PhaseResult, error) {
 	if err := datastore.Get(ctx, phaseResultID, phaseResult); err != nil {
 		return nil, err
 	}
+	if phaseResult.MessagesSentJSON != "" {
+		if err := json.Unmarshal([]byte(phaseResult.MessagesSentJSON), &phaseResult.MessagesSent); err != nil {
+			return nil, err
+		}
+	}
 
 	return phaseResult, nil
 }
@@ -83,6 +169,13 @@ func (p *PhaseResult) Save(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if p.MessagesSent != nil {
+		b, err := json.Marshal(p.MessagesSent)
+		if err != nil {
+			return err
+		}
+		p.MessagesSentJSON = string(b)
+	}
 	_, err = datastore.Put(ctx, id, p)
 	return err
 }
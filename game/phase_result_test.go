@@ -0,0 +1,73 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zond/godip"
+)
+
+func TestCountMessagesSent(t *testing.T) {
+	phaseStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	phaseEnd := phaseStart.Add(24 * time.Hour)
+	conference := Nations{godip.Austria, godip.England, godip.France}
+	messages := Messages{
+		{ChannelMembers: conference, Sender: godip.Austria, CreatedAt: phaseStart.Add(-time.Minute)},
+		{ChannelMembers: conference, Sender: godip.Austria, CreatedAt: phaseStart},
+		{ChannelMembers: conference, Sender: godip.Austria, CreatedAt: phaseStart.Add(time.Hour)},
+		{ChannelMembers: conference, Sender: godip.England, CreatedAt: phaseStart.Add(2 * time.Hour)},
+		{ChannelMembers: Nations{godip.England, godip.France}, Sender: godip.England, CreatedAt: phaseStart.Add(3 * time.Hour)},
+		{ChannelMembers: conference, Sender: DiplicitySender, CreatedAt: phaseStart.Add(4 * time.Hour)},
+		{ChannelMembers: conference, Sender: godip.France, CreatedAt: phaseEnd},
+	}
+	got := countMessagesSent(messages, phaseStart, phaseEnd)
+	want := map[godip.Nation]int{
+		godip.Austria: 2,
+		godip.England: 2,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got %+v, wanted %+v", got, want)
+	}
+	for nat, count := range want {
+		if got[nat] != count {
+			t.Errorf("Got %v messages from %v, wanted %v", got[nat], nat, count)
+		}
+	}
+}
+
+func TestAverageResponseMinutes(t *testing.T) {
+	phaseResults := []PhaseResult{
+		{ResponseTimes: []ResponseTime{{UserId: "a", Minutes: 10}, {UserId: "b", Minutes: 100}}},
+		{ResponseTimes: []ResponseTime{{UserId: "a", Minutes: 30}}},
+		{},
+	}
+	if average, count := averageResponseMinutes(phaseResults, "a"); average != 20 || count != 2 {
+		t.Errorf("Got %v, %v for a, wanted 20, 2", average, count)
+	}
+	if average, count := averageResponseMinutes(phaseResults, "c"); average != 0 || count != 0 {
+		t.Errorf("Got %v, %v for c, wanted 0, 0", average, count)
+	}
+}
+
+func TestResponseMinutesByPhaseType(t *testing.T) {
+	phaseResults := []PhaseResult{
+		{PhaseType: godip.Movement, ResponseTimes: []ResponseTime{{UserId: "a", Minutes: 10}, {UserId: "b", Minutes: 100}}},
+		{PhaseType: godip.Movement, ResponseTimes: []ResponseTime{{UserId: "a", Minutes: 30}}},
+		{PhaseType: godip.Adjustment, ResponseTimes: []ResponseTime{{UserId: "a", Minutes: 5}}},
+		{PhaseType: godip.Retreat, ResponseTimes: []ResponseTime{{UserId: "b", Minutes: 5}}},
+		{ResponseTimes: []ResponseTime{{UserId: "a", Minutes: 1000}}},
+	}
+	got := responseMinutesByPhaseType(phaseResults, "a")
+	want := []PhaseTypeResponseTime{
+		{PhaseType: godip.Adjustment, AverageResponseMinutes: 5, SampleCount: 1},
+		{PhaseType: godip.Movement, AverageResponseMinutes: 20, SampleCount: 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got %+v, wanted %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Got %+v, wanted %+v", got[i], want[i])
+		}
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/zond/diplicity/auth"
 	"github.com/zond/godip"
@@ -12,12 +15,18 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/appengine/v2"
 	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
 
 	. "github.com/zond/goaeoas"
 )
 
 const (
 	phaseStateKind = "PhaseState"
+	// maxAllPhaseStatesPhases is the most phases listed in one page of /Game/{game_id}/AllPhaseStates.
+	maxAllPhaseStatesPhases = 32
+	// maxPhaseExtensions is how many times the deadline of a phase can be extended by vote.
+	maxPhaseExtensions      = 3
+	phaseExtensionIncrement = 24 * time.Hour
 )
 
 var PhaseStateResource *Resource
@@ -30,7 +39,13 @@ func init() {
 			{
 				Path:    "/Game/{game_id}/Phase/{phase_ordinal}/PhaseStates",
 				Route:   ListPhaseStatesRoute,
-				Handler: listPhaseStates,
+				Handler: etagCached(listPhaseStates),
+			},
+			{
+				Path:        "/Game/{game_id}/AllPhaseStates",
+				Route:       ListAllPhaseStatesRoute,
+				Handler:     etagCached(listAllPhaseStates),
+				QueryParams: []string{"from", "limit"},
 			},
 		},
 	}
@@ -38,6 +53,50 @@ func init() {
 
 type PhaseStates []PhaseState
 
+// AllReadyToResolve returns whether all nations have declared ready to resolve, not counting eliminated nations.
+func (p PhaseStates) AllReadyToResolve(nations []godip.Nation) bool {
+	ready := map[godip.Nation]bool{}
+	for _, phaseState := range p {
+		if phaseState.ReadyToResolve || phaseState.Eliminated {
+			ready[phaseState.Nation] = true
+		}
+	}
+	for _, nation := range nations {
+		if !ready[nation] {
+			return false
+		}
+	}
+	return true
+}
+
+// ExtensionQuorumReached returns whether at least quorum non eliminated nations want the deadline extended,
+// or all of them if quorum is zero or larger than the number of non eliminated nations.
+func (p PhaseStates) ExtensionQuorumReached(nations []godip.Nation, quorum int) bool {
+	eliminated := map[godip.Nation]bool{}
+	wanting := map[godip.Nation]bool{}
+	for _, phaseState := range p {
+		if phaseState.Eliminated {
+			eliminated[phaseState.Nation] = true
+		} else if phaseState.WantsExtension {
+			wanting[phaseState.Nation] = true
+		}
+	}
+	active := 0
+	votes := 0
+	for _, nation := range nations {
+		if !eliminated[nation] {
+			active++
+			if wanting[nation] {
+				votes++
+			}
+		}
+	}
+	if quorum < 1 || quorum > active {
+		quorum = active
+	}
+	return active > 0 && votes >= quorum
+}
+
 func (p PhaseStates) Item(r Request, phase *Phase) *Item {
 	if !phase.Resolved {
 		r.Values()["is-unresolved"] = true
@@ -46,15 +105,15 @@ func (p PhaseStates) Item(r Request, phase *Phase) *Item {
 	for i := range p {
 		phaseStateItems[i] = p[i].Item(r)
 	}
-	phaseStatesItem := NewItem(phaseStateItems).SetName("phase-states").AddLink(r.NewLink(Link{
-		Rel:         "self",
-		Route:       ListPhaseStatesRoute,
-		RouteParams: []string{"game_id", phase.GameID.Encode(), "phase_ordinal", fmt.Sprint(phase.PhaseOrdinal)},
-	})).SetDesc([][]string{
+	desc := [][]string{
 		[]string{
 			"Phase states",
 			"Each member has exactly one phase state per phase. The phase state defines phase scoped configuration for the member, such as whether the member is ready for the phase to resolve, if the member wants a draw and if the member is currently on probation.",
 		},
+		[]string{
+			"Visibility",
+			"Before the phase resolves, members see their own phase state first, followed by whether the other nations are ready to resolve, have given any orders ('HasOrders', never which orders), on probation, without orders to give or eliminated. Non members only see how many nations are ready to resolve, in the top level 'ReadyToResolveCount' and 'NationCount' fields.",
+		},
 		[]string{
 			"Ready to resolve",
 			"If all members of a game are ready for the phase to resolve, the phase will resolve immediately without waiting for the deadline.",
@@ -63,12 +122,20 @@ func (p PhaseStates) Item(r Request, phase *Phase) *Item {
 			"Draws",
 			"If all members of a game want a draw, the game will end early. The scoring system will reflect this by distributing points to all remaining players.",
 		},
+		[]string{
+			"Deadline extensions",
+			fmt.Sprintf("If enough members want a deadline extension (all non eliminated members, unless the game has an 'ExtensionQuorum'), the deadline is postponed %v and everyone is notified. The votes are then reset, and each phase can be extended at most %d times.", phaseExtensionIncrement, maxPhaseExtensions),
+		},
 		[]string{
 			"Probation",
 			"Members on probation will get future phase states automatically marked as 'ready to resolve' and 'wanting draw'. To return from probation, simply update the phase state of the member on probation.",
 		},
-	})
-	return phaseStatesItem
+	}
+	return NewItem(phaseStateItems).SetName("phase-states").AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       ListPhaseStatesRoute,
+		RouteParams: []string{"game_id", phase.GameID.Encode(), "phase_ordinal", fmt.Sprint(phase.PhaseOrdinal)},
+	})).SetDesc(desc)
 }
 
 type PhaseState struct {
@@ -78,12 +145,17 @@ type PhaseState struct {
 	ReadyToResolve bool `methods:"PUT"`
 	WantsDIAS      bool `methods:"PUT"`
 	WantsConcede   bool `methods:"PUT"`
+	WantsExtension bool `methods:"PUT"`
 	OnProbation    bool
 	NoOrders       bool
 	Eliminated     bool
 	Messages       string
 	ZippedOptions  []byte `skip:"true"`
 	Note           string `datastore:",noindex"`
+	// ReadyAt is when the member last declared ready to resolve, zero if not ready or automatically ready.
+	ReadyAt time.Time
+	// HasOrders is whether the nation has given any orders in the phase, populated when listing phase states.
+	HasOrders bool `datastore:"-"`
 }
 
 func PhaseStateID(ctx context.Context, phaseID *datastore.Key, nation godip.Nation) (*datastore.Key, error) {
@@ -110,9 +182,26 @@ func (p *PhaseState) Save(ctx context.Context) error {
 	return err
 }
 
+// confirmationStatus returns a copy of the phase state containing only what other members of the game may see
+// before the phase is resolved.
+func (p *PhaseState) confirmationStatus() PhaseState {
+	return PhaseState{
+		GameID:         p.GameID,
+		PhaseOrdinal:   p.PhaseOrdinal,
+		Nation:         p.Nation,
+		ReadyToResolve: p.ReadyToResolve,
+		OnProbation:    p.OnProbation,
+		NoOrders:       p.NoOrders,
+		Eliminated:     p.Eliminated,
+		WantsExtension: p.WantsExtension,
+		HasOrders:      p.HasOrders,
+	}
+}
+
 func (p *PhaseState) Item(r Request) *Item {
 	phaseStateItem := NewItem(p).SetName(string(p.Nation))
-	if _, isUnresolved := r.Values()["is-unresolved"]; isUnresolved {
+	memberNation, hasMemberNation := r.Values()["member-nation"]
+	if _, isUnresolved := r.Values()["is-unresolved"]; isUnresolved && (!hasMemberNation || memberNation == p.Nation) {
 		phaseStateItem.AddLink(r.NewLink(PhaseStateResource.Link("update", Update, []string{"game_id", p.GameID.Encode(), "phase_ordinal", fmt.Sprint(p.PhaseOrdinal)})))
 	}
 	return phaseStateItem
@@ -169,6 +258,8 @@ func updatePhaseState(w ResponseWriter, r Request) (*PhaseState, error) {
 		if err := datastore.Get(ctx, phaseStateID, phaseState); err != nil && err != datastore.ErrNoSuchEntity {
 			return err
 		}
+		wasReady := phaseState.ReadyToResolve
+		wantedExtension := phaseState.WantsExtension
 
 		err = CopyBytes(phaseState, r, bodyBytes, "PUT")
 		if err != nil {
@@ -177,6 +268,14 @@ func updatePhaseState(w ResponseWriter, r Request) (*PhaseState, error) {
 		if game.Mustered && phaseState.NoOrders {
 			phaseState.ReadyToResolve = true
 		}
+		if phaseState.WantsExtension && !wantedExtension && phase.Extensions >= maxPhaseExtensions {
+			return HTTPErr{fmt.Sprintf("the deadline of this phase has already been extended %d times", phase.Extensions), http.StatusPreconditionFailed}
+		}
+		if !phaseState.ReadyToResolve {
+			phaseState.ReadyAt = time.Time{}
+		} else if !wasReady {
+			phaseState.ReadyAt = time.Now()
+		}
 		phaseState.GameID = gameID
 		phaseState.PhaseOrdinal = phaseOrdinal
 		phaseState.Nation = member.Nation
@@ -190,26 +289,39 @@ func updatePhaseState(w ResponseWriter, r Request) (*PhaseState, error) {
 			return err
 		}
 
-		if phaseState.ReadyToResolve {
-			allStates := []PhaseState{}
-			if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &allStates); err != nil {
-				return err
+		if !phaseState.ReadyToResolve && !(phaseState.WantsExtension && !wantedExtension) {
+			return nil
+		}
+
+		allStates := PhaseStates{}
+		if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &allStates); err != nil {
+			return err
+		}
+
+		// The query doesn't see the state saved in this transaction.
+		foundOwn := false
+		for i := range allStates {
+			if allStates[i].Nation == phaseState.Nation {
+				allStates[i] = *phaseState
+				foundOwn = true
 			}
+		}
+		if !foundOwn {
+			allStates = append(allStates, *phaseState)
+		}
 
-			readyNations := 0
-			for i := range allStates {
-				if allStates[i].Nation == phaseState.Nation {
-					allStates[i] = *phaseState
-				}
-				if allStates[i].ReadyToResolve {
-					readyNations += 1
-				}
+		nations := variants.Variants[game.Variant].Nations
+		if phaseState.WantsExtension && !wantedExtension && allStates.ExtensionQuorumReached(nations, game.ExtensionQuorum) {
+			if err := extendPhaseDeadline(ctx, game, phase, allStates); err != nil {
+				return err
 			}
+			phaseState.WantsExtension = false
+			return nil
+		}
 
-			if readyNations == len(variants.Variants[game.Variant].Nations) {
-				if err := asyncResolvePhaseFunc.EnqueueIn(ctx, 0, game.ID, phase.PhaseOrdinal); err != nil {
-					return err
-				}
+		if phaseState.ReadyToResolve && allStates.AllReadyToResolve(nations) {
+			if err := asyncResolvePhaseFunc.EnqueueIn(ctx, 0, game.ID, phase.PhaseOrdinal); err != nil {
+				return err
 			}
 		}
 		return nil
@@ -250,52 +362,298 @@ func listPhaseStates(w ResponseWriter, r Request) error {
 	}
 
 	phaseStates := PhaseStates{}
+	if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &phaseStates); err != nil {
+		return err
+	}
+	// Only whether nations have orders is revealed here, never the orders themselves.
+	orders := []Order{}
+	if _, err := datastore.NewQuery(orderKind).Ancestor(phaseID).GetAll(ctx, &orders); err != nil {
+		return err
+	}
+	nationsWithOrders := map[godip.Nation]bool{}
+	for _, order := range orders {
+		nationsWithOrders[order.Nation] = true
+	}
+	phaseStates = phaseStates.complete(variants.Variants[game.Variant].Nations, gameID, phaseOrdinal, nationsWithOrders)
 
-	if phase.Resolved {
-		if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &phaseStates); err != nil {
-			return err
-		}
-		for _, nat := range variants.Variants[game.Variant].Nations {
-			found := false
+	annotations := map[string]interface{}{}
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if !phase.Resolved {
+		if !isMember {
+			// Non members only get to know how many nations are ready, not which.
+			readyToResolve := 0
 			for _, phaseState := range phaseStates {
-				if phaseState.Nation == nat {
-					found = true
-					break
+				if phaseState.ReadyToResolve {
+					readyToResolve++
 				}
 			}
-			if !found {
-				phaseStates = append(phaseStates, PhaseState{
-					GameID:       gameID,
-					PhaseOrdinal: phaseOrdinal,
-					Nation:       nat,
-				})
+			annotations["ReadyToResolveCount"] = readyToResolve
+			annotations["NationCount"] = len(phaseStates)
+		} else if game.Mustered {
+			r.Values()["member-nation"] = member.Nation
+		}
+	}
+	phaseStates = phaseStates.visibleTo(game, phase, member)
+
+	// Members get their own phase state first in unresolved phases.
+	if !phase.Resolved && isMember {
+		for idx := range phaseStates {
+			if phaseStates[idx].Nation == member.Nation {
+				own := phaseStates[idx]
+				copy(phaseStates[1:idx+1], phaseStates[:idx])
+				phaseStates[0] = own
+				break
 			}
 		}
-	} else {
-		member, isMember := game.GetMemberByUserId(user.Id)
-		if isMember {
-			phaseStateID, err := PhaseStateID(ctx, phaseID, member.Nation)
+	}
+
+	w.SetContent(annotatedItem{Item: phaseStates.Item(r, phase), Annotations: annotations})
+	return nil
+}
+
+/*
+ * listAllPhaseStates lists the phase states of a page of phases of a game, ordered by phase ordinal and nation,
+ * with the same visibility as listPhaseStates. The page starts at the phase ordinal in the `from` query parameter
+ * and contains at most `limit` phases.
+ */
+func listAllPhaseStates(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return err
+	}
+	game.ID = gameID
+
+	uq := r.Req().URL.Query()
+	from := int64(1)
+	if fromParam := uq.Get("from"); fromParam != "" {
+		if from, err = strconv.ParseInt(fromParam, 10, 64); err != nil || from < 1 {
+			return HTTPErr{"from must be a positive phase ordinal", http.StatusBadRequest}
+		}
+	}
+	limit := capLimit(uq.Get("limit"), maxAllPhaseStatesPhases)
+	if limit < 1 {
+		limit = maxAllPhaseStatesPhases
+	}
+
+	newestOrdinal := int64(0)
+	if len(game.NewestPhaseMeta) > 0 {
+		newestOrdinal = game.NewestPhaseMeta[0].PhaseOrdinal
+	}
+	to := from + limit
+	if to > newestOrdinal+1 {
+		to = newestOrdinal + 1
+	}
+
+	phaseStates := PhaseStates{}
+	if from < to {
+		phaseIDs := []*datastore.Key{}
+		for ordinal := from; ordinal < to; ordinal++ {
+			phaseID, err := PhaseID(ctx, gameID, ordinal)
 			if err != nil {
 				return err
 			}
-			phaseState := &PhaseState{}
-			if err := datastore.Get(ctx, phaseStateID, phaseState); err == datastore.ErrNoSuchEntity {
-				phaseState.GameID = gameID
-				phaseState.PhaseOrdinal = phaseOrdinal
-				phaseState.Nation = member.Nation
-			} else if err != nil {
-				return err
+			phaseIDs = append(phaseIDs, phaseID)
+		}
+		phases := make([]Phase, len(phaseIDs))
+		if err := datastore.GetMulti(ctx, phaseIDs, phases); err != nil {
+			return err
+		}
+
+		storedStates := PhaseStates{}
+		if _, err := datastore.NewQuery(phaseStateKind).Ancestor(gameID).Filter("PhaseOrdinal>=", from).Filter("PhaseOrdinal<", to).Order("PhaseOrdinal").Order("Nation").GetAll(ctx, &storedStates); err != nil {
+			return err
+		}
+		orders := []Order{}
+		if _, err := datastore.NewQuery(orderKind).Ancestor(gameID).Filter("PhaseOrdinal>=", from).Filter("PhaseOrdinal<", to).GetAll(ctx, &orders); err != nil {
+			return err
+		}
+		nationsWithOrders := map[int64]map[godip.Nation]bool{}
+		for _, order := range orders {
+			if nationsWithOrders[order.PhaseOrdinal] == nil {
+				nationsWithOrders[order.PhaseOrdinal] = map[godip.Nation]bool{}
 			}
-			phaseStates = append(phaseStates, *phaseState)
+			nationsWithOrders[order.PhaseOrdinal][order.Nation] = true
+		}
+		statesByOrdinal := map[int64]PhaseStates{}
+		for _, phaseState := range storedStates {
+			statesByOrdinal[phaseState.PhaseOrdinal] = append(statesByOrdinal[phaseState.PhaseOrdinal], phaseState)
+		}
+
+		member, _ := game.GetMemberByUserId(user.Id)
+		nations := variants.Variants[game.Variant].Nations
+		for idx := range phases {
+			phase := &phases[idx]
+			phaseStatesForPhase := statesByOrdinal[phase.PhaseOrdinal].complete(nations, gameID, phase.PhaseOrdinal, nationsWithOrders[phase.PhaseOrdinal])
+			sort.Slice(phaseStatesForPhase, func(i, j int) bool {
+				return phaseStatesForPhase[i].Nation < phaseStatesForPhase[j].Nation
+			})
+			phaseStates = append(phaseStates, phaseStatesForPhase.visibleTo(game, phase, member)...)
 		}
 	}
 
-	if !game.Mustered {
-		for idx := range phaseStates {
-			phaseStates[idx].Nation = ""
+	w.SetContent(phaseStates.allPhasesItem(r, gameID, from, limit, to <= newestOrdinal))
+	return nil
+}
+
+// allPhasesItem returns the item of a page of phase states from listAllPhaseStates, linking to the next page if hasMore.
+func (p PhaseStates) allPhasesItem(r Request, gameID *datastore.Key, from int64, limit int64, hasMore bool) *Item {
+	phaseStateItems := make(List, len(p))
+	for i := range p {
+		phaseStateItems[i] = NewItem(p[i]).SetName(string(p[i].Nation))
+	}
+	item := NewItem(phaseStateItems).SetName("all-phase-states").AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       ListAllPhaseStatesRoute,
+		RouteParams: []string{"game_id", gameID.Encode()},
+		QueryParams: url.Values{"from": []string{fmt.Sprint(from)}, "limit": []string{fmt.Sprint(limit)}},
+	}))
+	if hasMore {
+		item.AddLink(r.NewLink(Link{
+			Rel:         "next",
+			Route:       ListAllPhaseStatesRoute,
+			RouteParams: []string{"game_id", gameID.Encode()},
+			QueryParams: url.Values{"from": []string{fmt.Sprint(from + limit)}, "limit": []string{fmt.Sprint(limit)}},
+		}))
+	}
+	return item.SetDesc([][]string{
+		[]string{
+			"All phase states",
+			fmt.Sprintf("The phase states of up to `limit` (at most %d) phases of the game, starting with the phase ordinal `from`, ordered by phase ordinal and nation. Follow the 'next' link for the following phases.", maxAllPhaseStatesPhases),
+		},
+		[]string{
+			"Visibility",
+			"The same as for the phase states of each phase: before a phase resolves members only see their own phase state and the confirmation status of the other nations, and non members don't see any phase states of it.",
+		},
+	})
+}
+
+// complete sets HasOrders of the phase states, and adds empty phase states for nations missing one.
+func (p PhaseStates) complete(nations []godip.Nation, gameID *datastore.Key, phaseOrdinal int64, nationsWithOrders map[godip.Nation]bool) PhaseStates {
+	for idx := range p {
+		p[idx].HasOrders = nationsWithOrders[p[idx].Nation]
+	}
+	for _, nat := range nations {
+		found := false
+		for _, phaseState := range p {
+			if phaseState.Nation == nat {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p = append(p, PhaseState{
+				GameID:       gameID,
+				PhaseOrdinal: phaseOrdinal,
+				Nation:       nat,
+				HasOrders:    nationsWithOrders[nat],
+			})
+		}
+	}
+	return p
+}
+
+/*
+ * visibleTo returns the phase states of phase that member (nil for non members) may see.
+ * Before the phase resolves, non members see nothing, and members see their own phase state and
+ * the confirmation status of the other nations if the game is mustered (before that the nations
+ * aren't revealed anyway). The nations of unmustered games are always hidden.
+ */
+func (p PhaseStates) visibleTo(game *Game, phase *Phase, member *Member) PhaseStates {
+	visible := PhaseStates{}
+	for _, phaseState := range p {
+		if !phase.Resolved {
+			if member == nil {
+				continue
+			}
+			if phaseState.Nation != member.Nation {
+				if !game.Mustered {
+					continue
+				}
+				phaseState = phaseState.confirmationStatus()
+			}
+		}
+		if !game.Mustered {
+			phaseState.Nation = ""
 		}
+		visible = append(visible, phaseState)
+	}
+	return visible
+}
+
+// extendPhaseDeadline postpones the deadline of phase by phaseExtensionIncrement, resets the extension votes in phaseStates
+// and notifies the members. Must be run inside a transaction.
+func extendPhaseDeadline(ctx context.Context, game *Game, phase *Phase, phaseStates PhaseStates) error {
+	phaseID, err := phase.ID(ctx)
+	if err != nil {
+		return err
+	}
+
+	phase.Extensions++
+	phase.DeadlineAt = phase.DeadlineAt.Add(phaseExtensionIncrement)
+	if _, err := datastore.Put(ctx, phaseID, phase); err != nil {
+		return err
+	}
+
+	keys := []*datastore.Key{}
+	values := PhaseStates{}
+	for _, phaseState := range phaseStates {
+		if !phaseState.WantsExtension {
+			continue
+		}
+		phaseState.WantsExtension = false
+		key, err := PhaseStateID(ctx, phaseID, phaseState.Nation)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, phaseState)
+	}
+	if _, err := datastore.PutMulti(ctx, keys, values); err != nil {
+		return err
+	}
+
+	for i := range game.Members {
+		game.Members[i].NewestPhaseState.WantsExtension = false
+	}
+	game.NewestPhaseMeta = []PhaseMeta{phase.PhaseMeta}
+	if err := game.DBSave(ctx); err != nil {
+		return err
+	}
+
+	if err := phase.ScheduleResolution(ctx); err != nil {
+		return err
+	}
+
+	members := make([]string, len(game.Members))
+	for idx := range game.Members {
+		members[idx] = string(game.Members[idx].Nation)
+	}
+	notificationBody := fmt.Sprintf("The members voted to extend the deadline. Phase resolution postponed %v until %v.",
+		phaseExtensionIncrement.Round(time.Minute),
+		phase.DeadlineAt.Format(time.RFC822))
+	if err := AsyncSendMsgFunc.EnqueueIn(
+		ctx, 0,
+		game.ID,
+		DiplicitySender,
+		members,
+		notificationBody,
+		phase.Host,
+	); err != nil {
+		log.Errorf(ctx, "AsyncSendMsgFunc(..., %v, %v, %+v, %q, %q): %v; fix it?", game.ID, DiplicitySender, members, notificationBody, phase.Host, err)
+		return err
 	}
 
-	w.SetContent(phaseStates.Item(r, phase))
 	return nil
 }
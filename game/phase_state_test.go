@@ -0,0 +1,101 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/godip"
+)
+
+func TestAllReadyToResolve(t *testing.T) {
+	nations := []godip.Nation{godip.England, godip.France, godip.Germany}
+	for _, tc := range []struct {
+		states PhaseStates
+		want   bool
+	}{
+		{PhaseStates{}, false},
+		{PhaseStates{
+			{Nation: godip.England, ReadyToResolve: true},
+			{Nation: godip.France, ReadyToResolve: true},
+		}, false},
+		{PhaseStates{
+			{Nation: godip.England, ReadyToResolve: true},
+			{Nation: godip.France, ReadyToResolve: true},
+			{Nation: godip.Germany},
+		}, false},
+		{PhaseStates{
+			{Nation: godip.England, ReadyToResolve: true},
+			{Nation: godip.France, ReadyToResolve: true},
+			{Nation: godip.Germany, Eliminated: true},
+		}, true},
+		{PhaseStates{
+			{Nation: godip.England, ReadyToResolve: true},
+			{Nation: godip.France, ReadyToResolve: true},
+			{Nation: godip.Germany, ReadyToResolve: true},
+		}, true},
+	} {
+		if got := tc.states.AllReadyToResolve(nations); got != tc.want {
+			t.Errorf("Got %v for %+v, wanted %v", got, tc.states, tc.want)
+		}
+	}
+}
+
+func TestExtensionQuorumReached(t *testing.T) {
+	nations := []godip.Nation{godip.England, godip.France, godip.Germany}
+	for _, tc := range []struct {
+		states PhaseStates
+		quorum int
+		want   bool
+	}{
+		{PhaseStates{}, 0, false},
+		{PhaseStates{
+			{Nation: godip.England, WantsExtension: true},
+			{Nation: godip.France, WantsExtension: true},
+		}, 0, false},
+		{PhaseStates{
+			{Nation: godip.England, WantsExtension: true},
+			{Nation: godip.France, WantsExtension: true},
+		}, 2, true},
+		{PhaseStates{
+			{Nation: godip.England, WantsExtension: true},
+			{Nation: godip.France, WantsExtension: true},
+			{Nation: godip.Germany, Eliminated: true},
+		}, 0, true},
+		{PhaseStates{
+			{Nation: godip.England, WantsExtension: true},
+			{Nation: godip.Germany, Eliminated: true, WantsExtension: true},
+		}, 2, false},
+		{PhaseStates{
+			{Nation: godip.England, WantsExtension: true},
+			{Nation: godip.France, WantsExtension: true},
+			{Nation: godip.Germany, Eliminated: true},
+		}, 5, true},
+	} {
+		if got := tc.states.ExtensionQuorumReached(nations, tc.quorum); got != tc.want {
+			t.Errorf("Got %v for %+v with quorum %v, wanted %v", got, tc.states, tc.quorum, tc.want)
+		}
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	states := PhaseStates{
+		{Nation: godip.England, ReadyToResolve: true, WantsDIAS: true},
+		{Nation: godip.France, WantsDIAS: true},
+	}
+	england := &Member{Nation: godip.England}
+	mustered := &Game{Mustered: true}
+
+	if got := states.visibleTo(mustered, &Phase{}, nil); len(got) != 0 {
+		t.Errorf("Got %+v for a non member in an unresolved phase, wanted nothing", got)
+	}
+	got := states.visibleTo(mustered, &Phase{}, england)
+	if len(got) != 2 || !got[0].WantsDIAS || got[1].WantsDIAS {
+		t.Errorf("Got %+v for a member in an unresolved phase, wanted their own state and the confirmation status of the other", got)
+	}
+	if got := states.visibleTo(&Game{}, &Phase{}, england); len(got) != 1 || got[0].Nation != "" {
+		t.Errorf("Got %+v for a member of an unmustered game, wanted only their own state without nation", got)
+	}
+	resolved := &Phase{PhaseMeta: PhaseMeta{Resolved: true}}
+	if got := states.visibleTo(mustered, resolved, nil); len(got) != 2 || !got[1].WantsDIAS {
+		t.Errorf("Got %+v for a non member in a resolved phase, wanted everything", got)
+	}
+}
@@ -0,0 +1,330 @@
+package game
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/urlfetch"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	phaseWebhookKind = "PhaseWebhook"
+	// PhaseWebhookSignatureHeader contains the hex encoded HMAC-SHA256 of the body of the webhook request, keyed with the secret of the webhook.
+	PhaseWebhookSignatureHeader = "X-Diplicity-Signature"
+	phaseWebhookSecretBytes     = 32
+)
+
+var (
+	deliverPhaseWebhookFunc *DelayFunc
+)
+
+func init() {
+	deliverPhaseWebhookFunc = NewDelayFunc("game-deliverPhaseWebhook", deliverPhaseWebhook)
+}
+
+// PhaseWebhook is a URL the server POSTs to each time a phase of the game resolves.
+type PhaseWebhook struct {
+	GameID    *datastore.Key
+	URL       string `methods:"PUT" datastore:",noindex"`
+	Secret    string `datastore:",noindex"`
+	CreatedAt time.Time
+}
+
+func (p *PhaseWebhook) Item(r Request) *Item {
+	return NewItem(p).SetName("phase-webhook").AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       PhaseWebhookRoute,
+		RouteParams: []string{"game_id", p.GameID.Encode()},
+	})).AddLink(r.NewLink(Link{
+		Rel:         "update",
+		Route:       UpdatePhaseWebhookRoute,
+		RouteParams: []string{"game_id", p.GameID.Encode()},
+		Method:      "PUT",
+	})).AddLink(r.NewLink(Link{
+		Rel:         "delete",
+		Route:       DeletePhaseWebhookRoute,
+		RouteParams: []string{"game_id", p.GameID.Encode()},
+		Method:      "DELETE",
+	})).SetDesc([][]string{
+		[]string{
+			"Phase webhook",
+			"Each time a phase of the game resolves, the server POSTs a JSON payload describing the resolution to the URL.",
+			"Failed deliveries are retried with backoff a limited number of times.",
+		},
+		[]string{
+			"Signature",
+			fmt.Sprintf("The %s header of each delivery contains the hex encoded HMAC-SHA256 of the body, keyed with the Secret of the webhook.", PhaseWebhookSignatureHeader),
+			"The Secret is created with the webhook, and only the creator of the game can see it.",
+		},
+	})
+}
+
+func PhaseWebhookID(ctx context.Context, gameID *datastore.Key) *datastore.Key {
+	return datastore.NewKey(ctx, phaseWebhookKind, "webhook", 0, gameID)
+}
+
+// PhaseWebhookPhase identifies a phase in webhook payloads.
+type PhaseWebhookPhase struct {
+	PhaseOrdinal int64
+	Season       godip.Season
+	Year         int
+	Type         godip.PhaseType
+}
+
+// PhaseWebhookPayload is the body POSTed to phase webhooks.
+type PhaseWebhookPayload struct {
+	GameID        string
+	Desc          string
+	Finished      bool
+	ResolvedPhase PhaseWebhookPhase
+	NewPhase      PhaseWebhookPhase
+	Resolutions   []Resolution
+	SupplyCenters map[godip.Nation]int
+}
+
+// newPhaseWebhookPayload describes the resolution of resolved into newPhase in the game with the encoded ID.
+func newPhaseWebhookPayload(encodedGameID string, game *Game, resolved *Phase, newPhase *Phase) *PhaseWebhookPayload {
+	webhookPhase := func(phase *Phase) PhaseWebhookPhase {
+		return PhaseWebhookPhase{
+			PhaseOrdinal: phase.PhaseOrdinal,
+			Season:       phase.Season,
+			Year:         phase.Year,
+			Type:         phase.Type,
+		}
+	}
+	payload := &PhaseWebhookPayload{
+		GameID:        encodedGameID,
+		Desc:          game.Desc,
+		Finished:      game.Finished,
+		ResolvedPhase: webhookPhase(resolved),
+		NewPhase:      webhookPhase(newPhase),
+		Resolutions:   resolved.Resolutions,
+		SupplyCenters: scCountsOf(newPhase),
+	}
+	if payload.Resolutions == nil {
+		payload.Resolutions = []Resolution{}
+	}
+	delete(payload.SupplyCenters, "")
+	return payload
+}
+
+// signPhaseWebhook returns the hex encoded HMAC-SHA256 of body keyed with secret.
+func signPhaseWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validatePhaseWebhookURL makes sure the URL is absolute, and uses HTTPS outside the development server.
+func validatePhaseWebhookURL(rawURL string, allowHTTP bool) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", rawURL)
+	}
+	if parsed.Scheme != "https" && !(allowHTTP && parsed.Scheme == "http") {
+		return fmt.Errorf("%q must use https", rawURL)
+	}
+	return nil
+}
+
+// enqueuePhaseWebhook enqueues delivery of the resolution of the phase with phaseOrdinal to the webhook of the game, if it has one.
+// Must be run in the transaction resolving the phase.
+func enqueuePhaseWebhook(ctx context.Context, gameID *datastore.Key, phaseOrdinal int64) error {
+	if err := datastore.Get(ctx, PhaseWebhookID(ctx, gameID), &PhaseWebhook{}); err == datastore.ErrNoSuchEntity {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return deliverPhaseWebhookFunc.EnqueueIn(ctx, 0, gameID, phaseOrdinal)
+}
+
+func deliverPhaseWebhook(ctx context.Context, gameID *datastore.Key, phaseOrdinal int64) error {
+	log.Infof(ctx, "deliverPhaseWebhook(..., %v, %v)", gameID, phaseOrdinal)
+
+	resolvedID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		return err
+	}
+	newPhaseID, err := PhaseID(ctx, gameID, phaseOrdinal+1)
+	if err != nil {
+		return err
+	}
+	webhook := &PhaseWebhook{}
+	game := &Game{}
+	resolved := &Phase{}
+	newPhase := &Phase{}
+	if err := datastore.GetMulti(ctx, []*datastore.Key{PhaseWebhookID(ctx, gameID), gameID, resolvedID, newPhaseID}, []interface{}{webhook, game, resolved, newPhase}); err != nil {
+		if merr, ok := err.(appengine.MultiError); ok && merr[0] == datastore.ErrNoSuchEntity {
+			log.Infof(ctx, "%v no longer has a webhook, will skip delivering", gameID)
+			return nil
+		}
+		log.Errorf(ctx, "Unable to load webhook, game and phases: %v; hope datastore gets fixed", err)
+		return err
+	}
+	body, err := json.Marshal(newPhaseWebhookPayload(gameID.Encode(), game, resolved, newPhase))
+	if err != nil {
+		log.Errorf(ctx, "Unable to marshal payload: %v; unable to recover, exiting", err)
+		return nil
+	}
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(body))
+	if err != nil {
+		log.Errorf(ctx, "Unable to create request to %q: %v; unable to recover, exiting", webhook.URL, err)
+		return nil
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set(PhaseWebhookSignatureHeader, signPhaseWebhook(webhook.Secret, body))
+
+	resp, err := urlfetch.Client(ctx).Do(req)
+	if err != nil {
+		log.Errorf(ctx, "Unable to POST to %q: %v; will retry", webhook.URL, err)
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		log.Infof(ctx, "deliverPhaseWebhook(..., %v, %v) *** SUCCESS ***", gameID, phaseOrdinal)
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		msg := fmt.Sprintf("POSTing to %q got %v: %s; will retry", webhook.URL, resp.Status, respBody)
+		log.Errorf(ctx, "%s", msg)
+		return fmt.Errorf("%s", msg)
+	}
+	log.Errorf(ctx, "POSTing to %q got %v: %s; unable to recover, exiting", webhook.URL, resp.Status, respBody)
+	return nil
+}
+
+// loadCreatedGame loads the game with the game_id of the request, and makes sure user created it.
+func loadCreatedGame(ctx context.Context, r Request, user *auth.User) (*Game, error) {
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return nil, err
+	}
+	game := &Game{}
+	if err := datastore.Get(ctx, gameID, game); err != nil {
+		return nil, err
+	}
+	game.ID = gameID
+	if game.CreatorId != user.Id {
+		return nil, HTTPErr{"only the creator of the game can manage its webhook", http.StatusForbidden}
+	}
+	return game, nil
+}
+
+func loadPhaseWebhook(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	game, err := loadCreatedGame(ctx, r, user)
+	if err != nil {
+		return err
+	}
+
+	webhook := &PhaseWebhook{}
+	if err := datastore.Get(ctx, PhaseWebhookID(ctx, game.ID), webhook); err == datastore.ErrNoSuchEntity {
+		return HTTPErr{"game has no webhook", http.StatusNotFound}
+	} else if err != nil {
+		return err
+	}
+
+	w.SetContent(webhook.Item(r))
+	return nil
+}
+
+func updatePhaseWebhook(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	update := &PhaseWebhook{}
+	if err := Copy(update, r, "PUT"); err != nil {
+		return err
+	}
+	if err := validatePhaseWebhookURL(update.URL, appengine.IsDevAppServer()); err != nil {
+		return HTTPErr{err.Error(), http.StatusBadRequest}
+	}
+
+	webhook := &PhaseWebhook{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		game, err := loadCreatedGame(ctx, r, user)
+		if err != nil {
+			return err
+		}
+		if game.Finished {
+			return HTTPErr{"can't add webhooks to finished games", http.StatusPreconditionFailed}
+		}
+		*webhook = PhaseWebhook{}
+		if err := datastore.Get(ctx, PhaseWebhookID(ctx, game.ID), webhook); err == datastore.ErrNoSuchEntity {
+			// The secret stays the same when the URL changes, so receivers don't have to be reconfigured.
+			secret := make([]byte, phaseWebhookSecretBytes)
+			if _, err := rand.Read(secret); err != nil {
+				return err
+			}
+			webhook.GameID = game.ID
+			webhook.Secret = base64.RawURLEncoding.EncodeToString(secret)
+			webhook.CreatedAt = time.Now()
+		} else if err != nil {
+			return err
+		}
+		webhook.URL = update.URL
+		_, err = datastore.Put(ctx, PhaseWebhookID(ctx, game.ID), webhook)
+		return err
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return err
+	}
+
+	w.SetContent(webhook.Item(r))
+	return nil
+}
+
+func deletePhaseWebhook(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		game, err := loadCreatedGame(ctx, r, user)
+		if err != nil {
+			return err
+		}
+		webhookID := PhaseWebhookID(ctx, game.ID)
+		if err := datastore.Get(ctx, webhookID, &PhaseWebhook{}); err == datastore.ErrNoSuchEntity {
+			return HTTPErr{"game has no webhook", http.StatusNotFound}
+		} else if err != nil {
+			return err
+		}
+		return datastore.Delete(ctx, webhookID)
+	}, &datastore.TransactionOptions{XG: false})
+}
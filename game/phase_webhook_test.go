@@ -0,0 +1,81 @@
+package game
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zond/godip"
+)
+
+func TestSignPhaseWebhook(t *testing.T) {
+	// From RFC 4231, test case 2.
+	if got, want := signPhaseWebhook("Jefe", []byte("what do ya want for nothing?")), "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+	if signPhaseWebhook("a", []byte("body")) == signPhaseWebhook("b", []byte("body")) {
+		t.Errorf("Got the same signature with different secrets")
+	}
+}
+
+func TestPhaseWebhookPayload(t *testing.T) {
+	game := &Game{
+		Desc:     "desc",
+		Finished: true,
+	}
+	resolved := &Phase{
+		PhaseMeta:   PhaseMeta{PhaseOrdinal: 1, Season: godip.Spring, Year: 1901, Type: godip.Movement},
+		Resolutions: []Resolution{{Province: "par", Resolution: "OK"}},
+	}
+	newPhase := &Phase{
+		PhaseMeta: PhaseMeta{PhaseOrdinal: 2, Season: godip.Spring, Year: 1901, Type: godip.Retreat},
+		SCs:       []SC{{Province: "par", Owner: godip.France}, {Province: "bre", Owner: godip.France}, {Province: "bel", Owner: ""}},
+	}
+	b, err := json.Marshal(newPhaseWebhookPayload("game-id", game, resolved, newPhase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(b, &payload); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for key := range payload {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if want := []string{"Desc", "Finished", "GameID", "NewPhase", "Resolutions", "ResolvedPhase", "SupplyCenters"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Got keys %v, wanted %v", keys, want)
+	}
+	if payload["GameID"] != "game-id" || payload["Finished"] != true {
+		t.Errorf("Got %v, wanted the ID and state of %v", payload, game)
+	}
+	if want := map[string]interface{}{"PhaseOrdinal": 2.0, "Season": "Spring", "Year": 1901.0, "Type": "Retreat"}; !reflect.DeepEqual(payload["NewPhase"], want) {
+		t.Errorf("Got new phase %v, wanted %v", payload["NewPhase"], want)
+	}
+	if want := map[string]interface{}{"France": 2.0}; !reflect.DeepEqual(payload["SupplyCenters"], want) {
+		t.Errorf("Got supply centers %v, wanted %v", payload["SupplyCenters"], want)
+	}
+	if want := []interface{}{map[string]interface{}{"Province": "par", "Resolution": "OK"}}; !reflect.DeepEqual(payload["Resolutions"], want) {
+		t.Errorf("Got resolutions %v, wanted %v", payload["Resolutions"], want)
+	}
+}
+
+func TestValidatePhaseWebhookURL(t *testing.T) {
+	for _, tc := range []struct {
+		url       string
+		allowHTTP bool
+		valid     bool
+	}{
+		{"https://example.com/hook", false, true},
+		{"http://example.com/hook", false, false},
+		{"http://localhost:8080/hook", true, true},
+		{"/hook", false, false},
+		{"ftp://example.com/hook", true, false},
+	} {
+		if err := validatePhaseWebhookURL(tc.url, tc.allowHTTP); (err == nil) != tc.valid {
+			t.Errorf("Got %v for %q (allowing http: %v), wanted valid: %v", err, tc.url, tc.allowHTTP, tc.valid)
+		}
+	}
+}
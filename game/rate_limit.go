@@ -0,0 +1,113 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zond/godip"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	rateLimitConfKind = "RateLimitConf"
+	// Used until a RateLimitConf is configured.
+	defaultMessagesPerChannelPerMinute = 30
+	messageRateLimitWindow             = time.Minute
+)
+
+var (
+	prodRateLimitConf = &confCache{}
+)
+
+// RateLimitConf limits how fast members can act, to stop misbehaving clients from flooding the game.
+type RateLimitConf struct {
+	// MessagesPerChannelPerMinute is how many messages each member may send to each channel per minute.
+	MessagesPerChannelPerMinute int
+}
+
+func (c *RateLimitConf) Validate() error {
+	if c.MessagesPerChannelPerMinute < 1 {
+		return fmt.Errorf("MessagesPerChannelPerMinute must be at least 1")
+	}
+	return nil
+}
+
+func getRateLimitConfKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, rateLimitConfKind, prodKey, 0, nil)
+}
+
+// SetRateLimit creates or replaces the RateLimit configuration. Must be called inside a transaction.
+func SetRateLimit(ctx context.Context, rateLimitConf *RateLimitConf) error {
+	if _, err := datastore.Put(ctx, getRateLimitConfKey(ctx), rateLimitConf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getRateLimitConf(ctx context.Context) (*RateLimitConf, error) {
+	conf, err := prodRateLimitConf.get(ctx, getRateLimitConfKey(ctx), &RateLimitConf{})
+	if err != nil {
+		return nil, err
+	}
+	return conf.(*RateLimitConf), nil
+}
+
+// rateLimitWindow returns the start of the fixed window containing now, and how long until the next window starts.
+func rateLimitWindow(now time.Time, window time.Duration) (time.Time, time.Duration) {
+	start := now.Truncate(window)
+	return start, start.Add(window).Sub(now)
+}
+
+// rateLimitErr returns a 429 error with the time to wait in seconds, rounded up, if count exceeds limit.
+func rateLimitErr(count uint64, limit int, retryAfter time.Duration) (int, error) {
+	if count <= uint64(limit) {
+		return 0, nil
+	}
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	return seconds, HTTPErr{fmt.Sprintf("rate limited, at most %d messages per channel per minute are allowed", limit), http.StatusTooManyRequests}
+}
+
+// checkMessageRateLimit counts a message from sender to the channel in the current window,
+// and sets the Retry-After header and returns an error if the sender has sent too many.
+// The counters live in memcache, so if memcache is unavailable messages are let through.
+func checkMessageRateLimit(ctx context.Context, w ResponseWriter, gameID *datastore.Key, channelMembers Nations, sender godip.Nation) error {
+	limit := defaultMessagesPerChannelPerMinute
+	if conf, err := getRateLimitConf(ctx); err == nil {
+		limit = conf.MessagesPerChannelPerMinute
+	} else if err != datastore.ErrNoSuchEntity {
+		return err
+	}
+
+	sortedMembers := append(Nations{}, channelMembers...)
+	sort.Sort(sortedMembers)
+	windowStart, retryAfter := rateLimitWindow(time.Now(), messageRateLimitWindow)
+	key := fmt.Sprintf("messageRateLimit/%s/%s/%s/%d", gameID.Encode(), sortedMembers.String(), sender, windowStart.Unix())
+
+	// Add the counter with an expiry first, since Increment creates counters that never expire.
+	if err := memcache.Add(ctx, &memcache.Item{
+		Key:        key,
+		Value:      []byte("0"),
+		Expiration: messageRateLimitWindow * 2,
+	}); err != nil && err != memcache.ErrNotStored {
+		log.Warningf(ctx, "Unable to add message rate limit counter %q: %v; letting the message through", key, err)
+		return nil
+	}
+	count, err := memcache.Increment(ctx, key, 1, 0)
+	if err != nil {
+		log.Warningf(ctx, "Unable to increment message rate limit counter %q: %v; letting the message through", key, err)
+		return nil
+	}
+
+	seconds, err := rateLimitErr(count, limit, retryAfter)
+	if err != nil {
+		w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitWindow(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 30, 45, 500000000, time.UTC)
+	start, retryAfter := rateLimitWindow(now, time.Minute)
+	if want := time.Date(2020, 1, 1, 12, 30, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("Got window start %v, wanted %v", start, want)
+	}
+	if want := 14500 * time.Millisecond; retryAfter != want {
+		t.Errorf("Got retry after %v, wanted %v", retryAfter, want)
+	}
+}
+
+func TestRateLimitErr(t *testing.T) {
+	limit := 5
+	for count := uint64(1); count <= uint64(limit); count++ {
+		if _, err := rateLimitErr(count, limit, time.Second); err != nil {
+			t.Errorf("Got %v for message %d, wanted it allowed with limit %d", err, count, limit)
+		}
+	}
+	seconds, err := rateLimitErr(uint64(limit+1), limit, 14500*time.Millisecond)
+	if err == nil {
+		t.Fatalf("Got message %d allowed, wanted it limited with limit %d", limit+1, limit)
+	}
+	if seconds != 15 {
+		t.Errorf("Got retry after %d seconds, wanted 15", seconds)
+	}
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/datastore"
+)
+
+const (
+	reliabilityConfKind = "ReliabilityConf"
+	// defaultReliabilityHalfLife is used when no ReliabilityConf is configured.
+	defaultReliabilityHalfLife = 180 * 24 * time.Hour
+)
+
+var (
+	prodReliabilityConf = &confCache{}
+)
+
+// ReliabilityConf configures how fast old phases lose weight in the reliability of players.
+type ReliabilityConf struct {
+	// HalfLifeDays is how many days it takes for a phase to weigh half as much as a phase resolved now.
+	HalfLifeDays int
+}
+
+func (c *ReliabilityConf) Validate() error {
+	if c.HalfLifeDays < 1 {
+		return fmt.Errorf("HalfLifeDays must be at least 1")
+	}
+	return nil
+}
+
+func getReliabilityConfKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, reliabilityConfKind, prodKey, 0, nil)
+}
+
+// SetReliability creates or replaces the Reliability configuration. Must be called inside a transaction.
+func SetReliability(ctx context.Context, reliabilityConf *ReliabilityConf) error {
+	if _, err := datastore.Put(ctx, getReliabilityConfKey(ctx), reliabilityConf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getReliabilityConf(ctx context.Context) (*ReliabilityConf, error) {
+	conf, err := prodReliabilityConf.get(ctx, getReliabilityConfKey(ctx), &ReliabilityConf{})
+	if err != nil {
+		return nil, err
+	}
+	return conf.(*ReliabilityConf), nil
+}
+
+// configuredReliabilityHalfLife returns the configured reliability half life, or defaultReliabilityHalfLife if none is configured.
+func configuredReliabilityHalfLife(ctx context.Context) (time.Duration, error) {
+	conf, err := getReliabilityConf(ctx)
+	if err == datastore.ErrNoSuchEntity {
+		return defaultReliabilityHalfLife, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return time.Duration(conf.HalfLifeDays) * 24 * time.Hour, nil
+}
+
+/*
+ * decayWeight returns how much a phase resolved at resolvedAt weighs at now, halving every halfLife.
+ * Phases resolved before phase results were timestamped weigh as much as phases one half life old.
+ */
+func decayWeight(resolvedAt, now time.Time, halfLife time.Duration) float64 {
+	if resolvedAt.IsZero() {
+		return 0.5
+	}
+	age := now.Sub(resolvedAt)
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// decayedPhaseCount returns the sum of the decayed weights of the phase results.
+func decayedPhaseCount(phaseResults []PhaseResult, now time.Time, halfLife time.Duration) float64 {
+	sum := 0.0
+	for _, phaseResult := range phaseResults {
+		sum += decayWeight(phaseResult.CreatedAt, now, halfLife)
+	}
+	return sum
+}
+
+// countPhaseResults returns how many phase results q finds, and the sum of their decayed weights.
+// Only the CreatedAt of each phase result is loaded, by a projection query. Phase results resolved before
+// CreatedAt was recorded don't have it, and are not found by the projection, so they are weighed like a zero CreatedAt.
+func countPhaseResults(ctx context.Context, q *datastore.Query, now time.Time, halfLife time.Duration) (int, float64, error) {
+	count, err := q.Count(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	resolved := []PhaseResult{}
+	if _, err := q.Project("CreatedAt").GetAll(ctx, &resolved); err != nil {
+		return 0, 0, err
+	}
+	unrecorded := count - len(resolved)
+	if unrecorded < 0 {
+		unrecorded = 0
+	}
+	return count, decayedPhaseCount(resolved, now, halfLife) + float64(unrecorded)*decayWeight(time.Time{}, now, halfLife), nil
+}
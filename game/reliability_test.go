@@ -0,0 +1,38 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecayWeight(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	halfLife := 10 * 24 * time.Hour
+	for _, tc := range []struct {
+		resolvedAt time.Time
+		want       float64
+	}{
+		{now, 1},
+		{now.Add(time.Hour), 1},
+		{now.Add(-halfLife), 0.5},
+		{now.Add(-2 * halfLife), 0.25},
+		{time.Time{}, 0.5},
+	} {
+		if got := decayWeight(tc.resolvedAt, now, halfLife); got != tc.want {
+			t.Errorf("Got %v for %v, wanted %v", got, tc.resolvedAt, tc.want)
+		}
+	}
+}
+
+func TestDecayedReliability(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	halfLife := 10 * 24 * time.Hour
+	oldNMRs := []PhaseResult{{CreatedAt: now.Add(-10 * halfLife)}, {CreatedAt: now.Add(-10 * halfLife)}}
+	recentNMRs := []PhaseResult{{CreatedAt: now}, {CreatedAt: now}}
+	ready := []PhaseResult{{CreatedAt: now}, {CreatedAt: now}}
+	improved := reliability(decayedPhaseCount(ready, now, halfLife), 0, decayedPhaseCount(oldNMRs, now, halfLife), 0)
+	declined := reliability(decayedPhaseCount(ready, now, halfLife), 0, decayedPhaseCount(recentNMRs, now, halfLife), 0)
+	if improved <= declined {
+		t.Errorf("Got %v with old NMRs and %v with recent NMRs, wanted old NMRs to weigh less", improved, declined)
+	}
+}
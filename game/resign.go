@@ -0,0 +1,206 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip/variants"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	// resignationNMRPhases is how many NMR phases a resignation counts as when calculating reliability.
+	resignationNMRPhases = 5
+)
+
+func (g *Game) HasAbandonedMember() bool {
+	for _, member := range g.Members {
+		if member.Abandoned {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Game) HasResigned(userId string) bool {
+	for _, resignedId := range g.ResignedUserIds {
+		if resignedId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// Resignable returns whether the member can resign from the game.
+func (g *Game) Resignable(member *Member) bool {
+	return g.Started && g.Mustered && !g.Finished && !member.NewestPhaseState.Eliminated
+}
+
+/*
+ * resignGame lets a member give up their nation in a started game. The seat is opened for
+ * replacements, and until someone joins the nation is in civil disorder: it has no orders,
+ * is ready to resolve and wants a draw, like a member on probation.
+ */
+func resignGame(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		*game = Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+		game.ID = gameID
+
+		member, isMember := game.GetMemberByUserId(user.Id)
+		if !isMember {
+			return HTTPErr{"can only resign from member games", http.StatusNotFound}
+		}
+		if !game.Resignable(member) || len(game.NewestPhaseMeta) != 1 {
+			return HTTPErr{"can only resign from started, mustered and unfinished games where you aren't eliminated", http.StatusPreconditionFailed}
+		}
+
+		phaseID, err := PhaseID(ctx, gameID, game.NewestPhaseMeta[0].PhaseOrdinal)
+		if err != nil {
+			return err
+		}
+		if err := abandonNation(ctx, game, phaseID, member); err != nil {
+			return err
+		}
+
+		// The user stays on the seat, so that the nation is still attributed to them, until a replacement joins.
+		member.GameAlias = ""
+		member.Replaceable = true
+		member.Abandoned = true
+		game.ResignedUserIds = append(game.ResignedUserIds, user.Id)
+		if err := game.DBSave(ctx); err != nil {
+			return err
+		}
+
+		if err := UpdateUserStatsASAP(ctx, []string{user.Id}); err != nil {
+			return err
+		}
+
+		members := make([]string, len(game.Members))
+		for idx := range game.Members {
+			members[idx] = string(game.Members[idx].Nation)
+		}
+		notificationBody := fmt.Sprintf("%v resigned from the game. The nation is in civil disorder until a replacement joins.", member.Nation)
+		if err := AsyncSendMsgFunc.EnqueueIn(
+			ctx, 0,
+			game.ID,
+			DiplicitySender,
+			members,
+			notificationBody,
+			r.Req().Host,
+		); err != nil {
+			log.Errorf(ctx, "AsyncSendMsgFunc(..., %v, %v, %+v, %q, %q): %v; fix it?", game.ID, DiplicitySender, members, notificationBody, r.Req().Host, err)
+			return err
+		}
+
+		return nil
+	}, &datastore.TransactionOptions{XG: true}); err != nil {
+		return err
+	}
+
+	game.Redact(user, viewerIsSuperuser(ctx, user), r)
+	w.SetContent(game.Item(r))
+	return nil
+}
+
+// abandonNation removes the orders of the member in the phase, and puts the member on probation
+// so that the phase resolves without them. Must be run inside a transaction.
+func abandonNation(ctx context.Context, game *Game, phaseID *datastore.Key, member *Member) error {
+	orderIDs, err := datastore.NewQuery(orderKind).Ancestor(phaseID).Filter("Nation=", member.Nation).KeysOnly().GetAll(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := datastore.DeleteMulti(ctx, orderIDs); err != nil {
+		return err
+	}
+
+	phaseStateID, err := PhaseStateID(ctx, phaseID, member.Nation)
+	if err != nil {
+		return err
+	}
+	phaseState := &PhaseState{}
+	if err := datastore.Get(ctx, phaseStateID, phaseState); err == datastore.ErrNoSuchEntity {
+		phaseState.GameID = game.ID
+		phaseState.PhaseOrdinal = game.NewestPhaseMeta[0].PhaseOrdinal
+		phaseState.Nation = member.Nation
+	} else if err != nil {
+		return err
+	}
+	phaseState.ReadyToResolve = true
+	phaseState.WantsDIAS = true
+	phaseState.OnProbation = true
+	if _, err := datastore.Put(ctx, phaseStateID, phaseState); err != nil {
+		return err
+	}
+	member.NewestPhaseState = *phaseState
+
+	allStates := PhaseStates{}
+	if _, err := datastore.NewQuery(phaseStateKind).Ancestor(phaseID).GetAll(ctx, &allStates); err != nil {
+		return err
+	}
+	found := false
+	for i := range allStates {
+		if allStates[i].Nation == member.Nation {
+			allStates[i] = *phaseState
+			found = true
+		}
+	}
+	if !found {
+		allStates = append(allStates, *phaseState)
+	}
+	if !game.Paused && allStates.AllReadyToResolve(variants.Variants[game.Variant].Nations) {
+		return asyncResolvePhaseFunc.EnqueueIn(ctx, 0, game.ID, phaseState.PhaseOrdinal)
+	}
+	return nil
+}
+
+// reclaimNation takes the nation of an abandoned member out of civil disorder, so that the
+// replacement gets to give orders in the current phase. Must be run inside a transaction.
+func reclaimNation(ctx context.Context, game *Game, member *Member) error {
+	if len(game.NewestPhaseMeta) != 1 {
+		return nil
+	}
+	phaseID, err := PhaseID(ctx, game.ID, game.NewestPhaseMeta[0].PhaseOrdinal)
+	if err != nil {
+		return err
+	}
+	phaseStateID, err := PhaseStateID(ctx, phaseID, member.Nation)
+	if err != nil {
+		return err
+	}
+	phaseState := &PhaseState{}
+	if err := datastore.Get(ctx, phaseStateID, phaseState); err == datastore.ErrNoSuchEntity {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	phaseState.ReadyToResolve = false
+	phaseState.WantsDIAS = false
+	phaseState.OnProbation = false
+	if _, err := datastore.Put(ctx, phaseStateID, phaseState); err != nil {
+		return err
+	}
+	member.NewestPhaseState = *phaseState
+	return nil
+}
@@ -0,0 +1,78 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+)
+
+func TestJoinableAbandoned(t *testing.T) {
+	g := &Game{
+		Variant:  "Classical",
+		Started:  true,
+		Mustered: true,
+		Closed:   true,
+		NMembers: 7,
+		Members:  Members{{Nation: godip.England, Replaceable: true}},
+	}
+	user := &auth.User{Id: "new"}
+	if g.Joinable(user) {
+		t.Errorf("Got joinable with a replaceable but not abandoned member, wanted not joinable")
+	}
+	g.Members[0].Abandoned = true
+	if !g.Joinable(user) {
+		t.Errorf("Got not joinable with an abandoned member, wanted joinable")
+	}
+	g.Finished = true
+	if g.Joinable(user) {
+		t.Errorf("Got joinable finished game, wanted not joinable")
+	}
+}
+
+func TestResignable(t *testing.T) {
+	g := &Game{Started: true, Mustered: true}
+	member := &Member{Nation: godip.England}
+	if !g.Resignable(member) {
+		t.Errorf("Got not resignable in a running game, wanted resignable")
+	}
+	member.NewestPhaseState.Eliminated = true
+	if g.Resignable(member) {
+		t.Errorf("Got resignable for an eliminated member, wanted not resignable")
+	}
+	member.NewestPhaseState.Eliminated = false
+	g.Finished = true
+	if g.Resignable(member) {
+		t.Errorf("Got resignable in a finished game, wanted not resignable")
+	}
+}
+
+func TestResignedMemberVacant(t *testing.T) {
+	g := &Game{
+		Members: Members{
+			{User: auth.User{Id: "resigned"}, Nation: godip.England, Replaceable: true, Abandoned: true},
+			{User: auth.User{Id: "playing"}, Nation: godip.France},
+			{Nation: godip.Germany, Replaceable: true},
+		},
+	}
+	for i, want := range []bool{true, false, true} {
+		if got := g.Members[i].Vacant(); got != want {
+			t.Errorf("Got vacant %v for %+v, wanted %v", got, g.Members[i], want)
+		}
+	}
+	if _, found := g.GetMemberByUserId("resigned"); found {
+		t.Errorf("Found the resigned user as a member, wanted not found")
+	}
+	if member, found := g.GetMemberByUserId("playing"); !found || member.Nation != godip.France {
+		t.Errorf("Got %+v, %v, wanted France", member, found)
+	}
+}
+
+func TestReliabilityCountsResignations(t *testing.T) {
+	if got := reliability(10, 0, 0, 0); got != 10 {
+		t.Errorf("Got %v, wanted 10", got)
+	}
+	if got, want := reliability(12, 0, 0, 1), 12.0/float64(resignationNMRPhases+1); got != want {
+		t.Errorf("Got %v, wanted %v", got, want)
+	}
+}
@@ -38,6 +38,11 @@ func handleIndex(w ResponseWriter, r Request) error {
 				"The source code for this service can be found at https://github.com/zond/diplicity.",
 				"Patches are welcome!",
 			},
+			[]string{
+				"Deadline calendar",
+				"The `calendar` link of the `calendar-token` is an iCalendar feed of the upcoming phase deadlines in your started games.",
+				"It contains a secret token instead of requiring authentication, so that calendar apps can subscribe to it. Don't share it, and rotate the token if you did.",
+			},
 			[]string{
 				"Creating games",
 				"Most fields when creating games are self explanatory, but some of them require a bit of extra help.",
@@ -45,6 +50,7 @@ func handleIndex(w ResponseWriter, r Request) error {
 				"FirstMember.NationPreferences is the nations the game creator wants to play, in order of preference. This is the same NationPreferences as when updating a game membership.",
 				"NoMerge should be set to true if the game should _not_ be merged with another open public game with the same settings.",
 				"Private should be set to true if the game should _not_ show up in any game lists other than 'My ...'.",
+				"Add `preset=<Name>` to the URL to use the settings of one of the game-presets for all fields not in the body.",
 			},
 		}).AddLink(r.NewLink(Link{
 		Rel:   "self",
@@ -58,9 +64,15 @@ func handleIndex(w ResponseWriter, r Request) error {
 	})).AddLink(r.NewLink(Link{
 		Rel:   "global-stats",
 		Route: GlobalStatsRoute,
+	})).AddLink(r.NewLink(Link{
+		Rel:   "game-presets",
+		Route: ListGamePresetsRoute,
 	})).AddLink(r.NewLink(Link{
 		Rel:   "rss",
 		Route: RssRoute,
+	})).AddLink(r.NewLink(Link{
+		Rel:   "finished-games-atom",
+		Route: FinishedGamesAtomRoute,
 	})).AddLink(r.NewLink(AllocationResource.Link("test-allocation", Create, nil))).
 		AddLink(r.NewLink(ForumMailResource.Link("latest-forum-mail", Load, nil)))
 
@@ -94,6 +106,9 @@ func handleIndex(w ResponseWriter, r Request) error {
 		})).AddLink(r.NewLink(Link{
 			Rel:   "top-hater-players",
 			Route: ListTopHaterPlayersRoute,
+		})).AddLink(r.NewLink(Link{
+			Rel:   "top-net-hated-players",
+			Route: ListTopNetHatedPlayersRoute,
 		})).AddLink(r.NewLink(Link{
 			Rel:   "top-quick-players",
 			Route: ListTopQuickPlayersRoute,
@@ -103,8 +118,12 @@ func handleIndex(w ResponseWriter, r Request) error {
 		addGamesHandlerLink(r, index, masteredFinishedGamesHandler)
 		addGamesHandlerLink(r, index, myStagingGamesHandler)
 		addGamesHandlerLink(r, index, myStartedGamesHandler)
+		addGamesHandlerLink(r, index, myActiveGamesHandler)
+		addGamesHandlerLink(r, index, myNeedsOrdersGamesHandler)
 		addGamesHandlerLink(r, index, myFinishedGamesHandler)
 		addGamesHandlerLink(r, index, openGamesHandler)
+		addGamesHandlerLink(r, index, replaceableGamesHandler)
+		addGamesHandlerLink(r, index, searchGamesHandler)
 		addGamesHandlerLink(r, index, startedGamesHandler)
 		addGamesHandlerLink(r, index, finishedGamesHandler)
 		index.AddLink(r.NewLink(Link{
@@ -121,6 +140,16 @@ func handleIndex(w ResponseWriter, r Request) error {
 				Route:       ListBansRoute,
 				RouteParams: []string{"user_id", user.Id},
 			})).AddLink(r.NewLink(UserStatsResource.Link("user-stats", Load, []string{"user_id", user.Id})))
+		index.AddLink(r.NewLink(Link{
+			Rel:         "hate",
+			Route:       GetHateRoute,
+			RouteParams: []string{"user_id", user.Id},
+		}))
+		index.AddLink(r.NewLink(Link{
+			Rel:         "calendar-token",
+			Route:       GetCalendarTokenRoute,
+			RouteParams: []string{"user_id", user.Id},
+		}))
 	}
 	w.SetContent(index)
 	return nil
@@ -268,6 +268,9 @@ func handleRss(w ResponseWriter, r Request) error {
 	events := map[time.Time][]event{}
 	eventTimes := []time.Time{}
 	for _, game := range games {
+		if game.Replay {
+			continue
+		}
 		limit, err := strconv.ParseInt(uq.Get("phaseLimit"), 10, 64)
 		if err != nil {
 			// Default to the last four phases per game.
@@ -377,3 +380,138 @@ func handleRss(w ResponseWriter, r Request) error {
 
 	return nil
 }
+
+// The maximum number of games to include in the finished games feed.
+const maxFinishedGamesFeedEntries = 32
+
+// summary describes the outcome of the game: who won, and the final supply center counts.
+func (r *GameResult) summary() string {
+	lines := []string{}
+	if r.SoloWinnerMember != "" {
+		lines = append(lines, fmt.Sprintf("Solo victory by %s.", r.SoloWinnerMember))
+	} else if len(r.DIASMembers) > 0 {
+		winners := make([]string, len(r.DIASMembers))
+		for idx, nation := range r.DIASMembers {
+			winners[idx] = string(nation)
+		}
+		lines = append(lines, fmt.Sprintf("Draw between %s.", strings.Join(winners, ", ")))
+	}
+	scores := make(GameScores, len(r.Scores))
+	copy(scores, r.Scores)
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].SCs != scores[j].SCs {
+			return scores[i].SCs > scores[j].SCs
+		}
+		return scores[i].Member < scores[j].Member
+	})
+	for _, score := range scores {
+		lines = append(lines, fmt.Sprintf("%s: %d SCs", score.Member, score.SCs))
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+ * handleFinishedGamesAtom returns an Atom feed of the newest public finished games,
+ * optionally of the variant in the `variant` query parameter, with their results.
+ */
+func handleFinishedGamesAtom(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	uq := r.Req().URL.Query()
+
+	limit, err := strconv.ParseInt(uq.Get("limit"), 10, 64)
+	if err != nil || limit > maxFinishedGamesFeedEntries || limit < 1 {
+		limit = maxFinishedGamesFeedEntries
+	}
+
+	q := finishedGamesHandler.query.Filter("Private=", false)
+	variantFilter := uq.Get("variant")
+	if variantFilter != "" {
+		q = q.Filter("Variant=", variantFilter)
+	}
+	q = q.Order("-FinishedAt").Limit(int(limit))
+
+	games := Games{}
+	gameIDs, err := q.GetAll(ctx, &games)
+	if err != nil {
+		return err
+	}
+
+	lastModified := time.Time{}
+	gameResultIDs := make([]*datastore.Key, len(gameIDs))
+	for idx, gameID := range gameIDs {
+		games[idx].ID = gameID
+		gameResultIDs[idx] = GameResultID(ctx, gameID)
+		if games[idx].FinishedAt.After(lastModified) {
+			lastModified = games[idx].FinishedAt
+		}
+	}
+	lastModified = lastModified.UTC().Truncate(time.Second)
+
+	if ifDate, err := time.Parse(httpDateFormat, r.Req().Header.Get("If-Modified-Since")); err == nil && !lastModified.After(ifDate) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	gameResults := make([]GameResult, len(gameIDs))
+	if err := datastore.GetMulti(ctx, gameResultIDs, gameResults); err != nil {
+		if merr, ok := err.(appengine.MultiError); ok {
+			for _, serr := range merr {
+				// Games finished before game results existed have no results to summarize.
+				if serr != nil && serr != datastore.ErrNoSuchEntity {
+					return err
+				}
+			}
+		} else {
+			return err
+		}
+	}
+
+	appURL, err := makeURL(IndexRoute, r.Req().Host)
+	if err != nil {
+		return err
+	}
+	title := "Diplicity finished games"
+	if variantFilter != "" {
+		title = fmt.Sprintf("Diplicity finished %s games", variantFilter)
+	}
+	feed := &feeds.Feed{
+		Title:       title,
+		Link:        &feeds.Link{Href: appURL.String()},
+		Description: "Feed of results of finished Diplicity games.",
+		Author:      &feeds.Author{Name: "Diplicity", Email: "diplicity-talk@googlegroups.com"},
+		Updated:     lastModified,
+	}
+
+	feed.Items = []*feeds.Item{}
+	for idx := range games {
+		game := &games[idx]
+		link := appURL.String()
+		if len(game.NewestPhaseMeta) > 0 {
+			phaseURL, err := makeURL(RenderPhaseMapRoute, r.Req().Host, "game_id", game.ID.Encode(), "phase_ordinal", fmt.Sprint(game.NewestPhaseMeta[0].PhaseOrdinal))
+			if err != nil {
+				return err
+			}
+			link = phaseURL.String()
+		}
+		feed.Items = append(feed.Items, &feeds.Item{
+			Title:       fmt.Sprintf("%s (%s)", game.Desc, game.Variant),
+			Link:        &feeds.Link{Href: link},
+			Description: gameResults[idx].summary(),
+			Id:          link,
+			Created:     game.FinishedAt,
+			Updated:     game.FinishedAt,
+		})
+	}
+
+	atom, err := feed.ToAtom()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Last-Modified", lastModified.Format(httpDateFormat))
+	w.Header().Set("Cache-Control", "public, max-age=3600") // 1 hour
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(atom))
+	return nil
+}
@@ -0,0 +1,203 @@
+package game
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+const (
+	// MemberRoleSpectator is the Role of the Spectators of a game. They have no nation, and
+	// aren't returned by GetMemberByUserId, so they have the access of non members: public
+	// channels, resolved phases, and orders of resolved phases. If the game has a
+	// SpectatorDelayMinutes, all non members only see phases, resolutions and messages older
+	// than that.
+	MemberRoleSpectator = "Spectator"
+
+	// How many spectators each game can have.
+	maxSpectators = 64
+)
+
+func (g *Game) GetSpectatorByUserId(userID string) (*Member, bool) {
+	for i := range g.Spectators {
+		if g.Spectators[i].User.Id == userID {
+			return &g.Spectators[i], true
+		}
+	}
+	return nil, false
+}
+
+// Spectatable returns whether user can start spectating the game.
+func (g *Game) Spectatable(user *auth.User) bool {
+	if !g.AllowSpectators || g.Finished || len(g.Spectators) >= maxSpectators {
+		return false
+	}
+	if _, isMember := g.GetMemberByUserId(user.Id); isMember {
+		return false
+	}
+	_, isSpectator := g.GetSpectatorByUserId(user.Id)
+	return !isSpectator
+}
+
+// nonMemberCutoff returns the time phases and messages must be created before to be visible to userID at now,
+// and whether userID is a non member, spectating or not, who only sees things that old. The game master sees
+// everything, and the delay ends when the game finishes.
+func (g *Game) nonMemberCutoff(userID string, now time.Time) (time.Time, bool) {
+	if g.Finished || g.SpectatorDelayMinutes < 1 || userID == g.GameMaster.Id {
+		return time.Time{}, false
+	}
+	if _, isMember := g.GetMemberByUserId(userID); isMember {
+		return time.Time{}, false
+	}
+	return now.Add(-time.Minute * g.SpectatorDelayMinutes), true
+}
+
+// delayTo makes the phase meta look like it did at cutoff, by hiding resolutions after it.
+func (p *PhaseMeta) delayTo(cutoff time.Time) {
+	if p.Resolved && p.ResolvedAt.After(cutoff) {
+		p.Resolved = false
+		p.ResolvedAt = time.Time{}
+		p.ResolvedAgo = 0
+	}
+}
+
+// delayTo makes the phase look like it did at cutoff, and returns whether it existed then.
+func (p *Phase) delayTo(cutoff time.Time) bool {
+	if p.CreatedAt.After(cutoff) {
+		return false
+	}
+	if p.Resolved && p.ResolvedAt.After(cutoff) {
+		p.PhaseMeta.delayTo(cutoff)
+		p.Resolutions = nil
+		p.ForceDisbands = nil
+	}
+	return true
+}
+
+// delayPhaseFor makes the phase look like it did at the cutoff of userID, and returns a 404 if it didn't exist then.
+func (g *Game) delayPhaseFor(userID string, phase *Phase) error {
+	if cutoff, delayed := g.nonMemberCutoff(userID, time.Now()); delayed && !phase.delayTo(cutoff) {
+		return HTTPErr{"phase not visible yet", http.StatusNotFound}
+	}
+	return nil
+}
+
+// delayNewestPhaseMetaTo replaces the newest phase meta with the newest phase meta at cutoff.
+func (g *Game) delayNewestPhaseMetaTo(ctx context.Context, cutoff time.Time) error {
+	if len(g.NewestPhaseMeta) != 1 {
+		return nil
+	}
+	if !g.NewestPhaseMeta[0].CreatedAt.After(cutoff) {
+		g.NewestPhaseMeta[0].delayTo(cutoff)
+		return nil
+	}
+	phases := Phases{}
+	if _, err := datastore.NewQuery(phaseKind).Ancestor(g.ID).Filter("CreatedAt<=", cutoff).Order("-CreatedAt").Limit(1).GetAll(ctx, &phases); err != nil {
+		return err
+	}
+	g.NewestPhaseMeta = nil
+	if len(phases) > 0 {
+		phases[0].PhaseMeta.delayTo(cutoff)
+		phases[0].PhaseMeta.Refresh()
+		g.NewestPhaseMeta = []PhaseMeta{phases[0].PhaseMeta}
+	}
+	return nil
+}
+
+// delayTo makes the channel look like it did at cutoff, by replacing the latest message and the message count.
+func (c *Channel) delayTo(ctx context.Context, cutoff time.Time) error {
+	if !c.LatestMessage.CreatedAt.After(cutoff) {
+		return nil
+	}
+	channelID, err := c.ID(ctx)
+	if err != nil {
+		return err
+	}
+	query := datastore.NewQuery(messageKind).Ancestor(channelID).Filter("CreatedAt<=", cutoff)
+	if c.NMessages, err = query.Count(ctx); err != nil {
+		return err
+	}
+	latest := Messages{}
+	if _, err := query.Order("-CreatedAt").Limit(1).GetAll(ctx, &latest); err != nil {
+		return err
+	}
+	c.LatestMessage = Message{}
+	if len(latest) > 0 {
+		c.LatestMessage = latest[0]
+	}
+	return nil
+}
+
+// removeSpectator removes the spectator with userID, and returns whether there was one.
+func (g *Game) removeSpectator(userID string) bool {
+	for i := range g.Spectators {
+		if g.Spectators[i].User.Id == userID {
+			g.Spectators = append(g.Spectators[:i], g.Spectators[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// changeSpectating loads the game, lets change update it, and saves it, before returning it redacted.
+func changeSpectating(w ResponseWriter, r Request, change func(game *Game, user *auth.User) error) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	game := &Game{}
+	if err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		*game = Game{}
+		if err := datastore.Get(ctx, gameID, game); err != nil {
+			return err
+		}
+		game.ID = gameID
+		if err := change(game, user); err != nil {
+			return err
+		}
+		return game.DBSave(ctx)
+	}, &datastore.TransactionOptions{XG: false}); err != nil {
+		return err
+	}
+
+	game.Redact(user, viewerIsSuperuser(ctx, user), r)
+	w.SetContent(game.Item(r))
+	return nil
+}
+
+func spectateGame(w ResponseWriter, r Request) error {
+	return changeSpectating(w, r, func(game *Game, user *auth.User) error {
+		if !game.Spectatable(user) {
+			return HTTPErr{fmt.Sprintf("can only spectate unfinished games allowing spectators, with fewer than %d spectators, that you aren't already a member or spectator of", maxSpectators), http.StatusPreconditionFailed}
+		}
+		game.Spectators = append(game.Spectators, Member{
+			User: *user,
+			Role: MemberRoleSpectator,
+		})
+		return nil
+	})
+}
+
+func stopSpectatingGame(w ResponseWriter, r Request) error {
+	return changeSpectating(w, r, func(game *Game, user *auth.User) error {
+		if !game.removeSpectator(user.Id) {
+			return HTTPErr{"can only stop spectating games you spectate", http.StatusNotFound}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,102 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+)
+
+func TestSpectatable(t *testing.T) {
+	g := &Game{
+		Started: true,
+		Members: Members{{User: auth.User{Id: "player"}, Nation: godip.England}},
+	}
+	user := &auth.User{Id: "watcher"}
+	if g.Spectatable(user) {
+		t.Errorf("Got spectatable without AllowSpectators, wanted not spectatable")
+	}
+	g.AllowSpectators = true
+	if !g.Spectatable(user) {
+		t.Errorf("Got not spectatable, wanted spectatable")
+	}
+	if g.Spectatable(&auth.User{Id: "player"}) {
+		t.Errorf("Got spectatable for a member, wanted not spectatable")
+	}
+	g.Spectators = append(g.Spectators, Member{User: *user, Role: MemberRoleSpectator})
+	if g.Spectatable(user) {
+		t.Errorf("Got spectatable for a spectator, wanted not spectatable")
+	}
+	if _, isMember := g.GetMemberByUserId(user.Id); isMember {
+		t.Errorf("Got spectator as member, wanted spectators to not be members")
+	}
+	if !g.removeSpectator(user.Id) || len(g.Spectators) != 0 {
+		t.Errorf("Got %+v after removing the spectator, wanted no spectators", g.Spectators)
+	}
+	if g.removeSpectator(user.Id) {
+		t.Errorf("Got removed twice, wanted removal to fail the second time")
+	}
+	g.Finished = true
+	if g.Spectatable(user) {
+		t.Errorf("Got spectatable finished game, wanted not spectatable")
+	}
+}
+
+func TestNonMemberCutoff(t *testing.T) {
+	now := time.Now()
+	g := &Game{
+		Started:               true,
+		AllowSpectators:       true,
+		SpectatorDelayMinutes: 30,
+		Members:               Members{{User: auth.User{Id: "player"}, Nation: godip.England}},
+		Spectators:            Members{{User: auth.User{Id: "watcher"}, Role: MemberRoleSpectator}},
+		GameMaster:            auth.User{Id: "master"},
+	}
+	if _, delayed := g.nonMemberCutoff("player", now); delayed {
+		t.Errorf("Got a delayed member, wanted members to see everything")
+	}
+	if _, delayed := g.nonMemberCutoff("master", now); delayed {
+		t.Errorf("Got a delayed game master, wanted the game master to see everything")
+	}
+	if _, delayed := g.nonMemberCutoff("passerby", now); !delayed {
+		t.Errorf("Got an undelayed non member, wanted non members to be delayed even when not spectating")
+	}
+	cutoff, delayed := g.nonMemberCutoff("watcher", now)
+	if !delayed {
+		t.Fatalf("Got an undelayed spectator, wanted a delay")
+	}
+	if postedAt := now.Add(-time.Minute); !postedAt.After(cutoff) {
+		t.Errorf("Got a message posted a minute ago visible with cutoff %v, wanted it hidden", cutoff)
+	}
+	if postedAt := now.Add(-31 * time.Minute); postedAt.After(cutoff) {
+		t.Errorf("Got a message posted 31 minutes ago hidden with cutoff %v, wanted it visible", cutoff)
+	}
+	g.Finished = true
+	if _, delayed := g.nonMemberCutoff("watcher", now); delayed {
+		t.Errorf("Got a delayed spectator in a finished game, wanted no delay")
+	}
+}
+
+func TestPhaseDelayTo(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-30 * time.Minute)
+	newer := &Phase{PhaseMeta: PhaseMeta{CreatedAt: now.Add(-time.Minute)}}
+	if newer.delayTo(cutoff) {
+		t.Errorf("Got a phase created after the cutoff visible, wanted it hidden")
+	}
+	resolvedAfter := &Phase{
+		PhaseMeta:   PhaseMeta{CreatedAt: now.Add(-time.Hour), Resolved: true, ResolvedAt: now.Add(-time.Minute)},
+		Resolutions: []Resolution{{Province: "par", Resolution: "OK"}},
+	}
+	if !resolvedAfter.delayTo(cutoff) || resolvedAfter.Resolved || resolvedAfter.Resolutions != nil {
+		t.Errorf("Got %+v, wanted a visible phase without the resolution after the cutoff", resolvedAfter)
+	}
+	resolvedBefore := &Phase{
+		PhaseMeta:   PhaseMeta{CreatedAt: now.Add(-2 * time.Hour), Resolved: true, ResolvedAt: now.Add(-time.Hour)},
+		Resolutions: []Resolution{{Province: "par", Resolution: "OK"}},
+	}
+	if !resolvedBefore.delayTo(cutoff) || !resolvedBefore.Resolved || len(resolvedBefore.Resolutions) != 1 {
+		t.Errorf("Got %+v, wanted the resolution before the cutoff kept", resolvedBefore)
+	}
+}
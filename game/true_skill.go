@@ -73,6 +73,12 @@ type TrueSkillContent struct {
 	Mu        float64
 	Sigma     float64
 	Rating    float64
+
+	// The rating considering only games of the same variant.
+	Variant       string
+	VariantMu     float64
+	VariantSigma  float64
+	VariantRating float64
 }
 
 type TrueSkill struct {
@@ -105,6 +111,29 @@ func GetTrueSkill(ctx context.Context, userId string) (*TrueSkill, error) {
 	return &trueSkills[0], nil
 }
 
+// GetVariantTrueSkill returns the latest TrueSkill of the user in the variant,
+// with the Variant* fields containing the rating considering only games of that variant.
+func GetVariantTrueSkill(ctx context.Context, userId string, variant string) (*TrueSkill, error) {
+	trueSkills := []TrueSkill{}
+	if _, err := datastore.NewQuery(trueSkillKind).Filter("UserId=", userId).Filter("Variant=", variant).Order("-CreatedAt").Limit(1).GetAll(ctx, &trueSkills); err != nil {
+		return nil, err
+	}
+	if len(trueSkills) == 0 {
+		ts := trueskill.New()
+		player := ts.NewPlayer()
+		return &TrueSkill{
+			TrueSkillContent: TrueSkillContent{
+				UserId:        userId,
+				Variant:       variant,
+				VariantMu:     player.Mu(),
+				VariantSigma:  player.Sigma(),
+				VariantRating: ts.TrueSkill(player),
+			},
+		}, nil
+	}
+	return &trueSkills[0], nil
+}
+
 func (t *TrueSkillContent) ID(ctx context.Context) (*datastore.Key, error) {
 	if t.GameID == nil || t.GameID.IntID() == 0 || t.UserId == "" {
 		return nil, fmt.Errorf("TrueSkills must have game IDs with non zero int ID, and non empty user IDs")
@@ -0,0 +1,77 @@
+package game
+
+import (
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+)
+
+const (
+	OutcomePlaying    = "Playing"
+	OutcomeSolo       = "Solo"
+	OutcomeDIAS       = "DIAS"
+	OutcomeEliminated = "Eliminated"
+	OutcomeDropped    = "Dropped"
+	OutcomeSurvived   = "Survived"
+)
+
+// UserGameHistory is what happened to one user in a game, as listed in /Users/{user_id}/Games.
+type UserGameHistory struct {
+	UserId string
+	// Nation is empty when the members of the game are anonymous to the viewer.
+	Nation  godip.Nation `json:",omitempty"`
+	Outcome string
+	SCs     int
+	Score   float64
+}
+
+// anonymizesMembers returns whether the identities of the members are hidden from other viewers, until the game finishes.
+func (g *Game) anonymizesMembers() bool {
+	return !g.Finished && (g.Anonymous || (!g.Private && g.DisablePrivateChat && g.DisableGroupChat && g.DisableConferenceChat))
+}
+
+// userHistory returns the history of the member with userId in the game as seen by viewer, or nil if there is no such member.
+// Superuser viewers see the nations of anonymous games. The Result of finished games must be loaded for their outcomes and
+// scores to be included.
+func (g *Game) userHistory(userId string, viewer *auth.User, viewerIsSuperuser bool) *UserGameHistory {
+	member, found := g.GetMemberByUserId(userId)
+	if !found {
+		return nil
+	}
+	history := &UserGameHistory{
+		UserId:  userId,
+		Outcome: OutcomePlaying,
+	}
+	if viewer.Id == userId || viewerIsSuperuser || !g.anonymizesMembers() {
+		history.Nation = member.Nation
+	}
+	if !g.Finished || g.Result == nil {
+		return history
+	}
+	contains := func(userIds []string) bool {
+		for _, id := range userIds {
+			if id == userId {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case g.Result.SoloWinnerUser == userId:
+		history.Outcome = OutcomeSolo
+	case contains(g.Result.DIASUsers):
+		history.Outcome = OutcomeDIAS
+	case contains(g.Result.EliminatedUsers):
+		history.Outcome = OutcomeEliminated
+	case contains(g.Result.NMRUsers):
+		history.Outcome = OutcomeDropped
+	default:
+		history.Outcome = OutcomeSurvived
+	}
+	for _, score := range g.Result.Scores {
+		if score.UserId == userId {
+			history.SCs = score.SCs
+			history.Score = score.Score
+		}
+	}
+	return history
+}
@@ -0,0 +1,85 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+)
+
+func TestUserHistory(t *testing.T) {
+	g := &Game{
+		Started: true,
+		Members: Members{
+			{User: auth.User{Id: "a"}, Nation: godip.England},
+			{User: auth.User{Id: "b"}, Nation: godip.France},
+		},
+	}
+	viewer := &auth.User{Id: "c"}
+	if h := g.userHistory("x", viewer, false); h != nil {
+		t.Errorf("Got %+v for a non member, wanted nil", h)
+	}
+	if h := g.userHistory("a", viewer, false); h.Outcome != OutcomePlaying || h.Nation != godip.England {
+		t.Errorf("Got %+v, wanted England playing", h)
+	}
+
+	g.Private = true
+	g.Anonymous = true
+	if h := g.userHistory("a", viewer, false); h.Nation != "" {
+		t.Errorf("Got %+v in an anonymous game, wanted no nation", h)
+	}
+	if h := g.userHistory("a", &auth.User{Id: "a"}, false); h.Nation != godip.England {
+		t.Errorf("Got %+v for the user themselves, wanted their nation", h)
+	}
+	if h := g.userHistory("a", viewer, true); h.Nation != godip.England {
+		t.Errorf("Got %+v for a superuser, wanted the nation", h)
+	}
+
+	g.Finished = true
+	g.Result = &GameResult{
+		SoloWinnerUser:  "b",
+		EliminatedUsers: []string{"a"},
+		Scores: GameScores{
+			{UserId: "a", SCs: 0, Score: 0},
+			{UserId: "b", SCs: 18, Score: 100},
+		},
+	}
+	if h := g.userHistory("a", viewer, false); h.Outcome != OutcomeEliminated || h.Nation != godip.England {
+		t.Errorf("Got %+v, wanted England eliminated", h)
+	}
+	if h := g.userHistory("b", viewer, false); h.Outcome != OutcomeSolo || h.SCs != 18 || h.Score != 100 {
+		t.Errorf("Got %+v, wanted a solo with 18 SCs and 100 points", h)
+	}
+}
+
+func TestAnonymizesMembers(t *testing.T) {
+	for _, tc := range []struct {
+		game *Game
+		want bool
+	}{
+		{&Game{}, false},
+		{&Game{Private: true}, false},
+		{&Game{Private: true, Anonymous: true}, true},
+		{&Game{Anonymous: true}, true},
+		{&Game{DisablePress: true}, false},
+		{&Game{Private: true, DisablePress: true}, false},
+		{&Game{DisablePrivateChat: true, DisableGroupChat: true, DisableConferenceChat: true}, true},
+		{&Game{DisablePrivateChat: true, DisableGroupChat: true}, false},
+		{&Game{Anonymous: true, DisablePress: true, Finished: true}, false},
+	} {
+		if got := tc.game.anonymizesMembers(); got != tc.want {
+			t.Errorf("Got %v for %+v, wanted %v", got, tc.game, tc.want)
+		}
+	}
+}
+
+func TestPressDisabled(t *testing.T) {
+	g := &Game{DisablePress: true}
+	if !g.pressDisabled() {
+		t.Errorf("Got press enabled in %+v, wanted disabled", g)
+	}
+	g.Finished = true
+	if g.pressDisabled() {
+		t.Errorf("Got press disabled in finished %+v, wanted enabled", g)
+	}
+}
@@ -7,9 +7,13 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip/variants"
 	"golang.org/x/net/context"
 	"google.golang.org/appengine/v2"
 	"google.golang.org/appengine/v2/datastore"
@@ -21,7 +25,10 @@ import (
 
 const (
 	userStatsKind          = "UserStats"
+	variantUserStatsKind   = "VariantUserStats"
 	userRatingHistogramKey = "userRatingsHistogram"
+	maxReliabilityHistory  = 20
+	maxRatingHistory       = 200
 )
 
 var (
@@ -35,7 +42,7 @@ func init() {
 	UpdateUserStatsFunc = NewDelayFunc("game-updateUserStats", updateUserStats)
 	updateUserStatFunc = NewDelayFunc("game-updateUserStat", updateUserStat)
 
-	userStatsListerParams := []string{"limit", "cursor"}
+	userStatsListerParams := []string{"limit", "cursor", "direction"}
 	UserStatsResource = &Resource{
 		Load:     loadUserStats,
 		FullPath: "/User/{user_id}/Stats",
@@ -44,7 +51,7 @@ func init() {
 				Path:        "/Users/TopRated",
 				Route:       ListTopRatedPlayersRoute,
 				Handler:     topRatedPlayersHandler.handle,
-				QueryParams: userStatsListerParams,
+				QueryParams: append([]string{"variant"}, userStatsListerParams...),
 			},
 			{
 				Path:        "/Users/TopReliable",
@@ -64,6 +71,12 @@ func init() {
 				Handler:     topHaterPlayersHandler.handle,
 				QueryParams: userStatsListerParams,
 			},
+			{
+				Path:        "/Users/TopNetHated",
+				Route:       ListTopNetHatedPlayersRoute,
+				Handler:     topNetHatedPlayersHandler.handle,
+				QueryParams: userStatsListerParams,
+			},
 			{
 				Path:        "/Users/TopQuick",
 				Route:       ListTopQuickPlayersRoute,
@@ -89,6 +102,12 @@ func updateUserStat(ctx context.Context, userId string) error {
 		return nil
 	}
 
+	oldUserStats := &UserStats{}
+	if err := datastore.Get(ctx, UserStatsID(ctx, userId), oldUserStats); err != nil && err != datastore.ErrNoSuchEntity {
+		log.Errorf(ctx, "Unable to load old stats for %q: %v; hope datastore gets fixed", userId, err)
+		return err
+	}
+
 	userStats := &UserStats{
 		UserId: userId,
 	}
@@ -100,12 +119,24 @@ func updateUserStat(ctx context.Context, userId string) error {
 		log.Errorf(ctx, "Unable to recalculate private user stats %v: %v; fix UserStatsNumbers#Recalculate", PP(userStats), err)
 		return err
 	}
+	userStats.ReliabilityHistory = append(oldUserStats.ReliabilityHistory, ReliabilitySample{
+		At:    time.Now(),
+		Value: userStats.Reliability,
+	})
+	if len(userStats.ReliabilityHistory) > maxReliabilityHistory {
+		userStats.ReliabilityHistory = userStats.ReliabilityHistory[len(userStats.ReliabilityHistory)-maxReliabilityHistory:]
+	}
 	latestTrueSkill, err := GetTrueSkill(ctx, userId)
 	if err != nil {
 		log.Errorf(ctx, "Unable to get latest TrueSkill for %q: %v; fix GetTrueSkill", userId, err)
 		return err
 	}
 	userStats.TrueSkill = *latestTrueSkill
+	userStats.RatingHistory = appendRatingSample(oldUserStats.RatingHistory, latestTrueSkill)
+	if err := updateVariantUserStats(ctx, userId); err != nil {
+		log.Errorf(ctx, "Unable to update variant user stats for %q: %v; hope datastore gets fixed", userId, err)
+		return err
+	}
 	user := &auth.User{}
 	if err := datastore.Get(ctx, auth.UserID(ctx, userId), user); err != nil {
 		log.Errorf(ctx, "Unable to load user for %q: %v; hope datastore gets fixed", userId, err)
@@ -159,27 +190,28 @@ func updateUserStats(ctx context.Context, origUids []string) error {
 
 type UserStatsSlice []UserStats
 
-func (u UserStatsSlice) Item(r Request, cursor *datastore.Cursor, limit int64, name string, desc []string, route string) *Item {
+func (u UserStatsSlice) Item(r Request, cursors pageCursors, limit int64, name string, desc []string, route string) *Item {
 	statsItems := make(List, len(u))
 	for i := range u {
 		statsItems[i] = u[i].Item(r)
 	}
+	max, err := configuredMaxLimit(appengine.NewContext(r.Req()))
+	if err != nil {
+		max = maxLimit
+	}
 	statsItem := NewItem(statsItems).SetName(name).SetDesc([][]string{
 		desc,
+		[]string{
+			"Cursor and limit",
+			fmt.Sprintf("The list contains at most %d players.", max),
+			"If there are more players, a 'next' link will be available with a 'cursor' query parameter.",
+			"Pages after the first also have a 'prev' link, which uses `direction=backward` to list the page before.",
+		},
 	}).AddLink(r.NewLink(Link{
 		Rel:   "self",
 		Route: route,
 	}))
-	if cursor != nil {
-		statsItem.AddLink(r.NewLink(Link{
-			Rel:   "next",
-			Route: route,
-			QueryParams: url.Values{
-				"cursor": []string{cursor.String()},
-				"limit":  []string{fmt.Sprint(limit)},
-			},
-		}))
-	}
+	cursors.addLinks(r, statsItem, route, nil, int(limit))
 	return statsItem
 }
 
@@ -193,17 +225,64 @@ type UserStatsNumbers struct {
 	DIASGames       int
 	EliminatedGames int
 	DroppedGames    int
+	ResignedGames   int
 
 	NMRPhases    int
 	ActivePhases int
 	ReadyPhases  int
 	Reliability  float64
 	Quickness    float64
+	// AverageResponseMinutes is the average time to declare ready in phases not resolved on timeout, from SampleCount phases.
+	AverageResponseMinutes float64
+	SampleCount            int
+	// HasResponseSamples is SampleCount > 0, to list only players with samples on the top quick players list.
+	HasResponseSamples bool
+	// PhaseTypeResponseTimes breaks AverageResponseMinutes down per phase type, see /User/{user_id}/Quickness.
+	PhaseTypeResponseTimes []PhaseTypeResponseTime `datastore:",noindex" json:"-"`
 
 	OwnedBans  int
 	SharedBans int
 	Hated      float64
 	Hater      float64
+	NetHate    float64
+
+	// Feedback received from other members of finished games.
+	FunToPlayWithFeedbacks int
+	ReliableFeedbacks      int
+	BackstabberFeedbacks   int
+}
+
+// ReliabilitySample is the public Reliability of a user at some point in time.
+type ReliabilitySample struct {
+	At    time.Time
+	Value float64
+}
+
+// RatingSample is the TrueSkill rating and deviation of a user after a rating update.
+type RatingSample struct {
+	At     time.Time
+	Rating float64
+	Sigma  float64
+}
+
+// appendRatingSample returns history with the rating of trueSkill appended, unless it's
+// already the latest sample or the default rating of users without rated games.
+func appendRatingSample(history []RatingSample, trueSkill *TrueSkill) []RatingSample {
+	if trueSkill.CreatedAt.IsZero() {
+		return history
+	}
+	if len(history) > 0 && !history[len(history)-1].At.Before(trueSkill.CreatedAt) {
+		return history
+	}
+	history = append(history, RatingSample{
+		At:     trueSkill.CreatedAt,
+		Rating: trueSkill.Rating,
+		Sigma:  trueSkill.Sigma,
+	})
+	if len(history) > maxRatingHistory {
+		history = history[len(history)-maxRatingHistory:]
+	}
+	return history
 }
 
 type UserStats struct {
@@ -213,6 +292,12 @@ type UserStats struct {
 
 	PrivateStats UserStatsNumbers
 
+	// ReliabilityHistory contains the last maxReliabilityHistory values of Reliability, oldest first.
+	ReliabilityHistory []ReliabilitySample `datastore:",noindex"`
+
+	// RatingHistory contains the last maxRatingHistory TrueSkill ratings, oldest first.
+	RatingHistory []RatingSample `datastore:",noindex" json:"-"`
+
 	TrueSkill TrueSkill
 
 	User auth.User
@@ -276,8 +361,26 @@ func loadUserStats(w ResponseWriter, r Request) (*UserStats, error) {
 
 func (u *UserStats) Item(r Request) *Item {
 	u.User.Email = ""
-	return NewItem(u).SetName("user-stats").
+	if u.ReliabilityHistory == nil {
+		u.ReliabilityHistory = []ReliabilitySample{}
+	}
+	item := NewItem(u).SetName("user-stats").
 		AddLink(r.NewLink(UserStatsResource.Link("self", Load, []string{"user_id", u.UserId}))).
+		AddLink(r.NewLink(Link{
+			Rel:         "rating-history",
+			Route:       GetRatingHistoryRoute,
+			RouteParams: []string{"user_id", u.UserId},
+		})).
+		AddLink(r.NewLink(Link{
+			Rel:         "quickness",
+			Route:       GetQuicknessRoute,
+			RouteParams: []string{"user_id", u.UserId},
+		})).
+		AddLink(r.NewLink(Link{
+			Rel:         "games",
+			Route:       ListUserGamesRoute,
+			RouteParams: []string{"user_id", u.UserId},
+		})).
 		AddLink(r.NewLink(Link{
 			Rel:         "finished-games",
 			Route:       ListOtherFinishedGamesRoute,
@@ -293,6 +396,19 @@ func (u *UserStats) Item(r Request) *Item {
 			Route:       ListOtherStartedGamesRoute,
 			RouteParams: []string{"user_id", u.UserId},
 		}))
+	if viewer, ok := r.Values()["user"].(*auth.User); ok && viewer.Id != u.UserId {
+		item.AddLink(r.NewLink(Link{
+			Rel:         "head-to-head",
+			Route:       GetHeadToHeadRoute,
+			RouteParams: []string{"user_id", viewer.Id, "other_user_id", u.UserId},
+		}))
+	}
+	return item
+}
+
+// reliability counts each resigned game as resignationNMRPhases NMR phases. The phase counts may be decayed, see decayedPhaseCount.
+func reliability(readyPhases, activePhases, nmrPhases float64, resignedGames int) float64 {
+	return (readyPhases + activePhases) / (nmrPhases + float64(resignationNMRPhases*resignedGames) + 1)
 }
 
 func (u *UserStatsNumbers) Recalculate(ctx context.Context, private bool, userId string) error {
@@ -323,17 +439,34 @@ func (u *UserStatsNumbers) Recalculate(ctx context.Context, private bool, userId
 		return err
 	}
 
-	if u.NMRPhases, err = datastore.NewQuery(phaseResultKind).Filter("NMRUsers=", userId).Filter("Private=", private).Count(ctx); err != nil {
+	if u.ResignedGames, err = datastore.NewQuery(gameKind).Filter("ResignedUserIds=", userId).Filter("Private=", private).Count(ctx); err != nil {
 		return err
 	}
-	if u.ActivePhases, err = datastore.NewQuery(phaseResultKind).Filter("ActiveUsers=", userId).Filter("Private=", private).Count(ctx); err != nil {
+
+	halfLife, err := configuredReliabilityHalfLife(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	decayedNMRPhases, decayedActivePhases, decayedReadyPhases := 0.0, 0.0, 0.0
+	if u.NMRPhases, decayedNMRPhases, err = countPhaseResults(ctx, datastore.NewQuery(phaseResultKind).Filter("NMRUsers=", userId).Filter("Private=", private), now, halfLife); err != nil {
+		return err
+	}
+	if u.ActivePhases, decayedActivePhases, err = countPhaseResults(ctx, datastore.NewQuery(phaseResultKind).Filter("ActiveUsers=", userId).Filter("Private=", private), now, halfLife); err != nil {
 		return err
 	}
-	if u.ReadyPhases, err = datastore.NewQuery(phaseResultKind).Filter("ReadyUsers=", userId).Filter("Private=", private).Count(ctx); err != nil {
+	if u.ReadyPhases, decayedReadyPhases, err = countPhaseResults(ctx, datastore.NewQuery(phaseResultKind).Filter("ReadyUsers=", userId).Filter("Private=", private), now, halfLife); err != nil {
 		return err
 	}
-	u.Reliability = float64(u.ReadyPhases+u.ActivePhases) / float64(u.NMRPhases+1)
+	u.Reliability = reliability(decayedReadyPhases, decayedActivePhases, decayedNMRPhases, u.ResignedGames)
 	u.Quickness = float64(u.ReadyPhases) / float64(u.ActivePhases+u.NMRPhases+1)
+	sampledPhaseResults := []PhaseResult{}
+	if _, err := datastore.NewQuery(phaseResultKind).Filter("ResponseTimes.UserId=", userId).Filter("Private=", private).GetAll(ctx, &sampledPhaseResults); err != nil {
+		return err
+	}
+	u.AverageResponseMinutes, u.SampleCount = averageResponseMinutes(sampledPhaseResults, userId)
+	u.PhaseTypeResponseTimes = responseMinutesByPhaseType(sampledPhaseResults, userId)
+	u.HasResponseSamples = u.SampleCount > 0
 
 	if u.OwnedBans, err = datastore.NewQuery(banKind).Filter("OwnerIds=", userId).Count(ctx); err != nil {
 		return err
@@ -343,6 +476,17 @@ func (u *UserStatsNumbers) Recalculate(ctx context.Context, private bool, userId
 	}
 	u.Hater = float64(u.OwnedBans) / float64(u.StartedGames+1)
 	u.Hated = float64(u.SharedBans-u.OwnedBans) / float64(u.StartedGames+1)
+	u.NetHate = u.Hated - u.Hater
+
+	if u.FunToPlayWithFeedbacks, err = datastore.NewQuery(feedbackKind).Filter("RateeId=", userId).Filter("Private=", private).Filter("FunToPlayWith=", true).Count(ctx); err != nil {
+		return err
+	}
+	if u.ReliableFeedbacks, err = datastore.NewQuery(feedbackKind).Filter("RateeId=", userId).Filter("Private=", private).Filter("Reliable=", true).Count(ctx); err != nil {
+		return err
+	}
+	if u.BackstabberFeedbacks, err = datastore.NewQuery(feedbackKind).Filter("RateeId=", userId).Filter("Private=", private).Filter("Backstabber=", true).Count(ctx); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -350,6 +494,59 @@ func UserStatsID(ctx context.Context, userId string) *datastore.Key {
 	return datastore.NewKey(ctx, userStatsKind, userId, 0, nil)
 }
 
+// VariantUserStats contains the rating of a user considering only games of one variant,
+// to allow sorting players per variant.
+type VariantUserStats struct {
+	UserId    string
+	Variant   string
+	Mu        float64
+	Sigma     float64
+	Rating    float64
+	UpdatedAt time.Time
+}
+
+func VariantUserStatsID(ctx context.Context, userId string, variant string) *datastore.Key {
+	return datastore.NewKey(ctx, variantUserStatsKind, variant, 0, UserStatsID(ctx, userId))
+}
+
+// updateVariantUserStats stores the latest per variant rating of the user.
+// The latest TrueSkill is loaded per variant the user has played, instead of loading all TrueSkills of the user.
+func updateVariantUserStats(ctx context.Context, userId string) error {
+	playedVariants := []TrueSkill{}
+	if _, err := datastore.NewQuery(trueSkillKind).Filter("UserId=", userId).Project("Variant").Distinct().GetAll(ctx, &playedVariants); err != nil {
+		return err
+	}
+	ids := []*datastore.Key{}
+	variantStats := []VariantUserStats{}
+	for _, playedVariant := range playedVariants {
+		variant := playedVariant.Variant
+		if _, found := variants.Variants[variant]; !found {
+			continue
+		}
+		trueSkills := []TrueSkill{}
+		if _, err := datastore.NewQuery(trueSkillKind).Filter("UserId=", userId).Filter("Variant=", variant).Order("-CreatedAt").Limit(1).GetAll(ctx, &trueSkills); err != nil {
+			return err
+		}
+		if len(trueSkills) == 0 {
+			continue
+		}
+		ids = append(ids, VariantUserStatsID(ctx, userId, variant))
+		variantStats = append(variantStats, VariantUserStats{
+			UserId:    userId,
+			Variant:   variant,
+			Mu:        trueSkills[0].VariantMu,
+			Sigma:     trueSkills[0].VariantSigma,
+			Rating:    trueSkills[0].VariantRating,
+			UpdatedAt: time.Now(),
+		})
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := datastore.PutMulti(ctx, ids, variantStats)
+	return err
+}
+
 func (u *UserStats) Redact() {
 	u.User.Email = ""
 }
@@ -358,6 +555,81 @@ func (u *UserStats) ID(ctx context.Context) *datastore.Key {
 	return UserStatsID(ctx, u.UserId)
 }
 
+// rankHandlers maps the stats a user can be ranked on to the top lists, so that users are ranked among the same
+// users, on the same UserStats field, as the top lists list.
+var rankHandlers = map[string]*userStatsHandler{
+	"rating":      &topRatedPlayersHandler,
+	"reliability": &topReliablePlayersHandler,
+	"hated":       &topHatedPlayersHandler,
+	"hater":       &topHaterPlayersHandler,
+	"net-hate":    &topNetHatedPlayersHandler,
+	"quickness":   &topQuickPlayersHandler,
+}
+
+type UserRank struct {
+	UserId string
+	Stat   string
+	Rank   int
+	Total  int
+}
+
+func (u *UserRank) Item(r Request) *Item {
+	return NewItem(u).SetName("user-rank").
+		AddLink(r.NewLink(Link{
+			Rel:         "self",
+			Route:       GetUserRankRoute,
+			RouteParams: []string{"user_id", u.UserId, "stat", u.Stat},
+		})).
+		AddLink(r.NewLink(UserStatsResource.Link("user-stats", Load, []string{"user_id", u.UserId})))
+}
+
+func getUserRank(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	_, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	stat := r.Vars()["stat"]
+	handler, found := rankHandlers[stat]
+	if !found {
+		return HTTPErr{fmt.Sprintf("unknown stat %q", stat), http.StatusNotFound}
+	}
+	field := strings.TrimPrefix(handler.order, "-")
+
+	userStats := &UserStats{}
+	if err := datastore.Get(ctx, UserStatsID(ctx, r.Vars()["user_id"]), userStats); err == datastore.ErrNoSuchEntity {
+		userStats.UserId = r.Vars()["user_id"]
+	} else if err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(userStats).Elem()
+	for _, part := range strings.Split(field, ".") {
+		value = value.FieldByName(part)
+	}
+
+	higherCount, err := handler.query.Filter(field+">", value.Interface()).Count(ctx)
+	if err != nil {
+		return err
+	}
+
+	total, err := handler.query.KeysOnly().Count(ctx)
+	if err != nil {
+		return err
+	}
+
+	rank := &UserRank{
+		UserId: userStats.UserId,
+		Stat:   stat,
+		Rank:   higherCount + 1,
+		Total:  total,
+	}
+	w.SetContent(rank.Item(r))
+	return nil
+}
+
 type UserRatingHistogram struct {
 	FirstBucketRating int
 	Counts            []int
@@ -447,3 +719,137 @@ func getUserRatingHistogram(w ResponseWriter, r Request) error {
 	w.SetContent(histogram.Item(r))
 	return nil
 }
+
+type RatingSamples []RatingSample
+
+func (s RatingSamples) Item(r Request, userId string, limit int) *Item {
+	sampleItems := make(List, len(s))
+	for i := range s {
+		sampleItems[i] = NewItem(s[i]).SetName("rating-sample")
+	}
+	samplesItem := NewItem(sampleItems).SetName("rating-history").SetDesc([][]string{
+		[]string{
+			"Rating history",
+			fmt.Sprintf("The TrueSkill rating of the user after each of the last %d rating updates, newest first.", maxRatingHistory),
+			"Rating is the conservative rating shown on the leaderboard, Sigma is the standard deviation of the skill estimate.",
+		},
+		[]string{
+			"Before and limit",
+			fmt.Sprintf("The list contains at most %d samples.", maxLimit),
+			"If there are more samples, a 'next' link will be available with a 'before' query parameter.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       GetRatingHistoryRoute,
+		RouteParams: []string{"user_id", userId},
+	}))
+	if len(s) == limit {
+		params := url.Values{}
+		for k, v := range r.Req().URL.Query() {
+			params[k] = v
+		}
+		params.Set("before", s[len(s)-1].At.Format(time.RFC3339Nano))
+		params.Set("limit", fmt.Sprint(limit))
+		samplesItem.AddLink(r.NewLink(Link{
+			Rel:         "next",
+			Route:       GetRatingHistoryRoute,
+			RouteParams: []string{"user_id", userId},
+			QueryParams: params,
+		}))
+	}
+	return samplesItem
+}
+
+// ratingHistoryPage returns at most limit samples from history taken before before, newest first.
+func ratingHistoryPage(history []RatingSample, before *time.Time, limit int) RatingSamples {
+	page := RatingSamples{}
+	for i := len(history) - 1; i >= 0 && len(page) < limit; i-- {
+		if before == nil || history[i].At.Before(*before) {
+			page = append(page, history[i])
+		}
+	}
+	return page
+}
+
+func getRatingHistory(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	_, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	limit, err := strconv.ParseInt(r.Req().URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit > maxLimit || limit < 1 {
+		limit = maxLimit
+	}
+
+	var before *time.Time
+	if beforeParam := r.Req().URL.Query().Get("before"); beforeParam != "" {
+		beforeTime, err := time.Parse(time.RFC3339Nano, beforeParam)
+		if err != nil {
+			return HTTPErr{fmt.Sprintf("unparseable 'before' %q: %v", beforeParam, err), http.StatusBadRequest}
+		}
+		before = &beforeTime
+	}
+
+	userId := r.Vars()["user_id"]
+	userStats := &UserStats{}
+	if err := datastore.Get(ctx, UserStatsID(ctx, userId), userStats); err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+
+	w.SetContent(ratingHistoryPage(userStats.RatingHistory, before, int(limit)).Item(r, userId, int(limit)))
+	return nil
+}
+
+// QuicknessBreakdown is the response time of a user per phase type, behind the AverageResponseMinutes of their user stats.
+type QuicknessBreakdown struct {
+	UserId                 string
+	Quickness              float64
+	AverageResponseMinutes float64
+	SampleCount            int
+	PhaseTypes             []PhaseTypeResponseTime
+}
+
+func (q *QuicknessBreakdown) Item(r Request) *Item {
+	return NewItem(q).SetName("quickness").SetDesc([][]string{
+		[]string{
+			"Quickness",
+			"How many minutes after the start of phases the user declared ready to resolve them, on average, both in total and for each phase type.",
+			"Only phases that resolved before their deadline count, and phases resolved before the phase type was recorded only count in the total.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Route:       GetQuicknessRoute,
+		RouteParams: []string{"user_id", q.UserId},
+	}))
+}
+
+func getQuickness(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	_, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	userId := r.Vars()["user_id"]
+	userStats := &UserStats{}
+	if err := datastore.Get(ctx, UserStatsID(ctx, userId), userStats); err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+
+	breakdown := &QuicknessBreakdown{
+		UserId:                 userId,
+		Quickness:              userStats.Quickness,
+		AverageResponseMinutes: userStats.AverageResponseMinutes,
+		SampleCount:            userStats.SampleCount,
+		PhaseTypes:             userStats.PhaseTypeResponseTimes,
+	}
+	if breakdown.PhaseTypes == nil {
+		breakdown.PhaseTypes = []PhaseTypeResponseTime{}
+	}
+	w.SetContent(breakdown.Item(r))
+	return nil
+}
@@ -0,0 +1,42 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRatingHistory(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := []RatingSample{}
+	if history = appendRatingSample(history, &TrueSkill{}); len(history) != 0 {
+		t.Fatalf("Got %v, wanted no sample for the default rating", history)
+	}
+	for i := 0; i < maxRatingHistory+5; i++ {
+		history = appendRatingSample(history, &TrueSkill{TrueSkillContent: TrueSkillContent{
+			CreatedAt: start.Add(time.Duration(i) * time.Hour),
+			Rating:    float64(i),
+		}})
+	}
+	history = appendRatingSample(history, &TrueSkill{TrueSkillContent: TrueSkillContent{
+		CreatedAt: start.Add(time.Duration(maxRatingHistory+4) * time.Hour),
+		Rating:    -1,
+	}})
+	if len(history) != maxRatingHistory {
+		t.Fatalf("Got %v samples, wanted %v", len(history), maxRatingHistory)
+	}
+	if history[0].Rating != 5 || history[len(history)-1].Rating != maxRatingHistory+4 {
+		t.Errorf("Got first %v and last %v, wanted 5 and %v", history[0].Rating, history[len(history)-1].Rating, maxRatingHistory+4)
+	}
+
+	page := ratingHistoryPage(history, nil, 3)
+	if len(page) != 3 || page[0].Rating != maxRatingHistory+4 || page[2].Rating != maxRatingHistory+2 {
+		t.Errorf("Got %v, wanted the 3 latest samples newest first", page)
+	}
+	page = ratingHistoryPage(history, &page[2].At, 3)
+	if len(page) != 3 || page[0].Rating != maxRatingHistory+1 {
+		t.Errorf("Got %v, wanted the 3 samples before the first page", page)
+	}
+	if page = ratingHistoryPage(nil, nil, 3); page == nil || len(page) != 0 {
+		t.Errorf("Got %v, wanted an empty page", page)
+	}
+}
@@ -0,0 +1,180 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/godip"
+	"github.com/zond/godip/state"
+	"github.com/zond/godip/variants"
+	"google.golang.org/appengine/v2"
+	"google.golang.org/appengine/v2/datastore"
+
+	. "github.com/zond/goaeoas"
+)
+
+// OrderValidation is the result of validating one candidate order.
+type OrderValidation struct {
+	Parts  []string
+	Valid  bool
+	Error  string `json:",omitempty"`
+	Status int    `json:",omitempty"`
+}
+
+// UnorderedUnit is a unit of the member that needs an order but didn't get a valid one.
+type UnorderedUnit struct {
+	Province godip.Province
+	Unit     godip.Unit
+}
+
+type OrdersValidation struct {
+	GameID         *datastore.Key
+	PhaseOrdinal   int64
+	Nation         godip.Nation
+	Orders         []OrderValidation
+	UnorderedUnits []UnorderedUnit
+}
+
+func (o *OrdersValidation) Item(r Request) *Item {
+	return NewItem(o).SetName("orders-validation").SetDesc([][]string{
+		[]string{
+			"Orders validation",
+			"The candidate orders of the member, each marked Valid or with the Error (and HTTP Status) it would have caused if created. Nothing is saved.",
+			"UnorderedUnits contains the units of the member in movement and retreat phases that didn't get a valid order among the candidates.",
+		},
+	}).AddLink(r.NewLink(Link{
+		Rel:         "self",
+		Method:      "POST",
+		Route:       ValidateOrdersRoute,
+		RouteParams: []string{"game_id", o.GameID.Encode(), "phase_ordinal", fmt.Sprint(o.PhaseOrdinal)},
+	}))
+}
+
+// validateOrders validates each of the candidate orders for nation in s, and marks all but the first order for each province invalid.
+// Returns the validations and the provinces that got a valid order.
+func validateOrders(variantName string, s *state.State, nation godip.Nation, orders Orders) ([]OrderValidation, map[godip.Province]bool, error) {
+	validations := make([]OrderValidation, len(orders))
+	ordered := map[godip.Province]bool{}
+	for i, order := range orders {
+		validations[i].Parts = order.Parts
+		if err := order.validate(variantName, s, nation); err != nil {
+			herr, ok := err.(HTTPErr)
+			if !ok {
+				return nil, nil, err
+			}
+			validations[i].Error = herr.Body
+			validations[i].Status = herr.Status
+			continue
+		}
+		srcProvince := godip.Province(order.Parts[0]).Super()
+		if ordered[srcProvince] {
+			validations[i].Error = fmt.Sprintf("more than one order for %v", srcProvince)
+			validations[i].Status = http.StatusBadRequest
+			continue
+		}
+		ordered[srcProvince] = true
+		validations[i].Valid = true
+	}
+	return validations, ordered, nil
+}
+
+// unorderedUnits returns the units of nation in s that need an order, but whose provinces aren't among the ordered provinces.
+// Adjustment phases have no units needing orders, since builds and disbands are optional or automatic.
+func unorderedUnits(s *state.State, nation godip.Nation, ordered map[godip.Province]bool) []UnorderedUnit {
+	result := []UnorderedUnit{}
+	units := map[godip.Province]godip.Unit{}
+	switch s.Phase().Type() {
+	case godip.Movement:
+		units = s.Units()
+	case godip.Retreat:
+		units = s.Dislodgeds()
+	}
+	for prov, unit := range units {
+		if unit.Nation == nation && !ordered[prov.Super()] {
+			result = append(result, UnorderedUnit{
+				Province: prov,
+				Unit:     unit,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Province < result[j].Province
+	})
+	return result
+}
+
+/*
+ * validateOrdersHandler validates candidate orders for the nation of the requesting member in the unresolved phase,
+ * the same way replaceOrders would, without saving anything.
+ */
+func validateOrdersHandler(w ResponseWriter, r Request) error {
+	ctx := appengine.NewContext(r.Req())
+
+	user, ok := r.Values()["user"].(*auth.User)
+	if !ok {
+		return HTTPErr{"unauthenticated", http.StatusUnauthorized}
+	}
+
+	gameID, err := datastore.DecodeKey(r.Vars()["game_id"])
+	if err != nil {
+		return err
+	}
+
+	phaseOrdinal, err := strconv.ParseInt(r.Vars()["phase_ordinal"], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	phaseID, err := PhaseID(ctx, gameID, phaseOrdinal)
+	if err != nil {
+		return err
+	}
+
+	request := &struct {
+		Orders Orders
+	}{}
+	if err := json.NewDecoder(r.Req().Body).Decode(request); err != nil {
+		return HTTPErr{fmt.Sprintf("unable to parse orders: %v", err), http.StatusBadRequest}
+	}
+
+	game := &Game{}
+	phase := &Phase{}
+	if err := datastore.GetMulti(ctx, []*datastore.Key{gameID, phaseID}, []interface{}{game, phase}); err != nil {
+		return err
+	}
+	game.ID = gameID
+	if !game.Mustered {
+		return HTTPErr{"can only validate orders for mustered games", http.StatusPreconditionFailed}
+	}
+	if phase.Resolved {
+		return HTTPErr{"can only validate orders for unresolved phases", http.StatusPreconditionFailed}
+	}
+	member, isMember := game.GetMemberByUserId(user.Id)
+	if !isMember {
+		return HTTPErr{"can only validate orders for member games", http.StatusNotFound}
+	}
+
+	s, err := phase.State(ctx, variants.Variants[game.Variant], nil)
+	if err != nil {
+		return err
+	}
+
+	validations, ordered, err := validateOrders(game.Variant, s, member.Nation, request.Orders)
+	if err != nil {
+		return err
+	}
+
+	result := &OrdersValidation{
+		GameID:         gameID,
+		PhaseOrdinal:   phaseOrdinal,
+		Nation:         member.Nation,
+		Orders:         validations,
+		UnorderedUnits: unorderedUnits(s, member.Nation, ordered),
+	}
+	w.SetContent(result.Item(r))
+	return nil
+}
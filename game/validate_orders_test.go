@@ -0,0 +1,45 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/zond/godip"
+	"github.com/zond/godip/variants"
+)
+
+func TestValidateOrders(t *testing.T) {
+	s, err := variants.Variants["Classical"].Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validations, ordered, err := validateOrders("Classical", s, godip.Russia, Orders{
+		{Parts: []string{"mos", "Move", "ukr"}},
+		{Parts: []string{"par", "Hold"}},
+		{Parts: []string{"stp/sc", "Hold"}},
+		{Parts: []string{"mos", "Hold"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, wantValid := range []bool{true, false, true, false} {
+		if validations[i].Valid != wantValid {
+			t.Errorf("Got %+v for order %d, wanted Valid %v", validations[i], i, wantValid)
+		}
+		if !wantValid && (validations[i].Error == "" || validations[i].Status == 0) {
+			t.Errorf("Got %+v for order %d, wanted an error and a status", validations[i], i)
+		}
+	}
+	if !ordered["mos"] || !ordered["stp"] || len(ordered) != 2 {
+		t.Errorf("Got ordered %v, wanted mos and stp", ordered)
+	}
+
+	unordered := unorderedUnits(s, godip.Russia, ordered)
+	if len(unordered) != 2 || unordered[0].Province != "sev" || unordered[1].Province != "war" {
+		t.Errorf("Got %+v, wanted sev and war", unordered)
+	}
+	for _, u := range unordered {
+		if u.Unit.Nation != godip.Russia {
+			t.Errorf("Got %+v, wanted only Russian units", u)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package game
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/zond/diplicity/auth"
+	"github.com/zond/go-fcm"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/urlfetch"
+)
+
+const (
+	webPushConfKind = "WebPushConf"
+	webPushTTL      = 24 * time.Hour
+)
+
+var (
+	webPushSendFunc *DelayFunc
+	prodWebPushConf = &confCache{}
+)
+
+func init() {
+	webPushSendFunc = NewDelayFunc("game-webPushSend", webPushSend)
+}
+
+// WebPushConf contains the VAPID key pair used to authenticate web push requests (RFC 8292).
+// The keys are URL safe base64 encodings of the uncompressed P-256 public key and the raw private key.
+type WebPushConf struct {
+	PublicKey  string
+	PrivateKey string `datastore:",noindex"`
+	Subject    string
+}
+
+func (w *WebPushConf) Validate() error {
+	privBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(w.PrivateKey, "="))
+	if err != nil {
+		return fmt.Errorf("unparseable PrivateKey: %v", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(privBytes)
+	if err != nil {
+		return fmt.Errorf("invalid PrivateKey: %v", err)
+	}
+	pubBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(w.PublicKey, "="))
+	if err != nil {
+		return fmt.Errorf("unparseable PublicKey: %v", err)
+	}
+	if !bytes.Equal(priv.PublicKey().Bytes(), pubBytes) {
+		return fmt.Errorf("PublicKey doesn't belong to PrivateKey")
+	}
+	if !strings.HasPrefix(w.Subject, "mailto:") && !strings.HasPrefix(w.Subject, "https:") {
+		return fmt.Errorf("Subject must be a mailto: or https: URL")
+	}
+	return nil
+}
+
+// options returns the webpush-go options for pushing with the configured keys using client.
+func (w *WebPushConf) options(client webpush.HTTPClient) *webpush.Options {
+	return &webpush.Options{
+		HTTPClient: client,
+		// webpush-go adds mailto: to all subjects that aren't https: URLs.
+		Subscriber:      strings.TrimPrefix(w.Subject, "mailto:"),
+		TTL:             int(webPushTTL.Seconds()),
+		VAPIDPublicKey:  strings.TrimRight(w.PublicKey, "="),
+		VAPIDPrivateKey: strings.TrimRight(w.PrivateKey, "="),
+	}
+}
+
+func getWebPushConfKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, webPushConfKind, prodKey, 0, nil)
+}
+
+// SetWebPush creates or replaces the WebPush configuration. Must be called inside a transaction.
+func SetWebPush(ctx context.Context, webPushConf *WebPushConf) error {
+	if _, err := datastore.Put(ctx, getWebPushConfKey(ctx), webPushConf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getWebPushConf(ctx context.Context) (*WebPushConf, error) {
+	conf, err := prodWebPushConf.get(ctx, getWebPushConfKey(ctx), &WebPushConf{})
+	if err != nil {
+		return nil, err
+	}
+	return conf.(*WebPushConf), nil
+}
+
+func hasEnabledFCMTokens(userConfig *auth.UserConfig) bool {
+	for _, token := range userConfig.FCMTokens {
+		if !token.Disabled && token.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sendWebPushFallback schedules pushing the notification to the web push subscriptions of the user,
+// one task per subscription so that failing subscriptions don't block the others.
+func sendWebPushFallback(ctx context.Context, userId string, userConfig *auth.UserConfig, notif *fcm.NotificationPayload) error {
+	for _, subscription := range userConfig.WebPushSubscriptions {
+		if subscription.Disabled || subscription.Endpoint == "" {
+			continue
+		}
+		if err := webPushSendFunc.EnqueueIn(ctx, 0, userId, subscription.Endpoint, notif); err != nil {
+			log.Errorf(ctx, "Unable to enqueue web push to %v/%v: %v; hope datastore gets fixed", userId, subscription.Endpoint, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func webPushSend(ctx context.Context, userId string, endpoint string, notif *fcm.NotificationPayload) error {
+	log.Infof(ctx, "webPushSend(..., %q, %q, %v)", userId, endpoint, PP(notif))
+
+	webPushConf, err := getWebPushConf(ctx)
+	if err == datastore.ErrNoSuchEntity {
+		log.Infof(ctx, "Web push isn't configured, will skip sending")
+		return nil
+	} else if err != nil {
+		log.Errorf(ctx, "Unable to get WebPushConf: %v; fix getWebPushConf or hope datastore gets fixed", err)
+		return err
+	}
+
+	userConfig := &auth.UserConfig{}
+	if err := datastore.Get(ctx, auth.UserConfigID(ctx, auth.UserID(ctx, userId)), userConfig); err == datastore.ErrNoSuchEntity {
+		log.Infof(ctx, "%q has no configuration, will skip sending", userId)
+		return nil
+	} else if err != nil {
+		log.Errorf(ctx, "Unable to load user config for %q: %v; hope datastore gets fixed", userId, err)
+		return err
+	}
+	var subscription *auth.WebPushSubscription
+	for i := range userConfig.WebPushSubscriptions {
+		if userConfig.WebPushSubscriptions[i].Endpoint == endpoint && !userConfig.WebPushSubscriptions[i].Disabled {
+			subscription = &userConfig.WebPushSubscriptions[i]
+		}
+	}
+	if subscription == nil {
+		log.Infof(ctx, "%q no longer has an enabled subscription for %q, will skip sending", userId, endpoint)
+		return nil
+	}
+
+	// Subscriptions stored before they were validated could point anywhere.
+	if err := subscription.Validate(); err != nil {
+		log.Errorf(ctx, "Subscription %q is invalid: %v; disabling subscription", endpoint, err)
+		return disableWebPushSubscription(ctx, userId, endpoint, err.Error())
+	}
+
+	payload, err := json.Marshal(notif)
+	if err != nil {
+		log.Errorf(ctx, "Unable to marshal %v: %v; unable to recover, exiting", PP(notif), err)
+		return nil
+	}
+
+	resp, err := webpush.SendNotification(payload, &webpush.Subscription{
+		Endpoint: subscription.Endpoint,
+		Keys: webpush.Keys{
+			Auth:   subscription.Auth,
+			P256dh: subscription.P256dh,
+		},
+	}, webPushConf.options(urlfetch.Client(ctx)))
+	if err == webpush.ErrMaxPadExceeded {
+		log.Errorf(ctx, "Payload %v is too big to push: %v; unable to recover, exiting", PP(notif), err)
+		return nil
+	} else if err != nil {
+		// Safe to retry, nothing got sent probably.
+		log.Errorf(ctx, "Unable to push to %q: %v; will retry", endpoint, err)
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		log.Infof(ctx, "webPushSend(..., %q, %q, %v) *** SUCCESS ***", userId, endpoint, PP(notif))
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		log.Warningf(ctx, "Subscription %q got %v, will disable it.", endpoint, resp.Status)
+		return disableWebPushSubscription(ctx, userId, endpoint, resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		msg := fmt.Sprintf("Pushing to %q got %v: %s; will retry", endpoint, resp.Status, body)
+		log.Errorf(ctx, "%s", msg)
+		return fmt.Errorf("%s", msg)
+	}
+	log.Errorf(ctx, "Pushing to %q got %v: %s; unable to recover, exiting", endpoint, resp.Status, body)
+	return nil
+}
+
+func disableWebPushSubscription(ctx context.Context, userId string, endpoint string, note string) error {
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		userConfigID := auth.UserConfigID(ctx, auth.UserID(ctx, userId))
+		userConfig := &auth.UserConfig{}
+		if err := datastore.Get(ctx, userConfigID, userConfig); err != nil {
+			return err
+		}
+		for i := range userConfig.WebPushSubscriptions {
+			if userConfig.WebPushSubscriptions[i].Endpoint == endpoint {
+				userConfig.WebPushSubscriptions[i].Disabled = true
+				userConfig.WebPushSubscriptions[i].Note = note
+			}
+		}
+		_, err := datastore.Put(ctx, userConfigID, userConfig)
+		return err
+	}, &datastore.TransactionOptions{XG: false})
+}
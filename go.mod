@@ -3,6 +3,7 @@ module github.com/zond/diplicity
 go 1.20
 
 require (
+	github.com/SherClockHolmes/webpush-go v1.4.0
 	github.com/aymerick/raymond v2.0.2+incompatible
 	github.com/davecgh/go-spew v1.1.1
 	github.com/dustin/go-humanize v1.0.0
@@ -19,8 +20,8 @@ require (
 	github.com/zond/go-fcm v0.1.0
 	github.com/zond/goaeoas v0.1.10
 	github.com/zond/godip v0.4.1
-	golang.org/x/crypto v0.1.0
-	golang.org/x/net v0.7.0
+	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.25.0
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	google.golang.org/api v0.19.0
 	google.golang.org/appengine/v2 v2.0.4
@@ -29,6 +30,7 @@ require (
 require (
 	cloud.google.com/go v0.38.0 // indirect
 	github.com/gogs/chardet v0.0.0-20150115103509-2404f7772561 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
 	github.com/golang/protobuf v1.5.0 // indirect
 	github.com/googleapis/gax-go/v2 v2.0.5 // indirect
 	github.com/gorilla/schema v1.2.0 // indirect
@@ -42,8 +44,8 @@ require (
 	github.com/ssor/bom v0.0.0-20170718123548-6386211fdfcf // indirect
 	github.com/stretchr/testify v1.5.1 // indirect
 	go.opencensus.io v0.21.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
-	golang.org/x/text v0.7.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
 	google.golang.org/grpc v1.27.0 // indirect
@@ -12,6 +12,8 @@ import (
 )
 
 func Setup(r *mux.Router) {
+	r.Use(game.CompressResponses)
+	r.Use(game.RestrictCORSOrigins)
 	r.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		CORSHeaders(w)
 	})
@@ -14,9 +14,30 @@ var (
 		{
 			"-FinishedAt",
 		},
+		{
+			"FinishedAt",
+		},
 		{
 			"-StartedAt",
 		},
+		{
+			"-LastActivityAt",
+		},
+		{
+			"NewestPhaseMeta.DeadlineAt",
+		},
+		{
+			"-StartETA",
+		},
+		{
+			"StartedAt",
+		},
+		{
+			"LastActivityAt",
+		},
+		{
+			"-NewestPhaseMeta.DeadlineAt",
+		},
 	}
 	fields = []string{
 		"GameMasterId",